@@ -0,0 +1,427 @@
+package geoattractorannotate
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"encoding/csv"
+	"encoding/json"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+const (
+	// DefaultPrefix is prepended to the names of the columns that are added if
+	// `AnnotatorConfig.Prefix` isn't set.
+	DefaultPrefix = "nearest_"
+)
+
+var (
+	// ErrInvalidCoordinates is returned in strict mode when a row doesn't have
+	// usable coordinates.
+	ErrInvalidCoordinates = errors.New("invalid coordinates")
+
+	// ErrColumnNotFound is returned when a coordinate column isn't in the
+	// header.
+	ErrColumnNotFound = errors.New("column not found")
+)
+
+var (
+	// annotationFields are the names of the added columns, without the prefix,
+	// in the order that they're added.
+	annotationFields = []string{
+		"city",
+		"country",
+		"province",
+		"population",
+		"distance_km",
+		"source",
+		"id",
+	}
+)
+
+// AnnotatorConfig configures an `Annotator`.
+type AnnotatorConfig struct {
+	// Index is a prebuilt index.
+	Index *geoattractorindex.CityIndex
+
+	// Prefix is prepended to the names of the added columns. Defaults to
+	// `DefaultPrefix`.
+	Prefix string
+
+	// Strict fails on the first row without usable coordinates rather than
+	// leaving its added columns empty.
+	Strict bool
+}
+
+// AnnotateReport counts the rows that were processed.
+type AnnotateReport struct {
+	Rows int `json:"rows"`
+
+	// Annotated is the number of rows that a city was found for.
+	Annotated int `json:"annotated"`
+
+	// NotFound is the number of rows that no city was found near.
+	NotFound int `json:"not_found"`
+
+	// Invalid is the number of rows without usable coordinates.
+	Invalid int `json:"invalid"`
+}
+
+func (ar AnnotateReport) String() string {
+	return fmt.Sprintf("AnnotateReport<ROWS=(%d) ANNOTATED=(%d) NOT-FOUND=(%d) INVALID=(%d)>", ar.Rows, ar.Annotated, ar.NotFound, ar.Invalid)
+}
+
+// Annotator appends the nearest city to rows of coordinates.
+type Annotator struct {
+	config AnnotatorConfig
+	report AnnotateReport
+}
+
+// NewAnnotator returns an `Annotator`.
+func NewAnnotator(config AnnotatorConfig) *Annotator {
+	if config.Prefix == "" {
+		config.Prefix = DefaultPrefix
+	}
+
+	return &Annotator{
+		config: config,
+	}
+}
+
+// Report returns the counts for everything annotated so far.
+func (an *Annotator) Report() AnnotateReport {
+	return an.report
+}
+
+// Columns returns the names of the added columns, in order.
+func (an *Annotator) Columns() []string {
+	columns := make([]string, len(annotationFields))
+	for i, name := range annotationFields {
+		columns[i] = an.config.Prefix + name
+	}
+
+	return columns
+}
+
+// annotation is the nearest city to one row.
+type annotation struct {
+	found      bool
+	sourceName string
+	cr         geoattractor.CityRecord
+	distanceKm float64
+}
+
+// values returns the added columns as strings. They're empty if no city was
+// found.
+func (a annotation) values() []string {
+	if a.found == false {
+		return make([]string, len(annotationFields))
+	}
+
+	return []string{
+		a.cr.City,
+		a.cr.Country,
+		a.cr.ProvinceState,
+		strconv.FormatUint(a.cr.Population, 10),
+		strconv.FormatFloat(a.distanceKm, 'f', 3, 64),
+		a.sourceName,
+		a.cr.Id,
+	}
+}
+
+// lookup finds the nearest city to the given coordinates and counts the row.
+// `isValid` is false if the coordinates couldn't be parsed.
+func (an *Annotator) lookup(latitude, longitude float64, isValid bool) (a annotation, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	an.report.Rows++
+
+	if isValid == true && (latitude < -90.0 || latitude > 90.0 || longitude < -180.0 || longitude > 180.0) {
+		isValid = false
+	}
+
+	if isValid == false {
+		if an.config.Strict == true {
+			log.Panicf("%s: row (%d)", ErrInvalidCoordinates, an.report.Rows)
+		}
+
+		an.report.Invalid++
+		return a, nil
+	}
+
+	sourceName, _, cr, err := an.config.Index.Nearest(latitude, longitude, false)
+	if err != nil {
+		if log.Is(err, geoattractorindex.ErrNoNearestCity) == true {
+			an.report.NotFound++
+			return a, nil
+		}
+
+		log.Panic(err)
+	}
+
+	origin := geo.NewPoint(latitude, longitude)
+	p := geo.NewPoint(cr.Latitude, cr.Longitude)
+
+	a = annotation{
+		found:      true,
+		sourceName: sourceName,
+		cr:         cr,
+		distanceKm: origin.GreatCircleDistance(p),
+	}
+
+	an.report.Annotated++
+
+	return a, nil
+}
+
+// CsvOptions describes the CSV input.
+type CsvOptions struct {
+	// LatitudeColumn and LongitudeColumn are column names if `NoHeader` is
+	// false, and zero-based column numbers otherwise.
+	LatitudeColumn  string
+	LongitudeColumn string
+
+	// NoHeader indicates that the first row is data.
+	NoHeader bool
+
+	// Comma is the field delimiter. Defaults to a comma.
+	Comma rune
+}
+
+// columnIndex resolves a column given by name (against the header) or by
+// number.
+func columnIndex(column string, header []string) (index int, err error) {
+	if header == nil {
+		index, err = strconv.Atoi(column)
+		if err != nil || index < 0 {
+			return 0, fmt.Errorf("column must be a zero-based number without a header: [%s]", column)
+		}
+
+		return index, nil
+	}
+
+	for i, name := range header {
+		if strings.TrimSpace(name) == column {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%s: [%s]", ErrColumnNotFound, column)
+}
+
+// AnnotateCsv reads CSV rows from `r` and writes them to `w` with the nearest
+// city appended to each. The header, if there is one, gets the names from
+// `Columns()`.
+func (an *Annotator) AnnotateCsv(r io.Reader, w io.Writer, options CsvOptions) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	cw := csv.NewWriter(w)
+
+	if options.Comma != 0 {
+		cr.Comma = options.Comma
+		cw.Comma = options.Comma
+	}
+
+	var header []string
+	if options.NoHeader == false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		log.PanicIf(err)
+
+		header = append(header, record...)
+
+		err = cw.Write(append(record, an.Columns()...))
+		log.PanicIf(err)
+	}
+
+	latitudeIndex, err := columnIndex(options.LatitudeColumn, header)
+	log.PanicIf(err)
+
+	longitudeIndex, err := columnIndex(options.LongitudeColumn, header)
+	log.PanicIf(err)
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		var latitude, longitude float64
+
+		isValid := latitudeIndex < len(record) && longitudeIndex < len(record)
+		if isValid == true {
+			var latitudeErr, longitudeErr error
+
+			latitude, latitudeErr = strconv.ParseFloat(strings.TrimSpace(record[latitudeIndex]), 64)
+			longitude, longitudeErr = strconv.ParseFloat(strings.TrimSpace(record[longitudeIndex]), 64)
+
+			isValid = latitudeErr == nil && longitudeErr == nil
+		}
+
+		a, err := an.lookup(latitude, longitude, isValid)
+		log.PanicIf(err)
+
+		err = cw.Write(append(record, a.values()...))
+		log.PanicIf(err)
+	}
+
+	cw.Flush()
+
+	err = cw.Error()
+	log.PanicIf(err)
+
+	return nil
+}
+
+// JsonLinesOptions describes the JSON-lines input.
+type JsonLinesOptions struct {
+	// LatitudeField and LongitudeField are the names of the top-level fields
+	// with the coordinates. Either numbers or numeric strings are accepted.
+	LatitudeField  string
+	LongitudeField string
+}
+
+// jsonCoordinate returns the value as a float if it's a number or a numeric
+// string.
+func jsonCoordinate(value interface{}) (coordinate float64, isValid bool) {
+	switch v := value.(type) {
+	case json.Number:
+		coordinate, err := v.Float64()
+		return coordinate, err == nil
+	case string:
+		coordinate, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return coordinate, err == nil
+	}
+
+	return 0.0, false
+}
+
+// AnnotateJsonLines reads one JSON object per line from `r` and writes each to
+// `w` with the nearest city added as fields. The original fields are written
+// as they were read. Blank lines are skipped.
+func (an *Annotator) AnnotateJsonLines(r io.Reader, w io.Writer, options JsonLinesOptions) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	columns := an.Columns()
+
+	// The names never change, so encode them once.
+	encodedColumns := make([][]byte, len(columns))
+	for i, name := range columns {
+		encodedColumns[i], err = json.Marshal(name)
+		log.PanicIf(err)
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	bw := bufio.NewWriter(w)
+
+	lineNumber := 0
+	for s.Scan() {
+		lineNumber++
+
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		d := json.NewDecoder(bytes.NewReader(line))
+		d.UseNumber()
+
+		object := make(map[string]interface{})
+
+		err := d.Decode(&object)
+		if err != nil {
+			log.Panicf("line (%d) is not a JSON object: %s", lineNumber, err)
+		} else if d.More() == true {
+			log.Panicf("line (%d) has more than one JSON value", lineNumber)
+		} else if object == nil || line[0] != '{' {
+			// A `null` decodes without error but leaves the map nil.
+			log.Panicf("line (%d) is not a JSON object", lineNumber)
+		}
+
+		for _, name := range columns {
+			if _, found := object[name]; found == true {
+				log.Panicf("line (%d) already has a [%s] field; set a prefix to avoid the collision", lineNumber, name)
+			}
+		}
+
+		latitude, isLatitudeValid := jsonCoordinate(object[options.LatitudeField])
+		longitude, isLongitudeValid := jsonCoordinate(object[options.LongitudeField])
+
+		a, err := an.lookup(latitude, longitude, isLatitudeValid == true && isLongitudeValid == true)
+		log.PanicIf(err)
+
+		// Reuse the original text of the object and add our fields before the
+		// closing brace.
+
+		body := bytes.TrimSpace(line[:len(line)-1])
+
+		_, err = bw.Write(body)
+		log.PanicIf(err)
+
+		values := a.values()
+		for i, encodedName := range encodedColumns {
+			if i > 0 || len(object) > 0 {
+				bw.WriteByte(',')
+			}
+
+			bw.Write(encodedName)
+			bw.WriteByte(':')
+
+			var encodedValue []byte
+			if a.found == false {
+				encodedValue = []byte("null")
+			} else if annotationFields[i] == "population" || annotationFields[i] == "distance_km" {
+				encodedValue = []byte(values[i])
+			} else {
+				encodedValue, err = json.Marshal(values[i])
+				log.PanicIf(err)
+			}
+
+			bw.Write(encodedValue)
+		}
+
+		_, err = bw.WriteString("}\n")
+		log.PanicIf(err)
+	}
+
+	err = s.Err()
+	log.PanicIf(err)
+
+	err = bw.Flush()
+	log.PanicIf(err)
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package geoattractorannotate
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"encoding/csv"
+	"encoding/json"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+func getTestAnnotator(config AnnotatorConfig) (an *Annotator, cleanup func()) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	config.Index = ci
+
+	cleanup = func() {
+		ci.Close()
+		os.Remove(kvFilepath)
+	}
+
+	return NewAnnotator(config), cleanup
+}
+
+func TestAnnotator_AnnotateCsv(t *testing.T) {
+	an, cleanup := getTestAnnotator(AnnotatorConfig{})
+	defer cleanup()
+
+	input := "name,lat,lon\n" +
+		"dubai,25.2048,55.2708\n" +
+		"nowhere,-45.0,-120.0\n" +
+		"garbage,abc,55.2708\n" +
+		"short,25.2048\n"
+
+	b := new(bytes.Buffer)
+
+	options := CsvOptions{
+		LatitudeColumn:  "lat",
+		LongitudeColumn: "lon",
+	}
+
+	err := an.AnnotateCsv(strings.NewReader(input), b, options)
+	log.PanicIf(err)
+
+	// The short row stays short.
+	cr := csv.NewReader(b)
+	cr.FieldsPerRecord = -1
+
+	records, err := cr.ReadAll()
+	log.PanicIf(err)
+
+	if len(records) != 5 {
+		t.Fatalf("Expected five rows: (%d)", len(records))
+	}
+
+	expectedHeader := []string{"name", "lat", "lon", "nearest_city", "nearest_country", "nearest_province", "nearest_population", "nearest_distance_km", "nearest_source", "nearest_id"}
+	if strings.Join(records[0], ",") != strings.Join(expectedHeader, ",") {
+		t.Fatalf("Header not correct: %v", records[0])
+	}
+
+	dubai := records[1]
+	if len(dubai) != 10 || dubai[3] != "Dubai" || dubai[4] != "United Arab Emirates" || dubai[8] != "GeoNames" || dubai[9] != "292223" {
+		t.Fatalf("Dubai row not correct: %v", dubai)
+	} else if dubai[7] == "" || dubai[7] == "0.000" {
+		t.Fatalf("Distance not correct: [%s]", dubai[7])
+	}
+
+	if len(records[2]) != 10 || records[2][3] != "" || records[2][9] != "" {
+		t.Fatalf("Row without a city not correct: %v", records[2])
+	}
+
+	if len(records[3]) != 10 || records[3][3] != "" {
+		t.Fatalf("Invalid row not correct: %v", records[3])
+	}
+
+	if len(records[4]) != 9 || records[4][2] != "" {
+		t.Fatalf("Short row not correct: %v", records[4])
+	}
+
+	report := an.Report()
+	if report.Rows != 4 || report.Annotated != 1 || report.NotFound != 1 || report.Invalid != 2 {
+		t.Fatalf("Report not correct: %s", report)
+	}
+}
+
+func TestAnnotator_AnnotateCsv_NoHeader(t *testing.T) {
+	an, cleanup := getTestAnnotator(AnnotatorConfig{Prefix: "x_"})
+	defer cleanup()
+
+	input := "42.50779;1.52109;andorra\n"
+
+	b := new(bytes.Buffer)
+
+	options := CsvOptions{
+		LatitudeColumn:  "0",
+		LongitudeColumn: "1",
+		NoHeader:        true,
+		Comma:           ';',
+	}
+
+	err := an.AnnotateCsv(strings.NewReader(input), b, options)
+	log.PanicIf(err)
+
+	cr := csv.NewReader(b)
+	cr.Comma = ';'
+
+	records, err := cr.ReadAll()
+	log.PanicIf(err)
+
+	if len(records) != 1 {
+		t.Fatalf("Expected one row: (%d)", len(records))
+	} else if records[0][2] != "andorra" || records[0][3] != "Andorra la Vella" || records[0][9] != "3041563" {
+		t.Fatalf("Row not correct: %v", records[0])
+	}
+}
+
+func TestAnnotator_AnnotateCsv_MissingColumn(t *testing.T) {
+	an, cleanup := getTestAnnotator(AnnotatorConfig{})
+	defer cleanup()
+
+	options := CsvOptions{
+		LatitudeColumn:  "latitude",
+		LongitudeColumn: "lon",
+	}
+
+	err := an.AnnotateCsv(strings.NewReader("lat,lon\n1,2\n"), new(bytes.Buffer), options)
+	if err == nil || strings.Contains(err.Error(), ErrColumnNotFound.Error()) == false {
+		t.Fatalf("Expected column-not-found: %v", err)
+	}
+}
+
+func TestAnnotator_AnnotateJsonLines(t *testing.T) {
+	an, cleanup := getTestAnnotator(AnnotatorConfig{})
+	defer cleanup()
+
+	input := `{"b": 1, "lat": 25.2048, "lon": 55.2708, "a": [1, 2]}` + "\n" +
+		"\n" +
+		`{"lat": "-45.0", "lon": "-120.0"}` + "\n" +
+		`{}` + "\n"
+
+	b := new(bytes.Buffer)
+
+	options := JsonLinesOptions{
+		LatitudeField:  "lat",
+		LongitudeField: "lon",
+	}
+
+	err := an.AnnotateJsonLines(strings.NewReader(input), b, options)
+	log.PanicIf(err)
+
+	lines := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected three lines: (%d)", len(lines))
+	}
+
+	// The original fields keep their order and formatting.
+	if strings.HasPrefix(lines[0], `{"b": 1, "lat": 25.2048, "lon": 55.2708, "a": [1, 2],"nearest_city":"Dubai",`) == false {
+		t.Fatalf("First line not correct: [%s]", lines[0])
+	}
+
+	objects := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		err := json.Unmarshal([]byte(line), &objects[i])
+		log.PanicIf(err)
+	}
+
+	if objects[0]["nearest_id"] != "292223" || objects[0]["nearest_population"].(float64) == 0 || objects[0]["nearest_distance_km"].(float64) <= 0 {
+		t.Fatalf("First object not correct: %v", objects[0])
+	}
+
+	if value, found := objects[1]["nearest_city"]; found == false || value != nil {
+		t.Fatalf("Second object not correct: %v", objects[1])
+	}
+
+	if len(objects[2]) != 7 {
+		t.Fatalf("Third object not correct: %v", objects[2])
+	}
+
+	report := an.Report()
+	if report.Rows != 3 || report.Annotated != 1 || report.NotFound != 1 || report.Invalid != 1 {
+		t.Fatalf("Report not correct: %s", report)
+	}
+}
+
+func TestAnnotator_AnnotateJsonLines_Strict(t *testing.T) {
+	an, cleanup := getTestAnnotator(AnnotatorConfig{Strict: true})
+	defer cleanup()
+
+	options := JsonLinesOptions{
+		LatitudeField:  "lat",
+		LongitudeField: "lon",
+	}
+
+	err := an.AnnotateJsonLines(strings.NewReader(`{"lat": 95, "lon": 0}`+"\n"), new(bytes.Buffer), options)
+	if err == nil || strings.Contains(err.Error(), ErrInvalidCoordinates.Error()) == false {
+		t.Fatalf("Expected invalid-coordinates: %v", err)
+	}
+}
+
+func TestAnnotator_AnnotateJsonLines_NotObject(t *testing.T) {
+	an, cleanup := getTestAnnotator(AnnotatorConfig{})
+	defer cleanup()
+
+	options := JsonLinesOptions{
+		LatitudeField:  "lat",
+		LongitudeField: "lon",
+	}
+
+	for _, line := range []string{"[1, 2]", "null", "\"text\"", "1"} {
+		err := an.AnnotateJsonLines(strings.NewReader(line+"\n"), new(bytes.Buffer), options)
+		if err == nil {
+			t.Fatalf("Expected failure for a non-object: [%s]", line)
+		}
+	}
+}
+
+func TestAnnotator_AnnotateJsonLines_FieldCollision(t *testing.T) {
+	an, cleanup := getTestAnnotator(AnnotatorConfig{})
+	defer cleanup()
+
+	options := JsonLinesOptions{
+		LatitudeField:  "lat",
+		LongitudeField: "lon",
+	}
+
+	input := `{"lat": 42.5, "lon": 1.5, "nearest_city": "mine"}` + "\n"
+
+	b := new(bytes.Buffer)
+
+	err := an.AnnotateJsonLines(strings.NewReader(input), b, options)
+	if err == nil {
+		t.Fatalf("Expected failure for a colliding field.")
+	} else if strings.Contains(err.Error(), "nearest_city") == false {
+		t.Fatalf("Error doesn't name the field: [%s]", err)
+	}
+
+	if b.Len() != 0 {
+		t.Fatalf("Expected no output: [%s]", b.String())
+	}
+}
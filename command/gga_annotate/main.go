@@ -0,0 +1,174 @@
+package main
+
+// Tool to append the nearest city to every row of a CSV or JSON-lines file of
+// coordinates.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"encoding/json"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/dsoprea/go-geographic-attractor/annotate"
+	"github.com/dsoprea/go-geographic-attractor/index"
+	"github.com/dsoprea/go-geographic-attractor/parse"
+)
+
+type parameters struct {
+	CityDatabaseFilepath string `long:"city-db-filepath" description:"File-path of the prebuilt city database" required:"true"`
+	MinimumLevel         int    `long:"minimum-level" description:"Minimum search level that the database was built with" default:"7"`
+
+	InputFilepath  string `short:"i" long:"input" description:"File-path to read (plain, gzip, or bzip2; '-' for STDIN)" default:"-"`
+	OutputFilepath string `short:"o" long:"output" description:"File-path to write ('-' for STDOUT)" default:"-"`
+	Format         string `short:"f" long:"format" choice:"csv" choice:"jsonl" description:"Input format. Defaults to the input's extension, or CSV."`
+
+	LatitudeColumn  string `long:"lat-column" description:"CSV column or JSON field with the latitude. A zero-based number for CSV without a header." default:"latitude"`
+	LongitudeColumn string `long:"lon-column" description:"CSV column or JSON field with the longitude. A zero-based number for CSV without a header." default:"longitude"`
+	NoHeader        bool   `long:"no-header" description:"The CSV doesn't have a header row"`
+	Delimiter       string `short:"d" long:"delimiter" description:"CSV field delimiter" default:","`
+
+	Prefix  string `long:"prefix" description:"Prefix for the names of the added columns" default:"nearest_"`
+	Strict  bool   `long:"strict" description:"Fail on rows without usable coordinates rather than leaving their columns empty"`
+	Verbose bool   `short:"v" long:"verbose" description:"Print the counts to STDERR when done"`
+	Json    bool   `short:"j" long:"json" description:"Print the counts as JSON"`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+// detectFormat returns the format from the file-name, ignoring any compression
+// extension.
+func detectFormat(filepath string) string {
+	name := strings.ToLower(filepath)
+	name = strings.TrimSuffix(name, ".gz")
+	name = strings.TrimSuffix(name, ".bz2")
+
+	if strings.HasSuffix(name, ".jsonl") == true || strings.HasSuffix(name, ".ndjson") == true || strings.HasSuffix(name, ".json") == true {
+		return "jsonl"
+	}
+
+	return "csv"
+}
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(arguments.CityDatabaseFilepath); err != nil {
+		log.Panicf("city database not found: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	format := arguments.Format
+	if format == "" {
+		format = detectFormat(arguments.InputFilepath)
+	}
+
+	comma, size := utf8.DecodeRuneInString(arguments.Delimiter)
+	if size == 0 || size != len(arguments.Delimiter) {
+		log.Panicf("delimiter must be one character: [%s]", arguments.Delimiter)
+	}
+
+	ci := geoattractorindex.NewCityIndex(arguments.CityDatabaseFilepath, arguments.MinimumLevel, geoattractorindex.DefaultUrbanCenterMinimumPopulation)
+
+	defer ci.Close()
+
+	// Input.
+
+	var input io.ReadCloser
+	if arguments.InputFilepath == "-" {
+		input = ioutil.NopCloser(os.Stdin)
+	} else {
+		input, err = os.Open(arguments.InputFilepath)
+		log.PanicIf(err)
+	}
+
+	defer input.Close()
+
+	// This also handles the compression.
+	r, err := geoattractorparse.NewCitydataReadCloser(input)
+	log.PanicIf(err)
+
+	defer r.Close()
+
+	// Output.
+
+	var output io.WriteCloser = os.Stdout
+	if arguments.OutputFilepath != "-" {
+		output, err = os.Create(arguments.OutputFilepath)
+		log.PanicIf(err)
+
+		defer output.Close()
+	}
+
+	w := bufio.NewWriter(output)
+
+	config := geoattractorannotate.AnnotatorConfig{
+		Index:  ci,
+		Prefix: arguments.Prefix,
+		Strict: arguments.Strict,
+	}
+
+	an := geoattractorannotate.NewAnnotator(config)
+
+	if format == "jsonl" {
+		options := geoattractorannotate.JsonLinesOptions{
+			LatitudeField:  arguments.LatitudeColumn,
+			LongitudeField: arguments.LongitudeColumn,
+		}
+
+		err = an.AnnotateJsonLines(r, w, options)
+	} else {
+		options := geoattractorannotate.CsvOptions{
+			LatitudeColumn:  arguments.LatitudeColumn,
+			LongitudeColumn: arguments.LongitudeColumn,
+			NoHeader:        arguments.NoHeader,
+			Comma:           comma,
+		}
+
+		err = an.AnnotateCsv(r, w, options)
+	}
+
+	log.PanicIf(err)
+
+	err = w.Flush()
+	log.PanicIf(err)
+
+	if arguments.Verbose == false {
+		return
+	}
+
+	report := an.Report()
+
+	if arguments.Json == true {
+		encoded, err := json.MarshalIndent(report, "", "  ")
+		log.PanicIf(err)
+
+		fmt.Fprintln(os.Stderr, string(encoded))
+	} else {
+		fmt.Fprintf(os.Stderr, "Rows: (%d)\n", report.Rows)
+		fmt.Fprintf(os.Stderr, "Annotated: (%d)\n", report.Annotated)
+		fmt.Fprintf(os.Stderr, "Not found: (%d)\n", report.NotFound)
+		fmt.Fprintf(os.Stderr, "Invalid: (%d)\n", report.Invalid)
+	}
+}
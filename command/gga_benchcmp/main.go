@@ -0,0 +1,234 @@
+package main
+
+// Tool to compare the output of `go test -bench` from two builds and flag the
+// benchmarks that got slower (or started allocating more) by more than a
+// threshold.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+)
+
+const (
+	// regressionExitCode is returned if anything regressed, so that scripts can
+	// tell that apart from a failure to run.
+	regressionExitCode = 2
+)
+
+type parameters struct {
+	OldFilepath string   `long:"old-filepath" description:"Benchmark output from the baseline build" required:"true"`
+	NewFilepath string   `long:"new-filepath" description:"Benchmark output from the build being checked" required:"true"`
+	Threshold   float64  `long:"threshold" description:"Percentage by which a measurement has to get worse to be flagged" default:"10"`
+	Metrics     []string `long:"metric" description:"Units to compare (may be given more than once)" default:"ns/op" default:"B/op" default:"allocs/op" default:"MB/s"`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+var (
+	// benchmarkLineRx matches a result line, such as
+	// "BenchmarkCityIndex_GetById-8   48682   23492 ns/op   14602 B/op". The
+	// GOMAXPROCS suffix is dropped so that results from machines with
+	// different numbers of CPUs can be compared.
+	benchmarkLineRx = regexp.MustCompile(`^(Benchmark\S+?)(?:-\d+)?\s+\d+\s+(.+)$`)
+)
+
+// benchmarkResults maps each benchmark name to each unit to every measurement
+// (one for each `-count`).
+type benchmarkResults map[string]map[string][]float64
+
+func readBenchmarks(r io.Reader) (results benchmarkResults, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	results = make(benchmarkResults)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		matches := benchmarkLineRx.FindStringSubmatch(s.Text())
+		if matches == nil {
+			continue
+		}
+
+		name := matches[1]
+
+		// The rest of the line is pairs of value and unit.
+		fields := strings.Fields(matches[2])
+		if len(fields)%2 != 0 {
+			continue
+		}
+
+		units, found := results[name]
+		if found == false {
+			units = make(map[string][]float64)
+			results[name] = units
+		}
+
+		for i := 0; i < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+
+			unit := fields[i+1]
+			units[unit] = append(units[unit], value)
+		}
+	}
+
+	err = s.Err()
+	log.PanicIf(err)
+
+	return results, nil
+}
+
+func readBenchmarksFile(filepath string) (results benchmarkResults, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.Open(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	results, err = readBenchmarks(f)
+	log.PanicIf(err)
+
+	return results, nil
+}
+
+// median is less sensitive than the mean to the odd slow run.
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2.0
+	}
+
+	return sorted[middle]
+}
+
+// higherIsBetter says whether an increase in the unit is an improvement.
+func higherIsBetter(unit string) bool {
+	return strings.HasSuffix(unit, "/s")
+}
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	oldResults, err := readBenchmarksFile(arguments.OldFilepath)
+	log.PanicIf(err)
+
+	newResults, err := readBenchmarksFile(arguments.NewFilepath)
+	log.PanicIf(err)
+
+	names := make([]string, 0, len(newResults))
+	for name := range newResults {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	w := bufio.NewWriter(os.Stdout)
+
+	fmt.Fprintf(w, "%-60s %-10s %14s %14s %9s\n", "BENCHMARK", "UNIT", "OLD", "NEW", "DELTA")
+
+	regressions := 0
+	for _, name := range names {
+		oldUnits, found := oldResults[name]
+		if found == false {
+			fmt.Fprintf(w, "%-60s (new)\n", name)
+			continue
+		}
+
+		newUnits := newResults[name]
+
+		for _, unit := range arguments.Metrics {
+			oldValues, oldFound := oldUnits[unit]
+			newValues, newFound := newUnits[unit]
+
+			if oldFound == false || newFound == false {
+				continue
+			}
+
+			oldMedian := median(oldValues)
+			newMedian := median(newValues)
+
+			delta := 0.0
+			if oldMedian != 0 {
+				delta = (newMedian - oldMedian) / oldMedian * 100.0
+			} else if newMedian != 0 {
+				delta = 100.0
+			}
+
+			worse := delta
+			if higherIsBetter(unit) == true {
+				worse = -delta
+			}
+
+			flag := ""
+			if worse > arguments.Threshold {
+				flag = "  REGRESSION"
+				regressions++
+			}
+
+			fmt.Fprintf(w, "%-60s %-10s %14.2f %14.2f %+8.2f%%%s\n", name, unit, oldMedian, newMedian, delta, flag)
+		}
+	}
+
+	oldNames := make([]string, 0)
+	for name := range oldResults {
+		if _, found := newResults[name]; found == false {
+			oldNames = append(oldNames, name)
+		}
+	}
+
+	sort.Strings(oldNames)
+
+	for _, name := range oldNames {
+		fmt.Fprintf(w, "%-60s (removed)\n", name)
+	}
+
+	if regressions > 0 {
+		fmt.Fprintf(w, "\n(%d) measurements regressed by more than %.1f%%.\n", regressions, arguments.Threshold)
+	}
+
+	err = w.Flush()
+	log.PanicIf(err)
+
+	if regressions > 0 {
+		os.Exit(regressionExitCode)
+	}
+}
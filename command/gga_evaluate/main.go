@@ -0,0 +1,250 @@
+package main
+
+// Tool to measure how often the index's nearest-city answers agree with an
+// exhaustive search over every city in the database.
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/dsoprea/go-geographic-attractor/evaluate"
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+type parameters struct {
+	CityDatabaseFilepath string `long:"city-db-filepath" description:"File-path of the prebuilt city database" required:"true"`
+	MinimumLevel         int    `long:"minimum-level" description:"Minimum search level that the database was built with" default:"7"`
+	UrbanCenterMinimum   int    `long:"urban-center-minimum-population" description:"Population at which a city attracts the points around it"`
+
+	PointCount  int     `short:"n" long:"points" description:"Number of points to generate" default:"1000"`
+	Seed        int64   `long:"seed" description:"Seed for generating points (defaults to the current time)"`
+	Sample      string  `long:"sample" choice:"cities" choice:"uniform" description:"Generate points around the cities in the database or uniformly over a region" default:"cities"`
+	BoundingBox string  `long:"bbox" description:"Region for uniform points: 'min-lat,min-lon,max-lat,max-lon'" default:"-90,-180,90,180"`
+	JitterKm    float64 `long:"jitter-km" description:"Largest distance of a generated point from its city" default:"50"`
+
+	PointsFilepath string `long:"points-filepath" description:"CSV file of 'latitude,longitude' rows to use instead of generating points ('-' for STDIN)"`
+
+	LatitudeBandSize float64 `long:"latitude-band-size" description:"Size, in degrees, of the latitude bands in the breakdown" default:"15"`
+	WorstCount       int     `long:"worst" description:"Number of the largest disagreements to print" default:"10"`
+
+	Json bool `short:"j" long:"json" description:"Print the report as JSON"`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+func readPoints(r io.Reader) (points []geoattractorindex.Coordinate, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+
+	points = make([]geoattractorindex.Coordinate, 0)
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		if len(record) < 2 {
+			log.Panicf("point row does not have two columns: %v", record)
+		}
+
+		latitude, err := strconv.ParseFloat(strings.TrimSpace(record[0]), 64)
+		if err != nil {
+			// Allow a header.
+			if len(points) == 0 {
+				continue
+			}
+
+			log.Panic(err)
+		}
+
+		longitude, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		log.PanicIf(err)
+
+		points = append(points, geoattractorindex.Coordinate{
+			Latitude:  latitude,
+			Longitude: longitude,
+		})
+	}
+
+	return points, nil
+}
+
+func getPoints(bfi *geoattractorevaluate.BruteForceIndex) (points []geoattractorindex.Coordinate, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if arguments.PointsFilepath != "" {
+		var r io.Reader = os.Stdin
+		if arguments.PointsFilepath != "-" {
+			f, err := os.Open(arguments.PointsFilepath)
+			log.PanicIf(err)
+
+			defer f.Close()
+
+			r = f
+		}
+
+		points, err = readPoints(r)
+		log.PanicIf(err)
+
+		return points, nil
+	}
+
+	seed := arguments.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+
+	if arguments.Sample == "cities" {
+		cities := bfi.Cities()
+		if len(cities) == 0 {
+			log.Panicf("database has no cities to sample around")
+		}
+
+		return geoattractorevaluate.PointsNearCities(rng, arguments.PointCount, cities, arguments.JitterKm), nil
+	}
+
+	parts := strings.Split(arguments.BoundingBox, ",")
+	if len(parts) != 4 {
+		log.Panicf("bounding box is not exactly four parts: [%s]", arguments.BoundingBox)
+	}
+
+	box := make([]float64, 4)
+	for i, part := range parts {
+		box[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+		log.PanicIf(err)
+	}
+
+	return geoattractorevaluate.RandomPoints(rng, arguments.PointCount, box[0], box[1], box[2], box[3]), nil
+}
+
+func printBreakdowns(w io.Writer, title string, breakdowns []geoattractorevaluate.Breakdown) {
+	fmt.Fprintf(w, "%s:\n", title)
+
+	for _, b := range breakdowns {
+		fmt.Fprintf(w, "  %-16s points=%-8d agreement=%6.2f%%  mean-error=%.3f km\n", b.Name, b.Points, b.AgreementRate*100.0, b.MeanErrorKm)
+	}
+
+	fmt.Fprintf(w, "\n")
+}
+
+func printReport(w io.Writer, report geoattractorevaluate.EvaluationReport) {
+	fmt.Fprintf(w, "Points: (%d)\n", report.Points)
+	fmt.Fprintf(w, "Unanswered by the index: (%d)\n", report.Unanswered)
+	fmt.Fprintf(w, "Compared: (%d)\n", report.Compared)
+	fmt.Fprintf(w, "Agreement: (%d) %.2f%%\n", report.Agreements, report.AgreementRate*100.0)
+	fmt.Fprintf(w, "Mean excess distance: %.3f km\n", report.MeanErrorKm)
+	fmt.Fprintf(w, "\n")
+
+	fmt.Fprintf(w, "Excess distance percentiles:\n")
+
+	for _, p := range report.ErrorPercentiles {
+		fmt.Fprintf(w, "  p%-5g %.3f km\n", p.Percentile, p.ErrorKm)
+	}
+
+	fmt.Fprintf(w, "\n")
+
+	printBreakdowns(w, "By latitude band", report.ByLatitudeBand)
+	printBreakdowns(w, "By shared S2 level", report.BySharedLevel)
+
+	if len(report.Worst) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "Largest disagreements:\n")
+
+	for _, c := range report.Worst {
+		fmt.Fprintf(w, "  (%.6f, %.6f): index [%s] %s (%.3f km), brute-force [%s] %s (%.3f km)\n", c.Point.Latitude, c.Point.Longitude, c.Index.City.Id, c.Index.City.City, c.Index.DistanceKm, c.BruteForce.City.Id, c.BruteForce.City.City, c.BruteForce.DistanceKm)
+	}
+}
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(arguments.CityDatabaseFilepath); err != nil {
+		log.Panicf("city database not found: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	urbanCenterMinimum := arguments.UrbanCenterMinimum
+	if urbanCenterMinimum == 0 {
+		urbanCenterMinimum = geoattractorindex.DefaultUrbanCenterMinimumPopulation
+	}
+
+	ci := geoattractorindex.NewCityIndex(arguments.CityDatabaseFilepath, arguments.MinimumLevel, urbanCenterMinimum)
+
+	defer ci.Close()
+
+	bfi, err := geoattractorevaluate.LoadBruteForceIndex(ci)
+	log.PanicIf(err)
+
+	points, err := getPoints(bfi)
+	log.PanicIf(err)
+
+	config := geoattractorevaluate.EvaluatorConfig{
+		Index:            ci,
+		BruteForce:       bfi,
+		LatitudeBandSize: arguments.LatitudeBandSize,
+		WorstCount:       arguments.WorstCount,
+	}
+
+	ev := geoattractorevaluate.NewEvaluator(config)
+
+	report, err := ev.Evaluate(points)
+	log.PanicIf(err)
+
+	w := bufio.NewWriter(os.Stdout)
+
+	if arguments.Json == true {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+
+		err := e.Encode(report)
+		log.PanicIf(err)
+	} else {
+		printReport(w, report)
+	}
+
+	err = w.Flush()
+	log.PanicIf(err)
+}
@@ -0,0 +1,134 @@
+package main
+
+// Tool to export S2 cells as GeoJSON or KML for viewing on a map: either the
+// cells visited when finding the nearest city to a point, or the city that
+// every cell in a region resolves to.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/dsoprea/go-geographic-attractor/export"
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+type parameters struct {
+	CityDatabaseFilepath string `long:"city-db-filepath" description:"File-path of the prebuilt city database" required:"true"`
+	MinimumLevel         int    `long:"minimum-level" description:"Minimum search level that the database was built with" default:"7"`
+	UrbanCenterMinimum   int    `long:"urban-center-minimum-population" description:"Population at which a city attracts the points around it"`
+
+	Latitude  *float64 `short:"a" long:"latitude" description:"Latitude of the point to export the visited cells for"`
+	Longitude *float64 `short:"o" long:"longitude" description:"Longitude of the point to export the visited cells for"`
+
+	BoundingBox string `long:"bbox" description:"Region to export the attraction map for: 'min-lat,min-lon,max-lat,max-lon'. The box crosses the antimeridian if min-lon is greater than max-lon."`
+	Level       int    `long:"level" description:"Level of the cells in the attraction map" default:"10"`
+	MaxCells    int    `long:"max-cells" description:"Most cells to resolve for the attraction map" default:"10000"`
+
+	Format         string `short:"f" long:"format" choice:"geojson" choice:"kml" description:"Output format" default:"geojson"`
+	OutputFilepath string `long:"output" description:"File-path to write ('-' for STDOUT)" default:"-"`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	hasPoint := arguments.Latitude != nil || arguments.Longitude != nil
+	if hasPoint == (arguments.BoundingBox != "") {
+		log.Panicf("give either a point (--latitude and --longitude) or a region (--bbox)")
+	} else if hasPoint == true && (arguments.Latitude == nil || arguments.Longitude == nil) {
+		log.Panicf("both --latitude and --longitude are required")
+	}
+
+	if _, err := os.Stat(arguments.CityDatabaseFilepath); err != nil {
+		log.Panicf("city database not found: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	urbanCenterMinimum := arguments.UrbanCenterMinimum
+	if urbanCenterMinimum == 0 {
+		urbanCenterMinimum = geoattractorindex.DefaultUrbanCenterMinimumPopulation
+	}
+
+	ci := geoattractorindex.NewCityIndex(arguments.CityDatabaseFilepath, arguments.MinimumLevel, urbanCenterMinimum)
+
+	defer ci.Close()
+
+	var features []geoattractorexport.Feature
+	var name string
+
+	if hasPoint == true {
+		latitude := *arguments.Latitude
+		longitude := *arguments.Longitude
+
+		features, err = geoattractorexport.VisitedCells(ci, latitude, longitude)
+		if err != nil {
+			if log.Is(err, geoattractorindex.ErrNoNearestCity) == true {
+				fmt.Fprintf(os.Stderr, "No nearest city found.\n")
+				os.Exit(10)
+			}
+
+			log.Panic(err)
+		}
+
+		name = fmt.Sprintf("Cells visited for (%.6f, %.6f)", latitude, longitude)
+	} else {
+		parts := strings.Split(arguments.BoundingBox, ",")
+		if len(parts) != 4 {
+			log.Panicf("bounding box is not exactly four parts: [%s]", arguments.BoundingBox)
+		}
+
+		box := make([]float64, 4)
+		for i, part := range parts {
+			box[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+			log.PanicIf(err)
+		}
+
+		features, err = geoattractorexport.AttractionMap(ci, box[0], box[1], box[2], box[3], arguments.Level, arguments.MaxCells)
+		log.PanicIf(err)
+
+		name = fmt.Sprintf("Attraction at level (%d) for [%s]", arguments.Level, arguments.BoundingBox)
+	}
+
+	var output io.WriteCloser = os.Stdout
+	if arguments.OutputFilepath != "-" {
+		output, err = os.Create(arguments.OutputFilepath)
+		log.PanicIf(err)
+
+		defer output.Close()
+	}
+
+	w := bufio.NewWriter(output)
+
+	if arguments.Format == "kml" {
+		err = geoattractorexport.WriteKml(w, name, features)
+	} else {
+		err = geoattractorexport.WriteGeojson(w, features)
+	}
+
+	log.PanicIf(err)
+
+	err = w.Flush()
+	log.PanicIf(err)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"encoding/csv"
+	"encoding/json"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+// queryPoint is the point that was searched.
+type queryPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// visitResult is one city that was considered, in the order visited.
+type visitResult struct {
+	Token      string                  `json:"token"`
+	SourceName string                  `json:"source"`
+	City       geoattractor.CityRecord `json:"city"`
+}
+
+// nearestResult is what every format prints and what templates are executed
+// against.
+type nearestResult struct {
+	Query      queryPoint              `json:"query"`
+	SourceName string                  `json:"source"`
+	City       geoattractor.CityRecord `json:"city"`
+	DistanceKm float64                 `json:"distance_km"`
+
+	// Visits is only set if verbose.
+	Visits []visitResult `json:"visits,omitempty"`
+
+	// Load is only set if verbose and something was loaded during this run.
+	Load *geoattractorindex.LoadReport `json:"load,omitempty"`
+}
+
+// resultWriter prints a result in one format.
+type resultWriter func(w io.Writer, result nearestResult) error
+
+var (
+	resultWriters = map[string]resultWriter{
+		"json":    writeJson,
+		"jsonl":   writeJsonLine,
+		"csv":     writeCsv,
+		"geojson": writeGeojson,
+		"yaml":    writeYaml,
+	}
+)
+
+func writeJson(w io.Writer, result nearestResult) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	encoded, err := json.MarshalIndent(result, "", "  ")
+	log.PanicIf(err)
+
+	_, err = fmt.Fprintln(w, string(encoded))
+	log.PanicIf(err)
+
+	return nil
+}
+
+func writeJsonLine(w io.Writer, result nearestResult) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	encoded, err := json.Marshal(result)
+	log.PanicIf(err)
+
+	_, err = fmt.Fprintln(w, string(encoded))
+	log.PanicIf(err)
+
+	return nil
+}
+
+// writeCsv prints a header and one row. Visits and the load report aren't
+// included.
+func writeCsv(w io.Writer, result nearestResult) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	formatFloat := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	cw := csv.NewWriter(w)
+
+	header := []string{
+		"query_latitude",
+		"query_longitude",
+		"source",
+		"id",
+		"country",
+		"province_or_state",
+		"city",
+		"population",
+		"latitude",
+		"longitude",
+		"distance_km",
+	}
+
+	cr := result.City
+
+	row := []string{
+		formatFloat(result.Query.Latitude),
+		formatFloat(result.Query.Longitude),
+		result.SourceName,
+		cr.Id,
+		cr.Country,
+		cr.ProvinceState,
+		cr.City,
+		strconv.FormatUint(cr.Population, 10),
+		formatFloat(cr.Latitude),
+		formatFloat(cr.Longitude),
+		strconv.FormatFloat(result.DistanceKm, 'f', 3, 64),
+	}
+
+	err = cw.WriteAll([][]string{header, row})
+	log.PanicIf(err)
+
+	return nil
+}
+
+// writeGeojson prints a Feature whose geometry is the city's point and a line
+// from the city to the query point. GeoJSON puts the longitude first.
+func writeGeojson(w io.Writer, result nearestResult) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cityCoordinates := []float64{result.City.Longitude, result.City.Latitude}
+	queryCoordinates := []float64{result.Query.Longitude, result.Query.Latitude}
+
+	feature := map[string]interface{}{
+		"type": "Feature",
+		"id":   result.City.Id,
+		"geometry": map[string]interface{}{
+			"type": "GeometryCollection",
+			"geometries": []interface{}{
+				map[string]interface{}{
+					"type":        "Point",
+					"coordinates": cityCoordinates,
+				},
+				map[string]interface{}{
+					"type":        "LineString",
+					"coordinates": [][]float64{cityCoordinates, queryCoordinates},
+				},
+			},
+		},
+		"properties": map[string]interface{}{
+			"source":            result.SourceName,
+			"id":                result.City.Id,
+			"country":           result.City.Country,
+			"province_or_state": result.City.ProvinceState,
+			"city":              result.City.City,
+			"population":        result.City.Population,
+			"distance_km":       result.DistanceKm,
+			"query_latitude":    result.Query.Latitude,
+			"query_longitude":   result.Query.Longitude,
+		},
+	}
+
+	encoded, err := json.MarshalIndent(feature, "", "  ")
+	log.PanicIf(err)
+
+	_, err = fmt.Fprintln(w, string(encoded))
+	log.PanicIf(err)
+
+	return nil
+}
+
+// writeYaml prints the same document as `writeJson()` as YAML. It's converted
+// from the JSON encoding so that the field names and order are the same.
+func writeYaml(w io.Writer, result nearestResult) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	encoded, err := json.Marshal(result)
+	log.PanicIf(err)
+
+	d := json.NewDecoder(bytes.NewReader(encoded))
+	d.UseNumber()
+
+	_, lines, err := yamlFromJson(d)
+	log.PanicIf(err)
+
+	for _, line := range lines {
+		_, err := fmt.Fprintln(w, line)
+		log.PanicIf(err)
+	}
+
+	return nil
+}
+
+// yamlFromJson converts the next JSON value from the decoder. A scalar (or an
+// empty collection) is returned as `scalar`; anything else as the lines of a
+// block, unindented.
+func yamlFromJson(d *json.Decoder) (scalar string, lines []string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	token, err := d.Token()
+	log.PanicIf(err)
+
+	switch t := token.(type) {
+	case json.Delim:
+		isObject := t == '{'
+
+		lines = make([]string, 0)
+		for d.More() == true {
+			prefix := "-"
+			if isObject == true {
+				key, err := d.Token()
+				log.PanicIf(err)
+
+				encodedKey, err := json.Marshal(key)
+				log.PanicIf(err)
+
+				// Only quote keys that need it.
+				prefix = key.(string) + ":"
+				if key.(string) == "" || strings.ContainsAny(key.(string), ":#{}[],&*?|<>=!%@`'\" ") == true {
+					prefix = string(encodedKey) + ":"
+				}
+			}
+
+			childScalar, childLines, err := yamlFromJson(d)
+			log.PanicIf(err)
+
+			if childLines == nil {
+				lines = append(lines, prefix+" "+childScalar)
+			} else if isObject == true {
+				lines = append(lines, prefix)
+				for _, line := range childLines {
+					lines = append(lines, "  "+line)
+				}
+			} else {
+				lines = append(lines, prefix+" "+childLines[0])
+				for _, line := range childLines[1:] {
+					lines = append(lines, "  "+line)
+				}
+			}
+		}
+
+		// Consume the closing delimiter.
+		_, err := d.Token()
+		log.PanicIf(err)
+
+		if len(lines) == 0 {
+			if isObject == true {
+				return "{}", nil, nil
+			}
+
+			return "[]", nil, nil
+		}
+
+		return "", lines, nil
+	case string:
+		// A JSON string is a valid double-quoted YAML string.
+		encoded, err := json.Marshal(t)
+		log.PanicIf(err)
+
+		return string(encoded), nil, nil
+	case json.Number:
+		return t.String(), nil, nil
+	case bool:
+		return strconv.FormatBool(t), nil, nil
+	case nil:
+		return "null", nil, nil
+	}
+
+	log.Panicf("unexpected JSON token: [%v]", token)
+	return "", nil, nil
+}
+
+// newResultTemplate parses a template for printing the result. `json` encodes
+// any value as JSON.
+func newResultTemplate(text string) (t *template.Template, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	funcs := template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+	}
+
+	t, err = template.New("result").Funcs(funcs).Parse(text)
+	log.PanicIf(err)
+
+	return t, nil
+}
+
+// writeTemplate executes the template against the result. A newline is added
+// if the output doesn't end with one.
+func writeTemplate(w io.Writer, t *template.Template, result nearestResult) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	b := new(bytes.Buffer)
+
+	err = t.Execute(b, result)
+	log.PanicIf(err)
+
+	if b.Len() > 0 && bytes.HasSuffix(b.Bytes(), []byte{'\n'}) == false {
+		b.WriteByte('\n')
+	}
+
+	_, err = w.Write(b.Bytes())
+	log.PanicIf(err)
+
+	return nil
+}
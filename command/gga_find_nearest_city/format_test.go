@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"encoding/json"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+func getTestResult() nearestResult {
+	return nearestResult{
+		Query: queryPoint{
+			Latitude:  42.5,
+			Longitude: 1.5,
+		},
+		SourceName: "GeoNames",
+		City: geoattractor.CityRecord{
+			Id:            "3041563",
+			Country:       "Andorra",
+			ProvinceState: "07",
+			City:          "Andorra la Vella",
+			Population:    20430,
+			Latitude:      42.50779,
+			Longitude:     1.52109,
+		},
+		DistanceKm: 1.925,
+	}
+}
+
+func getYamlLines(t *testing.T, document string) []string {
+	d := json.NewDecoder(strings.NewReader(document))
+	d.UseNumber()
+
+	scalar, lines, err := yamlFromJson(d)
+	log.PanicIf(err)
+
+	if scalar != "" {
+		t.Fatalf("Expected a block, not a scalar: [%s]", scalar)
+	}
+
+	return lines
+}
+
+func TestYamlFromJson_Nested(t *testing.T) {
+	lines := getYamlLines(t, `{"a": {"b": 1, "c": [true, null, {"d": "e", "f": [1, 2]}]}, "g": 1.5}`)
+
+	expected := []string{
+		"a:",
+		"  b: 1",
+		"  c:",
+		"    - true",
+		"    - null",
+		"    - d: \"e\"",
+		"      f:",
+		"        - 1",
+		"        - 2",
+		"g: 1.5",
+	}
+
+	if reflect.DeepEqual(lines, expected) == false {
+		t.Fatalf("YAML not correct:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestYamlFromJson_NestedArrays(t *testing.T) {
+	lines := getYamlLines(t, `[[1, 2], [], ["a"]]`)
+
+	expected := []string{
+		"- - 1",
+		"  - 2",
+		"- []",
+		"- - \"a\"",
+	}
+
+	if reflect.DeepEqual(lines, expected) == false {
+		t.Fatalf("YAML not correct:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestYamlFromJson_EmptyCollections(t *testing.T) {
+	lines := getYamlLines(t, `{"object": {}, "array": []}`)
+
+	expected := []string{
+		"object: {}",
+		"array: []",
+	}
+
+	if reflect.DeepEqual(lines, expected) == false {
+		t.Fatalf("YAML not correct:\n%s", strings.Join(lines, "\n"))
+	}
+
+	for _, document := range []string{"{}", "[]"} {
+		d := json.NewDecoder(strings.NewReader(document))
+
+		scalar, lines, err := yamlFromJson(d)
+		log.PanicIf(err)
+
+		if scalar != document || lines != nil {
+			t.Fatalf("Empty collection not correct: [%s] %v", scalar, lines)
+		}
+	}
+}
+
+func TestYamlFromJson_QuotedKeys(t *testing.T) {
+	lines := getYamlLines(t, `{"plain_key": 1, "has space": 2, "has:colon": 3, "has\"quote": 4, "#comment": 5, "": 6}`)
+
+	expected := []string{
+		"plain_key: 1",
+		"\"has space\": 2",
+		"\"has:colon\": 3",
+		"\"has\\\"quote\": 4",
+		"\"#comment\": 5",
+		"\"\": 6",
+	}
+
+	if reflect.DeepEqual(lines, expected) == false {
+		t.Fatalf("YAML not correct:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestYamlFromJson_EscapedStrings(t *testing.T) {
+	lines := getYamlLines(t, `{"quote": "say \"hi\"", "newline": "a\nb", "tab": "a\tb", "backslash": "a\\b", "unicode": "Sant Julià", "number": "123", "boolean": "true"}`)
+
+	expected := []string{
+		"quote: \"say \\\"hi\\\"\"",
+		"newline: \"a\\nb\"",
+		"tab: \"a\\tb\"",
+		"backslash: \"a\\\\b\"",
+		"unicode: \"Sant Julià\"",
+		"number: \"123\"",
+		"boolean: \"true\"",
+	}
+
+	if reflect.DeepEqual(lines, expected) == false {
+		t.Fatalf("YAML not correct:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestWriteYaml(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	err := writeYaml(b, getTestResult())
+	log.PanicIf(err)
+
+	expected := `query:
+  latitude: 42.5
+  longitude: 1.5
+source: "GeoNames"
+city:
+  id: "3041563"
+  country: "Andorra"
+  province_or_state: "07"
+  city: "Andorra la Vella"
+  population: 20430
+  latitude: 42.50779
+  longitude: 1.52109
+  Cell: 0
+distance_km: 1.925
+`
+
+	if b.String() != expected {
+		t.Fatalf("YAML not correct:\n%s", b.String())
+	}
+}
+
+func TestWriteCsv(t *testing.T) {
+	result := getTestResult()
+	result.City.City = "Andorra, \"la\" Vella"
+
+	b := new(bytes.Buffer)
+
+	err := writeCsv(b, result)
+	log.PanicIf(err)
+
+	expected := "query_latitude,query_longitude,source,id,country,province_or_state,city,population,latitude,longitude,distance_km\n" +
+		"42.5,1.5,GeoNames,3041563,Andorra,07,\"Andorra, \"\"la\"\" Vella\",20430,42.50779,1.52109,1.925\n"
+
+	if b.String() != expected {
+		t.Fatalf("CSV not correct:\n%s", b.String())
+	}
+}
+
+func TestWriteGeojson(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	err := writeGeojson(b, getTestResult())
+	log.PanicIf(err)
+
+	expected := `{
+  "geometry": {
+    "geometries": [
+      {
+        "coordinates": [
+          1.52109,
+          42.50779
+        ],
+        "type": "Point"
+      },
+      {
+        "coordinates": [
+          [
+            1.52109,
+            42.50779
+          ],
+          [
+            1.5,
+            42.5
+          ]
+        ],
+        "type": "LineString"
+      }
+    ],
+    "type": "GeometryCollection"
+  },
+  "id": "3041563",
+  "properties": {
+    "city": "Andorra la Vella",
+    "country": "Andorra",
+    "distance_km": 1.925,
+    "id": "3041563",
+    "population": 20430,
+    "province_or_state": "07",
+    "query_latitude": 42.5,
+    "query_longitude": 1.5,
+    "source": "GeoNames"
+  },
+  "type": "Feature"
+}
+`
+
+	if b.String() != expected {
+		t.Fatalf("GeoJSON not correct:\n%s", b.String())
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	tpl, err := newResultTemplate(`{{.City.City}} {{json .Query}}`)
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	err = writeTemplate(b, tpl, getTestResult())
+	log.PanicIf(err)
+
+	expected := "Andorra la Vella {\"latitude\":42.5,\"longitude\":1.5}\n"
+
+	if b.String() != expected {
+		t.Fatalf("Template output not correct: [%s]", b.String())
+	}
+}
@@ -3,26 +3,33 @@ package main
 // Tool to do test queries against indexed data.
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
+	"text/template"
 
 	"github.com/dsoprea/go-logging"
 	"github.com/jessevdk/go-flags"
+	"github.com/kellydunn/golang-geo"
 
+	"github.com/dsoprea/go-geographic-attractor"
 	"github.com/dsoprea/go-geographic-attractor/index"
 	"github.com/dsoprea/go-geographic-attractor/parse"
 )
 
 type parameters struct {
-	CountryDataFilepath  string `short:"c" long:"country-data-filepath" description:"GeoNames country-data file-path"`
-	CityDataFilepath     string `short:"p" long:"city-data-filepath" description:"GeoNames city- and population-data file-path"`
-	CityDatabaseFilepath string `long:"city-db-filepath" description:"File-path of city database. Will be created if does not exist. If not provided a temporary one is used."`
+	CountryDataFilepath  string   `short:"c" long:"country-data-filepath" description:"GeoNames country-data file-path"`
+	CityDataFilepaths    []string `short:"p" long:"city-data-filepath" description:"GeoNames city- and population-data file-path (plain, gzip, bzip2, or ZIP; '-' for STDIN). Can be provided more than once and globs are allowed. Records with IDs that were already loaded from an earlier file are skipped."`
+	NaturalEarthFilepath string   `long:"natural-earth-filepath" description:"Natural Earth populated-places shapefile (\".shp\") to load instead of GeoNames. The \".dbf\" file alongside it is read for the attributes."`
+	CityDatabaseFilepath string   `long:"city-db-filepath" description:"File-path of city database. Will be created if does not exist. If not provided a temporary one is used."`
+	ParseWorkers         int      `long:"parse-workers" description:"Number of goroutines to parse the city data on. Less than two parses sequentially."`
+	Progress             string   `long:"progress" choice:"bar" choice:"json" description:"Show load progress as a terminal bar or as JSON lines on STDERR"`
 
 	Latitude  float64 `short:"a" long:"latitude" description:"Latitude" required:"true"`
 	Longitude float64 `short:"o" long:"longitude" description:"Longitude" required:"true"`
-	Verbose   bool    `short:"v" long:"verbose" description:"Print logging"`
-	Json      bool    `short:"j" long:"json" description:"Print as JSON"`
+	Verbose   bool    `short:"v" long:"verbose" description:"Print logging, the load report, and the cities visited"`
+	Json      bool    `short:"j" long:"json" description:"Print as JSON (same as --format json)"`
+	Format    string  `short:"f" long:"format" choice:"text" choice:"json" choice:"jsonl" choice:"csv" choice:"geojson" choice:"yaml" description:"Output format" default:"text"`
+	Template  string  `short:"t" long:"template" description:"Go text/template to print the result with (e.g. '{{.City.City}}, {{.City.Country}}'). The fields are those of the JSON output, by their Go names; 'json' encodes a value."`
 }
 
 var (
@@ -49,54 +56,196 @@ func main() {
 		os.Exit(1)
 	}
 
-	gp, err := geoattractorparse.NewGeonamesParserWithFiles(arguments.CountryDataFilepath)
-	log.PanicIf(err)
+	format := arguments.Format
+	if arguments.Json == true {
+		format = "json"
+	}
 
-	cityDataFile, err := geoattractorparse.GetCitydataReadCloser(arguments.CityDataFilepath)
-	log.PanicIf(err)
+	var t *template.Template
+	if arguments.Template != "" {
+		if format != "text" {
+			log.Panicf("a template can't be used with another format: [%s]", format)
+		}
 
-	defer cityDataFile.Close()
+		t, err = newResultTemplate(arguments.Template)
+		log.PanicIf(err)
+	}
 
 	ci := geoattractorindex.NewCityIndex(arguments.CityDatabaseFilepath, geoattractorindex.DefaultMinimumLevelForUrbanCenterAttraction, geoattractorindex.DefaultUrbanCenterMinimumPopulation)
 
-	err = ci.Load(gp, cityDataFile, nil, nil)
+	switch arguments.Progress {
+	case "bar":
+		ci.SetProgressReporter(geoattractorindex.NewTerminalProgressReporter())
+	case "json":
+		ci.SetProgressReporter(geoattractorindex.NewJsonProgressReporter(os.Stderr, 0))
+	}
+
+	var source geoattractor.CityRecordSource
+	var cityDataFilepaths []string
+
+	if arguments.NaturalEarthFilepath != "" {
+		if len(arguments.CityDataFilepaths) > 0 {
+			log.Panicf("Natural Earth and GeoNames city data can't both be given")
+		}
+
+		nep, err := geoattractorparse.NewNaturalEarthParserWithFiles(arguments.NaturalEarthFilepath, geoattractorparse.NaturalEarthParserConfig{})
+		log.PanicIf(err)
+
+		defer nep.Close()
+
+		source = nep
+		cityDataFilepaths = []string{arguments.NaturalEarthFilepath}
+	} else {
+		gp, err := geoattractorparse.NewGeonamesParserWithFiles(arguments.CountryDataFilepath)
+		log.PanicIf(err)
+
+		gp.SetParallelism(arguments.ParseWorkers, true)
+
+		source = gp
+		cityDataFilepaths = arguments.CityDataFilepaths
+	}
+
+	report, err := ci.LoadFiles(source, cityDataFilepaths, geoattractorindex.LoadOptions{})
 	log.PanicIf(err)
 
 	sourceName, visits, cr, err := ci.Nearest(arguments.Latitude, arguments.Longitude, arguments.Verbose)
 	if err != nil {
 		if log.Is(err, geoattractorindex.ErrNoNearestCity) == true {
-			fmt.Printf("No nearest city found.\n")
+			if format == "text" && t == nil {
+				fmt.Printf("No nearest city found.\n")
+			} else {
+				fmt.Fprintf(os.Stderr, "No nearest city found.\n")
+			}
+
 			os.Exit(10)
 		}
 
 		log.Panic(err)
 	}
 
-	if arguments.Json == true {
-		result := map[string]interface{}{
-			"Result": cr,
-			"Stats":  ci.Stats(),
+	origin := geo.NewPoint(arguments.Latitude, arguments.Longitude)
+	cityPoint := geo.NewPoint(cr.Latitude, cr.Longitude)
+
+	result := nearestResult{
+		Query: queryPoint{
+			Latitude:  arguments.Latitude,
+			Longitude: arguments.Longitude,
+		},
+		SourceName: sourceName,
+		City:       cr,
+		DistanceKm: origin.GreatCircleDistance(cityPoint),
+	}
+
+	if arguments.Verbose == true {
+		result.Visits = make([]visitResult, len(visits))
+		for i, vhi := range visits {
+			result.Visits[i] = visitResult{
+				Token:      vhi.Token,
+				SourceName: vhi.SourceName,
+				City:       vhi.City,
+			}
 		}
 
-		encoded, err := json.MarshalIndent(result, "", "  ")
+		// A prebuilt database isn't reloaded, so there's nothing to report.
+		if report.Parsed > 0 {
+			result.Load = &report
+		}
+	}
+
+	if t != nil {
+		err := writeTemplate(os.Stdout, t, result)
 		log.PanicIf(err)
 
-		fmt.Println(string(encoded))
-	} else {
-		if arguments.Verbose == true {
-			for i, vhi := range visits {
-				fmt.Printf("VISIT(% 2d): %s: %s\n", i, vhi.Token, vhi.City)
-			}
+		return
+	}
+
+	if format != "text" {
+		err := resultWriters[format](os.Stdout, result)
+		log.PanicIf(err)
+
+		return
+	}
+
+	if arguments.Verbose == true {
+		if report.Parsed > 0 {
+			printLoadReport(report)
+		}
 
-			fmt.Printf("\n")
+		for i, vhi := range visits {
+			fmt.Printf("VISIT(% 2d): %s: %s\n", i, vhi.Token, vhi.City)
 		}
 
-		fmt.Printf("Source: %s\n", sourceName)
-		fmt.Printf("ID: %s\n", cr.Id)
-		fmt.Printf("Country: %s\n", cr.Country)
-		fmt.Printf("City: %s\n", cr.City)
-		fmt.Printf("Population: %d\n", cr.Population)
-		fmt.Printf("Latitude: %.10f\n", cr.Latitude)
-		fmt.Printf("Longitude: %.10f\n", cr.Longitude)
+		fmt.Printf("\n")
 	}
+
+	fmt.Printf("Source: %s\n", sourceName)
+	fmt.Printf("ID: %s\n", cr.Id)
+	fmt.Printf("Country: %s\n", cr.Country)
+	fmt.Printf("Province/State: %s\n", cr.ProvinceState)
+	fmt.Printf("City: %s\n", cr.City)
+	fmt.Printf("Population: %d\n", cr.Population)
+	fmt.Printf("Latitude: %.10f\n", cr.Latitude)
+	fmt.Printf("Longitude: %.10f\n", cr.Longitude)
+	fmt.Printf("Distance: %.3f km\n", result.DistanceKm)
+}
+
+// printLoadReport prints the report for people.
+func printLoadReport(report geoattractorindex.LoadReport) {
+	fmt.Printf("Load (%s):\n", report.SourceName)
+	fmt.Printf("\n")
+	fmt.Printf("  Parsed: (%d)\n", report.Parsed)
+	fmt.Printf("  Filtered: (%d)\n", report.Filtered)
+	fmt.Printf("  Duplicates: (%d)\n", report.Duplicates)
+	fmt.Printf("  Indexed: (%d)\n", report.Indexed)
+	fmt.Printf("  Index adds: (%d)\n", report.Added)
+	fmt.Printf("  Index updates: (%d)\n", report.Updated)
+	fmt.Printf("  Elapsed: %s\n", report.Elapsed)
+	fmt.Printf("\n")
+
+	printTallies := func(title string, tallies []geoattractorindex.LoadTally) {
+		if len(tallies) == 0 {
+			return
+		}
+
+		fmt.Printf("%s:\n", title)
+		fmt.Printf("\n")
+
+		for _, lt := range tallies {
+			fmt.Printf("> %s (%d)\n", lt.Name, lt.Count)
+		}
+
+		fmt.Printf("\n")
+	}
+
+	printMisses := func(title string, misses []string) {
+		if len(misses) == 0 {
+			return
+		}
+
+		fmt.Printf("%s:\n", title)
+		fmt.Printf("\n")
+
+		for _, name := range misses {
+			fmt.Printf("> %s\n", name)
+		}
+
+		fmt.Printf("\n")
+	}
+
+	for _, is := range report.Inputs {
+		fmt.Printf("INPUT: %s\n", is)
+	}
+
+	if len(report.Inputs) > 0 {
+		fmt.Printf("\n")
+	}
+
+	printTallies("Skipped rows", report.SkippedRows)
+	printTallies("Cities per country", report.Countries)
+
+	printTallies("City load-filter hits", report.CityFilterHits)
+	printMisses("One or more of the filtered cities was not found in the city data", report.CityFilterMisses)
+
+	printTallies("Country load-filter hits", report.CountryFilterHits)
+	printMisses("One or more of the filtered countries was not found in the city data", report.CountryFilterMisses)
 }
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"encoding/csv"
+	"encoding/json"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+// foundRecord is one record that matched.
+type foundRecord struct {
+	City        geoattractor.CityRecord `json:"city"`
+	FeatureCode string                  `json:"feature_code"`
+
+	// DistanceKm is from the nearest of the given coordinates, if any were
+	// given.
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+}
+
+// recordWriter prints the records in one format. Records are printed as
+// they're given rather than being collected.
+type recordWriter interface {
+	Begin() error
+	Write(fr foundRecord) error
+	End() error
+}
+
+func newRecordWriter(format string, w io.Writer) recordWriter {
+	bw := bufio.NewWriter(w)
+
+	switch format {
+	case "json":
+		return &jsonRecordWriter{w: bw}
+	case "jsonl":
+		return &jsonLinesRecordWriter{w: bw}
+	case "csv":
+		return &csvRecordWriter{w: bw, cw: csv.NewWriter(bw)}
+	case "geojson":
+		return &geojsonRecordWriter{w: bw}
+	}
+
+	return &textRecordWriter{w: bw}
+}
+
+// textRecordWriter prints `CityRecord.String()`.
+type textRecordWriter struct {
+	w *bufio.Writer
+}
+
+func (trw *textRecordWriter) Begin() error {
+	return nil
+}
+
+func (trw *textRecordWriter) Write(fr foundRecord) error {
+	_, err := fmt.Fprintf(trw.w, "%s\n", fr.City)
+	return err
+}
+
+func (trw *textRecordWriter) End() error {
+	return trw.w.Flush()
+}
+
+// jsonLinesRecordWriter prints one JSON object per line.
+type jsonLinesRecordWriter struct {
+	w *bufio.Writer
+}
+
+func (jlrw *jsonLinesRecordWriter) Begin() error {
+	return nil
+}
+
+func (jlrw *jsonLinesRecordWriter) Write(fr foundRecord) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	encoded, err := json.Marshal(fr)
+	log.PanicIf(err)
+
+	_, err = jlrw.w.Write(append(encoded, '\n'))
+	log.PanicIf(err)
+
+	return nil
+}
+
+func (jlrw *jsonLinesRecordWriter) End() error {
+	return jlrw.w.Flush()
+}
+
+// jsonRecordWriter prints a JSON array with one object per line.
+type jsonRecordWriter struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (jrw *jsonRecordWriter) Begin() error {
+	_, err := jrw.w.WriteString("[")
+	return err
+}
+
+func (jrw *jsonRecordWriter) Write(fr foundRecord) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	encoded, err := json.Marshal(fr)
+	log.PanicIf(err)
+
+	separator := ",\n  "
+	if jrw.count == 0 {
+		separator = "\n  "
+	}
+
+	jrw.count++
+
+	_, err = jrw.w.WriteString(separator)
+	log.PanicIf(err)
+
+	_, err = jrw.w.Write(encoded)
+	log.PanicIf(err)
+
+	return nil
+}
+
+func (jrw *jsonRecordWriter) End() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	closing := "\n]\n"
+	if jrw.count == 0 {
+		closing = "]\n"
+	}
+
+	_, err = jrw.w.WriteString(closing)
+	log.PanicIf(err)
+
+	err = jrw.w.Flush()
+	log.PanicIf(err)
+
+	return nil
+}
+
+// csvRecordWriter prints a header and one row per record.
+type csvRecordWriter struct {
+	w  *bufio.Writer
+	cw *csv.Writer
+}
+
+func (crw *csvRecordWriter) Begin() error {
+	header := []string{
+		"id",
+		"country",
+		"province_or_state",
+		"city",
+		"population",
+		"latitude",
+		"longitude",
+		"feature_code",
+		"distance_km",
+	}
+
+	return crw.cw.Write(header)
+}
+
+func (crw *csvRecordWriter) Write(fr foundRecord) error {
+	distance := ""
+	if fr.DistanceKm != nil {
+		distance = strconv.FormatFloat(*fr.DistanceKm, 'f', 3, 64)
+	}
+
+	cr := fr.City
+
+	row := []string{
+		cr.Id,
+		cr.Country,
+		cr.ProvinceState,
+		cr.City,
+		strconv.FormatUint(cr.Population, 10),
+		strconv.FormatFloat(cr.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(cr.Longitude, 'f', -1, 64),
+		fr.FeatureCode,
+		distance,
+	}
+
+	return crw.cw.Write(row)
+}
+
+func (crw *csvRecordWriter) End() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	crw.cw.Flush()
+
+	err = crw.cw.Error()
+	log.PanicIf(err)
+
+	err = crw.w.Flush()
+	log.PanicIf(err)
+
+	return nil
+}
+
+// geojsonRecordWriter prints a FeatureCollection of points, one feature per
+// line.
+type geojsonRecordWriter struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (grw *geojsonRecordWriter) Begin() error {
+	_, err := grw.w.WriteString(`{"type":"FeatureCollection","features":[`)
+	return err
+}
+
+func (grw *geojsonRecordWriter) Write(fr foundRecord) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cr := fr.City
+
+	properties := map[string]interface{}{
+		"id":                cr.Id,
+		"country":           cr.Country,
+		"province_or_state": cr.ProvinceState,
+		"city":              cr.City,
+		"population":        cr.Population,
+		"feature_code":      fr.FeatureCode,
+	}
+
+	if fr.DistanceKm != nil {
+		properties["distance_km"] = *fr.DistanceKm
+	}
+
+	// GeoJSON puts the longitude first.
+	feature := map[string]interface{}{
+		"type": "Feature",
+		"id":   cr.Id,
+		"geometry": map[string]interface{}{
+			"type":        "Point",
+			"coordinates": []float64{cr.Longitude, cr.Latitude},
+		},
+		"properties": properties,
+	}
+
+	encoded, err := json.Marshal(feature)
+	log.PanicIf(err)
+
+	separator := ",\n"
+	if grw.count == 0 {
+		separator = "\n"
+	}
+
+	grw.count++
+
+	_, err = grw.w.WriteString(separator)
+	log.PanicIf(err)
+
+	_, err = grw.w.Write(encoded)
+	log.PanicIf(err)
+
+	return nil
+}
+
+func (grw *geojsonRecordWriter) End() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	_, err = grw.w.WriteString("\n]}\n")
+	log.PanicIf(err)
+
+	err = grw.w.Flush()
+	log.PanicIf(err)
+
+	return nil
+}
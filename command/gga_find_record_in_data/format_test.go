@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"encoding/json"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+func getTestRecords() []foundRecord {
+	distanceKm := 1.925
+
+	return []foundRecord{
+		{
+			City: geoattractor.CityRecord{
+				Id:            "3041563",
+				Country:       "Andorra",
+				ProvinceState: "07",
+				City:          "Andorra la Vella",
+				Population:    20430,
+				Latitude:      42.50779,
+				Longitude:     1.52109,
+			},
+			FeatureCode: "PPLC",
+			DistanceKm:  &distanceKm,
+		},
+		{
+			City: geoattractor.CityRecord{
+				Id:            "3039163",
+				Country:       "Andorra",
+				ProvinceState: "06",
+				City:          "Sant Julià de Lòria, \"Centre\"",
+				Population:    8022,
+				Latitude:      42.46372,
+				Longitude:     1.49129,
+			},
+			FeatureCode: "PPLA",
+		},
+	}
+}
+
+// writeTestRecords writes the records in the given format and returns the
+// output.
+func writeTestRecords(format string, records []foundRecord) string {
+	b := new(bytes.Buffer)
+
+	rw := newRecordWriter(format, b)
+
+	err := rw.Begin()
+	log.PanicIf(err)
+
+	for _, fr := range records {
+		err := rw.Write(fr)
+		log.PanicIf(err)
+	}
+
+	err = rw.End()
+	log.PanicIf(err)
+
+	return b.String()
+}
+
+func TestJsonRecordWriter(t *testing.T) {
+	output := writeTestRecords("json", getTestRecords())
+
+	expected := `[
+  {"city":{"id":"3041563","country":"Andorra","province_or_state":"07","city":"Andorra la Vella","population":20430,"latitude":42.50779,"longitude":1.52109,"Cell":0},"feature_code":"PPLC","distance_km":1.925},
+  {"city":{"id":"3039163","country":"Andorra","province_or_state":"06","city":"Sant Julià de Lòria, \"Centre\"","population":8022,"latitude":42.46372,"longitude":1.49129,"Cell":0},"feature_code":"PPLA"}
+]
+`
+
+	if output != expected {
+		t.Fatalf("JSON not correct:\n%s", output)
+	}
+
+	var decoded []foundRecord
+
+	err := json.Unmarshal([]byte(output), &decoded)
+	log.PanicIf(err)
+
+	if len(decoded) != 2 {
+		t.Fatalf("Decoded count not correct: (%d)", len(decoded))
+	}
+}
+
+func TestJsonRecordWriter_Empty(t *testing.T) {
+	output := writeTestRecords("json", nil)
+
+	if output != "[]\n" {
+		t.Fatalf("Empty JSON not correct: [%s]", output)
+	}
+}
+
+func TestCsvRecordWriter(t *testing.T) {
+	output := writeTestRecords("csv", getTestRecords())
+
+	expected := "id,country,province_or_state,city,population,latitude,longitude,feature_code,distance_km\n" +
+		"3041563,Andorra,07,Andorra la Vella,20430,42.50779,1.52109,PPLC,1.925\n" +
+		"3039163,Andorra,06,\"Sant Julià de Lòria, \"\"Centre\"\"\",8022,42.46372,1.49129,PPLA,\n"
+
+	if output != expected {
+		t.Fatalf("CSV not correct:\n%s", output)
+	}
+}
+
+func TestCsvRecordWriter_Empty(t *testing.T) {
+	output := writeTestRecords("csv", nil)
+
+	expected := "id,country,province_or_state,city,population,latitude,longitude,feature_code,distance_km\n"
+
+	if output != expected {
+		t.Fatalf("Empty CSV not correct:\n%s", output)
+	}
+}
+
+func TestGeojsonRecordWriter(t *testing.T) {
+	output := writeTestRecords("geojson", getTestRecords())
+
+	expected := `{"type":"FeatureCollection","features":[
+{"geometry":{"coordinates":[1.52109,42.50779],"type":"Point"},"id":"3041563","properties":{"city":"Andorra la Vella","country":"Andorra","distance_km":1.925,"feature_code":"PPLC","id":"3041563","population":20430,"province_or_state":"07"},"type":"Feature"},
+{"geometry":{"coordinates":[1.49129,42.46372],"type":"Point"},"id":"3039163","properties":{"city":"Sant Julià de Lòria, \"Centre\"","country":"Andorra","feature_code":"PPLA","id":"3039163","population":8022,"province_or_state":"06"},"type":"Feature"}
+]}
+`
+
+	if output != expected {
+		t.Fatalf("GeoJSON not correct:\n%s", output)
+	}
+}
+
+func TestGeojsonRecordWriter_Empty(t *testing.T) {
+	output := writeTestRecords("geojson", nil)
+
+	expected := "{\"type\":\"FeatureCollection\",\"features\":[\n]}\n"
+
+	if output != expected {
+		t.Fatalf("Empty GeoJSON not correct:\n%s", output)
+	}
+
+	var collection map[string]interface{}
+
+	err := json.Unmarshal([]byte(output), &collection)
+	log.PanicIf(err)
+
+	features, ok := collection["features"].([]interface{})
+	if collection["type"] != "FeatureCollection" || ok != true || len(features) != 0 {
+		t.Fatalf("Empty GeoJSON not correct: [%s]", output)
+	}
+}
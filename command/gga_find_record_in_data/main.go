@@ -5,13 +5,15 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/dsoprea/go-logging"
 	"github.com/jessevdk/go-flags"
-	"github.com/randomingenuity/go-utility/geographic"
 
 	"github.com/dsoprea/go-geographic-attractor"
 	"github.com/dsoprea/go-geographic-attractor/index"
@@ -20,11 +22,30 @@ import (
 
 type parameters struct {
 	CountryDataFilepath string   `short:"c" long:"country-data-filepath" description:"GeoNames country-data file-path"`
-	CityDataFilepath    string   `short:"p" long:"city-data-filepath" description:"GeoNames city- and population-data file-path"`
-	IdList              []string `short:"i" long:"record-id" description:"ID of record to find (can be provided zero or more times)"`
-	NameList            []string `short:"n" long:"name" description:"Name of a place to to filter for (can be provided zero or more times)"`
-	CoordinatesList     []string `short:"C" long:"coordinates" description:"Exact latitude/longitude to search (e.g. '12.345,67.891'; can be provided zero or more times)"`
-	OnlyUrbanCenters    bool     `short:"u" long:"urban-centers" description:"Only print urban centers"`
+	CityDataFilepaths   []string `short:"p" long:"city-data-filepath" description:"GeoNames city- and population-data file-path (plain, gzip, bzip2, or ZIP; '-' for STDIN). Can be provided more than once and globs are allowed. Records with IDs that were already seen in an earlier file are skipped."`
+
+	// Records that match any of these are selected. If none are given, every
+	// record is.
+
+	IdList          []string `short:"i" long:"record-id" description:"ID of record to find (can be provided zero or more times)"`
+	NameList        []string `short:"n" long:"name" description:"Name of a place to to filter for, ignoring case (can be provided zero or more times)"`
+	CoordinatesList []string `short:"C" long:"coordinates" description:"Latitude/longitude to search around (e.g. '12.345,67.891'; can be provided zero or more times). See --radius-km."`
+	RadiusKm        float64  `short:"r" long:"radius-km" description:"Distance around each of the coordinates to search" default:"10"`
+
+	// The selected records must also match all of these.
+
+	Countries        []string `long:"country" description:"Only records in this country, by name (can be provided zero or more times)"`
+	ProvinceStates   []string `long:"admin1" description:"Only records with this province/state (GeoNames admin1) code (can be provided zero or more times)"`
+	MinPopulation    uint64   `long:"min-population" description:"Only records with at least this population"`
+	MaxPopulation    uint64   `long:"max-population" description:"Only records with at most this population"`
+	BoundingBox      string   `long:"bbox" description:"Only records within this box: 'min-lat,min-lon,max-lat,max-lon'. The box crosses the antimeridian if min-lon is greater than max-lon."`
+	FeatureCodes     []string `long:"feature-code" description:"Only records with this GeoNames feature code (e.g. PPLC or PPLA2; can be provided zero or more times)"`
+	NameRegex        string   `long:"name-regex" description:"Only records whose name matches this regular expression (prefix with '(?i)' to ignore case)"`
+	OnlyUrbanCenters bool     `short:"u" long:"urban-centers" description:"Only print urban centers"`
+
+	SortBy string `short:"s" long:"sort" choice:"population" choice:"distance" description:"Sort by population (largest first) or by distance from the nearest of the coordinates (nearest first)"`
+	Limit  int    `short:"l" long:"limit" description:"Print at most this many records"`
+	Format string `short:"f" long:"format" choice:"text" choice:"json" choice:"jsonl" choice:"csv" choice:"geojson" description:"Output format" default:"text"`
 }
 
 var (
@@ -35,6 +56,24 @@ var (
 	commandLogger = log.NewLogger("command/find_record_in_data")
 )
 
+// parseFloats parses a comma-separated list of exactly `count` numbers.
+func parseFloats(phrase string, count int) []float64 {
+	parts := strings.Split(phrase, ",")
+	if len(parts) != count {
+		log.Panicf("phrase is not exactly (%d) parts: [%s]", count, phrase)
+	}
+
+	values := make([]float64, count)
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		log.PanicIf(err)
+
+		values[i] = value
+	}
+
+	return values
+}
+
 func main() {
 	defer func() {
 		if state := recover(); state != nil {
@@ -55,89 +94,199 @@ func main() {
 	gp, err := geoattractorparse.NewGeonamesParserWithFiles(arguments.CountryDataFilepath)
 	log.PanicIf(err)
 
-	cityDataReadcloser, err := geoattractorparse.GetCitydataReadCloser(arguments.CityDataFilepath)
+	cityDataFilepaths, err := geoattractorparse.ExpandCitydataFilepaths(arguments.CityDataFilepaths)
 	log.PanicIf(err)
 
-	defer cityDataReadcloser.Close()
+	// Build the filter.
 
-	cellsList := make([]uint64, len(arguments.CoordinatesList))
+	selectors := make([]geoattractorindex.LoadFilter, 0)
 
-	for i, coordinatePhrase := range arguments.CoordinatesList {
-		parts := strings.Split(coordinatePhrase, ",")
-		if len(parts) != 2 {
-			log.Panicf("coordinate phrase is not exactly two parts: [%s]", coordinatePhrase)
+	if len(arguments.IdList) > 0 {
+		selectors = append(selectors, geoattractorindex.NewIdFilter(arguments.IdList...))
+	}
+
+	if len(arguments.NameList) > 0 {
+		names := make(map[string]struct{})
+		for _, name := range arguments.NameList {
+			names[strings.ToLower(name)] = struct{}{}
 		}
 
-		latitute, err := strconv.ParseFloat(parts[0], 64)
-		log.PanicIf(err)
+		nameFilter := func(cr geoattractor.CityRecord) bool {
+			_, found := names[strings.ToLower(cr.City)]
+			return found
+		}
+
+		selectors = append(selectors, geoattractorindex.LoadFilterFunc(nameFilter))
+	}
+
+	radiusFilters := make([]*geoattractorindex.RadiusFilter, len(arguments.CoordinatesList))
+	for i, coordinatePhrase := range arguments.CoordinatesList {
+		coordinates := parseFloats(coordinatePhrase, 2)
+
+		radiusFilters[i] = geoattractorindex.NewRadiusFilter(coordinates[0], coordinates[1], arguments.RadiusKm)
+		selectors = append(selectors, radiusFilters[i])
+	}
+
+	if arguments.SortBy == "distance" && len(radiusFilters) == 0 {
+		log.Panicf("sorting by distance requires coordinates")
+	}
+
+	filters := make([]geoattractorindex.LoadFilter, 0)
+
+	if len(selectors) > 0 {
+		filters = append(filters, geoattractorindex.AnyOf(selectors...))
+	}
+
+	if len(arguments.Countries) > 0 {
+		filters = append(filters, geoattractorindex.NewCountryFilter(arguments.Countries...))
+	}
+
+	if len(arguments.ProvinceStates) > 0 {
+		filters = append(filters, geoattractorindex.NewProvinceStateFilter(arguments.ProvinceStates...))
+	}
+
+	minPopulation := arguments.MinPopulation
+	if arguments.OnlyUrbanCenters == true && minPopulation < geoattractorindex.DefaultUrbanCenterMinimumPopulation {
+		minPopulation = geoattractorindex.DefaultUrbanCenterMinimumPopulation
+	}
+
+	if minPopulation > 0 || arguments.MaxPopulation > 0 {
+		filters = append(filters, geoattractorindex.NewPopulationFilter(minPopulation, arguments.MaxPopulation))
+	}
+
+	if arguments.BoundingBox != "" {
+		box := parseFloats(arguments.BoundingBox, 4)
+		filters = append(filters, geoattractorindex.NewBoundingBoxFilter(box[0], box[1], box[2], box[3]))
+	}
 
-		longitude, err := strconv.ParseFloat(parts[1], 64)
+	if arguments.NameRegex != "" {
+		rx, err := regexp.Compile(arguments.NameRegex)
 		log.PanicIf(err)
 
-		cell := rigeo.S2CellFromCoordinates(latitute, longitude)
-		cellsList[i] = uint64(cell)
+		filters = append(filters, geoattractorindex.NewNameRegexFilter(rx))
 	}
 
-	hasQualifiers := len(arguments.IdList) > 0 || len(cellsList) > 0 || len(arguments.NameList) > 0
+	filter := geoattractorindex.AllOf(filters...)
 
-	cb := func(cr geoattractor.CityRecord) (err error) {
+	featureCodes := make(map[string]struct{})
+	for _, featureCode := range arguments.FeatureCodes {
+		featureCodes[strings.ToUpper(featureCode)] = struct{}{}
+	}
+
+	// Scan.
+
+	// Messages go to STDERR unless we're printing text.
+	var messages io.Writer = os.Stderr
+	if arguments.Format == "text" {
+		messages = os.Stdout
+	}
+
+	rw := newRecordWriter(arguments.Format, os.Stdout)
+
+	err = rw.Begin()
+	log.PanicIf(err)
+
+	// We only need to hold the results if we're sorting.
+	held := make([]foundRecord, 0)
+
+	printed := 0
+	seenIds := make(map[string]struct{})
+
+	cb := func(cr geoattractor.CityRecord, featureCode string) (err error) {
 		defer func() {
 			if state := recover(); state != nil {
 				err = log.Wrap(state.(error))
 			}
 		}()
 
-		// The parser implementation is expected to filter by everything but
-		// population.
-		if arguments.OnlyUrbanCenters == true && cr.Population < geoattractorindex.DefaultUrbanCenterMinimumPopulation {
+		if _, found := seenIds[cr.Id]; found == true {
 			return nil
 		}
 
-		hit := false
-		if arguments.IdList != nil {
-			for _, idRaw := range arguments.IdList {
-				if idRaw == cr.Id {
-					hit = true
-					break
-				}
+		seenIds[cr.Id] = struct{}{}
+
+		if filter.Match(cr) == false {
+			return nil
+		}
+
+		if len(featureCodes) > 0 {
+			if _, found := featureCodes[featureCode]; found == false {
+				return nil
 			}
 		}
 
-		if hit == false {
-			currentCell := cr.S2Cell()
-			currentCellId := uint64(currentCell)
+		fr := foundRecord{
+			City:        cr,
+			FeatureCode: featureCode,
+		}
 
-			for _, cellId := range cellsList {
-				if cellId == currentCellId {
-					hit = true
-					break
+		if len(radiusFilters) > 0 {
+			distanceKm := radiusFilters[0].DistanceKm(cr)
+			for _, rf := range radiusFilters[1:] {
+				if current := rf.DistanceKm(cr); current < distanceKm {
+					distanceKm = current
 				}
 			}
+
+			fr.DistanceKm = &distanceKm
 		}
 
-		if hit == false {
-			for _, name := range arguments.NameList {
-				if strings.ToLower(cr.City) == strings.ToLower(name) {
-					hit = true
-					break
-				}
-			}
+		if arguments.SortBy != "" {
+			held = append(held, fr)
+			return nil
 		}
 
-		// If no qualifiers are given, just print all of the records. This is
-		// for exploring the data since the acceptance criteria can make it
-		// difficult to the naked eye to know which records will be indexed.
-		if hasQualifiers == true && hit == false {
+		// Keep scanning so that the count is right, but stop printing.
+		if arguments.Limit > 0 && printed >= arguments.Limit {
 			return nil
 		}
 
-		fmt.Printf("%s\n", cr)
+		err = rw.Write(fr)
+		log.PanicIf(err)
+
+		printed++
 
 		return nil
 	}
 
-	recordsCount, err := gp.Parse(cityDataReadcloser, cb)
+	parseFile := func(cityDataFilepath string) int {
+		cityDataReadcloser, err := geoattractorparse.GetCitydataReadCloser(cityDataFilepath)
+		log.PanicIf(err)
+
+		defer cityDataReadcloser.Close()
+
+		recordsCount, err := gp.ParseWithFeatureCodes(cityDataReadcloser, cb)
+		log.PanicIf(err)
+
+		return recordsCount
+	}
+
+	recordsCount := 0
+	for _, cityDataFilepath := range cityDataFilepaths {
+		recordsCount += parseFile(cityDataFilepath)
+	}
+
+	if arguments.SortBy != "" {
+		sort.SliceStable(held, func(i, j int) bool {
+			if arguments.SortBy == "distance" {
+				return *held[i].DistanceKm < *held[j].DistanceKm
+			}
+
+			return held[i].City.Population > held[j].City.Population
+		})
+
+		if arguments.Limit > 0 && len(held) > arguments.Limit {
+			held = held[:arguments.Limit]
+		}
+
+		for _, fr := range held {
+			err := rw.Write(fr)
+			log.PanicIf(err)
+		}
+	}
+
+	err = rw.End()
 	log.PanicIf(err)
 
-	fmt.Printf("(%d) records scanned.\n", recordsCount)
+	fmt.Fprintf(messages, "(%d) records scanned.\n", recordsCount)
 }
@@ -0,0 +1,107 @@
+package main
+
+// Tool to write a synthetic city dataset in the GeoNames format, for loading
+// into an index for load testing.
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/dsoprea/go-geographic-attractor/synthetic"
+)
+
+type parameters struct {
+	Count       int     `short:"n" long:"count" description:"Number of cities" default:"10000"`
+	Density     float64 `long:"density" description:"Cities per 10,000 square kilometers (instead of --count)"`
+	BoundingBox string  `long:"bbox" description:"Region to place the cities in: 'min-lat,min-lon,max-lat,max-lon'" default:"-90,-180,90,180"`
+	Seed        int64   `long:"seed" description:"Seed for the dataset" default:"1"`
+
+	Population        string `long:"population" choice:"pareto" choice:"uniform" choice:"fixed" description:"Distribution of the populations" default:"pareto"`
+	MinimumPopulation uint64 `long:"min-population" description:"Smallest population" default:"100"`
+	MaximumPopulation uint64 `long:"max-population" description:"Largest population" default:"20000000"`
+
+	Metros          int     `long:"metros" description:"Number of metros to cluster cities around"`
+	MetroFraction   float64 `long:"metro-fraction" description:"Share of the cities placed around the metros" default:"0.5"`
+	MetroRadiusKm   float64 `long:"metro-radius-km" description:"Distance from the center of a metro that its cities are placed within" default:"50"`
+	MetroPopulation uint64  `long:"metro-population" description:"Population of the city at the center of each metro" default:"5000000"`
+
+	EdgeCases bool `long:"edge-cases" description:"Add cities at the poles, the antimeridian, and the S2 face boundaries"`
+
+	OutputFilepath string `long:"output" description:"File-path to write ('-' for STDOUT)" default:"-"`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	parts := strings.Split(arguments.BoundingBox, ",")
+	if len(parts) != 4 {
+		log.Panicf("bounding box is not exactly four parts: [%s]", arguments.BoundingBox)
+	}
+
+	box := make([]float64, 4)
+	for i, part := range parts {
+		box[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+		log.PanicIf(err)
+	}
+
+	config := geoattractorsynthetic.GeneratorConfig{
+		Count:   arguments.Count,
+		Density: arguments.Density,
+		Bounds: &geoattractorsynthetic.Bounds{
+			MinLatitude:  box[0],
+			MinLongitude: box[1],
+			MaxLatitude:  box[2],
+			MaxLongitude: box[3],
+		},
+		Seed:              arguments.Seed,
+		Population:        geoattractorsynthetic.PopulationDistribution(arguments.Population),
+		MinimumPopulation: arguments.MinimumPopulation,
+		MaximumPopulation: arguments.MaximumPopulation,
+		Metros:            arguments.Metros,
+		MetroFraction:     arguments.MetroFraction,
+		MetroRadiusKm:     arguments.MetroRadiusKm,
+		MetroPopulation:   arguments.MetroPopulation,
+		EdgeCases:         arguments.EdgeCases,
+	}
+
+	g := geoattractorsynthetic.NewGenerator(config)
+
+	var output io.WriteCloser = os.Stdout
+	if arguments.OutputFilepath != "-" {
+		output, err = os.Create(arguments.OutputFilepath)
+		log.PanicIf(err)
+
+		defer output.Close()
+	}
+
+	w := bufio.NewWriter(output)
+
+	err = g.WriteGeonames(w)
+	log.PanicIf(err)
+
+	err = w.Flush()
+	log.PanicIf(err)
+}
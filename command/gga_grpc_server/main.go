@@ -0,0 +1,111 @@
+package main
+
+// Tool to serve nearest-city queries against a prebuilt city database over
+// gRPC.
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+	"google.golang.org/grpc"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+	"github.com/dsoprea/go-geographic-attractor/rpc"
+)
+
+type parameters struct {
+	CityDatabaseFilepath string        `long:"city-db-filepath" description:"File-path of the prebuilt city database" required:"true"`
+	MinimumLevel         int           `long:"minimum-level" description:"Minimum search level that the database was built with" default:"7"`
+	ListenAddress        string        `short:"l" long:"listen" description:"Address to listen on" default:":50051"`
+	MaxBatchSize         int           `long:"max-batch-size" description:"Most requests accepted in one batch" default:"1000"`
+	ShutdownTimeout      time.Duration `long:"shutdown-timeout" description:"Maximum time to wait for calls to finish when shutting down" default:"30s"`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(arguments.CityDatabaseFilepath); err != nil {
+		log.Panicf("city database not found: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	ci := geoattractorindex.NewCityIndex(arguments.CityDatabaseFilepath, arguments.MinimumLevel, geoattractorindex.DefaultUrbanCenterMinimumPopulation)
+
+	defer ci.Close()
+
+	// Open the database now rather than on the first query.
+
+	count, err := ci.KvCount()
+	log.PanicIf(err)
+
+	if count == 0 {
+		log.Panicf("city database is empty: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	config := geoattractorrpc.ServerConfig{
+		Index:        ci,
+		MaxBatchSize: arguments.MaxBatchSize,
+	}
+
+	gs := grpc.NewServer()
+	geoattractorrpc.RegisterCityIndexServer(gs, geoattractorrpc.NewServer(config))
+
+	listener, err := net.Listen("tcp", arguments.ListenAddress)
+	log.PanicIf(err)
+
+	serveErrors := make(chan error, 1)
+
+	go func() {
+		serveErrors <- gs.Serve(listener)
+	}()
+
+	fmt.Printf("Listening on [%s] with (%d) keys.\n", arguments.ListenAddress, count)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErrors:
+		log.Panic(err)
+	case sig := <-signals:
+		fmt.Printf("Received [%s]. Shutting down.\n", sig)
+	}
+
+	// Let the calls in progress finish, but not forever.
+
+	stopped := make(chan struct{})
+
+	go func() {
+		gs.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(arguments.ShutdownTimeout):
+		fmt.Printf("Calls did not finish in time. Stopping.\n")
+		gs.Stop()
+	}
+}
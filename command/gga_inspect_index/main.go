@@ -0,0 +1,147 @@
+package main
+
+// Tool to dump the contents of a city database as JSON lines or to summarize
+// it.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+type parameters struct {
+	CityDatabaseFilepath string `long:"city-db-filepath" description:"File-path of the city database to inspect" required:"true"`
+
+	Stats         bool `short:"s" long:"stats" description:"Print statistics instead of dumping the keys"`
+	LargestTokens int  `long:"largest-tokens" description:"Number of largest tokens to list with the statistics" default:"10"`
+	Json          bool `short:"j" long:"json" description:"Print the statistics as JSON"`
+
+	Groups      []string `short:"g" long:"group" choice:"city" choice:"token" choice:"metadata" description:"Only dump this key group. Can be provided more than once."`
+	TokenPrefix string   `short:"t" long:"token-prefix" description:"Only dump tokens with this prefix"`
+	Levels      []int    `short:"l" long:"level" description:"Only dump tokens at this level. Can be provided more than once."`
+	CityId      string   `short:"i" long:"city-id" description:"Only dump this city and the token entries for it"`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(arguments.CityDatabaseFilepath); err != nil {
+		log.Panicf("city database not found: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	ci := geoattractorindex.NewCityIndex(arguments.CityDatabaseFilepath, geoattractorindex.DefaultMinimumLevelForUrbanCenterAttraction, geoattractorindex.DefaultUrbanCenterMinimumPopulation)
+
+	defer ci.Close()
+
+	if arguments.Stats == true {
+		printStats(ci)
+		return
+	}
+
+	filter := geoattractorindex.InspectFilter{
+		Groups:      arguments.Groups,
+		TokenPrefix: arguments.TokenPrefix,
+		Levels:      arguments.Levels,
+		CityId:      arguments.CityId,
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+
+	defer w.Flush()
+
+	e := json.NewEncoder(w)
+
+	cb := func(item geoattractorindex.InspectItem) (err error) {
+		return e.Encode(item)
+	}
+
+	err = ci.Inspect(filter, cb)
+	log.PanicIf(err)
+}
+
+func printStats(ci *geoattractorindex.CityIndex) {
+	stats, err := ci.InspectStats(arguments.LargestTokens)
+	log.PanicIf(err)
+
+	if arguments.Json == true {
+		encoded, err := json.MarshalIndent(stats, "", "  ")
+		log.PanicIf(err)
+
+		fmt.Println(string(encoded))
+
+		return
+	}
+
+	fmt.Printf("Keys: (%d)\n", stats.Keys)
+	fmt.Printf("Cities: (%d)\n", stats.Cities)
+	fmt.Printf("Tokens: (%d)\n", stats.Tokens)
+	fmt.Printf("Token entries: (%d)\n", stats.Entries)
+	fmt.Printf("Metadata: (%d)\n", stats.Metadata)
+	fmt.Printf("\n")
+
+	fmt.Printf("Levels:\n")
+	fmt.Printf("\n")
+
+	for _, lc := range stats.Levels {
+		fmt.Printf("> (%2d) TOKENS=(%d) ENTRIES=(%d)\n", lc.Level, lc.Tokens, lc.Entries)
+	}
+
+	fmt.Printf("\n")
+
+	fmt.Printf("Cities per token:\n")
+	fmt.Printf("\n")
+
+	for _, tsb := range stats.TokenSizes {
+		fmt.Printf("> %d-%d: (%d)\n", tsb.Min, tsb.Max, tsb.Tokens)
+	}
+
+	fmt.Printf("\n")
+
+	fmt.Printf("Largest tokens:\n")
+	fmt.Printf("\n")
+
+	for _, ts := range stats.LargestTokens {
+		fmt.Printf("> %s (%d): (%d)\n", ts.Token, ts.Level, ts.Cities)
+	}
+
+	fmt.Printf("\n")
+
+	fmt.Printf("Cities per source:\n")
+	fmt.Printf("\n")
+
+	for _, lt := range stats.Sources {
+		fmt.Printf("> %s (%d)\n", lt.Name, lt.Count)
+	}
+
+	fmt.Printf("\n")
+
+	fmt.Printf("Cities per country:\n")
+	fmt.Printf("\n")
+
+	for _, lt := range stats.Countries {
+		fmt.Printf("> %s (%d)\n", lt.Name, lt.Count)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+// Tool to serve reverse-geocoding queries against a prebuilt city database
+// over HTTP.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+	"github.com/dsoprea/go-geographic-attractor/server"
+)
+
+type parameters struct {
+	CityDatabaseFilepath string  `long:"city-db-filepath" description:"File-path of the prebuilt city database" required:"true"`
+	MinimumLevel         int     `long:"minimum-level" description:"Minimum search level that the database was built with" default:"7"`
+	ListenAddress        string  `short:"l" long:"listen" description:"Address to listen on" default:":8080"`
+	DefaultSourceName    string  `long:"default-source" description:"Source to look cities up by ID in when the request doesn't give one" default:"GeoNames"`
+	MaxResults           int     `long:"max-results" description:"Most results that a k-nearest, radius, or name query returns" default:"100"`
+	MaxRadiusKm          float64 `long:"max-radius-km" description:"Largest radius that can be queried" default:"500"`
+
+	ReadTimeout     time.Duration `long:"read-timeout" description:"Maximum time to read a request" default:"10s"`
+	WriteTimeout    time.Duration `long:"write-timeout" description:"Maximum time to write a response" default:"30s"`
+	IdleTimeout     time.Duration `long:"idle-timeout" description:"Maximum time to keep an idle connection open" default:"120s"`
+	ShutdownTimeout time.Duration `long:"shutdown-timeout" description:"Maximum time to wait for requests to finish when shutting down" default:"30s"`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(arguments.CityDatabaseFilepath); err != nil {
+		log.Panicf("city database not found: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	ci := geoattractorindex.NewCityIndex(arguments.CityDatabaseFilepath, arguments.MinimumLevel, geoattractorindex.DefaultUrbanCenterMinimumPopulation)
+
+	defer ci.Close()
+
+	// Open the database now rather than on the first query.
+
+	count, err := ci.KvCount()
+	log.PanicIf(err)
+
+	if count == 0 {
+		log.Panicf("city database is empty: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	config := geoattractorserver.ServerConfig{
+		Index:             ci,
+		DefaultSourceName: arguments.DefaultSourceName,
+		MaxResults:        arguments.MaxResults,
+		MaxRadiusKm:       arguments.MaxRadiusKm,
+	}
+
+	s := geoattractorserver.NewServer(config)
+
+	hs := &http.Server{
+		Addr:         arguments.ListenAddress,
+		Handler:      s,
+		ReadTimeout:  arguments.ReadTimeout,
+		WriteTimeout: arguments.WriteTimeout,
+		IdleTimeout:  arguments.IdleTimeout,
+	}
+
+	serveErrors := make(chan error, 1)
+
+	go func() {
+		serveErrors <- hs.ListenAndServe()
+	}()
+
+	s.SetReady(true)
+
+	fmt.Printf("Listening on [%s] with (%d) keys.\n", arguments.ListenAddress, count)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErrors:
+		log.Panic(err)
+	case sig := <-signals:
+		fmt.Printf("Received [%s]. Shutting down.\n", sig)
+	}
+
+	s.SetReady(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), arguments.ShutdownTimeout)
+	defer cancel()
+
+	err = hs.Shutdown(ctx)
+	log.PanicIf(err)
+}
@@ -0,0 +1,94 @@
+package main
+
+// Interactive shell for exploring a prebuilt city database without reloading it
+// for every query.
+
+import (
+	"os"
+	"path"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+type parameters struct {
+	CityDatabaseFilepath string `long:"city-db-filepath" description:"File-path of the prebuilt city database" required:"true"`
+	MinimumLevel         int    `long:"minimum-level" description:"Minimum search level that the database was built with" default:"7"`
+	UrbanCenterMinimum   int    `long:"urban-center-minimum-population" description:"Population at which a city attracts the points around it (can be changed with 'threshold')"`
+	DefaultSourceName    string `long:"default-source" description:"Source to look cities up by ID in when a command doesn't give one" default:"GeoNames"`
+	HistoryFilepath      string `long:"history-filepath" description:"File to keep the command history in. Defaults to ~/.gga_shell_history. Pass 'none' to not keep it."`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(arguments.CityDatabaseFilepath); err != nil {
+		log.Panicf("city database not found: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	urbanCenterMinimum := arguments.UrbanCenterMinimum
+	if urbanCenterMinimum == 0 {
+		urbanCenterMinimum = geoattractorindex.DefaultUrbanCenterMinimumPopulation
+	}
+
+	ci := geoattractorindex.NewCityIndex(arguments.CityDatabaseFilepath, arguments.MinimumLevel, urbanCenterMinimum)
+
+	defer ci.Close()
+
+	// Open the database now rather than on the first command.
+
+	count, err := ci.KvCount()
+	log.PanicIf(err)
+
+	if count == 0 {
+		log.Panicf("city database is empty: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	historyFilepath := arguments.HistoryFilepath
+	if historyFilepath == "" {
+		if homePath, err := os.UserHomeDir(); err == nil {
+			historyFilepath = path.Join(homePath, ".gga_shell_history")
+		}
+	} else if historyFilepath == "none" {
+		historyFilepath = ""
+	}
+
+	s := newShell(ci, arguments.DefaultSourceName, os.Stdout)
+
+	if historyFilepath != "" {
+		err := s.loadHistory(historyFilepath)
+		log.PanicIf(err)
+	}
+
+	// Only prompt if a person is typing.
+	isInteractive := false
+	if fi, err := os.Stdin.Stat(); err == nil {
+		isInteractive = fi.Mode()&os.ModeCharDevice != 0
+	}
+
+	if isInteractive == true {
+		s.printf("Opened [%s] with (%d) keys. Type 'help' for commands.\n", arguments.CityDatabaseFilepath, count)
+	}
+
+	err = s.run(os.Stdin, isInteractive)
+	log.PanicIf(err)
+}
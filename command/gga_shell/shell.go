@@ -0,0 +1,645 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"encoding/json"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/golang/geo/s2"
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+const (
+	// maxHistory is the most commands kept in the history file.
+	maxHistory = 1000
+
+	// defaultK is the number of cities that `knn` returns if not given.
+	defaultK = 5
+)
+
+var (
+	errQuit = errors.New("quit")
+)
+
+// shellCommand is one command. `usage` is printed by `help` and on bad
+// arguments.
+type shellCommand struct {
+	usage       string
+	description string
+	handler     func(args []string) error
+}
+
+// shell reads commands and runs them against the index.
+type shell struct {
+	ci                *geoattractorindex.CityIndex
+	defaultSourceName string
+	out               io.Writer
+
+	commands map[string]shellCommand
+
+	history         []string
+	historyFilepath string
+
+	// lastLatitude and lastLongitude are the last point queried, which
+	// `visits` uses if not given one.
+	lastLatitude  float64
+	lastLongitude float64
+	hasLast       bool
+}
+
+func newShell(ci *geoattractorindex.CityIndex, defaultSourceName string, out io.Writer) *shell {
+	s := &shell{
+		ci:                ci,
+		defaultSourceName: defaultSourceName,
+		out:               out,
+		history:           make([]string, 0),
+	}
+
+	s.commands = map[string]shellCommand{
+		"nearest":   {"nearest <lat> <lon>", "Nearest city, preferring urban centers (what gga_find_nearest_city returns)", s.nearest},
+		"visits":    {"visits [<lat> <lon>]", "Cities that the nearest-city search considered, by level (defaults to the last point)", s.visits},
+		"knn":       {"knn <lat> <lon> [<k>]", fmt.Sprintf("The k (default %d) nearest cities, regardless of size", defaultK), s.knn},
+		"radius":    {"radius <lat> <lon> <km>", "Cities within the given distance", s.radius},
+		"get":       {"get <id> [<source>]", "City by ID", s.get},
+		"name":      {"name <name> [<country>]", "Cities by name (quote names with spaces)", s.name},
+		"cell":      {"cell <token>", "Cities indexed at an S2 token", s.cell},
+		"stats":     {"stats [index]", "Query statistics, or statistics for the whole index", s.stats},
+		"threshold": {"threshold [<population>]", "Show or change the population at which a city attracts", s.threshold},
+		"history":   {"history", "Previous commands (re-run with !<number> or !!)", s.showHistory},
+		"help":      {"help", "This list", s.help},
+		"quit":      {"quit", "Leave (or EOF)", s.quit},
+	}
+
+	s.commands["exit"] = s.commands["quit"]
+
+	return s
+}
+
+func (s *shell) printf(format string, args ...interface{}) {
+	fmt.Fprintf(s.out, format, args...)
+}
+
+// run reads and runs commands until EOF or `quit`. Errors from commands are
+// printed rather than returned.
+func (s *shell) run(r io.Reader, isInteractive bool) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	scanner := bufio.NewScanner(r)
+
+	for {
+		if isInteractive == true {
+			s.printf("gga> ")
+		}
+
+		if scanner.Scan() == false {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") == true {
+			continue
+		}
+
+		line, err := s.expandHistory(line)
+		if err != nil {
+			s.printf("Error: %s\n", err)
+			continue
+		}
+
+		s.addHistory(line)
+
+		err = s.execute(line)
+		if err == errQuit {
+			break
+		} else if err != nil {
+			s.printf("Error: %s\n", err)
+		}
+	}
+
+	if isInteractive == true {
+		s.printf("\n")
+	}
+
+	err = scanner.Err()
+	log.PanicIf(err)
+
+	return nil
+}
+
+// execute runs one line.
+func (s *shell) execute(line string) (err error) {
+	args, err := splitArguments(line)
+	if err != nil {
+		return err
+	}
+
+	sc, found := s.commands[strings.ToLower(args[0])]
+	if found == false {
+		return fmt.Errorf("unknown command [%s]; type 'help' for commands", args[0])
+	}
+
+	return sc.handler(args[1:])
+}
+
+// splitArguments splits on whitespace, keeping double- or single-quoted
+// phrases together.
+func splitArguments(line string) (args []string, err error) {
+	args = make([]string, 0)
+
+	var current strings.Builder
+	var quote rune
+	inArgument := false
+
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+			inArgument = true
+		case c == ' ' || c == '\t':
+			if inArgument == true {
+				args = append(args, current.String())
+				current.Reset()
+				inArgument = false
+			}
+		default:
+			current.WriteRune(c)
+			inArgument = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+
+	if inArgument == true {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// History
+
+// loadHistory reads the history file, if it exists, and remembers where to
+// append new commands.
+func (s *shell) loadHistory(filepath string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	s.historyFilepath = filepath
+
+	f, err := os.Open(filepath)
+	if os.IsNotExist(err) == true {
+		return nil
+	}
+
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			s.history = append(s.history, line)
+		}
+	}
+
+	err = scanner.Err()
+	log.PanicIf(err)
+
+	if len(s.history) > maxHistory {
+		s.history = s.history[len(s.history)-maxHistory:]
+	}
+
+	return nil
+}
+
+// addHistory remembers the command and appends it to the history file. A
+// history file that can't be written is ignored.
+func (s *shell) addHistory(line string) {
+	if len(s.history) > 0 && s.history[len(s.history)-1] == line {
+		return
+	}
+
+	s.history = append(s.history, line)
+
+	if s.historyFilepath == "" {
+		return
+	}
+
+	f, err := os.OpenFile(s.historyFilepath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	fmt.Fprintln(f, line)
+}
+
+// expandHistory replaces "!!" with the last command and "!<number>" with the
+// numbered one.
+func (s *shell) expandHistory(line string) (expanded string, err error) {
+	if strings.HasPrefix(line, "!") == false {
+		return line, nil
+	}
+
+	if len(s.history) == 0 {
+		return "", errors.New("history is empty")
+	}
+
+	if line == "!!" {
+		expanded = s.history[len(s.history)-1]
+	} else {
+		number, err := strconv.Atoi(line[1:])
+		if err != nil || number < 1 || number > len(s.history) {
+			return "", fmt.Errorf("no such history entry: [%s]", line)
+		}
+
+		expanded = s.history[number-1]
+	}
+
+	s.printf("%s\n", expanded)
+
+	return expanded, nil
+}
+
+func (s *shell) showHistory(args []string) error {
+	for i, line := range s.history {
+		s.printf("%4d  %s\n", i+1, line)
+	}
+
+	return nil
+}
+
+// Arguments
+
+func usageError(usage string) error {
+	return fmt.Errorf("usage: %s", usage)
+}
+
+// parseCoordinates parses the first two arguments and remembers them as the
+// last point.
+func (s *shell) parseCoordinates(args []string, usage string) (latitude, longitude float64, err error) {
+	if len(args) < 2 {
+		return 0.0, 0.0, usageError(usage)
+	}
+
+	latitude, err = strconv.ParseFloat(args[0], 64)
+	if err != nil || latitude < -90.0 || latitude > 90.0 {
+		return 0.0, 0.0, fmt.Errorf("latitude not valid: [%s]", args[0])
+	}
+
+	longitude, err = strconv.ParseFloat(args[1], 64)
+	if err != nil || longitude < -180.0 || longitude > 180.0 {
+		return 0.0, 0.0, fmt.Errorf("longitude not valid: [%s]", args[1])
+	}
+
+	s.lastLatitude = latitude
+	s.lastLongitude = longitude
+	s.hasLast = true
+
+	return latitude, longitude, nil
+}
+
+// Printing
+
+func (s *shell) printCity(cr geoattractor.CityRecord, sourceName string) {
+	s.printf("%s (%s)\n", cr.City, sourceName)
+	s.printf("  ID:             %s\n", cr.Id)
+	s.printf("  Country:        %s\n", cr.Country)
+	s.printf("  Province/State: %s\n", cr.ProvinceState)
+	s.printf("  Population:     %d\n", cr.Population)
+	s.printf("  Coordinates:    %.6f, %.6f\n", cr.Latitude, cr.Longitude)
+	s.printf("  Cell:           %s (level %d)\n", cr.S2Cell().ToToken(), cr.S2Cell().Level())
+}
+
+func (s *shell) printNearby(nearby []geoattractorindex.NearbyCity) {
+	if len(nearby) == 0 {
+		s.printf("No cities.\n")
+		return
+	}
+
+	for i, nc := range nearby {
+		s.printf("%3d. %9.3f km  %s, %s [%s] pop (%d) (%s,%s)\n", i+1, nc.DistanceKm, nc.City.City, nc.City.Country, nc.City.ProvinceState, nc.City.Population, nc.SourceName, nc.City.Id)
+	}
+}
+
+func distanceKm(latitude, longitude float64, cr geoattractor.CityRecord) float64 {
+	origin := geo.NewPoint(latitude, longitude)
+	return origin.GreatCircleDistance(geo.NewPoint(cr.Latitude, cr.Longitude))
+}
+
+// Commands
+
+func (s *shell) nearest(args []string) error {
+	latitude, longitude, err := s.parseCoordinates(args, s.commands["nearest"].usage)
+	if err != nil {
+		return err
+	}
+
+	sourceName, _, cr, err := s.ci.Nearest(latitude, longitude, false)
+	if err != nil {
+		if log.Is(err, geoattractorindex.ErrNoNearestCity) == true {
+			s.printf("No nearest city found.\n")
+			return nil
+		}
+
+		return err
+	}
+
+	s.printCity(cr, sourceName)
+	s.printf("  Distance:       %.3f km\n", distanceKm(latitude, longitude, cr))
+
+	return nil
+}
+
+// visits prints the cities that `Nearest()` considered, grouped by the level
+// of the cell that they were found at, from the smallest cell outward.
+func (s *shell) visits(args []string) error {
+	usage := s.commands["visits"].usage
+
+	if len(args) > 0 {
+		if _, _, err := s.parseCoordinates(args, usage); err != nil {
+			return err
+		}
+	} else if s.hasLast == false {
+		return usageError(usage)
+	}
+
+	latitude := s.lastLatitude
+	longitude := s.lastLongitude
+
+	sourceName, visits, cr, err := s.ci.Nearest(latitude, longitude, true)
+	if err != nil {
+		if log.Is(err, geoattractorindex.ErrNoNearestCity) == true {
+			s.printf("No nearest city found.\n")
+			return nil
+		}
+
+		return err
+	}
+
+	s.printf("Point (%.6f, %.6f); urban centers have at least (%d) people.\n", latitude, longitude, s.ci.UrbanCenterMinimumPopulation())
+	s.printf("\n")
+
+	lastToken := ""
+	for _, vhi := range visits {
+		if vhi.Token != lastToken {
+			s.printf("Level %2d [%s]:\n", s2.CellIDFromToken(vhi.Token).Level(), vhi.Token)
+			lastToken = vhi.Token
+		}
+
+		marker := " "
+		if vhi.City.Id == cr.Id && vhi.SourceName == sourceName {
+			marker = "*"
+		} else if int(vhi.City.Population) >= s.ci.UrbanCenterMinimumPopulation() {
+			marker = "+"
+		}
+
+		s.printf("  %s %s, %s pop (%d) %.3f km (%s,%s)\n", marker, vhi.City.City, vhi.City.Country, vhi.City.Population, distanceKm(latitude, longitude, vhi.City), vhi.SourceName, vhi.City.Id)
+	}
+
+	if len(visits) > 0 {
+		s.printf("\n")
+	}
+
+	s.printf("Result (*): %s, %s (%.3f km). Other urban centers are marked with (+).\n", cr.City, cr.Country, distanceKm(latitude, longitude, cr))
+
+	return nil
+}
+
+func (s *shell) knn(args []string) error {
+	usage := s.commands["knn"].usage
+
+	latitude, longitude, err := s.parseCoordinates(args, usage)
+	if err != nil {
+		return err
+	}
+
+	k := defaultK
+	if len(args) > 2 {
+		k, err = strconv.Atoi(args[2])
+		if err != nil || k < 1 {
+			return usageError(usage)
+		}
+	}
+
+	nearby, err := s.ci.KNearest(latitude, longitude, k)
+	if err != nil {
+		return err
+	}
+
+	s.printNearby(nearby)
+
+	return nil
+}
+
+func (s *shell) radius(args []string) error {
+	usage := s.commands["radius"].usage
+
+	if len(args) != 3 {
+		return usageError(usage)
+	}
+
+	latitude, longitude, err := s.parseCoordinates(args, usage)
+	if err != nil {
+		return err
+	}
+
+	radiusKm, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || radiusKm <= 0.0 {
+		return usageError(usage)
+	}
+
+	nearby, err := s.ci.WithinRadius(latitude, longitude, radiusKm)
+	if err != nil {
+		return err
+	}
+
+	s.printNearby(nearby)
+
+	return nil
+}
+
+func (s *shell) get(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError(s.commands["get"].usage)
+	}
+
+	sourceName := s.defaultSourceName
+	if len(args) == 2 {
+		sourceName = args[1]
+	}
+
+	cr, err := s.ci.GetById(sourceName, args[0])
+	if err != nil {
+		if log.Is(err, geoattractorindex.ErrNotFound) == true {
+			s.printf("Not found.\n")
+			return nil
+		}
+
+		return err
+	}
+
+	s.printCity(cr, sourceName)
+
+	return nil
+}
+
+func (s *shell) name(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError(s.commands["name"].usage)
+	}
+
+	country := ""
+	if len(args) == 2 {
+		country = args[1]
+	}
+
+	cities, err := s.ci.FindByName(args[0], country, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(cities) == 0 {
+		s.printf("No cities.\n")
+		return nil
+	}
+
+	for i, ic := range cities {
+		s.printf("%3d. %s, %s [%s] pop (%d) (%.6f, %.6f) (%s,%s)\n", i+1, ic.City.City, ic.City.Country, ic.City.ProvinceState, ic.City.Population, ic.City.Latitude, ic.City.Longitude, ic.SourceName, ic.City.Id)
+	}
+
+	return nil
+}
+
+func (s *shell) cell(args []string) error {
+	if len(args) != 1 {
+		return usageError(s.commands["cell"].usage)
+	}
+
+	token := args[0]
+
+	cellId := s2.CellIDFromToken(token)
+	if cellId.IsValid() == false {
+		return fmt.Errorf("not a valid token: [%s]", token)
+	}
+
+	center := cellId.LatLng()
+	s.printf("Cell [%s] level (%d) centered at (%.6f, %.6f)\n", cellId.ToToken(), cellId.Level(), center.Lat.Degrees(), center.Lng.Degrees())
+
+	if cellId.Level() < s.ci.MinimumSearchLevel() {
+		s.printf("Cells below the minimum search level (%d) aren't indexed.\n", s.ci.MinimumSearchLevel())
+		return nil
+	}
+
+	entries, err := s.ci.TokenEntries(cellId.ToToken())
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		s.printf("No cities.\n")
+		return nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].City.Population > entries[j].City.Population
+	})
+
+	for i, entry := range entries {
+		s.printf("%3d. %s, %s pop (%d) leaf [%s] (%s,%s)\n", i+1, entry.City.City, entry.City.Country, entry.City.Population, entry.LeafToken, entry.SourceName, entry.City.Id)
+	}
+
+	return nil
+}
+
+func (s *shell) stats(args []string) error {
+	var value interface{}
+
+	if len(args) == 0 {
+		value = s.ci.Stats()
+	} else if len(args) == 1 && args[0] == "index" {
+		stats, err := s.ci.InspectStats(10)
+		if err != nil {
+			return err
+		}
+
+		value = stats
+	} else {
+		return usageError(s.commands["stats"].usage)
+	}
+
+	encoded, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.printf("%s\n", encoded)
+
+	return nil
+}
+
+func (s *shell) threshold(args []string) error {
+	if len(args) > 1 {
+		return usageError(s.commands["threshold"].usage)
+	}
+
+	if len(args) == 1 {
+		population, err := strconv.Atoi(args[0])
+		if err != nil || population < 0 {
+			return fmt.Errorf("population not valid: [%s]", args[0])
+		}
+
+		s.ci.SetUrbanCenterMinimumPopulation(population)
+	}
+
+	s.printf("Urban centers have at least (%d) people.\n", s.ci.UrbanCenterMinimumPopulation())
+
+	return nil
+}
+
+func (s *shell) help(args []string) error {
+	names := make([]string, 0, len(s.commands))
+	for name := range s.commands {
+		if name != "exit" {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		sc := s.commands[name]
+		s.printf("  %-26s %s\n", sc.usage, sc.description)
+	}
+
+	return nil
+}
+
+func (s *shell) quit(args []string) error {
+	return errQuit
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/index"
+	"github.com/dsoprea/go-geographic-attractor/synthetic"
+)
+
+// runTestShell runs the commands against a small index and returns what was
+// printed.
+func runTestShell(commands string) string {
+	records := []geoattractor.CityRecord{
+		{Id: "1", Country: "Andorra", ProvinceState: "07", City: "Big City", Population: 500000, Latitude: 42.5, Longitude: 1.5},
+		{Id: "2", Country: "Andorra", ProvinceState: "07", City: "Smallton", Population: 100, Latitude: 42.51, Longitude: 1.52},
+		{Id: "3", Country: "Elsewhere", City: "Farburg", Population: 2000, Latitude: 10.0, Longitude: 10.0},
+	}
+
+	ci, kvFilepath := geoattractorindex.NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	_, err := ci.Load(geoattractorsynthetic.NewRecordSource("Test", records), nil, geoattractorindex.LoadOptions{})
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	s := newShell(ci, "Test", b)
+
+	err = s.run(strings.NewReader(commands), false)
+	log.PanicIf(err)
+
+	return b.String()
+}
+
+func TestSplitArguments(t *testing.T) {
+	cases := []struct {
+		line     string
+		expected []string
+	}{
+		{"", []string{}},
+		{"nearest 42.5 1.5", []string{"nearest", "42.5", "1.5"}},
+		{"  knn\t42.5   1.5  ", []string{"knn", "42.5", "1.5"}},
+		{`name "New York" US`, []string{"name", "New York", "US"}},
+		{`name 'Sant Julià de Lòria'`, []string{"name", "Sant Julià de Lòria"}},
+		{`name "it's"`, []string{"name", "it's"}},
+		{`name ""`, []string{"name", ""}},
+		{`name New" "York`, []string{"name", "New York"}},
+	}
+
+	for _, c := range cases {
+		args, err := splitArguments(c.line)
+		log.PanicIf(err)
+
+		if reflect.DeepEqual(args, c.expected) == false {
+			t.Fatalf("Arguments for [%s] not correct: %q", c.line, args)
+		}
+	}
+
+	_, err := splitArguments(`name "New York`)
+	if err == nil {
+		t.Fatalf("Expected error for unterminated quote.")
+	}
+}
+
+func TestShell_Run_History(t *testing.T) {
+	output := runTestShell(`!!
+get 2
+!!
+knn 42.511 1.521 1
+!1
+!0
+!5
+!x
+history
+`)
+
+	expected := `Error: history is empty
+Smallton (Test)
+  ID:             2
+  Country:        Andorra
+  Province/State: 07
+  Population:     100
+  Coordinates:    42.510000, 1.520000
+  Cell:           12a5f52d394524ed (level 30)
+get 2
+Smallton (Test)
+  ID:             2
+  Country:        Andorra
+  Province/State: 07
+  Population:     100
+  Coordinates:    42.510000, 1.520000
+  Cell:           12a5f52d394524ed (level 30)
+  1.     0.138 km  Smallton, Andorra [07] pop (100) (Test,2)
+get 2
+Smallton (Test)
+  ID:             2
+  Country:        Andorra
+  Province/State: 07
+  Population:     100
+  Coordinates:    42.510000, 1.520000
+  Cell:           12a5f52d394524ed (level 30)
+Error: no such history entry: [!0]
+Error: no such history entry: [!5]
+Error: no such history entry: [!x]
+   1  get 2
+   2  knn 42.511 1.521 1
+   3  get 2
+   4  history
+`
+
+	if output != expected {
+		t.Fatalf("Output not correct:\n%s", output)
+	}
+}
+
+func TestShell_Run_Dispatch(t *testing.T) {
+	output := runTestShell(`# Comments and blank lines are skipped.
+
+NEAREST 42.511 1.521
+knn 42.511 1.521 2
+radius 42.5 1.5 5
+name 'Big City' Andorra
+get 9
+bogus
+nearest 100 1
+knn 1
+threshold 50
+nearest 42.511 1.521
+name "unterminated
+quit
+get 1
+`)
+
+	expected := `Big City (Test)
+  ID:             1
+  Country:        Andorra
+  Province/State: 07
+  Population:     500000
+  Coordinates:    42.500000, 1.500000
+  Cell:           12a5f4e05c9c4fa9 (level 30)
+  Distance:       2.112 km
+  1.     0.138 km  Smallton, Andorra [07] pop (100) (Test,2)
+  2.     2.112 km  Big City, Andorra [07] pop (500000) (Test,1)
+  1.     0.000 km  Big City, Andorra [07] pop (500000) (Test,1)
+  2.     1.981 km  Smallton, Andorra [07] pop (100) (Test,2)
+  1. Big City, Andorra [07] pop (500000) (42.500000, 1.500000) (Test,1)
+Not found.
+Error: unknown command [bogus]; type 'help' for commands
+Error: latitude not valid: [100]
+Error: usage: knn <lat> <lon> [<k>]
+Urban centers have at least (50) people.
+Smallton (Test)
+  ID:             2
+  Country:        Andorra
+  Province/State: 07
+  Population:     100
+  Coordinates:    42.510000, 1.520000
+  Cell:           12a5f52d394524ed (level 30)
+  Distance:       0.138 km
+Error: unterminated quote
+`
+
+	if output != expected {
+		t.Fatalf("Output not correct:\n%s", output)
+	}
+}
+
+func TestShell_Run_Cell(t *testing.T) {
+	output := runTestShell(`cell 12a5f52d394524ed
+cell 1
+cell 12a5f52d394524e3
+cell xyz
+`)
+
+	expected := `Cell [12a5f52d394524ed] level (30) centered at (42.510000, 1.520000)
+  1. Smallton, Andorra pop (100) leaf [12a5f52d394524ed] (Test,2)
+Cell [1] level (0) centered at (0.000000, 0.000000)
+Cells below the minimum search level (7) aren't indexed.
+Cell [12a5f52d394524e3] level (30) centered at (42.510000, 1.520000)
+No cities.
+Error: not a valid token: [xyz]
+`
+
+	if output != expected {
+		t.Fatalf("Output not correct:\n%s", output)
+	}
+}
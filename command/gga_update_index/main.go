@@ -0,0 +1,155 @@
+package main
+
+// Tool to apply the GeoNames daily modification and deletion files to an
+// existing city database.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+	"github.com/dsoprea/go-geographic-attractor/parse"
+)
+
+type parameters struct {
+	CountryDataFilepath  string `short:"c" long:"country-data-filepath" description:"GeoNames country-data file-path" required:"true"`
+	CityDatabaseFilepath string `long:"city-db-filepath" description:"File-path of the city database to update" required:"true"`
+	DeltaPath            string `short:"d" long:"delta-path" description:"Directory with the GeoNames \"modifications-YYYY-MM-DD.txt\" and \"deletes-YYYY-MM-DD.txt\" files. Days that were already applied are skipped." required:"true"`
+	Json                 bool   `short:"j" long:"json" description:"Print as JSON"`
+
+	// The modified cities are filtered the same way that the database was
+	// when it was built, so these should be the same as then.
+
+	IdList        []string `short:"i" long:"record-id" description:"Only cities with this ID (can be provided zero or more times)"`
+	Countries     []string `long:"country" description:"Only cities in this country, by name (can be provided zero or more times)"`
+	MinPopulation uint64   `long:"min-population" description:"Only cities with at least this population"`
+	MaxPopulation uint64   `long:"max-population" description:"Only cities with at most this population"`
+	BoundingBox   string   `long:"bbox" description:"Only cities within this box: 'min-lat,min-lon,max-lat,max-lon'. The box crosses the antimeridian if min-lon is greater than max-lon."`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+// getLoadOptions builds the filter from the arguments.
+func getLoadOptions() (options geoattractorindex.LoadOptions, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	filters := make([]geoattractorindex.LoadFilter, 0)
+
+	if len(arguments.IdList) > 0 {
+		filters = append(filters, geoattractorindex.NewIdFilter(arguments.IdList...))
+	}
+
+	if len(arguments.Countries) > 0 {
+		filters = append(filters, geoattractorindex.NewCountryFilter(arguments.Countries...))
+	}
+
+	if arguments.MinPopulation > 0 || arguments.MaxPopulation > 0 {
+		filters = append(filters, geoattractorindex.NewPopulationFilter(arguments.MinPopulation, arguments.MaxPopulation))
+	}
+
+	if arguments.BoundingBox != "" {
+		parts := strings.Split(arguments.BoundingBox, ",")
+		if len(parts) != 4 {
+			log.Panicf("bounding box is not exactly four parts: [%s]", arguments.BoundingBox)
+		}
+
+		box := make([]float64, 4)
+		for i, part := range parts {
+			box[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+			log.PanicIf(err)
+		}
+
+		filters = append(filters, geoattractorindex.NewBoundingBoxFilter(box[0], box[1], box[2], box[3]))
+	}
+
+	if len(filters) > 0 {
+		options.Filter = geoattractorindex.AllOf(filters...)
+	}
+
+	return options, nil
+}
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(arguments.CityDatabaseFilepath); err != nil {
+		log.Panicf("city database not found: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	gp, err := geoattractorparse.NewGeonamesParserWithFiles(arguments.CountryDataFilepath)
+	log.PanicIf(err)
+
+	ci := geoattractorindex.NewCityIndex(arguments.CityDatabaseFilepath, geoattractorindex.DefaultMinimumLevelForUrbanCenterAttraction, geoattractorindex.DefaultUrbanCenterMinimumPopulation)
+
+	defer ci.Close()
+
+	options, err := getLoadOptions()
+	log.PanicIf(err)
+
+	reports, err := ci.ApplyGeonamesDeltaDirectory(gp, arguments.DeltaPath, options)
+	log.PanicIf(err)
+
+	lastDate, err := ci.GetMetadata(geoattractorindex.GeonamesLastDeltaDateMetadataName)
+	if err != nil && err != geoattractorindex.ErrNotFound {
+		log.Panic(err)
+	}
+
+	if arguments.Json == true {
+		result := map[string]interface{}{
+			"Applied":  reports,
+			"LastDate": lastDate,
+		}
+
+		encoded, err := json.MarshalIndent(result, "", "  ")
+		log.PanicIf(err)
+
+		fmt.Println(string(encoded))
+
+		return
+	}
+
+	if len(reports) == 0 {
+		fmt.Printf("No new deltas to apply.\n")
+	}
+
+	for _, dr := range reports {
+		fmt.Printf("%s:\n", dr.Date)
+		fmt.Printf("\n")
+		fmt.Printf("  Modified rows: (%d)\n", dr.Modified)
+		fmt.Printf("  Upserted: (%d)\n", dr.Upserted)
+		fmt.Printf("  Removed (no longer a city): (%d)\n", dr.Removed)
+		fmt.Printf("  Filtered out: (%d)\n", dr.Filtered)
+		fmt.Printf("  Deleted: (%d)\n", dr.Deleted)
+		fmt.Printf("  Deletes not indexed: (%d)\n", dr.DeletesNotFound)
+		fmt.Printf("\n")
+	}
+
+	if lastDate != "" {
+		fmt.Printf("Last applied: %s\n", lastDate)
+	}
+}
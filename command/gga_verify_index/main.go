@@ -0,0 +1,110 @@
+package main
+
+// Tool to check a city database for inconsistencies and, optionally, repair
+// them.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+type parameters struct {
+	CityDatabaseFilepath string `long:"city-db-filepath" description:"File-path of the city database to verify" required:"true"`
+	MinimumLevel         int    `long:"minimum-level" description:"Minimum search level that the database was built with" default:"7"`
+	Repair               bool   `short:"r" long:"repair" description:"Delete undecodable values and bad entries and reindex cities that are missing levels. Unrecognized keys are left alone."`
+	Verbose              bool   `short:"v" long:"verbose" description:"Print every issue"`
+	Json                 bool   `short:"j" long:"json" description:"Print as JSON"`
+}
+
+var (
+	arguments = new(parameters)
+)
+
+func main() {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.PrintError(err)
+			os.Exit(1)
+		}
+	}()
+
+	p := flags.NewParser(arguments, flags.Default)
+
+	_, err := p.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(arguments.CityDatabaseFilepath); err != nil {
+		log.Panicf("city database not found: [%s]", arguments.CityDatabaseFilepath)
+	}
+
+	ci := geoattractorindex.NewCityIndex(arguments.CityDatabaseFilepath, arguments.MinimumLevel, geoattractorindex.DefaultUrbanCenterMinimumPopulation)
+
+	defer ci.Close()
+
+	report, err := ci.Verify(arguments.Repair)
+	log.PanicIf(err)
+
+	if arguments.Json == true {
+		encoded, err := json.MarshalIndent(report, "", "  ")
+		log.PanicIf(err)
+
+		fmt.Println(string(encoded))
+	} else {
+		fmt.Printf("Keys: (%d)\n", report.Keys)
+		fmt.Printf("Cities: (%d)\n", report.Cities)
+		fmt.Printf("Tokens: (%d)\n", report.Tokens)
+		fmt.Printf("Token entries: (%d)\n", report.Entries)
+		fmt.Printf("Metadata: (%d)\n", report.Metadata)
+		fmt.Printf("\n")
+
+		if report.IsConsistent() == true {
+			fmt.Printf("No issues found.\n")
+		} else {
+			fmt.Printf("Issues:\n")
+			fmt.Printf("\n")
+
+			for _, lt := range report.IssueCounts() {
+				fmt.Printf("> %s (%d)\n", lt.Name, lt.Count)
+			}
+
+			fmt.Printf("\n")
+
+			if arguments.Verbose == true {
+				for _, vi := range report.Issues {
+					fmt.Printf("%s: %s", vi.Kind, vi.Key)
+
+					if vi.IdPhrase != "" {
+						fmt.Printf(" [%s]", vi.IdPhrase)
+					}
+
+					if vi.Detail != "" {
+						fmt.Printf(": %s", vi.Detail)
+					}
+
+					fmt.Printf("\n")
+				}
+
+				fmt.Printf("\n")
+			}
+
+			if report.Repaired == true {
+				fmt.Printf("Repaired.\n")
+			}
+		}
+	}
+
+	// Let scripts tell whether the database needs attention.
+	if report.IsConsistent() == false && report.Repaired == false {
+		ci.Close()
+		os.Exit(2)
+	}
+}
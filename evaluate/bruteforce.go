@@ -0,0 +1,141 @@
+package geoattractorevaluate
+
+import (
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/golang/geo/s2"
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+// BruteForceIndex finds the nearest city by measuring the distance to every
+// city. It's slow but exact, which makes it the reference that `Nearest()` is
+// checked against.
+type BruteForceIndex struct {
+	cities []geoattractorindex.IndexedCity
+	points []*geo.Point
+
+	urbanCenterMinimumPopulation int
+	attractionRadiusKm           float64
+}
+
+// AttractionRadiusKm returns the average edge length of a cell at the given
+// level. `Nearest()` only sees the urban centers that share the cell at the
+// minimum search level with the point, so this is roughly how far away an
+// urban center can be and still attract it.
+func AttractionRadiusKm(minimumSearchLevel int) float64 {
+	return s2.AvgEdgeMetric.Value(minimumSearchLevel) * geo.EARTH_RADIUS
+}
+
+// NewBruteForceIndex returns a `BruteForceIndex` over the given cities. Cities
+// with at least `urbanCenterMinimumPopulation` people are preferred the same
+// way that `Nearest()` prefers them, but only within `attractionRadiusKm` (if
+// not zero).
+func NewBruteForceIndex(cities []geoattractorindex.IndexedCity, urbanCenterMinimumPopulation int, attractionRadiusKm float64) *BruteForceIndex {
+	points := make([]*geo.Point, len(cities))
+	for i, ic := range cities {
+		points[i] = geo.NewPoint(ic.City.Latitude, ic.City.Longitude)
+	}
+
+	return &BruteForceIndex{
+		cities:                       cities,
+		points:                       points,
+		urbanCenterMinimumPopulation: urbanCenterMinimumPopulation,
+		attractionRadiusKm:           attractionRadiusKm,
+	}
+}
+
+// LoadBruteForceIndex reads every city stored in the index and uses the same
+// urban-center threshold and an attraction radius that matches its minimum
+// search level.
+func LoadBruteForceIndex(ci *geoattractorindex.CityIndex) (bfi *BruteForceIndex, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cities := make([]geoattractorindex.IndexedCity, 0)
+
+	filter := geoattractorindex.InspectFilter{
+		Groups: []string{geoattractorindex.InspectGroupCity},
+	}
+
+	err = ci.Inspect(filter, func(item geoattractorindex.InspectItem) error {
+		// The name is the ID-phrase ("<source>,<ID>").
+		sourceName := strings.SplitN(item.Name, ",", 2)[0]
+
+		ic := geoattractorindex.IndexedCity{
+			SourceName: sourceName,
+			City:       *item.City,
+		}
+
+		cities = append(cities, ic)
+
+		return nil
+	})
+
+	log.PanicIf(err)
+
+	attractionRadiusKm := AttractionRadiusKm(ci.MinimumSearchLevel())
+
+	return NewBruteForceIndex(cities, ci.UrbanCenterMinimumPopulation(), attractionRadiusKm), nil
+}
+
+// Cities returns every city.
+func (bfi *BruteForceIndex) Cities() []geoattractorindex.IndexedCity {
+	return bfi.cities
+}
+
+// Nearest returns the nearest urban center within the attraction radius or, if
+// there are none, the nearest city. Returns `ErrNoNearestCity` if there are no
+// cities at all.
+func (bfi *BruteForceIndex) Nearest(latitude, longitude float64) (nc geoattractorindex.NearbyCity, err error) {
+	origin := geo.NewPoint(latitude, longitude)
+
+	nearestUrban := -1
+	nearestUrbanDistance := 0.0
+
+	nearestAny := -1
+	nearestAnyDistance := 0.0
+
+	for i, p := range bfi.points {
+		distance := origin.GreatCircleDistance(p)
+
+		if nearestAny == -1 || distance < nearestAnyDistance {
+			nearestAny = i
+			nearestAnyDistance = distance
+		}
+
+		if int(bfi.cities[i].City.Population) < bfi.urbanCenterMinimumPopulation {
+			continue
+		} else if bfi.attractionRadiusKm != 0 && distance > bfi.attractionRadiusKm {
+			continue
+		}
+
+		if nearestUrban == -1 || distance < nearestUrbanDistance {
+			nearestUrban = i
+			nearestUrbanDistance = distance
+		}
+	}
+
+	if nearestUrban != -1 {
+		nc = geoattractorindex.NearbyCity{
+			IndexedCity: bfi.cities[nearestUrban],
+			DistanceKm:  nearestUrbanDistance,
+		}
+
+		return nc, nil
+	} else if nearestAny != -1 {
+		nc = geoattractorindex.NearbyCity{
+			IndexedCity: bfi.cities[nearestAny],
+			DistanceKm:  nearestAnyDistance,
+		}
+
+		return nc, nil
+	}
+
+	return nc, geoattractorindex.ErrNoNearestCity
+}
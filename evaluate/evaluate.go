@@ -0,0 +1,347 @@
+package geoattractorevaluate
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/kellydunn/golang-geo"
+	"github.com/randomingenuity/go-utility/geographic"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+const (
+	// DefaultLatitudeBandSize is the size of the latitude bands, in degrees, if
+	// `EvaluatorConfig.LatitudeBandSize` isn't set.
+	DefaultLatitudeBandSize = 15.0
+
+	// DefaultWorstCount is the number of largest disagreements reported if
+	// `EvaluatorConfig.WorstCount` isn't set.
+	DefaultWorstCount = 10
+
+	// DifferentFace is the shared level of a point and city on different S2
+	// cube faces.
+	DifferentFace = -1
+)
+
+var (
+	// reportedPercentiles are the distance-error percentiles in the report.
+	reportedPercentiles = []float64{50, 90, 95, 99, 100}
+)
+
+// EvaluatorConfig configures an `Evaluator`.
+type EvaluatorConfig struct {
+	Index      *geoattractorindex.CityIndex
+	BruteForce *BruteForceIndex
+
+	// LatitudeBandSize is the size of the latitude bands in the report, in
+	// degrees.
+	LatitudeBandSize float64
+
+	// WorstCount is the number of largest disagreements to report.
+	WorstCount int
+}
+
+// Evaluator compares `Nearest()` against the brute-force answer.
+type Evaluator struct {
+	config EvaluatorConfig
+}
+
+// NewEvaluator returns an `Evaluator`.
+func NewEvaluator(config EvaluatorConfig) *Evaluator {
+	if config.LatitudeBandSize <= 0 {
+		config.LatitudeBandSize = DefaultLatitudeBandSize
+	}
+
+	if config.WorstCount <= 0 {
+		config.WorstCount = DefaultWorstCount
+	}
+
+	return &Evaluator{
+		config: config,
+	}
+}
+
+// Comparison is the two answers for one point. `ErrorKm` is how much farther
+// the index's answer is than the brute-force answer (negative if the index
+// returned a smaller, nearer city instead of an urban center).
+type Comparison struct {
+	Point geoattractorindex.Coordinate `json:"point"`
+
+	Index      geoattractorindex.NearbyCity `json:"index"`
+	BruteForce geoattractorindex.NearbyCity `json:"brute_force"`
+
+	Agrees  bool    `json:"agrees"`
+	ErrorKm float64 `json:"error_km"`
+
+	// SharedLevel is the level of the smallest S2 cell that contains both the
+	// point and the brute-force answer. Below the index's minimum search level
+	// the index can't see the answer at all. It's `DifferentFace` if they're
+	// on different cube faces and so share no cell.
+	SharedLevel int `json:"shared_level"`
+}
+
+// Percentile is the distance error that the given percentage of the points
+// are at or under.
+type Percentile struct {
+	Percentile float64 `json:"percentile"`
+	ErrorKm    float64 `json:"error_km"`
+}
+
+// Breakdown summarizes the points in one latitude band or at one level.
+type Breakdown struct {
+	// Name is the band ("-15..0") or level ("7").
+	Name string `json:"name"`
+
+	Points        int     `json:"points"`
+	Agreements    int     `json:"agreements"`
+	AgreementRate float64 `json:"agreement_rate"`
+	MeanErrorKm   float64 `json:"mean_error_km"`
+}
+
+func (b *Breakdown) add(c Comparison) {
+	b.Points++
+	if c.Agrees == true {
+		b.Agreements++
+	}
+
+	// Keep a running mean.
+	b.MeanErrorKm += (math.Abs(c.ErrorKm) - b.MeanErrorKm) / float64(b.Points)
+	b.AgreementRate = float64(b.Agreements) / float64(b.Points)
+}
+
+// EvaluationReport describes how well `Nearest()` agreed with the brute-force
+// answer.
+type EvaluationReport struct {
+	Points int `json:"points"`
+
+	// Unanswered is the number of points that the index returned nothing for
+	// although there's a brute-force answer.
+	Unanswered int `json:"unanswered"`
+
+	// Compared is the number of points with both answers.
+	Compared      int     `json:"compared"`
+	Agreements    int     `json:"agreements"`
+	AgreementRate float64 `json:"agreement_rate"`
+
+	// ErrorPercentiles are over the absolute distance errors of every compared
+	// point (zero where they agree).
+	ErrorPercentiles []Percentile `json:"error_percentiles"`
+	MeanErrorKm      float64      `json:"mean_error_km"`
+
+	ByLatitudeBand []Breakdown `json:"by_latitude_band"`
+	BySharedLevel  []Breakdown `json:"by_shared_level"`
+
+	// Worst are the largest disagreements, largest first.
+	Worst []Comparison `json:"worst"`
+}
+
+func (er EvaluationReport) String() string {
+	return fmt.Sprintf("EvaluationReport<POINTS=(%d) COMPARED=(%d) AGREEMENTS=(%d) RATE=(%.4f) MEAN-ERROR-KM=(%.3f)>", er.Points, er.Compared, er.Agreements, er.AgreementRate, er.MeanErrorKm)
+}
+
+// Compare returns both answers for one point. `indexFound` and
+// `bruteForceFound` are false for whichever didn't return anything.
+func (ev *Evaluator) Compare(latitude, longitude float64) (c Comparison, indexFound, bruteForceFound bool, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	c.Point = geoattractorindex.Coordinate{
+		Latitude:  latitude,
+		Longitude: longitude,
+	}
+
+	bruteForce, err := ev.config.BruteForce.Nearest(latitude, longitude)
+	if err == nil {
+		c.BruteForce = bruteForce
+		bruteForceFound = true
+	} else if log.Is(err, geoattractorindex.ErrNoNearestCity) == false {
+		log.Panic(err)
+	}
+
+	sourceName, _, cr, err := ev.config.Index.Nearest(latitude, longitude, false)
+	if err == nil {
+		origin := geo.NewPoint(latitude, longitude)
+
+		c.Index = geoattractorindex.NearbyCity{
+			IndexedCity: geoattractorindex.IndexedCity{
+				SourceName: sourceName,
+				City:       cr,
+			},
+			DistanceKm: origin.GreatCircleDistance(geo.NewPoint(cr.Latitude, cr.Longitude)),
+		}
+
+		indexFound = true
+	} else if log.Is(err, geoattractorindex.ErrNoNearestCity) == false {
+		log.Panic(err)
+	}
+
+	if indexFound == false || bruteForceFound == false {
+		return c, indexFound, bruteForceFound, nil
+	}
+
+	c.Agrees = c.Index.SourceName == c.BruteForce.SourceName && c.Index.City.Id == c.BruteForce.City.Id
+	if c.Agrees == false {
+		c.ErrorKm = c.Index.DistanceKm - c.BruteForce.DistanceKm
+	}
+
+	pointCellId := rigeo.S2CellFromCoordinates(latitude, longitude)
+	cityCellId := c.BruteForce.City.S2Cell()
+
+	c.SharedLevel = DifferentFace
+	for level := pointCellId.Level(); level >= 0; level-- {
+		if pointCellId.Parent(level) == cityCellId.Parent(level) {
+			c.SharedLevel = level
+			break
+		}
+	}
+
+	return c, true, true, nil
+}
+
+// percentile returns the value at the given percentile of the sorted values
+// (nearest rank).
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0.0
+	}
+
+	rank := int(math.Ceil(p/100.0*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+// Evaluate compares the answers for every point. Points that neither returns
+// anything for are only counted.
+func (ev *Evaluator) Evaluate(points []geoattractorindex.Coordinate) (report EvaluationReport, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	report.Points = len(points)
+
+	errorsKm := make([]float64, 0, len(points))
+	disagreements := make([]Comparison, 0)
+
+	bands := make(map[int]*Breakdown)
+	levels := make(map[int]*Breakdown)
+
+	for _, point := range points {
+		c, indexFound, bruteForceFound, err := ev.Compare(point.Latitude, point.Longitude)
+		log.PanicIf(err)
+
+		if bruteForceFound == false {
+			continue
+		} else if indexFound == false {
+			report.Unanswered++
+			continue
+		}
+
+		report.Compared++
+		if c.Agrees == true {
+			report.Agreements++
+		} else {
+			disagreements = append(disagreements, c)
+		}
+
+		absoluteError := math.Abs(c.ErrorKm)
+		errorsKm = append(errorsKm, absoluteError)
+		report.MeanErrorKm += absoluteError
+
+		// Latitude band. The north pole goes in the last band.
+
+		band := int(math.Floor((point.Latitude + 90.0) / ev.config.LatitudeBandSize))
+		if float64(band)*ev.config.LatitudeBandSize >= 180.0 {
+			band--
+		}
+
+		b, found := bands[band]
+		if found == false {
+			minLatitude := -90.0 + float64(band)*ev.config.LatitudeBandSize
+			maxLatitude := math.Min(minLatitude+ev.config.LatitudeBandSize, 90.0)
+
+			b = &Breakdown{
+				Name: fmt.Sprintf("%g..%g", minLatitude, maxLatitude),
+			}
+
+			bands[band] = b
+		}
+
+		b.add(c)
+
+		// Shared level.
+
+		b, found = levels[c.SharedLevel]
+		if found == false {
+			name := fmt.Sprintf("%d", c.SharedLevel)
+			if c.SharedLevel == DifferentFace {
+				name = "different face"
+			}
+
+			b = &Breakdown{
+				Name: name,
+			}
+
+			levels[c.SharedLevel] = b
+		}
+
+		b.add(c)
+	}
+
+	if report.Compared > 0 {
+		report.AgreementRate = float64(report.Agreements) / float64(report.Compared)
+		report.MeanErrorKm /= float64(report.Compared)
+	}
+
+	sort.Float64s(errorsKm)
+
+	report.ErrorPercentiles = make([]Percentile, len(reportedPercentiles))
+	for i, p := range reportedPercentiles {
+		report.ErrorPercentiles[i] = Percentile{
+			Percentile: p,
+			ErrorKm:    percentile(errorsKm, p),
+		}
+	}
+
+	report.ByLatitudeBand = sortedBreakdowns(bands)
+	report.BySharedLevel = sortedBreakdowns(levels)
+
+	sort.SliceStable(disagreements, func(i, j int) bool {
+		return math.Abs(disagreements[i].ErrorKm) > math.Abs(disagreements[j].ErrorKm)
+	})
+
+	if len(disagreements) > ev.config.WorstCount {
+		disagreements = disagreements[:ev.config.WorstCount]
+	}
+
+	report.Worst = disagreements
+
+	return report, nil
+}
+
+// sortedBreakdowns returns the breakdowns in the order of their keys.
+func sortedBreakdowns(breakdowns map[int]*Breakdown) []Breakdown {
+	keys := make([]int, 0, len(breakdowns))
+	for key := range breakdowns {
+		keys = append(keys, key)
+	}
+
+	sort.Ints(keys)
+
+	sorted := make([]Breakdown, len(keys))
+	for i, key := range keys {
+		sorted[i] = *breakdowns[key]
+	}
+
+	return sorted
+}
@@ -0,0 +1,292 @@
+package geoattractorevaluate
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/index"
+	"github.com/dsoprea/go-geographic-attractor/synthetic"
+)
+
+func getTestCity(id string, population uint64, latitude, longitude float64) geoattractorindex.IndexedCity {
+	return geoattractorindex.IndexedCity{
+		SourceName: "Test",
+		City: geoattractor.CityRecord{
+			Id:         id,
+			Population: population,
+			Latitude:   latitude,
+			Longitude:  longitude,
+		},
+	}
+}
+
+func TestBruteForceIndex_Nearest(t *testing.T) {
+	cities := []geoattractorindex.IndexedCity{
+		getTestCity("small", 10, 0.0, 0.1),
+		getTestCity("large", 1000, 0.0, 1.0),
+		getTestCity("larger", 2000, 0.0, 2.0),
+	}
+
+	bfi := NewBruteForceIndex(cities, 100, 0)
+
+	nc, err := bfi.Nearest(0.0, 0.0)
+	log.PanicIf(err)
+
+	// The urban center is preferred over the nearer small city.
+	if nc.City.Id != "large" {
+		t.Fatalf("Expected the nearest urban center: %v", nc)
+	}
+
+	expectedKm := geo.NewPoint(0.0, 0.0).GreatCircleDistance(geo.NewPoint(0.0, 1.0))
+	if nc.DistanceKm != expectedKm {
+		t.Fatalf("Distance not correct: (%f) != (%f)", nc.DistanceKm, expectedKm)
+	}
+
+	// Without urban centers, the nearest city wins.
+
+	bfi = NewBruteForceIndex(cities, 1000000, 0)
+
+	nc, err = bfi.Nearest(0.0, 0.0)
+	log.PanicIf(err)
+
+	if nc.City.Id != "small" {
+		t.Fatalf("Expected the nearest city: %v", nc)
+	}
+
+	// Urban centers beyond the attraction radius don't attract.
+
+	bfi = NewBruteForceIndex(cities, 100, 50.0)
+
+	nc, err = bfi.Nearest(0.0, 0.0)
+	log.PanicIf(err)
+
+	if nc.City.Id != "small" {
+		t.Fatalf("Expected the nearest city outside of the radius: %v", nc)
+	}
+
+	_, err = NewBruteForceIndex(nil, 0, 0).Nearest(0.0, 0.0)
+	if err != geoattractorindex.ErrNoNearestCity {
+		t.Fatalf("Expected no-nearest-city: %v", err)
+	}
+}
+
+func TestLoadBruteForceIndex(t *testing.T) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	bfi, err := LoadBruteForceIndex(ci)
+	log.PanicIf(err)
+
+	if len(bfi.Cities()) != 35 {
+		t.Fatalf("Expected every city: (%d)", len(bfi.Cities()))
+	}
+
+	nc, err := bfi.Nearest(25.2048, 55.2708)
+	log.PanicIf(err)
+
+	if nc.City.Id != "292223" || nc.SourceName != "GeoNames" {
+		t.Fatalf("Expected Dubai: %v", nc)
+	}
+}
+
+func TestRandomPoints(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	points := RandomPoints(rng, 1000, 10.0, 170.0, 20.0, -170.0)
+	if len(points) != 1000 {
+		t.Fatalf("Expected (1000) points: (%d)", len(points))
+	}
+
+	for _, point := range points {
+		if point.Latitude < 10.0 || point.Latitude > 20.0 {
+			t.Fatalf("Latitude out of the box: %v", point)
+		} else if point.Longitude > -170.0 && point.Longitude < 170.0 {
+			t.Fatalf("Longitude out of the box: %v", point)
+		}
+	}
+}
+
+func TestPointsNearCities(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	cities := []geoattractorindex.IndexedCity{
+		getTestCity("a", 10, 42.5, 1.5),
+		getTestCity("b", 10, -18.1, 179.9),
+	}
+
+	points := PointsNearCities(rng, 500, cities, 5.0)
+	if len(points) != 500 {
+		t.Fatalf("Expected (500) points: (%d)", len(points))
+	}
+
+	for _, point := range points {
+		p := geo.NewPoint(point.Latitude, point.Longitude)
+
+		nearestKm := math.Inf(1)
+		for _, ic := range cities {
+			distanceKm := p.GreatCircleDistance(geo.NewPoint(ic.City.Latitude, ic.City.Longitude))
+			nearestKm = math.Min(nearestKm, distanceKm)
+		}
+
+		if nearestKm > 5.001 {
+			t.Fatalf("Point too far from every city: %v (%f)", point, nearestKm)
+		} else if point.Longitude < -180.0 || point.Longitude > 180.0 {
+			t.Fatalf("Longitude not normalized: %v", point)
+		}
+	}
+}
+
+func TestEvaluator_Evaluate(t *testing.T) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	bfi, err := LoadBruteForceIndex(ci)
+	log.PanicIf(err)
+
+	config := EvaluatorConfig{
+		Index:      ci,
+		BruteForce: bfi,
+		WorstCount: 3,
+	}
+
+	ev := NewEvaluator(config)
+
+	rng := rand.New(rand.NewSource(1))
+	points := PointsNearCities(rng, 300, bfi.Cities(), 30.0)
+
+	report, err := ev.Evaluate(points)
+	log.PanicIf(err)
+
+	if report.Points != 300 || report.Compared+report.Unanswered != 300 {
+		t.Fatalf("Counts not correct: %s", report)
+	} else if report.Agreements == 0 || report.Agreements > report.Compared {
+		t.Fatalf("Agreements not correct: %s", report)
+	}
+
+	expectedRate := float64(report.Agreements) / float64(report.Compared)
+	if report.AgreementRate != expectedRate {
+		t.Fatalf("Rate not correct: (%f) != (%f)", report.AgreementRate, expectedRate)
+	}
+
+	// The percentiles don't decrease.
+
+	if len(report.ErrorPercentiles) != len(reportedPercentiles) {
+		t.Fatalf("Percentiles not correct: %v", report.ErrorPercentiles)
+	}
+
+	for i := 1; i < len(report.ErrorPercentiles); i++ {
+		if report.ErrorPercentiles[i].ErrorKm < report.ErrorPercentiles[i-1].ErrorKm {
+			t.Fatalf("Percentiles not monotonic: %v", report.ErrorPercentiles)
+		}
+	}
+
+	// The breakdowns account for every compared point.
+
+	for _, breakdowns := range [][]Breakdown{report.ByLatitudeBand, report.BySharedLevel} {
+		total := 0
+		agreements := 0
+		for _, b := range breakdowns {
+			total += b.Points
+			agreements += b.Agreements
+		}
+
+		if total != report.Compared || agreements != report.Agreements {
+			t.Fatalf("Breakdown doesn't add up: %v", breakdowns)
+		}
+	}
+
+	if len(report.Worst) > 3 {
+		t.Fatalf("Too many of the worst: (%d)", len(report.Worst))
+	}
+
+	for i, c := range report.Worst {
+		if c.Agrees == true {
+			t.Fatalf("Agreement reported as a disagreement: %v", c)
+		} else if i > 0 && math.Abs(c.ErrorKm) > math.Abs(report.Worst[i-1].ErrorKm) {
+			t.Fatalf("Worst not sorted.")
+		}
+	}
+}
+
+func TestEvaluator_Compare_AtUrbanCenter(t *testing.T) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	bfi, err := LoadBruteForceIndex(ci)
+	log.PanicIf(err)
+
+	ev := NewEvaluator(EvaluatorConfig{Index: ci, BruteForce: bfi})
+
+	// Dubai itself.
+	c, indexFound, bruteForceFound, err := ev.Compare(25.0657, 55.17128)
+	log.PanicIf(err)
+
+	if indexFound != true || bruteForceFound != true {
+		t.Fatalf("Expected both answers.")
+	} else if c.Agrees != true || c.ErrorKm != 0 {
+		t.Fatalf("Expected agreement: %v", c)
+	} else if c.SharedLevel != 30 {
+		t.Fatalf("Shared level not correct: (%d)", c.SharedLevel)
+	}
+
+	// Nothing nearby for the index, but the brute force always has an answer.
+
+	_, indexFound, bruteForceFound, err = ev.Compare(-45.0, -120.0)
+	log.PanicIf(err)
+
+	if indexFound != false || bruteForceFound != true {
+		t.Fatalf("Expected only the brute-force answer.")
+	}
+}
+
+func TestEvaluator_Compare_DifferentFace(t *testing.T) {
+	// The nearest city is just across the boundary between the first two cube
+	// faces, so the index can only find the one on the point's side.
+	records := []geoattractor.CityRecord{
+		{Id: "1", Country: "Nowhere", City: "Edgeton", Population: 500000, Latitude: 0.5, Longitude: 45.01},
+		{Id: "2", Country: "Nowhere", City: "Nearside", Population: 500000, Latitude: 0.5, Longitude: 44.9},
+	}
+
+	ci, kvFilepath := geoattractorindex.NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	_, err := ci.Load(geoattractorsynthetic.NewRecordSource("Test", records), nil, geoattractorindex.LoadOptions{})
+	log.PanicIf(err)
+
+	bfi, err := LoadBruteForceIndex(ci)
+	log.PanicIf(err)
+
+	ev := NewEvaluator(EvaluatorConfig{Index: ci, BruteForce: bfi})
+
+	c, indexFound, bruteForceFound, err := ev.Compare(0.5, 44.99)
+	log.PanicIf(err)
+
+	if indexFound != true || bruteForceFound != true {
+		t.Fatalf("Expected both answers.")
+	} else if c.Agrees != false || c.BruteForce.City.Id != "1" {
+		t.Fatalf("Expected the brute force to find the city across the edge: %v", c)
+	} else if c.SharedLevel != DifferentFace {
+		t.Fatalf("Shared level not correct: (%d)", c.SharedLevel)
+	}
+
+	report, err := ev.Evaluate([]geoattractorindex.Coordinate{{Latitude: 0.5, Longitude: 44.99}})
+	log.PanicIf(err)
+
+	if len(report.BySharedLevel) != 1 || report.BySharedLevel[0].Name != "different face" {
+		t.Fatalf("Shared-level breakdown not correct: %v", report.BySharedLevel)
+	}
+}
@@ -0,0 +1,74 @@
+package geoattractorevaluate
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+// RandomPoints returns points spread evenly over the surface within the box
+// (not evenly over latitude, which would crowd the poles). If the minimum
+// longitude is greater than the maximum, the box crosses the antimeridian.
+func RandomPoints(rng *rand.Rand, count int, minLatitude, minLongitude, maxLatitude, maxLongitude float64) []geoattractorindex.Coordinate {
+	minZ := math.Sin(minLatitude * math.Pi / 180.0)
+	maxZ := math.Sin(maxLatitude * math.Pi / 180.0)
+
+	longitudeSpan := maxLongitude - minLongitude
+	if longitudeSpan < 0 {
+		longitudeSpan += 360.0
+	}
+
+	points := make([]geoattractorindex.Coordinate, count)
+	for i := range points {
+		z := minZ + rng.Float64()*(maxZ-minZ)
+
+		longitude := minLongitude + rng.Float64()*longitudeSpan
+		if longitude > 180.0 {
+			longitude -= 360.0
+		}
+
+		points[i] = geoattractorindex.Coordinate{
+			Latitude:  math.Asin(z) * 180.0 / math.Pi,
+			Longitude: longitude,
+		}
+	}
+
+	return points
+}
+
+// PointsNearCities returns points within `radiusKm` of randomly-chosen cities.
+// Since most of the world has no cities, this exercises the index far more than
+// `RandomPoints()` does.
+func PointsNearCities(rng *rand.Rand, count int, cities []geoattractorindex.IndexedCity, radiusKm float64) []geoattractorindex.Coordinate {
+	points := make([]geoattractorindex.Coordinate, 0, count)
+	if len(cities) == 0 {
+		return points
+	}
+
+	for i := 0; i < count; i++ {
+		cr := cities[rng.Intn(len(cities))].City
+
+		origin := s2.LatLngFromDegrees(cr.Latitude, cr.Longitude)
+
+		// Pick a distance that's even over the area of the disc and a heading.
+		distance := s1.Angle(radiusKm * math.Sqrt(rng.Float64()) / geo.EARTH_RADIUS)
+		heading := rng.Float64() * 2.0 * math.Pi
+
+		ll := geoattractor.Destination(origin, distance, heading)
+
+		point := geoattractorindex.Coordinate{
+			Latitude:  ll.Lat.Degrees(),
+			Longitude: ll.Lng.Degrees(),
+		}
+
+		points = append(points, point)
+	}
+
+	return points
+}
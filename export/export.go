@@ -0,0 +1,363 @@
+package geoattractorexport
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/golang/geo/r1"
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+const (
+	// DefaultMaxCells is the most cells that `AttractionMap()` resolves if a
+	// limit isn't given.
+	DefaultMaxCells = 10000
+)
+
+var (
+	// ErrTooManyCells is returned when a region is covered by more cells than
+	// allowed at the requested level.
+	ErrTooManyCells = errors.New("too many cells")
+
+	// ErrInvalidBounds is returned when a box is out of range or its minimum
+	// latitude is greater than its maximum.
+	ErrInvalidBounds = errors.New("invalid bounds")
+)
+
+// Feature is one shape to export, along with what to label it with. Exactly
+// one of `Point` and `Polygon` is set.
+type Feature struct {
+	Name        string
+	Description string
+
+	Point *geoattractorindex.Coordinate
+
+	// Polygon is a closed ring (the first vertex is repeated at the end).
+	Polygon []geoattractorindex.Coordinate
+
+	// Color is an "#rrggbb" fill color, if any.
+	Color string
+
+	// Properties are exported as GeoJSON properties and as KML extended data.
+	Properties map[string]interface{}
+}
+
+// CellPolygon returns the outline of the cell as a closed ring.
+func CellPolygon(cellId s2.CellID) []geoattractorindex.Coordinate {
+	cell := s2.CellFromCellID(cellId)
+
+	ring := make([]geoattractorindex.Coordinate, 5)
+	for i := 0; i < 4; i++ {
+		ll := s2.LatLngFromPoint(cell.Vertex(i))
+
+		ring[i] = geoattractorindex.Coordinate{
+			Latitude:  ll.Lat.Degrees(),
+			Longitude: ll.Lng.Degrees(),
+		}
+	}
+
+	ring[4] = ring[0]
+
+	return ring
+}
+
+// cityPointFeature returns a point for the city.
+func cityPointFeature(sourceName string, cr geoattractor.CityRecord, role string) Feature {
+	return Feature{
+		Name:        cr.City,
+		Description: fmt.Sprintf("%s, %s (%d people)", cr.City, cr.Country, cr.Population),
+		Point: &geoattractorindex.Coordinate{
+			Latitude:  cr.Latitude,
+			Longitude: cr.Longitude,
+		},
+		Properties: map[string]interface{}{
+			"role":       role,
+			"source":     sourceName,
+			"id":         cr.Id,
+			"city":       cr.City,
+			"country":    cr.Country,
+			"population": cr.Population,
+		},
+	}
+}
+
+// VisitedCells returns the cells that `Nearest()` visits for the given point,
+// from the smallest outward, each labeled with the cities found in it. The
+// point that was queried and the city that it resolved to are included as
+// points.
+func VisitedCells(ci *geoattractorindex.CityIndex, latitude, longitude float64) (features []Feature, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sourceName, visits, cr, err := ci.Nearest(latitude, longitude, true)
+	log.PanicIf(err)
+
+	features = make([]Feature, 0)
+
+	// The visits are grouped by token, in the order visited.
+
+	tokens := make([]string, 0)
+	citiesByToken := make(map[string][]geoattractorindex.VisitHistoryItem)
+
+	for _, vhi := range visits {
+		if _, found := citiesByToken[vhi.Token]; found == false {
+			tokens = append(tokens, vhi.Token)
+		}
+
+		citiesByToken[vhi.Token] = append(citiesByToken[vhi.Token], vhi)
+	}
+
+	for _, token := range tokens {
+		cellId := s2.CellIDFromToken(token)
+
+		names := make([]string, 0)
+		ids := make([]string, 0)
+
+		for _, vhi := range citiesByToken[token] {
+			names = append(names, vhi.City.City)
+			ids = append(ids, geoattractorindex.IdPhrase(vhi.SourceName, vhi.City.Id))
+		}
+
+		feature := Feature{
+			Name:        fmt.Sprintf("Level %d [%s]", cellId.Level(), token),
+			Description: strings.Join(names, ", "),
+			Polygon:     CellPolygon(cellId),
+			Properties: map[string]interface{}{
+				"role":   "visited",
+				"token":  token,
+				"level":  cellId.Level(),
+				"cities": names,
+				"ids":    ids,
+			},
+		}
+
+		features = append(features, feature)
+	}
+
+	query := Feature{
+		Name:        "Query",
+		Description: fmt.Sprintf("(%.6f, %.6f)", latitude, longitude),
+		Point: &geoattractorindex.Coordinate{
+			Latitude:  latitude,
+			Longitude: longitude,
+		},
+		Properties: map[string]interface{}{
+			"role": "query",
+		},
+	}
+
+	features = append(features, query, cityPointFeature(sourceName, cr, "result"))
+
+	return features, nil
+}
+
+// colorFor returns a stable color for the given name.
+func colorFor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+
+	sum := h.Sum32()
+
+	// Keep the channels away from black and white.
+	r := 0x40 + (sum>>16)&0x7f
+	g := 0x40 + (sum>>8)&0x7f
+	b := 0x40 + sum&0x7f
+
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// minimumCellCount returns a lower bound on the number of cells at the given
+// level that it takes to cover the rect: no cell has more than the maximum
+// area and no cell spans more than the maximum diagonal, so a long and thin
+// rect is counted by its length rather than its area.
+func minimumCellCount(rect s2.Rect, level int) float64 {
+	byArea := rect.Area() / s2.MaxAreaMetric.Value(level)
+
+	// The longest parallel in the rect is the one nearest the equator.
+	nearestEquator := 0.0
+	if rect.Lat.Lo > 0 {
+		nearestEquator = rect.Lat.Lo
+	} else if rect.Lat.Hi < 0 {
+		nearestEquator = -rect.Lat.Hi
+	}
+
+	length := math.Max(rect.Lat.Length(), rect.Lng.Length()*math.Cos(nearestEquator))
+	byLength := length / s2.MaxDiagMetric.Value(level)
+
+	return math.Max(byArea, byLength)
+}
+
+// validBounds returns whether the box is in range and its latitudes are in
+// order. The longitudes may be in either order.
+func validBounds(minLatitude, minLongitude, maxLatitude, maxLongitude float64) bool {
+	for _, latitude := range []float64{minLatitude, maxLatitude} {
+		if (latitude >= -90.0 && latitude <= 90.0) == false {
+			return false
+		}
+	}
+
+	for _, longitude := range []float64{minLongitude, maxLongitude} {
+		if (longitude >= -180.0 && longitude <= 180.0) == false {
+			return false
+		}
+	}
+
+	return minLatitude <= maxLatitude
+}
+
+// AttractionMap covers the box with cells at the given level and resolves the
+// center of each with `Nearest()`. Each cell is labeled, and colored, with the
+// city that it resolves to; cells that don't resolve to anything are labeled
+// as such and not colored. One point per city that was resolved to is
+// included. If the box crosses the antimeridian, the minimum longitude is
+// greater than the maximum. If more than `maxCells` cells would be needed,
+// `ErrTooManyCells` is returned (zero means `DefaultMaxCells`). A box that's
+// out of range or upside down returns `ErrInvalidBounds`.
+func AttractionMap(ci *geoattractorindex.CityIndex, minLatitude, minLongitude, maxLatitude, maxLongitude float64, level int, maxCells int) (features []Feature, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if maxCells <= 0 {
+		maxCells = DefaultMaxCells
+	}
+
+	if level < 0 || level > 30 {
+		log.Panicf("level not valid: (%d)", level)
+	}
+
+	if validBounds(minLatitude, minLongitude, maxLatitude, maxLongitude) == false {
+		log.Panicf("%s: (%f, %f) to (%f, %f)", ErrInvalidBounds, minLatitude, minLongitude, maxLatitude, maxLongitude)
+	}
+
+	// An inverted longitude interval is one that crosses the antimeridian.
+	rect := s2.Rect{
+		Lat: r1.Interval{Lo: minLatitude * math.Pi / 180.0, Hi: maxLatitude * math.Pi / 180.0},
+		Lng: s1.IntervalFromEndpoints(minLongitude*math.Pi/180.0, maxLongitude*math.Pi/180.0),
+	}
+
+	// Covering enumerates every cell, so refuse a region that's certainly too
+	// large before doing it.
+	if minimum := minimumCellCount(rect, level); minimum > float64(maxCells) {
+		log.Panicf("%s: at least (%.0f) at level (%d)", ErrTooManyCells, minimum, level)
+	}
+
+	rc := &s2.RegionCoverer{
+		MinLevel: level,
+		MaxLevel: level,
+		MaxCells: maxCells + 1,
+	}
+
+	cellIds := make([]s2.CellID, 0)
+	for _, cellId := range rc.Covering(rect) {
+		// The covering might have been normalized into larger cells.
+		if cellId.Level() == level {
+			cellIds = append(cellIds, cellId)
+		} else {
+			end := cellId.ChildEndAtLevel(level)
+			for child := cellId.ChildBeginAtLevel(level); child != end; child = child.Next() {
+				cellIds = append(cellIds, child)
+			}
+		}
+
+		if len(cellIds) > maxCells {
+			log.Panicf("%s: more than (%d) at level (%d)", ErrTooManyCells, maxCells, level)
+		}
+	}
+
+	features = make([]Feature, 0, len(cellIds))
+
+	type resolvedCity struct {
+		sourceName string
+		cr         geoattractor.CityRecord
+		cells      int
+	}
+
+	resolved := make(map[string]*resolvedCity)
+
+	for _, cellId := range cellIds {
+		center := cellId.LatLng()
+
+		feature := Feature{
+			Polygon: CellPolygon(cellId),
+			Properties: map[string]interface{}{
+				"role":  "cell",
+				"token": cellId.ToToken(),
+				"level": level,
+			},
+		}
+
+		sourceName, _, cr, err := ci.Nearest(center.Lat.Degrees(), center.Lng.Degrees(), false)
+		if err != nil {
+			if log.Is(err, geoattractorindex.ErrNoNearestCity) == false {
+				log.Panic(err)
+			}
+
+			feature.Name = cellId.ToToken()
+			feature.Description = "No city"
+
+			features = append(features, feature)
+
+			continue
+		}
+
+		idPhrase := geoattractorindex.IdPhrase(sourceName, cr.Id)
+
+		city, found := resolved[idPhrase]
+		if found == false {
+			city = &resolvedCity{
+				sourceName: sourceName,
+				cr:         cr,
+			}
+
+			resolved[idPhrase] = city
+		}
+
+		city.cells++
+
+		feature.Name = cr.City
+		feature.Description = fmt.Sprintf("[%s] resolves to %s, %s", cellId.ToToken(), cr.City, cr.Country)
+		feature.Color = colorFor(idPhrase)
+		feature.Properties["source"] = sourceName
+		feature.Properties["id"] = cr.Id
+		feature.Properties["city"] = cr.City
+		feature.Properties["country"] = cr.Country
+
+		features = append(features, feature)
+	}
+
+	// Add the cities in a stable order.
+
+	idPhrases := make([]string, 0, len(resolved))
+	for idPhrase := range resolved {
+		idPhrases = append(idPhrases, idPhrase)
+	}
+
+	sort.Strings(idPhrases)
+
+	for _, idPhrase := range idPhrases {
+		city := resolved[idPhrase]
+
+		feature := cityPointFeature(city.sourceName, city.cr, "city")
+		feature.Color = colorFor(idPhrase)
+		feature.Properties["cells"] = city.cells
+
+		features = append(features, feature)
+	}
+
+	return features, nil
+}
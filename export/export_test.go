@@ -0,0 +1,336 @@
+package geoattractorexport
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"encoding/json"
+	"encoding/xml"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/golang/geo/s2"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+func TestCellPolygon(t *testing.T) {
+	cellId := s2.CellIDFromToken("3e5f5")
+
+	ring := CellPolygon(cellId)
+
+	if len(ring) != 5 {
+		t.Fatalf("Expected a closed ring of four vertices: (%d)", len(ring))
+	} else if ring[0] != ring[4] {
+		t.Fatalf("Ring not closed.")
+	}
+
+	// Every vertex is on the cell (the center of the cell is inside).
+	center := cellId.LatLng()
+	for _, c := range ring[:4] {
+		if c.Latitude < center.Lat.Degrees()-1.0 || c.Latitude > center.Lat.Degrees()+1.0 {
+			t.Fatalf("Vertex too far from the center: %v", c)
+		}
+	}
+}
+
+func TestVisitedCells(t *testing.T) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	features, err := VisitedCells(ci, 25.2048, 55.2708)
+	log.PanicIf(err)
+
+	// A cell per visited token, then the query and the result.
+
+	if len(features) < 3 {
+		t.Fatalf("Expected cells and two points: (%d)", len(features))
+	}
+
+	query := features[len(features)-2]
+	result := features[len(features)-1]
+
+	if query.Properties["role"] != "query" || query.Point == nil || query.Point.Latitude != 25.2048 {
+		t.Fatalf("Query not correct: %v", query)
+	} else if result.Properties["role"] != "result" || result.Properties["id"] != "292223" {
+		t.Fatalf("Result not correct: %v", result)
+	}
+
+	cells := features[:len(features)-2]
+
+	lastLevel := 31
+	foundDubai := false
+	for _, feature := range cells {
+		if feature.Properties["role"] != "visited" || len(feature.Polygon) != 5 {
+			t.Fatalf("Cell not correct: %v", feature)
+		}
+
+		level := feature.Properties["level"].(int)
+		if level >= lastLevel {
+			t.Fatalf("Cells not ordered from the smallest outward.")
+		}
+
+		lastLevel = level
+
+		for _, id := range feature.Properties["ids"].([]string) {
+			if id == "GeoNames,292223" {
+				foundDubai = true
+			}
+		}
+	}
+
+	if lastLevel != geoattractorindex.DefaultMinimumLevelForUrbanCenterAttraction {
+		t.Fatalf("Expected the last cell to be at the minimum level: (%d)", lastLevel)
+	} else if foundDubai == false {
+		t.Fatalf("Expected Dubai among the cities visited.")
+	}
+}
+
+func TestVisitedCells_NoCity(t *testing.T) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	_, err := VisitedCells(ci, -45.0, -120.0)
+	if log.Is(err, geoattractorindex.ErrNoNearestCity) == false {
+		t.Fatalf("Expected no-nearest-city: %v", err)
+	}
+}
+
+func TestAttractionMap(t *testing.T) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	features, err := AttractionMap(ci, 24.9, 55.0, 25.5, 55.6, 9, 0)
+	log.PanicIf(err)
+
+	cells := 0
+	resolvedCells := 0
+	cities := make(map[string]int)
+
+	for _, feature := range features {
+		switch feature.Properties["role"] {
+		case "cell":
+			cells++
+
+			if len(feature.Polygon) != 5 {
+				t.Fatalf("Cell not a polygon: %v", feature)
+			}
+
+			if _, found := feature.Properties["id"]; found == true {
+				resolvedCells++
+
+				if feature.Color == "" {
+					t.Fatalf("Resolved cell not colored: %v", feature)
+				}
+			}
+		case "city":
+			cities[feature.Properties["id"].(string)] = feature.Properties["cells"].(int)
+		default:
+			t.Fatalf("Unexpected feature: %v", feature)
+		}
+	}
+
+	if cells == 0 || resolvedCells == 0 {
+		t.Fatalf("Expected resolved cells: (%d) (%d)", cells, resolvedCells)
+	} else if _, found := cities["292223"]; found == false {
+		t.Fatalf("Expected some cells to resolve to Dubai: %v", cities)
+	}
+
+	total := 0
+	for _, count := range cities {
+		total += count
+	}
+
+	if total != resolvedCells {
+		t.Fatalf("City cell-counts don't add up: (%d) != (%d)", total, resolvedCells)
+	}
+
+	// Cells of the same city have the same color.
+
+	colors := make(map[string]string)
+	for _, feature := range features {
+		if feature.Properties["role"] != "cell" || feature.Color == "" {
+			continue
+		}
+
+		id := feature.Properties["id"].(string)
+		if color, found := colors[id]; found == true && color != feature.Color {
+			t.Fatalf("Colors not consistent for [%s].", id)
+		}
+
+		colors[id] = feature.Color
+	}
+}
+
+func TestAttractionMap_TooManyCells(t *testing.T) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	_, err := AttractionMap(ci, 24.0, 54.0, 26.0, 56.0, 12, 10)
+	if err == nil || strings.Contains(err.Error(), ErrTooManyCells.Error()) == false {
+		t.Fatalf("Expected too-many-cells: %v", err)
+	}
+}
+
+func TestAttractionMap_InvalidBounds(t *testing.T) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	boxes := [][]float64{
+		{25.5, 55.0, 24.9, 55.6},
+		{-91.0, 55.0, 25.5, 55.6},
+		{24.9, 55.0, 91.0, 55.6},
+		{24.9, -181.0, 25.5, 55.6},
+		{24.9, 55.0, 25.5, 181.0},
+		{math.NaN(), 55.0, 25.5, 55.6},
+	}
+
+	for _, box := range boxes {
+		_, err := AttractionMap(ci, box[0], box[1], box[2], box[3], 9, 0)
+		if err == nil || strings.Contains(err.Error(), ErrInvalidBounds.Error()) == false {
+			t.Fatalf("Expected invalid-bounds for %v: %v", box, err)
+		}
+	}
+}
+
+func getTestFeatures() []Feature {
+	point := geoattractorindex.Coordinate{Latitude: 25.0657, Longitude: 55.17128}
+
+	return []Feature{
+		{
+			Name:    "cell",
+			Polygon: CellPolygon(s2.CellIDFromToken("3e5f5")),
+			Color:   "#336699",
+			Properties: map[string]interface{}{
+				"cities": []string{"Sharjah", "Ajman"},
+			},
+		},
+		{
+			Name:  "Dubai",
+			Point: &point,
+			Properties: map[string]interface{}{
+				"id": "292223",
+			},
+		},
+	}
+}
+
+func TestWriteGeojson(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	err := WriteGeojson(b, getTestFeatures())
+	log.PanicIf(err)
+
+	fc := struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string      `json:"type"`
+				Coordinates interface{} `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}{}
+
+	err = json.Unmarshal(b.Bytes(), &fc)
+	log.PanicIf(err)
+
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 2 {
+		t.Fatalf("Collection not correct: %s", b.String())
+	}
+
+	polygon := fc.Features[0]
+	if polygon.Geometry.Type != "Polygon" || polygon.Properties["fill"] != "#336699" || polygon.Properties["name"] != "cell" {
+		t.Fatalf("Polygon not correct: %v", polygon)
+	}
+
+	point := fc.Features[1]
+	if point.Geometry.Type != "Point" || reflect.DeepEqual(point.Geometry.Coordinates, []interface{}{55.17128, 25.0657}) == false {
+		t.Fatalf("Point not correct: %v", point.Geometry.Coordinates)
+	}
+}
+
+func TestWriteKml(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	err := WriteKml(b, "test", getTestFeatures())
+	log.PanicIf(err)
+
+	document := kmlDocument{}
+
+	err = xml.Unmarshal(b.Bytes(), &document)
+	log.PanicIf(err)
+
+	if document.Name != "test" || len(document.Placemark) != 2 {
+		t.Fatalf("Document not correct: %s", b.String())
+	}
+
+	polygon := document.Placemark[0]
+	if polygon.Polygon == nil || len(strings.Fields(*polygon.Polygon)) != 5 {
+		t.Fatalf("Polygon not correct: %v", polygon)
+	} else if polygon.Style == nil || polygon.Style.PolyColor != "80996633" {
+		t.Fatalf("Style not correct: %v", polygon.Style)
+	} else if len(polygon.Data) != 1 || polygon.Data[0].Value != "Sharjah, Ajman" {
+		t.Fatalf("Data not correct: %v", polygon.Data)
+	}
+
+	point := document.Placemark[1]
+	if point.Point == nil || *point.Point != "55.17128000,25.06570000" {
+		t.Fatalf("Point not correct: %v", point)
+	}
+}
+
+func TestAttractionMap_TooManyCells_BeforeCovering(t *testing.T) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	// This would be trillions of cells if they were enumerated.
+	startedAt := time.Now()
+
+	_, err := AttractionMap(ci, 0.0, 0.0, 10.0, 10.0, 24, 10000)
+	if err == nil || strings.Contains(err.Error(), ErrTooManyCells.Error()) == false {
+		t.Fatalf("Expected too-many-cells: %v", err)
+	} else if time.Since(startedAt) > time.Second {
+		t.Fatalf("Region was covered before being rejected.")
+	}
+
+	// A long, thin, box has a small area but still needs many cells.
+	_, err = AttractionMap(ci, 0.0, -170.0, 0.0001, 170.0, 20, 10000)
+	if err == nil || strings.Contains(err.Error(), ErrTooManyCells.Error()) == false {
+		t.Fatalf("Expected too-many-cells for a thin box: %v", err)
+	}
+}
+
+func TestMinimumCellCount(t *testing.T) {
+	// The bound never exceeds the real count.
+	for _, level := range []int{6, 8, 10} {
+		rect := s2.RectFromLatLng(s2.LatLngFromDegrees(24.0, 54.0)).AddPoint(s2.LatLngFromDegrees(26.0, 56.0))
+
+		rc := &s2.RegionCoverer{MinLevel: level, MaxLevel: level, MaxCells: 1 << 20}
+
+		cu := rc.Covering(rect)
+		cu.Denormalize(level, 1)
+
+		count := len(cu)
+
+		if minimum := minimumCellCount(rect, level); minimum > float64(count) {
+			t.Fatalf("Bound (%f) exceeds the count (%d) at level (%d).", minimum, count, level)
+		}
+	}
+}
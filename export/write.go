@@ -0,0 +1,224 @@
+package geoattractorexport
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"encoding/json"
+	"encoding/xml"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+// GeoJSON
+
+// geojsonPosition puts the longitude first, as GeoJSON requires.
+func geojsonPosition(c geoattractorindex.Coordinate) []float64 {
+	return []float64{c.Longitude, c.Latitude}
+}
+
+// WriteGeojson writes the features as a GeoJSON FeatureCollection. The name,
+// description, and color go into the properties (the color as "fill", per the
+// simplestyle convention that most viewers understand).
+func WriteGeojson(w io.Writer, features []Feature) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	encodedFeatures := make([]interface{}, len(features))
+	for i, feature := range features {
+		properties := make(map[string]interface{})
+		for k, v := range feature.Properties {
+			properties[k] = v
+		}
+
+		properties["name"] = feature.Name
+		properties["description"] = feature.Description
+
+		if feature.Color != "" {
+			properties["fill"] = feature.Color
+			properties["fill-opacity"] = 0.5
+
+			if feature.Point != nil {
+				properties["marker-color"] = feature.Color
+			}
+		}
+
+		var geometry map[string]interface{}
+		if feature.Point != nil {
+			geometry = map[string]interface{}{
+				"type":        "Point",
+				"coordinates": geojsonPosition(*feature.Point),
+			}
+		} else {
+			ring := make([][]float64, len(feature.Polygon))
+			for j, c := range feature.Polygon {
+				ring[j] = geojsonPosition(c)
+			}
+
+			geometry = map[string]interface{}{
+				"type":        "Polygon",
+				"coordinates": [][][]float64{ring},
+			}
+		}
+
+		encodedFeatures[i] = map[string]interface{}{
+			"type":       "Feature",
+			"geometry":   geometry,
+			"properties": properties,
+		}
+	}
+
+	fc := map[string]interface{}{
+		"type":     "FeatureCollection",
+		"features": encodedFeatures,
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+
+	err = e.Encode(fc)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// KML
+
+type kmlDocument struct {
+	XMLName   xml.Name       `xml:"kml"`
+	Namespace string         `xml:"xmlns,attr"`
+	Name      string         `xml:"Document>name"`
+	Placemark []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlStyle struct {
+	IconColor string `xml:"IconStyle>color,omitempty"`
+	LineColor string `xml:"LineStyle>color,omitempty"`
+	PolyColor string `xml:"PolyStyle>color,omitempty"`
+}
+
+type kmlPlacemark struct {
+	Name        string    `xml:"name"`
+	Description string    `xml:"description,omitempty"`
+	Style       *kmlStyle `xml:"Style,omitempty"`
+	Data        []kmlData `xml:"ExtendedData>Data,omitempty"`
+
+	Point   *string `xml:"Point>coordinates,omitempty"`
+	Polygon *string `xml:"Polygon>outerBoundaryIs>LinearRing>coordinates,omitempty"`
+}
+
+// kmlCoordinates formats the coordinates as KML's "lon,lat" tuples.
+func kmlCoordinates(coordinates ...geoattractorindex.Coordinate) *string {
+	tuples := make([]string, len(coordinates))
+	for i, c := range coordinates {
+		tuples[i] = fmt.Sprintf("%.8f,%.8f", c.Longitude, c.Latitude)
+	}
+
+	phrase := strings.Join(tuples, " ")
+	return &phrase
+}
+
+// kmlColor converts "#rrggbb" to KML's "aabbggrr".
+func kmlColor(color string, alpha string) string {
+	if len(color) != 7 || color[0] != '#' {
+		return ""
+	}
+
+	return alpha + color[5:7] + color[3:5] + color[1:3]
+}
+
+// kmlValue formats a property value. Lists are joined with commas.
+func kmlValue(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ", ")
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// WriteKml writes the features as a KML document with the given name. The
+// properties go into each placemark's extended data.
+func WriteKml(w io.Writer, name string, features []Feature) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	document := kmlDocument{
+		Namespace: "http://www.opengis.net/kml/2.2",
+		Name:      name,
+		Placemark: make([]kmlPlacemark, len(features)),
+	}
+
+	for i, feature := range features {
+		placemark := kmlPlacemark{
+			Name:        feature.Name,
+			Description: feature.Description,
+		}
+
+		if feature.Color != "" {
+			placemark.Style = &kmlStyle{
+				LineColor: kmlColor(feature.Color, "ff"),
+				PolyColor: kmlColor(feature.Color, "80"),
+			}
+
+			if feature.Point != nil {
+				placemark.Style = &kmlStyle{
+					IconColor: kmlColor(feature.Color, "ff"),
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(feature.Properties))
+		for key := range feature.Properties {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			data := kmlData{
+				Name:  key,
+				Value: kmlValue(feature.Properties[key]),
+			}
+
+			placemark.Data = append(placemark.Data, data)
+		}
+
+		if feature.Point != nil {
+			placemark.Point = kmlCoordinates(*feature.Point)
+		} else {
+			placemark.Polygon = kmlCoordinates(feature.Polygon...)
+		}
+
+		document.Placemark[i] = placemark
+	}
+
+	_, err = io.WriteString(w, xml.Header)
+	log.PanicIf(err)
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+
+	err = e.Encode(document)
+	log.PanicIf(err)
+
+	_, err = io.WriteString(w, "\n")
+	log.PanicIf(err)
+
+	return nil
+}
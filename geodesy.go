@@ -0,0 +1,21 @@
+package geoattractor
+
+import (
+    "math"
+
+    "github.com/golang/geo/s1"
+    "github.com/golang/geo/s2"
+)
+
+// Destination returns the point at the given angular distance and heading
+// (radians clockwise from north) from the origin.
+func Destination(origin s2.LatLng, distance s1.Angle, heading float64) s2.LatLng {
+    lat1 := origin.Lat.Radians()
+    lng1 := origin.Lng.Radians()
+    d := distance.Radians()
+
+    lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(heading))
+    lng2 := lng1 + math.Atan2(math.Sin(heading)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+
+    return s2.LatLng{Lat: s1.Angle(lat2), Lng: s1.Angle(lng2)}.Normalized()
+}
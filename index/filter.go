@@ -0,0 +1,427 @@
+package geoattractorindex
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+// LoadOptions controls what is loaded into the index and how. Each record is
+// first passed through the transforms, in order, and then through the filter.
+type LoadOptions struct {
+	// Transforms may modify or drop records. They run before the filter so
+	// that the filter sees the corrected records.
+	Transforms []LoadTransform
+
+	// Filter decides which records are loaded. If nil, all records are
+	// loaded. Use `AllOf()`, `AnyOf()`, and `Not()` to combine filters.
+	Filter LoadFilter
+}
+
+// Apply runs the transforms and then the filter over one record, the same way
+// that loading does. `dropped` is true if a transform dropped the record and
+// `filtered` is true if the filter didn't match it.
+func (lo LoadOptions) Apply(cr geoattractor.CityRecord) (transformed geoattractor.CityRecord, dropped, filtered bool, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	latitude, longitude := cr.Latitude, cr.Longitude
+
+	for _, transform := range lo.Transforms {
+		var keep bool
+
+		cr, keep, err = transform.Transform(cr)
+		log.PanicIf(err)
+
+		if keep == false {
+			return cr, true, false, nil
+		}
+	}
+
+	// A cell computed by the source is stale if the record was moved.
+	if cr.Latitude != latitude || cr.Longitude != longitude {
+		cr.Cell = 0
+	}
+
+	if lo.Filter != nil && lo.Filter.Match(cr) == false {
+		return cr, false, true, nil
+	}
+
+	return cr, false, false, nil
+}
+
+// LoadFilter decides whether a record should be loaded.
+type LoadFilter interface {
+	Match(cr geoattractor.CityRecord) bool
+}
+
+// LoadFilterFunc adapts a function to a `LoadFilter` (for custom predicates).
+type LoadFilterFunc func(cr geoattractor.CityRecord) bool
+
+func (lff LoadFilterFunc) Match(cr geoattractor.CityRecord) bool {
+	return lff(cr)
+}
+
+// LoadTransform may modify a record before it's loaded. If `keep` is false,
+// the record is dropped.
+type LoadTransform interface {
+	Transform(cr geoattractor.CityRecord) (transformed geoattractor.CityRecord, keep bool, err error)
+}
+
+// LoadTransformFunc adapts a function to a `LoadTransform`.
+type LoadTransformFunc func(cr geoattractor.CityRecord) (transformed geoattractor.CityRecord, keep bool, err error)
+
+func (ltf LoadTransformFunc) Transform(cr geoattractor.CityRecord) (transformed geoattractor.CityRecord, keep bool, err error) {
+	return ltf(cr)
+}
+
+// Combining filters
+
+type allOfFilter struct {
+	filters []LoadFilter
+}
+
+// AllOf matches records that match every one of the given filters (AND). With
+// no filters, it matches everything. Filters are evaluated in order and
+// evaluation stops at the first that doesn't match.
+func AllOf(filters ...LoadFilter) LoadFilter {
+	return allOfFilter{
+		filters: filters,
+	}
+}
+
+func (aof allOfFilter) Match(cr geoattractor.CityRecord) bool {
+	for _, filter := range aof.filters {
+		if filter.Match(cr) == false {
+			return false
+		}
+	}
+
+	return true
+}
+
+type anyOfFilter struct {
+	filters []LoadFilter
+}
+
+// AnyOf matches records that match at least one of the given filters (OR).
+// With no filters, it matches nothing. Filters are evaluated in order and
+// evaluation stops at the first that matches.
+func AnyOf(filters ...LoadFilter) LoadFilter {
+	return anyOfFilter{
+		filters: filters,
+	}
+}
+
+func (aof anyOfFilter) Match(cr geoattractor.CityRecord) bool {
+	for _, filter := range aof.filters {
+		if filter.Match(cr) == true {
+			return true
+		}
+	}
+
+	return false
+}
+
+type notFilter struct {
+	filter LoadFilter
+}
+
+// Not matches records that the given filter doesn't.
+func Not(filter LoadFilter) LoadFilter {
+	return notFilter{
+		filter: filter,
+	}
+}
+
+func (nf notFilter) Match(cr geoattractor.CityRecord) bool {
+	return nf.filter.Match(cr) == false
+}
+
+// Filters
+
+// IdFilter matches records with any of the given IDs.
+type IdFilter struct {
+	ids []string
+	set map[string]struct{}
+}
+
+func NewIdFilter(ids ...string) *IdFilter {
+	set := make(map[string]struct{})
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	return &IdFilter{
+		ids: ids,
+		set: set,
+	}
+}
+
+func (idf *IdFilter) Match(cr geoattractor.CityRecord) bool {
+	_, found := idf.set[cr.Id]
+	return found
+}
+
+// CountryFilter matches records in any of the given countries (by name).
+type CountryFilter struct {
+	names []string
+	set   map[string]struct{}
+}
+
+func NewCountryFilter(names ...string) *CountryFilter {
+	set := make(map[string]struct{})
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+
+	return &CountryFilter{
+		names: names,
+		set:   set,
+	}
+}
+
+func (cf *CountryFilter) Match(cr geoattractor.CityRecord) bool {
+	_, found := cf.set[cr.Country]
+	return found
+}
+
+// BoundingBoxFilter matches records within the given box (inclusive). If the
+// minimum longitude is greater than the maximum, the box is taken to cross the
+// antimeridian.
+type BoundingBoxFilter struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+func NewBoundingBoxFilter(minLatitude, minLongitude, maxLatitude, maxLongitude float64) *BoundingBoxFilter {
+	return &BoundingBoxFilter{
+		MinLatitude:  minLatitude,
+		MinLongitude: minLongitude,
+		MaxLatitude:  maxLatitude,
+		MaxLongitude: maxLongitude,
+	}
+}
+
+func (bbf *BoundingBoxFilter) Match(cr geoattractor.CityRecord) bool {
+	if cr.Latitude < bbf.MinLatitude || cr.Latitude > bbf.MaxLatitude {
+		return false
+	}
+
+	if bbf.MinLongitude <= bbf.MaxLongitude {
+		return cr.Longitude >= bbf.MinLongitude && cr.Longitude <= bbf.MaxLongitude
+	}
+
+	return cr.Longitude >= bbf.MinLongitude || cr.Longitude <= bbf.MaxLongitude
+}
+
+// Coordinate is a point of a polygon.
+type Coordinate struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// PolygonFilter matches records within the given polygon. The polygon is
+// treated as planar in latitude and longitude, which is fine for regions that
+// don't cross the antimeridian or a pole. It doesn't need to be closed.
+type PolygonFilter struct {
+	vertices []Coordinate
+}
+
+func NewPolygonFilter(vertices []Coordinate) *PolygonFilter {
+	return &PolygonFilter{
+		vertices: vertices,
+	}
+}
+
+func (pf *PolygonFilter) Match(cr geoattractor.CityRecord) bool {
+	// Ray-casting: count how many edges a ray heading east from the point
+	// crosses.
+
+	inside := false
+
+	count := len(pf.vertices)
+	for i, j := 0, count-1; i < count; j, i = i, i+1 {
+		a := pf.vertices[i]
+		b := pf.vertices[j]
+
+		if (a.Latitude > cr.Latitude) == (b.Latitude > cr.Latitude) {
+			continue
+		}
+
+		crossingLongitude := a.Longitude + (cr.Latitude-a.Latitude)*(b.Longitude-a.Longitude)/(b.Latitude-a.Latitude)
+		if cr.Longitude < crossingLongitude {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// PopulationFilter matches records with a population within the given range
+// (inclusive). A maximum of zero means that there's no maximum.
+type PopulationFilter struct {
+	Minimum uint64
+	Maximum uint64
+}
+
+func NewPopulationFilter(minimum, maximum uint64) *PopulationFilter {
+	return &PopulationFilter{
+		Minimum: minimum,
+		Maximum: maximum,
+	}
+}
+
+func (pf *PopulationFilter) Match(cr geoattractor.CityRecord) bool {
+	if cr.Population < pf.Minimum {
+		return false
+	} else if pf.Maximum != 0 && cr.Population > pf.Maximum {
+		return false
+	}
+
+	return true
+}
+
+// ProvinceStateFilter matches records in any of the given provinces or states
+// (by code, e.g. the GeoNames admin1 code). Case doesn't matter.
+type ProvinceStateFilter struct {
+	codes []string
+	set   map[string]struct{}
+}
+
+func NewProvinceStateFilter(codes ...string) *ProvinceStateFilter {
+	set := make(map[string]struct{})
+	for _, code := range codes {
+		set[strings.ToLower(code)] = struct{}{}
+	}
+
+	return &ProvinceStateFilter{
+		codes: codes,
+		set:   set,
+	}
+}
+
+func (psf *ProvinceStateFilter) Match(cr geoattractor.CityRecord) bool {
+	_, found := psf.set[strings.ToLower(cr.ProvinceState)]
+	return found
+}
+
+// RadiusFilter matches records within the given great-circle distance of a
+// point (inclusive).
+type RadiusFilter struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+
+	center *geo.Point
+}
+
+func NewRadiusFilter(latitude, longitude, radiusKm float64) *RadiusFilter {
+	return &RadiusFilter{
+		Latitude:  latitude,
+		Longitude: longitude,
+		RadiusKm:  radiusKm,
+		center:    geo.NewPoint(latitude, longitude),
+	}
+}
+
+// DistanceKm returns the distance of the record from the center.
+func (rf *RadiusFilter) DistanceKm(cr geoattractor.CityRecord) float64 {
+	return rf.center.GreatCircleDistance(geo.NewPoint(cr.Latitude, cr.Longitude))
+}
+
+func (rf *RadiusFilter) Match(cr geoattractor.CityRecord) bool {
+	return rf.DistanceKm(cr) <= rf.RadiusKm
+}
+
+// NameRegexFilter matches records whose city name matches the expression.
+type NameRegexFilter struct {
+	rx *regexp.Regexp
+}
+
+func NewNameRegexFilter(rx *regexp.Regexp) *NameRegexFilter {
+	return &NameRegexFilter{
+		rx: rx,
+	}
+}
+
+func (nrf *NameRegexFilter) Match(cr geoattractor.CityRecord) bool {
+	return nrf.rx.MatchString(cr.City)
+}
+
+// Transforms
+
+// CityNameOverrides replaces the city names of the records with the given IDs.
+type CityNameOverrides map[string]string
+
+func (cno CityNameOverrides) Transform(cr geoattractor.CityRecord) (transformed geoattractor.CityRecord, keep bool, err error) {
+	if name, found := cno[cr.Id]; found == true {
+		cr.City = name
+	}
+
+	return cr, true, nil
+}
+
+// PopulationOverrides replaces the populations of the records with the given
+// IDs.
+type PopulationOverrides map[string]uint64
+
+func (po PopulationOverrides) Transform(cr geoattractor.CityRecord) (transformed geoattractor.CityRecord, keep bool, err error) {
+	if population, found := po[cr.Id]; found == true {
+		cr.Population = population
+	}
+
+	return cr, true, nil
+}
+
+// DropIds drops the records with the given IDs.
+type DropIds map[string]struct{}
+
+func NewDropIds(ids ...string) DropIds {
+	di := make(DropIds)
+	for _, id := range ids {
+		di[id] = struct{}{}
+	}
+
+	return di
+}
+
+func (di DropIds) Transform(cr geoattractor.CityRecord) (transformed geoattractor.CityRecord, keep bool, err error) {
+	_, found := di[cr.Id]
+	return cr, found == false, nil
+}
+
+// walkFilters calls `cb` for the given filter and every filter that it
+// combines with AND or OR. Filters under `Not()` are skipped since records that
+// match them are never loaded.
+func walkFilters(filter LoadFilter, cb func(filter LoadFilter)) {
+	if filter == nil {
+		return
+	}
+
+	if _, ok := filter.(notFilter); ok == true {
+		return
+	}
+
+	cb(filter)
+
+	switch f := filter.(type) {
+	case allOfFilter:
+		for _, child := range f.filters {
+			walkFilters(child, cb)
+		}
+	case anyOfFilter:
+		for _, child := range f.filters {
+			walkFilters(child, cb)
+		}
+	}
+}
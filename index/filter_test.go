@@ -0,0 +1,303 @@
+package geoattractorindex
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+var (
+	testDubai = geoattractor.CityRecord{
+		Id:         "292223",
+		Country:    "United Arab Emirates",
+		City:       "Dubai",
+		Population: 1137347,
+		Latitude:   25.0657,
+		Longitude:  55.17128,
+	}
+
+	testSantJulia = geoattractor.CityRecord{
+		Id:         "3039163",
+		Country:    "Andorra",
+		City:       "Sant Julià de Lòria",
+		Population: 8022,
+		Latitude:   42.46372,
+		Longitude:  1.49129,
+	}
+
+	testSuva = geoattractor.CityRecord{
+		Id:         "2198148",
+		Country:    "Fiji",
+		City:       "Suva",
+		Population: 77366,
+		Latitude:   -18.14161,
+		Longitude:  178.44149,
+	}
+)
+
+func TestAllOf(t *testing.T) {
+	filter := AllOf(NewCountryFilter("United Arab Emirates", "Andorra"), NewPopulationFilter(10000, 0))
+
+	if filter.Match(testDubai) != true {
+		t.Fatalf("Expected match on both filters.")
+	} else if filter.Match(testSantJulia) != false {
+		t.Fatalf("Expected no match when only one filter matches.")
+	} else if filter.Match(testSuva) != false {
+		t.Fatalf("Expected no match when neither filter matches.")
+	}
+
+	if AllOf().Match(testDubai) != true {
+		t.Fatalf("Empty AllOf should match everything.")
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	filter := AnyOf(NewIdFilter(testSantJulia.Id), NewPopulationFilter(1000000, 0))
+
+	if filter.Match(testDubai) != true {
+		t.Fatalf("Expected match on the second filter.")
+	} else if filter.Match(testSantJulia) != true {
+		t.Fatalf("Expected match on the first filter.")
+	} else if filter.Match(testSuva) != false {
+		t.Fatalf("Expected no match when neither filter matches.")
+	}
+
+	if AnyOf().Match(testDubai) != false {
+		t.Fatalf("Empty AnyOf should match nothing.")
+	}
+}
+
+func TestAllOf_Nested(t *testing.T) {
+	// (Andorra OR Fiji) AND NOT (population under 10000)
+	filter := AllOf(
+		AnyOf(NewCountryFilter("Andorra"), NewCountryFilter("Fiji")),
+		Not(NewPopulationFilter(0, 9999)))
+
+	if filter.Match(testSuva) != true {
+		t.Fatalf("Expected Suva to match.")
+	} else if filter.Match(testSantJulia) != false {
+		t.Fatalf("Expected Sant Julià to be too small.")
+	} else if filter.Match(testDubai) != false {
+		t.Fatalf("Expected Dubai to be in the wrong country.")
+	}
+}
+
+func TestBoundingBoxFilter(t *testing.T) {
+	// The Arabian peninsula.
+	filter := NewBoundingBoxFilter(12.0, 34.0, 32.0, 60.0)
+
+	if filter.Match(testDubai) != true {
+		t.Fatalf("Expected Dubai to be in the box.")
+	} else if filter.Match(testSantJulia) != false {
+		t.Fatalf("Expected Sant Julià to be outside of the box.")
+	}
+
+	// Across the antimeridian.
+	filter = NewBoundingBoxFilter(-25.0, 175.0, -10.0, -175.0)
+
+	if filter.Match(testSuva) != true {
+		t.Fatalf("Expected Suva to be in the box across the antimeridian.")
+	} else if filter.Match(testDubai) != false {
+		t.Fatalf("Expected Dubai to be outside of the box across the antimeridian.")
+	}
+}
+
+func TestPolygonFilter(t *testing.T) {
+	// A triangle around the UAE.
+	filter := NewPolygonFilter([]Coordinate{
+		{Latitude: 26.5, Longitude: 51.0},
+		{Latitude: 26.5, Longitude: 57.0},
+		{Latitude: 22.0, Longitude: 54.0},
+	})
+
+	if filter.Match(testDubai) != true {
+		t.Fatalf("Expected Dubai to be in the polygon.")
+	} else if filter.Match(testSantJulia) != false {
+		t.Fatalf("Expected Sant Julià to be outside of the polygon.")
+	}
+
+	// Inside the bounding box of the triangle but outside of the triangle.
+	corner := geoattractor.CityRecord{
+		Latitude:  22.5,
+		Longitude: 51.5,
+	}
+
+	if filter.Match(corner) != false {
+		t.Fatalf("Expected the corner to be outside of the polygon.")
+	}
+}
+
+func TestPopulationFilter(t *testing.T) {
+	filter := NewPopulationFilter(8022, 77366)
+
+	if filter.Match(testSantJulia) != true {
+		t.Fatalf("Expected the minimum to be inclusive.")
+	} else if filter.Match(testSuva) != true {
+		t.Fatalf("Expected the maximum to be inclusive.")
+	} else if filter.Match(testDubai) != false {
+		t.Fatalf("Expected Dubai to be too large.")
+	}
+}
+
+func TestProvinceStateFilter(t *testing.T) {
+	dubai := testDubai
+	dubai.ProvinceState = "03"
+
+	santJulia := testSantJulia
+	santJulia.ProvinceState = "06"
+
+	filter := NewProvinceStateFilter("03", "xx")
+
+	if filter.Match(dubai) != true {
+		t.Fatalf("Expected Dubai to match.")
+	} else if filter.Match(santJulia) != false {
+		t.Fatalf("Expected Sant Julià not to match.")
+	}
+
+	if NewProvinceStateFilter("XX").Match(geoattractor.CityRecord{ProvinceState: "xx"}) != true {
+		t.Fatalf("Expected case not to matter.")
+	}
+}
+
+func TestRadiusFilter(t *testing.T) {
+	// Andorra la Vella.
+	filter := NewRadiusFilter(42.50779, 1.52109, 10.0)
+
+	if filter.Match(testSantJulia) != true {
+		t.Fatalf("Expected Sant Julià to be within the radius.")
+	} else if filter.Match(testDubai) != false {
+		t.Fatalf("Expected Dubai to be outside of the radius.")
+	}
+
+	distanceKm := filter.DistanceKm(testSantJulia)
+	if distanceKm < 5.0 || distanceKm > 6.0 {
+		t.Fatalf("Distance not correct: (%f)", distanceKm)
+	}
+}
+
+func TestNameRegexFilter(t *testing.T) {
+	filter := NewNameRegexFilter(regexp.MustCompile(`(?i)^sant\b`))
+
+	if filter.Match(testSantJulia) != true {
+		t.Fatalf("Expected Sant Julià to match.")
+	} else if filter.Match(testSuva) != false {
+		t.Fatalf("Expected Suva not to match.")
+	}
+}
+
+func TestLoadFilterFunc(t *testing.T) {
+	filter := LoadFilterFunc(func(cr geoattractor.CityRecord) bool {
+		return cr.City == "Suva"
+	})
+
+	if filter.Match(testSuva) != true || filter.Match(testDubai) != false {
+		t.Fatalf("Custom predicate not applied.")
+	}
+}
+
+func TestCityIndex_Load_Options(t *testing.T) {
+	gp := getTestGeonamesParser()
+
+	f, err := os.Open(path.Join(appPath, "parse", "test", "asset", "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	ci, kvFilepath := NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	// Both the ID list and the country list are applied (unlike the old
+	// arguments, where the ID list won).
+
+	options := LoadOptions{
+		Transforms: []LoadTransform{
+			CityNameOverrides{"292223": "Dubayy"},
+			PopulationOverrides{"3039163": 50000},
+			NewDropIds("292968"),
+		},
+		Filter: AnyOf(
+			NewIdFilter("292223", "292968"),
+			AllOf(
+				NewCountryFilter("Andorra"),
+				NewPopulationFilter(10000, 0))),
+	}
+
+	report, err := ci.Load(gp, f, options)
+	log.PanicIf(err)
+
+	// Dubai by ID, and les Escaldes, Encamp, Andorra la Vella, and (with its
+	// population overridden) Sant Julià de Lòria. Abu Dhabi was dropped.
+
+	if report.Dropped != 1 || report.Indexed != 5 || report.Filtered != 29 {
+		t.Fatalf("Counts not correct: %s", report)
+	}
+
+	cr, err := ci.GetById("GeoNames", "292223")
+	log.PanicIf(err)
+
+	if cr.City != "Dubayy" {
+		t.Fatalf("Name not overridden: %s", cr)
+	}
+
+	cr, err = ci.GetById("GeoNames", "3039163")
+	log.PanicIf(err)
+
+	if cr.Population != 50000 {
+		t.Fatalf("Population not overridden: %s", cr)
+	}
+
+	_, err = ci.GetById("GeoNames", "292968")
+	if log.Is(err, ErrNotFound) == false {
+		t.Fatalf("Dropped record was loaded: %v", err)
+	}
+
+	expectedHits := []LoadTally{
+		{Name: "292223", Count: 1},
+	}
+
+	if reflect.DeepEqual(report.CityFilterHits, expectedHits) == false {
+		t.Fatalf("City filter hits not correct: %v", report.CityFilterHits)
+	} else if reflect.DeepEqual(report.CityFilterMisses, []string{"292968"}) == false {
+		t.Fatalf("City filter misses not correct: %v", report.CityFilterMisses)
+	} else if reflect.DeepEqual(report.CountryFilterHits, []LoadTally{{Name: "Andorra", Count: 4}}) == false {
+		t.Fatalf("Country filter hits not correct: %v", report.CountryFilterHits)
+	}
+}
+
+func TestCityIndex_Load_TransformError(t *testing.T) {
+	gp := getTestGeonamesParser()
+
+	f, err := os.Open(path.Join(appPath, "parse", "test", "asset", "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	ci, kvFilepath := NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	errTransform := errors.New("transform failed")
+
+	options := LoadOptions{
+		Transforms: []LoadTransform{
+			LoadTransformFunc(func(cr geoattractor.CityRecord) (transformed geoattractor.CityRecord, keep bool, err error) {
+				return cr, false, errTransform
+			}),
+		},
+	}
+
+	_, err = ci.Load(gp, f, options)
+	if err == nil {
+		t.Fatalf("Expected error from transform.")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"encoding/gob"
 	"io/ioutil"
@@ -16,9 +17,9 @@ import (
 	"github.com/dsoprea/go-logging"
 	"github.com/kellydunn/golang-geo"
 	"github.com/randomingenuity/go-utility/geographic"
-	"gopkg.in/cheggaaa/pb.v1"
 
 	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/parse"
 )
 
 const (
@@ -38,6 +39,9 @@ var (
 var (
 	CityIndexKeyGroup = []string{"attractor", "index", "city_index"}
 	FineTokenKeyGroup = []string{"attractor", "index", "fine_token_index"}
+	MetadataKeyGroup  = []string{"attractor", "index", "metadata"}
+
+	knownKeyGroups = [][]string{CityIndexKeyGroup, FineTokenKeyGroup, MetadataKeyGroup}
 )
 
 type IndexEntry struct {
@@ -64,6 +68,10 @@ type AttractorStats struct {
 	// (mutually exclusively with RecordAdds).
 	RecordUpdates int `json:"records_updated_in_index"`
 
+	// DuplicateRecords is the number of records that were skipped because a
+	// record with the same ID was already loaded from another input.
+	DuplicateRecords int `json:"duplicate_records_skipped"`
+
 	// HaversineCalculations is how many times we've calculated distances
 	// between points.
 	HaversineCalculations int `json:"haversine_calculations"`
@@ -71,6 +79,23 @@ type AttractorStats struct {
 	CachedNearestHits   int
 	CachedNearestMisses int
 	CachedNearestShifts int
+
+	// Inputs describes what each input contributed when more than one was
+	// loaded.
+	Inputs []InputStats `json:"inputs,omitempty"`
+}
+
+// InputStats describes what one input (e.g. a file) contributed to the index.
+type InputStats struct {
+	Name              string `json:"name"`
+	UnfilteredRecords int    `json:"unfiltered_records_parsed"`
+	DuplicateRecords  int    `json:"duplicate_records_skipped"`
+	RecordAdds        int    `json:"records_added_to_index"`
+	RecordUpdates     int    `json:"records_updated_in_index"`
+}
+
+func (is InputStats) String() string {
+	return fmt.Sprintf("InputStats<NAME=[%s] UNFILTERED-RECORDS=(%d) DUPLICATES=(%d) ADDS=(%d) UPDATES=(%d)>", is.Name, is.UnfilteredRecords, is.DuplicateRecords, is.RecordAdds, is.RecordUpdates)
 }
 
 func (ls AttractorStats) String() string {
@@ -92,6 +117,10 @@ type CityIndex struct {
 	cachedNearest    map[string]cachedNearestInfo
 	cachedNearestLru sort.StringSlice
 
+	// nameIndex is built by `FindByName()` and dropped whenever a city is
+	// written or removed.
+	nameIndex map[string][]string
+
 	minimumSearchLevel           int
 	urbanCenterMinimumPopulation int
 
@@ -102,7 +131,8 @@ type CityIndex struct {
 
 	totalRecords int
 
-	beVerbose bool
+	beVerbose        bool
+	progressReporter ProgressReporter
 }
 
 // NewCityIndex returns a `CityIndex` instance. `minimumSearchLevel` specifies
@@ -145,8 +175,34 @@ func (ci *CityIndex) SetVerbose(flag bool) {
 	ci.beVerbose = flag
 }
 
-// SetTotalRecords enables us to provide progress information if the number of
-// records is already known.
+// SetUrbanCenterMinimumPopulation changes the population at which a city
+// attracts the points around it. Results cached by `Nearest()` are dropped.
+func (ci *CityIndex) SetUrbanCenterMinimumPopulation(population int) {
+	ci.urbanCenterMinimumPopulation = population
+	ci.resetNearestCache()
+}
+
+// UrbanCenterMinimumPopulation returns the population at which a city attracts
+// the points around it.
+func (ci *CityIndex) UrbanCenterMinimumPopulation() int {
+	return ci.urbanCenterMinimumPopulation
+}
+
+// MinimumSearchLevel returns the smallest level that cities are searched for
+// at.
+func (ci *CityIndex) MinimumSearchLevel() int {
+	return ci.minimumSearchLevel
+}
+
+// SetProgressReporter sets what receives progress while loading. If not set,
+// verbose indices draw a progress bar on the terminal.
+func (ci *CityIndex) SetProgressReporter(pr ProgressReporter) {
+	ci.progressReporter = pr
+}
+
+// SetTotalRecords enables us to provide exact progress information if the
+// number of records is already known. Otherwise, the total is estimated from
+// the size of the input.
 func (ci *CityIndex) SetTotalRecords(count int) {
 	ci.totalRecords = count
 }
@@ -220,8 +276,23 @@ func (kk kvKey) EqualsGroup(g []string) bool {
 	return true
 }
 
+// newKvKeyFromBytes parses a stored key. The name may contain dots (IDs and
+// source-names from the delimited and GeoJSON sources can), so the groups that
+// we write are matched by prefix. Anything else is split on the last dot.
 func newKvKeyFromBytes(key []byte) kvKey {
 	s := string(key)
+
+	for _, group := range knownKeyGroups {
+		prefix := strings.Join(group, ".") + "."
+
+		if strings.HasPrefix(s, prefix) == true && len(s) > len(prefix) {
+			return kvKey{
+				group: group,
+				name:  s[len(prefix):],
+			}
+		}
+	}
+
 	parts := strings.Split(s, ".")
 
 	len_ := len(parts)
@@ -309,6 +380,13 @@ func (ci *CityIndex) KvDump() (err error) {
 			for _, record := range records {
 				fmt.Printf("  %s (%d)\n", record.CityRecord, record.Level)
 			}
+		} else if kk.EqualsGroup(MetadataKeyGroup) == true {
+			var value string
+
+			err = gd.Decode(&value)
+			log.PanicIf(err)
+
+			fmt.Printf("%s (Metadata): [%s]\n", kk.Key(), value)
 		} else {
 			fmt.Printf("Unrecognized key group: [%s]\n", kk.group)
 		}
@@ -427,42 +505,199 @@ func (ci *CityIndex) setRecord(token string, ie IndexEntry) (err error) {
 	return nil
 }
 
-// Load feeds the given city data into the index. Cities will be stored at
-// multiple levels. If/when we experience collisions, we'll keep whichever has
-// the larger population.
-func (ci *CityIndex) Load(source geoattractor.CityRecordSource, r io.Reader, specificCityIds, specificCountryNames []string) (err error) {
+// indexCity stores the city and writes it to the token for its leaf cell and
+// those of every parent cell down to the minimum search level.
+func (ci *CityIndex) indexCity(sourceName string, cr geoattractor.CityRecord) (err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	var cityIdsFilter map[string]struct{}
-	if specificCityIds != nil {
-		cityIdsFilter = make(map[string]struct{})
-		for _, id := range specificCityIds {
-			cityIdsFilter[id] = struct{}{}
-		}
+	idPhrase := IdPhrase(sourceName, cr.Id)
+
+	// Sources may have already computed the cell.
+	cellId := cr.S2Cell()
+	token := cellId.ToToken()
+
+	ie := IndexEntry{
+		CityRecord: cr,
+		Level:      cellId.Level(),
+
+		// LeafCellId is the full cell-ID for the current city regardless of which
+		// level we indexed it at.
+		LeafCellToken: token,
+
+		SourceName: sourceName,
 	}
 
-	var countriesFilter map[string]struct{}
-	if specificCountryNames != nil {
-		countriesFilter = make(map[string]struct{})
-		for _, name := range specificCountryNames {
-			countriesFilter[name] = struct{}{}
+	indexKk := kvKey{CityIndexKeyGroup, idPhrase}
+
+	err = ci.kvPut(indexKk, cr)
+	log.PanicIf(err)
+
+	ci.nameIndex = nil
+
+	// Index this cell at all levels only to within the maximum area we'd
+	// like to attract within. We assume that any area we visit will
+	// hopefully be within this amount of distance from an urban center,
+	// and, if not, at least one other city. Otherwise, that city won't be
+	// matched within the index.
+
+	err = ci.setRecord(token, ie)
+	log.PanicIf(err)
+
+	for level := cellId.Level() - 1; level >= ci.minimumSearchLevel; level-- {
+		parentCellId := cellId.Parent(level)
+		parentToken := parentCellId.ToToken()
+
+		err := ci.setRecord(parentToken, ie)
+		log.PanicIf(err)
+	}
+
+	return nil
+}
+
+// cityLoader feeds records from one or more inputs into the index. The options,
+// progress, and filter tallies are shared across all of the inputs.
+type cityLoader struct {
+	ci     *CityIndex
+	source geoattractor.CityRecordSource
+
+	options LoadOptions
+
+	// The ID and country filters that records must have matched to be
+	// loaded. Their hits are tallied for the report.
+	idFilters      []*IdFilter
+	countryFilters []*CountryFilter
+
+	cityFilterHits    map[string]int
+	countryFilterHits map[string]int
+
+	// seenIds is used to skip records that were already loaded from a
+	// previous input. It's nil if we're not deduplicating.
+	seenIds map[string]struct{}
+
+	progressReporter ProgressReporter
+	recordsDone      int
+	currentInput     string
+
+	// bytesTotal is the size of all of the inputs, or zero if any of them
+	// can't be determined.
+	bytesTotal int64
+
+	// bytesReadBefore is the amount read from the inputs before the current
+	// one.
+	bytesReadBefore int64
+	currentCounter  byteCounter
+
+	startedAt time.Time
+	before    AttractorStats
+	report    LoadReport
+
+	countryTallies map[string]int
+	skippedRows    map[string]int
+}
+
+func newCityLoader(ci *CityIndex, source geoattractor.CityRecordSource, options LoadOptions, deduplicate bool) *cityLoader {
+	idFilters := make([]*IdFilter, 0)
+	countryFilters := make([]*CountryFilter, 0)
+
+	walkFilters(options.Filter, func(filter LoadFilter) {
+		switch f := filter.(type) {
+		case *IdFilter:
+			idFilters = append(idFilters, f)
+		case *CountryFilter:
+			countryFilters = append(countryFilters, f)
 		}
+	})
+
+	var seenIds map[string]struct{}
+	if deduplicate == true {
+		seenIds = make(map[string]struct{})
+	}
+
+	progressReporter := ci.progressReporter
+	if progressReporter == nil && ci.beVerbose == true {
+		progressReporter = NewTerminalProgressReporter()
+	}
+
+	return &cityLoader{
+		ci:     ci,
+		source: source,
+
+		options: options,
+
+		idFilters:      idFilters,
+		countryFilters: countryFilters,
+
+		cityFilterHits:    make(map[string]int),
+		countryFilterHits: make(map[string]int),
+
+		seenIds: seenIds,
+
+		progressReporter: progressReporter,
+
+		startedAt: time.Now(),
+		before:    ci.stats,
+		report: LoadReport{
+			SourceName: source.Name(),
+		},
+
+		countryTallies: make(map[string]int),
+		skippedRows:    make(map[string]int),
+	}
+}
+
+// progress describes where we are.
+func (cl *cityLoader) progress(phase string) LoadProgress {
+	lp := LoadProgress{
+		Phase:       phase,
+		Input:       cl.currentInput,
+		RecordsDone: cl.recordsDone,
+		BytesRead:   cl.bytesReadBefore,
+		BytesTotal:  cl.bytesTotal,
+	}
+
+	if cl.currentCounter != nil {
+		lp.BytesRead += cl.currentCounter.BytesRead()
 	}
 
-	var loadBar *pb.ProgressBar
-	if ci.beVerbose == true {
-		loadBar = pb.New(ci.totalRecords)
-		loadBar.Prefix("Loading cities ")
-		loadBar.SetMaxWidth(100)
-		loadBar.Start()
+	if cl.ci.totalRecords > 0 {
+		lp.RecordsTotal = cl.ci.totalRecords
+	} else if lp.BytesTotal > 0 && lp.BytesRead > 0 {
+		// Extrapolate from the portion of the input that we've read so far.
+		lp.RecordsTotal = int(float64(lp.RecordsDone) * float64(lp.BytesTotal) / float64(lp.BytesRead))
+		lp.TotalIsEstimate = true
 	}
 
-	cityFilterHits := make(map[string]int)
-	countryFilterHits := make(map[string]int)
+	return lp
+}
+
+// load parses one input. `counter` reports how much of the input has been read
+// and `inputName` is only used for progress. Returns the number of records
+// parsed and the number that were skipped because an earlier input already had
+// them. The report is updated as we go.
+func (cl *cityLoader) load(r io.Reader, inputName string, counter byteCounter) (recordsCount int, duplicatesCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ci := cl.ci
+	sourceName := cl.source.Name()
+
+	cl.currentInput = inputName
+	cl.currentCounter = counter
+
+	defer func() {
+		if counter != nil {
+			cl.bytesReadBefore += counter.BytesRead()
+		}
+
+		cl.currentCounter = nil
+	}()
 
 	cb := func(cr geoattractor.CityRecord) (err error) {
 		defer func() {
@@ -471,149 +706,230 @@ func (ci *CityIndex) Load(source geoattractor.CityRecordSource, r io.Reader, spe
 			}
 		}()
 
-		if loadBar != nil {
-			loadBar.Increment()
+		cl.recordsDone++
+
+		if cl.progressReporter != nil {
+			cl.progressReporter.Progress(cl.progress(LoadPhaseLoading))
 		}
 
-		// Apply the filter.
+		cr, dropped, filtered, err := cl.options.Apply(cr)
+		log.PanicIf(err)
 
-		if cityIdsFilter != nil {
-			_, found := cityIdsFilter[cr.Id]
-			if found == false {
-				return nil
+		if dropped == true {
+			cl.report.Dropped++
+			return nil
+		} else if filtered == true {
+			cl.report.Filtered++
+			return nil
+		}
+
+		for _, idf := range cl.idFilters {
+			if idf.Match(cr) == true {
+				cl.cityFilterHits[cr.Id]++
 			}
+		}
 
-			if _, found := cityFilterHits[cr.Id]; found == true {
-				cityFilterHits[cr.Id]++
-			} else {
-				cityFilterHits[cr.Id] = 1
+		for _, cf := range cl.countryFilters {
+			if cf.Match(cr) == true {
+				cl.countryFilterHits[cr.Country]++
 			}
-		} else if countriesFilter != nil {
-			_, found := countriesFilter[cr.Country]
-			if found == false {
+		}
+
+		idPhrase := IdPhrase(sourceName, cr.Id)
+
+		if cl.seenIds != nil {
+			if _, found := cl.seenIds[idPhrase]; found == true {
+				duplicatesCount++
 				return nil
 			}
 
-			if _, found := countryFilterHits[cr.Country]; found == true {
-				countryFilterHits[cr.Country]++
-			} else {
-				countryFilterHits[cr.Country] = 1
-			}
+			cl.seenIds[idPhrase] = struct{}{}
 		}
 
-		cellId := rigeo.S2CellFromCoordinates(cr.Latitude, cr.Longitude)
-		token := cellId.ToToken()
+		err = ci.indexCity(sourceName, cr)
+		log.PanicIf(err)
 
-		ie := IndexEntry{
-			CityRecord: cr,
-			Level:      cellId.Level(),
+		cl.report.Indexed++
+		cl.countryTallies[cr.Country]++
 
-			// LeafCellId is the full cell-ID for the current city regardless of which
-			// level we indexed it at.
-			LeafCellToken: token,
+		return nil
+	}
 
-			SourceName: source.Name(),
-		}
+	if srs, ok := cl.source.(geoattractor.SkipReportingSource); ok == true {
+		srs.SetSkipCb(func(reason string) {
+			cl.skippedRows[reason]++
+		})
 
-		idPhrase := IdPhrase(source.Name(), cr.Id)
+		defer srs.SetSkipCb(nil)
+	}
 
-		indexKk := kvKey{CityIndexKeyGroup, idPhrase}
+	recordsCount, err = cl.source.Parse(r, cb)
+	log.PanicIf(err)
 
-		err = ci.kvPut(indexKk, cr)
-		log.PanicIf(err)
+	ci.stats.UnfilteredRecords += recordsCount
+	ci.stats.DuplicateRecords += duplicatesCount
 
-		// Index this cell at all levels only to within the maximum area we'd
-		// like to attract within. We assume that any area we visit will
-		// hopefully be within this amount of distance from an urban center,
-		// and, if not, at least one other city. Otherwise, that city won't be
-		// matched within the index.
+	cl.report.Parsed += recordsCount
+	cl.report.Duplicates += duplicatesCount
 
-		err = ci.setRecord(token, ie)
-		log.PanicIf(err)
+	return recordsCount, duplicatesCount, nil
+}
 
-		for level := cellId.Level() - 1; level >= ci.minimumSearchLevel; level-- {
-			parentCellId := cellId.Parent(level)
-			parentToken := parentCellId.ToToken()
+// finish reports the final progress and completes the report.
+func (cl *cityLoader) finish() LoadReport {
+	if cl.progressReporter != nil {
+		cl.progressReporter.Finish(cl.progress(LoadPhaseFinished))
+	}
 
-			err := ci.setRecord(parentToken, ie)
-			log.PanicIf(err)
+	report := cl.report
+
+	report.Added = cl.ci.stats.RecordAdds - cl.before.RecordAdds
+	report.Updated = cl.ci.stats.RecordUpdates - cl.before.RecordUpdates
+
+	report.Countries = sortedTallies(cl.countryTallies)
+	report.SkippedRows = sortedTallies(cl.skippedRows)
+
+	if len(cl.idFilters) > 0 {
+		wanted := make([]string, 0)
+		for _, idf := range cl.idFilters {
+			wanted = append(wanted, idf.ids...)
 		}
 
-		return nil
+		report.CityFilterHits = sortedTallies(cl.cityFilterHits)
+		report.CityFilterMisses = filterMisses(wanted, cl.cityFilterHits)
 	}
 
-	recordsCount, err := source.Parse(r, cb)
-	log.PanicIf(err)
+	if len(cl.countryFilters) > 0 {
+		wanted := make([]string, 0)
+		for _, cf := range cl.countryFilters {
+			wanted = append(wanted, cf.names...)
+		}
 
-	if loadBar != nil {
-		loadBar.Finish()
+		report.CountryFilterHits = sortedTallies(cl.countryFilterHits)
+		report.CountryFilterMisses = filterMisses(wanted, cl.countryFilterHits)
 	}
 
-	ci.stats.UnfilteredRecords = recordsCount
+	report.Elapsed = time.Since(cl.startedAt)
 
-	if len(cityFilterHits) > 0 && ci.beVerbose == true {
-		fmt.Printf("\n")
-		fmt.Printf("City load-filter hits:\n")
-		fmt.Printf("\n")
+	return report
+}
 
-		// TODO(dustin): !! Sort this.
-		for cityId, tally := range cityFilterHits {
-			fmt.Printf("> %s (%d)\n", cityId, tally)
+// Load feeds the given city data into the index. Cities will be stored at
+// multiple levels. If/when we experience collisions, we'll keep whichever has
+// the larger population. The options can transform and filter the records.
+// The report describes what was loaded and what was left out.
+func (ci *CityIndex) Load(source geoattractor.CityRecordSource, r io.Reader, options LoadOptions) (report LoadReport, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
 		}
+	}()
 
-		fmt.Printf("\n")
+	cl := newCityLoader(ci, source, options, false)
+	cl.bytesTotal = inputSize(r)
 
-		misses := make([]string, 0)
-		for _, cityId := range specificCityIds {
-			if _, found := cityFilterHits[cityId]; found == false {
-				misses = append(misses, cityId)
-			}
+	cr := &countingReader{
+		r: r,
+	}
+
+	_, _, err = cl.load(cr, "", cr)
+	log.PanicIf(err)
+
+	report = cl.finish()
+
+	return report, nil
+}
+
+// LoadFiles feeds several city-data files into the index as if they were one.
+// The file-paths may be globs (see `geoattractorparse.ExpandCitydataFilepaths`)
+// and each file may be in any of the formats supported by
+// `geoattractorparse.NewCitydataReadCloser`. Records that have the same ID as
+// one loaded from an earlier file are skipped. What each file contributed is
+// recorded in the `Inputs` member of both the report and the stats.
+func (ci *CityIndex) LoadFiles(source geoattractor.CityRecordSource, filepaths []string, options LoadOptions) (report LoadReport, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
 		}
+	}()
 
-		if len(misses) > 0 {
-			fmt.Printf("One or more of the filtered cities was not found in the city data:\n")
-			fmt.Printf("\n")
+	filepaths, err = geoattractorparse.ExpandCitydataFilepaths(filepaths)
+	log.PanicIf(err)
 
-			for _, cityId := range misses {
-				fmt.Printf("> %s\n", cityId)
-			}
+	cl := newCityLoader(ci, source, options, true)
+
+	// Progress is estimated from the combined size of the files, so we can only
+	// estimate if we know all of their sizes.
 
-			fmt.Printf("\n")
+	for _, filepath := range filepaths {
+		if filepath == "-" {
+			cl.bytesTotal = 0
+			break
 		}
+
+		fi, err := os.Stat(filepath)
+		log.PanicIf(err)
+
+		cl.bytesTotal += fi.Size()
 	}
 
-	if len(countryFilterHits) > 0 && ci.beVerbose == true {
-		fmt.Printf("\n")
-		fmt.Printf("Country load-filter hits:\n")
-		fmt.Printf("\n")
+	loadFile := func(filepath string) {
+		var rc io.ReadCloser
+		var counter byteCounter
 
-		// TODO(dustin): !! Sort this.
-		for name, tally := range countryFilterHits {
-			fmt.Printf("> %s (%d)\n", name, tally)
-		}
+		if filepath == "-" {
+			cr := &countingReader{
+				r: os.Stdin,
+			}
+
+			// We don't want to close STDIN out from under the process.
+			rc, err = geoattractorparse.NewCitydataReadCloser(ioutil.NopCloser(cr))
+			log.PanicIf(err)
+
+			counter = cr
+		} else {
+			f, err := os.Open(filepath)
+			log.PanicIf(err)
 
-		fmt.Printf("\n")
+			cf := &countingFile{
+				File: f,
+			}
 
-		misses := make([]string, 0)
-		for _, name := range specificCountryNames {
-			if _, found := countryFilterHits[name]; found == false {
-				misses = append(misses, name)
+			rc, err = geoattractorparse.NewCitydataReadCloser(cf)
+			if err != nil {
+				f.Close()
+				log.Panic(err)
 			}
+
+			counter = cf
 		}
 
-		if len(misses) > 0 {
-			fmt.Printf("One or more of the filtered countries was not found in the city data:\n")
-			fmt.Printf("\n")
+		defer rc.Close()
 
-			for _, name := range misses {
-				fmt.Printf("> %s\n", name)
-			}
+		before := ci.stats
+
+		recordsCount, duplicatesCount, err := cl.load(rc, filepath, counter)
+		log.PanicIf(err)
 
-			fmt.Printf("\n")
+		is := InputStats{
+			Name:              filepath,
+			UnfilteredRecords: recordsCount,
+			DuplicateRecords:  duplicatesCount,
+			RecordAdds:        ci.stats.RecordAdds - before.RecordAdds,
+			RecordUpdates:     ci.stats.RecordUpdates - before.RecordUpdates,
 		}
+
+		ci.stats.Inputs = append(ci.stats.Inputs, is)
+		cl.report.Inputs = append(cl.report.Inputs, is)
 	}
 
-	return nil
+	for _, filepath := range filepaths {
+		loadFile(filepath)
+	}
+
+	report = cl.finish()
+
+	return report, nil
 }
 
 type VisitHistoryItem struct {
@@ -1,16 +1,25 @@
 package geoattractorindex
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"os"
 	"path"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"encoding/json"
+	"io/ioutil"
 
 	"github.com/dsoprea/go-logging"
 
 	"github.com/dsoprea/go-geographic-attractor"
 	"github.com/dsoprea/go-geographic-attractor/parse"
+	"github.com/dsoprea/go-geographic-attractor/synthetic"
 )
 
 func getCityIndex(cityDataFilepath string) (*CityIndex, string) {
@@ -45,7 +54,7 @@ func getCityIndex(cityDataFilepath string) (*CityIndex, string) {
 
 	ci, kvFilepath := NewTestCityIndex()
 
-	err = ci.Load(gp, g, nil, nil)
+	_, err = ci.Load(gp, g, LoadOptions{})
 	log.PanicIf(err)
 
 	// Now, close and reopen, so we can rely on the DB.
@@ -56,6 +65,28 @@ func getCityIndex(cityDataFilepath string) (*CityIndex, string) {
 	return ci, kvFilepath
 }
 
+// getRecordCityIndex returns an index loaded with just the given cities, under
+// the synthetic source-name.
+func getRecordCityIndex(records []geoattractor.CityRecord) (ci *CityIndex, kvFilepath string) {
+	source := geoattractorsynthetic.NewRecordSource(geoattractorsynthetic.SourceName, records)
+
+	ci, kvFilepath = NewTestCityIndex()
+
+	_, err := ci.Load(source, nil, LoadOptions{})
+	log.PanicIf(err)
+
+	return ci, kvFilepath
+}
+
+// Cities around Al Ain and Dubai (`testDubai` is with the filter tests). Only
+// the two large ones attract.
+var (
+	testAlAin     = geoattractor.CityRecord{Id: "292913", Country: "United Arab Emirates", City: "Al Ain", Population: 408733, Latitude: 24.19167, Longitude: 55.76056}
+	testDeira     = geoattractor.CityRecord{Id: "1", Country: "United Arab Emirates", City: "Deira Village", Population: 500, Latitude: 25.2, Longitude: 55.27}
+	testMahdah    = geoattractor.CityRecord{Id: "2", Country: "Oman", City: "Mahdah Village", Population: 300, Latitude: 24.05, Longitude: 56.1}
+	testUaeCities = []geoattractor.CityRecord{testAlAin, testDubai, testDeira, testMahdah}
+)
+
 func dumpVisits(visits []VisitHistoryItem) {
 	for _, vhi := range visits {
 		fmt.Printf("%s: %s\n", vhi.Token, vhi.City)
@@ -71,7 +102,7 @@ func TestCityIndex_Nearest_Miss(t *testing.T) {
 		}
 	}()
 
-	ci, kvFilepath := getCityIndex(path.Join(appPath, "index", "test", "asset", "allCountries.txt.head"))
+	ci, kvFilepath := getRecordCityIndex(testUaeCities)
 
 	defer os.Remove(kvFilepath)
 	defer ci.Close()
@@ -89,7 +120,7 @@ func TestCityIndex_Nearest_Miss(t *testing.T) {
 // TestCityIndex_Nearest_MultipleWithinSameCity just tests that multiple local
 // points resolve to that same city. It's not profound.
 func TestCityIndex_Nearest_MultipleWithinSameCity(t *testing.T) {
-	ci, kvFilepath := getCityIndex(path.Join(appPath, "index", "test", "asset", "allCountries.txt.head"))
+	ci, kvFilepath := getRecordCityIndex(testUaeCities)
 
 	defer os.Remove(kvFilepath)
 	defer ci.Close()
@@ -101,7 +132,7 @@ func TestCityIndex_Nearest_MultipleWithinSameCity(t *testing.T) {
 	sourceName1, _, cr1, err := ci.Nearest(alainCoordinates[0], alainCoordinates[1], false)
 	log.PanicIf(err)
 
-	if sourceName1 != "GeoNames" {
+	if sourceName1 != geoattractorsynthetic.SourceName {
 		t.Fatalf("Source-name for search (1) is not correct: [%s]", sourceName1)
 	} else if cr1.Id != "292913" {
 		t.Fatalf("ID for search (1) is not correct: [%s]", cr1.Id)
@@ -354,7 +385,7 @@ func ExampleCityIndex_Nearest() {
 	defer os.Remove(kvFilepath)
 	defer ci.Close()
 
-	err = ci.Load(gp, g, nil, nil)
+	_, err = ci.Load(gp, g, LoadOptions{})
 	log.PanicIf(err)
 
 	// Do the query.
@@ -555,3 +586,579 @@ func TestCityIndex_kvGet(t *testing.T) {
 		t.Fatalf("Recovered value is not the same: %v != %v", recovered, value)
 	}
 }
+
+func TestCityIndex_LoadFiles(t *testing.T) {
+	gp := getTestGeonamesParser()
+
+	// Write the first half of the sample to one file and all of it to
+	// another so that the second file repeats the records of the first.
+
+	data, err := ioutil.ReadFile(path.Join(appPath, "parse", "test", "asset", "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	i := bytes.IndexByte(data[len(data)/2:], '\n') + len(data)/2
+
+	tempPath, err := ioutil.TempDir("", "")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	err = ioutil.WriteFile(path.Join(tempPath, "a.txt"), data[:i+1], 0644)
+	log.PanicIf(err)
+
+	err = ioutil.WriteFile(path.Join(tempPath, "b.txt"), data, 0644)
+	log.PanicIf(err)
+
+	ci, kvFilepath := NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	report, err := ci.LoadFiles(gp, []string{path.Join(tempPath, "*.txt")}, LoadOptions{})
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(report.Inputs, ci.Stats().Inputs) == false {
+		t.Fatalf("Report inputs not correct: %v", report.Inputs)
+	}
+
+	stats := ci.Stats()
+
+	if len(stats.Inputs) != 2 {
+		t.Fatalf("Expected two inputs: %v", stats.Inputs)
+	}
+
+	first := stats.Inputs[0]
+	second := stats.Inputs[1]
+
+	if first.Name != path.Join(tempPath, "a.txt") || second.Name != path.Join(tempPath, "b.txt") {
+		t.Fatalf("Input names not correct: [%s] [%s]", first.Name, second.Name)
+	} else if first.UnfilteredRecords == 0 || first.DuplicateRecords != 0 || first.RecordAdds == 0 {
+		t.Fatalf("First input not correct: %s", first)
+	} else if second.UnfilteredRecords != 35 || second.DuplicateRecords != first.UnfilteredRecords {
+		t.Fatalf("Second input not correct: %s", second)
+	} else if stats.UnfilteredRecords != first.UnfilteredRecords+second.UnfilteredRecords {
+		t.Fatalf("Total unfiltered records not correct: (%d)", stats.UnfilteredRecords)
+	} else if stats.DuplicateRecords != first.UnfilteredRecords {
+		t.Fatalf("Total duplicates not correct: (%d)", stats.DuplicateRecords)
+	} else if stats.RecordAdds != first.RecordAdds+second.RecordAdds {
+		t.Fatalf("Total adds not correct: (%d)", stats.RecordAdds)
+	}
+
+	// Every record should be findable.
+
+	cr, err := ci.GetById("GeoNames", "1120879")
+	log.PanicIf(err)
+
+	if cr.City != "Zaṟah Sharan" {
+		t.Fatalf("Record from second input not correct: %s", cr)
+	}
+}
+
+func TestCityIndex_Load_Report(t *testing.T) {
+	gp := getTestGeonamesParser()
+
+	f, err := os.Open(path.Join(appPath, "parse", "test", "asset", "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	ci, kvFilepath := NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	report, err := ci.Load(gp, f, LoadOptions{Filter: NewCountryFilter("Atlantis", "Andorra")})
+	log.PanicIf(err)
+
+	if report.SourceName != "GeoNames" {
+		t.Fatalf("Source-name not correct: [%s]", report.SourceName)
+	} else if report.Parsed != 35 || report.Filtered != 20 || report.Indexed != 15 {
+		t.Fatalf("Counts not correct: %s", report)
+	} else if report.Added != ci.Stats().RecordAdds || report.Updated != ci.Stats().RecordUpdates {
+		t.Fatalf("Index counts not correct: %s", report)
+	}
+
+	expectedCountries := []LoadTally{
+		{Name: "Andorra", Count: 15},
+	}
+
+	if reflect.DeepEqual(report.Countries, expectedCountries) == false {
+		t.Fatalf("Country tallies not correct: %v", report.Countries)
+	} else if reflect.DeepEqual(report.CountryFilterHits, expectedCountries) == false {
+		t.Fatalf("Country filter hits not correct: %v", report.CountryFilterHits)
+	} else if reflect.DeepEqual(report.CountryFilterMisses, []string{"Atlantis"}) == false {
+		t.Fatalf("Country filter misses not correct: %v", report.CountryFilterMisses)
+	} else if report.CityFilterHits != nil || report.CityFilterMisses != nil {
+		t.Fatalf("City filter should not be reported: %v %v", report.CityFilterHits, report.CityFilterMisses)
+	}
+
+	// Every row in the sample is either parsed or skipped for a reason.
+
+	if report.Parsed+report.SkippedRowsCount() != 10000 {
+		t.Fatalf("Skipped rows not correct: %v", report.SkippedRows)
+	}
+
+	for _, lt := range report.SkippedRows {
+		if lt.Name == geoattractorparse.GeonamesSkipNotPopulatedPlace {
+			return
+		}
+	}
+
+	t.Fatalf("Expected rows to be skipped for not being populated places: %v", report.SkippedRows)
+}
+
+func TestCityIndex_Load_ReportCityFilter(t *testing.T) {
+	gp := getTestGeonamesParser()
+
+	f, err := os.Open(path.Join(appPath, "parse", "test", "asset", "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	ci, kvFilepath := NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	report, err := ci.Load(gp, f, LoadOptions{Filter: NewIdFilter("292968", "292223", "1")})
+	log.PanicIf(err)
+
+	expectedHits := []LoadTally{
+		{Name: "292223", Count: 1},
+		{Name: "292968", Count: 1},
+	}
+
+	if report.Indexed != 2 || report.Filtered != 33 {
+		t.Fatalf("Counts not correct: %s", report)
+	} else if reflect.DeepEqual(report.CityFilterHits, expectedHits) == false {
+		t.Fatalf("City filter hits not correct: %v", report.CityFilterHits)
+	} else if reflect.DeepEqual(report.CityFilterMisses, []string{"1"}) == false {
+		t.Fatalf("City filter misses not correct: %v", report.CityFilterMisses)
+	}
+}
+
+type recordingProgressReporter struct {
+	progress []LoadProgress
+	finished []LoadProgress
+}
+
+func (rpr *recordingProgressReporter) Progress(lp LoadProgress) {
+	rpr.progress = append(rpr.progress, lp)
+}
+
+func (rpr *recordingProgressReporter) Finish(lp LoadProgress) {
+	rpr.finished = append(rpr.finished, lp)
+}
+
+func TestCityIndex_Load_JsonProgress(t *testing.T) {
+	gp := getTestGeonamesParser()
+
+	f, err := os.Open(path.Join(appPath, "parse", "test", "asset", "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	fi, err := f.Stat()
+	log.PanicIf(err)
+
+	ci, kvFilepath := NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	b := new(bytes.Buffer)
+	ci.SetProgressReporter(NewJsonProgressReporter(b, time.Nanosecond))
+
+	_, err = ci.Load(gp, f, LoadOptions{})
+	log.PanicIf(err)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("Expected progress and a final line: %v", lines)
+	}
+
+	var first LoadProgress
+	err = json.Unmarshal([]byte(lines[0]), &first)
+	log.PanicIf(err)
+
+	if first.Phase != LoadPhaseLoading || first.RecordsDone != 1 {
+		t.Fatalf("First progress not correct: %v", first)
+	} else if first.BytesTotal != fi.Size() || first.TotalIsEstimate != true || first.RecordsTotal < 1 {
+		t.Fatalf("First progress was not estimated: %v", first)
+	}
+
+	var last LoadProgress
+	err = json.Unmarshal([]byte(lines[len(lines)-1]), &last)
+	log.PanicIf(err)
+
+	expected := LoadProgress{
+		Phase:           LoadPhaseFinished,
+		RecordsDone:     35,
+		RecordsTotal:    35,
+		TotalIsEstimate: true,
+		BytesRead:       fi.Size(),
+		BytesTotal:      fi.Size(),
+	}
+
+	if last != expected {
+		t.Fatalf("Final progress not correct: %v", last)
+	}
+}
+
+func TestCityIndex_LoadFiles_ProgressWithTotal(t *testing.T) {
+	gp := getTestGeonamesParser()
+
+	cityDataFilepath := path.Join(appPath, "parse", "test", "asset", "allCountries.txt.short")
+
+	ci, kvFilepath := NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	rpr := new(recordingProgressReporter)
+	ci.SetProgressReporter(rpr)
+	ci.SetTotalRecords(100)
+
+	_, err := ci.LoadFiles(gp, []string{cityDataFilepath}, LoadOptions{})
+	log.PanicIf(err)
+
+	if len(rpr.progress) != 35 || len(rpr.finished) != 1 {
+		t.Fatalf("Progress not reported for every record: (%d) (%d)", len(rpr.progress), len(rpr.finished))
+	}
+
+	for i, lp := range rpr.progress {
+		if lp.RecordsDone != i+1 || lp.RecordsTotal != 100 || lp.TotalIsEstimate != false || lp.Input != cityDataFilepath {
+			t.Fatalf("Progress (%d) not correct: %v", i, lp)
+		}
+	}
+
+	if rpr.finished[0].Phase != LoadPhaseFinished || rpr.finished[0].BytesRead != rpr.finished[0].BytesTotal {
+		t.Fatalf("Final progress not correct: %v", rpr.finished[0])
+	}
+}
+
+func TestCityIndex_SetUrbanCenterMinimumPopulation(t *testing.T) {
+	ci, kvFilepath := getRecordCityIndex(testUaeCities)
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	if ci.UrbanCenterMinimumPopulation() != DefaultUrbanCenterMinimumPopulation {
+		t.Fatalf("Threshold not correct: (%d)", ci.UrbanCenterMinimumPopulation())
+	}
+
+	_, _, cr, err := ci.Nearest(25.2048, 55.2708, false)
+	log.PanicIf(err)
+
+	if cr.Id != "292223" {
+		t.Fatalf("Expected Dubai to attract the point: %s", cr)
+	}
+
+	// Nothing is large enough to attract, so the nearest city wins. The earlier
+	// result mustn't come from the cache.
+
+	ci.SetUrbanCenterMinimumPopulation(2000000)
+
+	_, _, cr, err = ci.Nearest(25.2048, 55.2708, false)
+	log.PanicIf(err)
+
+	if cr.Id != testDeira.Id {
+		t.Fatalf("Expected the village nearest the point: %s", cr)
+	}
+
+	ci.SetUrbanCenterMinimumPopulation(DefaultUrbanCenterMinimumPopulation)
+
+	_, _, cr, err = ci.Nearest(25.2048, 55.2708, false)
+	log.PanicIf(err)
+
+	if cr.Id != "292223" {
+		t.Fatalf("Expected Dubai again: %s", cr)
+	}
+}
+
+func getTestGeonamesParser() *geoattractorparse.GeonamesParser {
+	countryDataFilepath := path.Join(appPath, "test", "asset", "countryInfo.txt")
+
+	gp, err := geoattractorparse.NewGeonamesParserWithFiles(countryDataFilepath)
+	log.PanicIf(err)
+
+	return gp
+}
+
+// getBenchmarkData returns the bundled sample of GeoNames data if `count` is
+// zero or that many synthetic cities, in the same format, otherwise.
+func getBenchmarkData(count int) (data []byte, records []geoattractor.CityRecord) {
+	if count == 0 {
+		data, err := ioutil.ReadFile(path.Join(appPath, "parse", "test", "asset", "allCountries.txt.short"))
+		log.PanicIf(err)
+
+		return data, nil
+	}
+
+	g := geoattractorsynthetic.NewGenerator(geoattractorsynthetic.GeneratorConfig{Count: count, Seed: 1})
+
+	b := new(bytes.Buffer)
+
+	err := g.WriteGeonames(b)
+	log.PanicIf(err)
+
+	return b.Bytes(), g.Records()
+}
+
+func benchmarkCityIndexLoad(b *testing.B, data []byte) {
+	gp := getTestGeonamesParser()
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ci, kvFilepath := NewTestCityIndex()
+		b.StartTimer()
+
+		_, err := ci.Load(gp, bytes.NewReader(data), LoadOptions{})
+		log.PanicIf(err)
+
+		b.StopTimer()
+		ci.Close()
+		os.Remove(kvFilepath)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkCityIndex_Load(b *testing.B) {
+	data, _ := getBenchmarkData(0)
+	benchmarkCityIndexLoad(b, data)
+}
+
+func BenchmarkCityIndex_Load_Synthetic(b *testing.B) {
+	for _, count := range []int{1000, 10000} {
+		data, _ := getBenchmarkData(count)
+
+		b.Run(fmt.Sprintf("cities=%d", count), func(b *testing.B) {
+			benchmarkCityIndexLoad(b, data)
+		})
+	}
+}
+
+// getSyntheticCityIndex returns an index loaded directly with synthetic
+// cities along with the cities.
+func getSyntheticCityIndex(config geoattractorsynthetic.GeneratorConfig) (ci *CityIndex, kvFilepath string, records []geoattractor.CityRecord) {
+	g := geoattractorsynthetic.NewGenerator(config)
+	source := g.Source()
+
+	ci, kvFilepath = NewTestCityIndex()
+
+	_, err := ci.Load(source, nil, LoadOptions{})
+	log.PanicIf(err)
+
+	return ci, kvFilepath, g.Records()
+}
+
+func getBenchmarkCityIndex(count int) (ci *CityIndex, kvFilepath string, records []geoattractor.CityRecord) {
+	return getSyntheticCityIndex(geoattractorsynthetic.GeneratorConfig{Count: count, Seed: 1})
+}
+
+// closeAfterBenchmark closes and removes the index once the benchmark is done.
+// The timer is stopped by then, so closing the store isn't measured.
+func closeAfterBenchmark(b *testing.B, ci *CityIndex, kvFilepath string) {
+	b.Cleanup(func() {
+		ci.Close()
+		os.Remove(kvFilepath)
+	})
+}
+
+func BenchmarkCityIndex_Nearest_Cold(b *testing.B) {
+	ci, kvFilepath, records := getBenchmarkCityIndex(2000)
+
+	closeAfterBenchmark(b, ci, kvFilepath)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// Every query has to search the index. Resetting is two small
+		// allocations, which is negligible next to the search, and cheaper to
+		// leave in than stopping and starting the timer around it.
+		ci.resetNearestCache()
+
+		cr := records[i%len(records)]
+
+		_, _, _, err := ci.Nearest(cr.Latitude, cr.Longitude, false)
+		log.PanicIf(err)
+	}
+}
+
+func BenchmarkCityIndex_Nearest_Cached(b *testing.B) {
+	ci, kvFilepath, records := getBenchmarkCityIndex(2000)
+
+	closeAfterBenchmark(b, ci, kvFilepath)
+
+	cr := records[0]
+
+	_, _, _, err := ci.Nearest(cr.Latitude, cr.Longitude, false)
+	log.PanicIf(err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _, _, err := ci.Nearest(cr.Latitude, cr.Longitude, false)
+		log.PanicIf(err)
+	}
+}
+
+func BenchmarkCityIndex_GetById(b *testing.B) {
+	ci, kvFilepath, records := getBenchmarkCityIndex(2000)
+
+	closeAfterBenchmark(b, ci, kvFilepath)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := ci.GetById(geoattractorsynthetic.SourceName, records[i%len(records)].Id)
+		log.PanicIf(err)
+	}
+}
+
+func getBenchmarkIndexEntries() []IndexEntry {
+	_, records := getBenchmarkData(5)
+
+	entries := make([]IndexEntry, len(records))
+	for i, cr := range records {
+		entries[i] = IndexEntry{
+			SourceName: "GeoNames",
+			CityRecord: cr,
+		}
+	}
+
+	return entries
+}
+
+func BenchmarkCityIndex_kvPut(b *testing.B) {
+	ci, kvFilepath := NewTestCityIndex()
+
+	closeAfterBenchmark(b, ci, kvFilepath)
+
+	entries := getBenchmarkIndexEntries()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		kk := kvKey{FineTokenKeyGroup, strconv.Itoa(i % 1000)}
+
+		err := ci.kvPut(kk, entries)
+		log.PanicIf(err)
+	}
+}
+
+func BenchmarkCityIndex_kvGet(b *testing.B) {
+	ci, kvFilepath := NewTestCityIndex()
+
+	closeAfterBenchmark(b, ci, kvFilepath)
+
+	entries := getBenchmarkIndexEntries()
+
+	for i := 0; i < 1000; i++ {
+		kk := kvKey{FineTokenKeyGroup, strconv.Itoa(i)}
+
+		err := ci.kvPut(kk, entries)
+		log.PanicIf(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		kk := kvKey{FineTokenKeyGroup, strconv.Itoa(i % 1000)}
+
+		recovered := make([]IndexEntry, 0)
+
+		err := ci.kvGet(kk, &recovered)
+		log.PanicIf(err)
+	}
+}
+
+func TestCityIndex_Nearest_SyntheticEdgeCases(t *testing.T) {
+	config := geoattractorsynthetic.GeneratorConfig{
+		Count:     100,
+		Seed:      1,
+		EdgeCases: true,
+	}
+
+	ci, kvFilepath, records := getSyntheticCityIndex(config)
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	// Nothing is large enough to attract, so every city is the nearest to its
+	// own coordinates.
+	ci.SetUrbanCenterMinimumPopulation(math.MaxInt32)
+
+	for _, expected := range records[100:] {
+		sourceName, _, cr, err := ci.Nearest(expected.Latitude, expected.Longitude, false)
+		log.PanicIf(err)
+
+		if sourceName != geoattractorsynthetic.SourceName {
+			t.Fatalf("Source not correct: [%s]", sourceName)
+		} else if cr.Id != expected.Id {
+			t.Fatalf("Edge case [%s] not found at its own coordinates: %s", expected.City, cr)
+		}
+
+		recovered, err := ci.GetById(sourceName, expected.Id)
+		log.PanicIf(err)
+
+		if recovered.City != expected.City {
+			t.Fatalf("Edge case [%s] not recovered by ID: %s", expected.City, recovered)
+		}
+	}
+}
+
+func TestCityIndex_Load_Delimited(t *testing.T) {
+	data := "id,name,lat,lon,pop\n" +
+		"A.1,Good,42.33143,-83.04575,1000\n" +
+		"2,Not A Number,NaN,-83.0,1000\n" +
+		"3,Too Far North,95.0,-83.0,1000\n" +
+		"4,Too Far East,42.0,200.0,1000\n" +
+		",No ID,42.0,-83.0,1000\n"
+
+	dp := geoattractorparse.NewDelimitedParser(geoattractorparse.DelimitedParserConfig{
+		HasHeader: true,
+		Columns: geoattractorparse.DelimitedColumnMapping{
+			Id:         geoattractorparse.ColumnByName("id"),
+			City:       geoattractorparse.ColumnByName("name"),
+			Latitude:   geoattractorparse.ColumnByName("lat"),
+			Longitude:  geoattractorparse.ColumnByName("lon"),
+			Population: geoattractorparse.ColumnByName("pop"),
+		},
+	})
+
+	ci, kvFilepath := NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	report, err := ci.Load(dp, strings.NewReader(data), LoadOptions{})
+	log.PanicIf(err)
+
+	if report.Indexed != 1 || report.SkippedRowsCount() != 4 {
+		t.Fatalf("Report not correct: %v", report)
+	}
+
+	sourceName, _, cr, err := ci.Nearest(42.33, -83.04, false)
+	log.PanicIf(err)
+
+	if sourceName != geoattractorparse.DefaultDelimitedSourceName || cr.Id != "A.1" {
+		t.Fatalf("Nearest not correct: [%s] %s", sourceName, cr)
+	}
+
+	verifyReport, err := ci.Verify(false)
+	log.PanicIf(err)
+
+	if verifyReport.IsConsistent() == false {
+		t.Fatalf("Index not consistent: %v", verifyReport.Issues)
+	}
+}
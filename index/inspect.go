@@ -0,0 +1,445 @@
+package geoattractorindex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"container/heap"
+	"encoding/gob"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/golang/geo/s2"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+const (
+	// The short names of the key groups, as used by `InspectFilter` and
+	// `InspectItem`.
+	InspectGroupCity     = "city"
+	InspectGroupToken    = "token"
+	InspectGroupMetadata = "metadata"
+)
+
+// InspectFilter selects what `Inspect()` returns. Empty fields match
+// everything.
+type InspectFilter struct {
+	// Groups are the short names of the key groups to return.
+	Groups []string
+
+	// TokenPrefix and Levels only apply to fine-token keys.
+	TokenPrefix string
+	Levels      []int
+
+	// CityId selects cities with this ID (from any source) and, for tokens,
+	// only the entries for those cities. Tokens without any are skipped.
+	CityId string
+}
+
+func (inf InspectFilter) hasGroup(group string) bool {
+	if len(inf.Groups) == 0 {
+		return true
+	}
+
+	for _, g := range inf.Groups {
+		if g == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (inf InspectFilter) hasLevel(level int) bool {
+	if len(inf.Levels) == 0 {
+		return true
+	}
+
+	for _, l := range inf.Levels {
+		if l == level {
+			return true
+		}
+	}
+
+	return false
+}
+
+// InspectEntry is one city at a token.
+type InspectEntry struct {
+	SourceName string `json:"source"`
+
+	// LeafLevel and LeafToken are the cell that the city is at, regardless of
+	// the level of the token that it's listed under.
+	LeafLevel int    `json:"leaf_level"`
+	LeafToken string `json:"leaf_token"`
+
+	City geoattractor.CityRecord `json:"city"`
+}
+
+// InspectItem is one key from the store. Which of the value fields is set
+// depends on the group.
+type InspectItem struct {
+	Key   string `json:"key"`
+	Group string `json:"group"`
+	Name  string `json:"name"`
+
+	// Level is the level of a token.
+	Level int `json:"level,omitempty"`
+
+	City     *geoattractor.CityRecord `json:"city,omitempty"`
+	Entries  []InspectEntry           `json:"entries,omitempty"`
+	Metadata string                   `json:"metadata,omitempty"`
+}
+
+// TokenEntries returns the cities indexed at exactly the given token. Unlike
+// `Inspect()`, it reads the one key rather than walking the store. Returns an
+// empty slice if there are none.
+func (ci *CityIndex) TokenEntries(token string) (entries []InspectEntry, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	fineTokenKk := kvKey{FineTokenKeyGroup, token}
+
+	records := make([]IndexEntry, 0)
+
+	err = ci.kvGet(fineTokenKk, &records)
+	if err == ErrNotFound {
+		return []InspectEntry{}, nil
+	}
+
+	log.PanicIf(err)
+
+	entries = make([]InspectEntry, len(records))
+	for i, ie := range records {
+		entries[i] = InspectEntry{
+			SourceName: ie.SourceName,
+			LeafLevel:  ie.Level,
+			LeafToken:  ie.LeafCellToken,
+			City:       ie.CityRecord,
+		}
+	}
+
+	return entries, nil
+}
+
+// Inspect calls `cb` with every key in the store that matches the filter.
+// Unlike `KvDump()`, the values are decoded into structures that can be
+// encoded as JSON.
+func (ci *CityIndex) Inspect(filter InspectFilter, cb func(item InspectItem) error) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = ci.kvInit()
+	log.PanicIf(err)
+
+	err = ci.kvWalk(func(kk kvKey, key []byte, gd *gob.Decoder) {
+		item := InspectItem{
+			Key:  kk.Key(),
+			Name: kk.name,
+		}
+
+		if kk.EqualsGroup(CityIndexKeyGroup) == true {
+			if filter.hasGroup(InspectGroupCity) == false {
+				return
+			}
+
+			cr := geoattractor.CityRecord{}
+
+			err := gd.Decode(&cr)
+			log.PanicIf(err)
+
+			if filter.CityId != "" && cr.Id != filter.CityId {
+				return
+			}
+
+			item.Group = InspectGroupCity
+			item.City = &cr
+		} else if kk.EqualsGroup(FineTokenKeyGroup) == true {
+			if filter.hasGroup(InspectGroupToken) == false || strings.HasPrefix(kk.name, filter.TokenPrefix) == false {
+				return
+			}
+
+			level := s2.CellIDFromToken(kk.name).Level()
+			if filter.hasLevel(level) == false {
+				return
+			}
+
+			records := make([]IndexEntry, 0)
+
+			err := gd.Decode(&records)
+			log.PanicIf(err)
+
+			entries := make([]InspectEntry, 0, len(records))
+			for _, ie := range records {
+				if filter.CityId != "" && ie.CityRecord.Id != filter.CityId {
+					continue
+				}
+
+				entry := InspectEntry{
+					SourceName: ie.SourceName,
+					LeafLevel:  ie.Level,
+					LeafToken:  ie.LeafCellToken,
+					City:       ie.CityRecord,
+				}
+
+				entries = append(entries, entry)
+			}
+
+			if filter.CityId != "" && len(entries) == 0 {
+				return
+			}
+
+			item.Group = InspectGroupToken
+			item.Level = level
+			item.Entries = entries
+		} else if kk.EqualsGroup(MetadataKeyGroup) == true {
+			if filter.hasGroup(InspectGroupMetadata) == false || filter.CityId != "" {
+				return
+			}
+
+			err := gd.Decode(&item.Metadata)
+			log.PanicIf(err)
+
+			item.Group = InspectGroupMetadata
+		} else {
+			// Unrecognized keys are reported by `Verify()`.
+			return
+		}
+
+		err := cb(item)
+		log.PanicIf(err)
+	})
+
+	log.PanicIf(err)
+
+	return nil
+}
+
+// LevelCount is the number of tokens and the number of entries across them for
+// one level.
+type LevelCount struct {
+	Level   int `json:"level"`
+	Tokens  int `json:"tokens"`
+	Entries int `json:"entries"`
+}
+
+// TokenSizeBucket is the number of tokens that hold between `Min` and `Max`
+// cities, inclusive.
+type TokenSizeBucket struct {
+	Min    int `json:"min"`
+	Max    int `json:"max"`
+	Tokens int `json:"tokens"`
+}
+
+// TokenSize is the number of cities at one token.
+type TokenSize struct {
+	Token  string `json:"token"`
+	Level  int    `json:"level"`
+	Cities int    `json:"cities"`
+}
+
+// IndexStats summarizes what's in the store. The tallies are sorted by name.
+type IndexStats struct {
+	Keys     int `json:"keys"`
+	Cities   int `json:"cities"`
+	Tokens   int `json:"tokens"`
+	Entries  int `json:"entries"`
+	Metadata int `json:"metadata"`
+
+	Levels []LevelCount `json:"levels"`
+
+	// TokenSizes is a histogram of how many cities each token holds, in
+	// power-of-two buckets.
+	TokenSizes []TokenSizeBucket `json:"token_sizes"`
+
+	// LargestTokens is sorted by size, largest first.
+	LargestTokens []TokenSize `json:"largest_tokens"`
+
+	Sources   []LoadTally `json:"sources"`
+	Countries []LoadTally `json:"countries"`
+}
+
+func (is IndexStats) String() string {
+	return fmt.Sprintf("IndexStats<KEYS=(%d) CITIES=(%d) TOKENS=(%d) ENTRIES=(%d) METADATA=(%d) LEVELS=(%d) SOURCES=(%d) COUNTRIES=(%d)>", is.Keys, is.Cities, is.Tokens, is.Entries, is.Metadata, len(is.Levels), len(is.Sources), len(is.Countries))
+}
+
+// tokenSizeBucketIndex returns the histogram bucket for the given number of
+// cities: 1, 2, 3-4, 5-8, 9-16, etc..
+func tokenSizeBucketIndex(cities int) (index, min, max int) {
+	min = 1
+	max = 1
+
+	for cities > max {
+		index++
+		min = max + 1
+		max *= 2
+	}
+
+	return index, min, max
+}
+
+// tokenSizeBefore returns whether `a` ranks ahead of `b` among the largest
+// tokens: largest first, and then by token so that the order is stable.
+func tokenSizeBefore(a, b TokenSize) bool {
+	if a.Cities != b.Cities {
+		return a.Cities > b.Cities
+	}
+
+	return a.Token < b.Token
+}
+
+// tokenSizeHeap is a min-heap with the token that ranks last at the top, so
+// that only the largest tokens have to be kept while walking the store.
+type tokenSizeHeap []TokenSize
+
+func (tsh tokenSizeHeap) Len() int {
+	return len(tsh)
+}
+
+func (tsh tokenSizeHeap) Less(i, j int) bool {
+	return tokenSizeBefore(tsh[j], tsh[i])
+}
+
+func (tsh tokenSizeHeap) Swap(i, j int) {
+	tsh[i], tsh[j] = tsh[j], tsh[i]
+}
+
+func (tsh *tokenSizeHeap) Push(x interface{}) {
+	*tsh = append(*tsh, x.(TokenSize))
+}
+
+func (tsh *tokenSizeHeap) Pop() interface{} {
+	old := *tsh
+	last := old[len(old)-1]
+	*tsh = old[:len(old)-1]
+
+	return last
+}
+
+// InspectStats returns statistics for the whole store. `largestCount` is the
+// number of largest tokens to return.
+func (ci *CityIndex) InspectStats(largestCount int) (stats IndexStats, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = ci.kvInit()
+	log.PanicIf(err)
+
+	levels := make(map[int]*LevelCount)
+	buckets := make([]TokenSizeBucket, 0)
+	if largestCount < 0 {
+		largestCount = 0
+	}
+
+	largest := make(tokenSizeHeap, 0, largestCount+1)
+	sources := make(map[string]int)
+	countries := make(map[string]int)
+
+	err = ci.kvWalk(func(kk kvKey, key []byte, gd *gob.Decoder) {
+		stats.Keys++
+
+		if kk.EqualsGroup(CityIndexKeyGroup) == true {
+			cr := geoattractor.CityRecord{}
+
+			err := gd.Decode(&cr)
+			log.PanicIf(err)
+
+			stats.Cities++
+
+			// The name is the ID-phrase ("<source>,<ID>").
+			sourceName := strings.SplitN(kk.name, ",", 2)[0]
+			sources[sourceName]++
+
+			countries[cr.Country]++
+		} else if kk.EqualsGroup(FineTokenKeyGroup) == true {
+			records := make([]IndexEntry, 0)
+
+			err := gd.Decode(&records)
+			log.PanicIf(err)
+
+			stats.Tokens++
+			stats.Entries += len(records)
+
+			level := s2.CellIDFromToken(kk.name).Level()
+
+			lc, found := levels[level]
+			if found == false {
+				lc = &LevelCount{
+					Level: level,
+				}
+
+				levels[level] = lc
+			}
+
+			lc.Tokens++
+			lc.Entries += len(records)
+
+			if len(records) > 0 {
+				index, min, max := tokenSizeBucketIndex(len(records))
+				for len(buckets) <= index {
+					buckets = append(buckets, TokenSizeBucket{})
+				}
+
+				buckets[index].Min = min
+				buckets[index].Max = max
+				buckets[index].Tokens++
+			}
+
+			ts := TokenSize{
+				Token:  kk.name,
+				Level:  level,
+				Cities: len(records),
+			}
+
+			if largestCount > 0 && (len(largest) < largestCount || tokenSizeBefore(ts, largest[0]) == true) {
+				heap.Push(&largest, ts)
+
+				if len(largest) > largestCount {
+					heap.Pop(&largest)
+				}
+			}
+		} else if kk.EqualsGroup(MetadataKeyGroup) == true {
+			stats.Metadata++
+		}
+	})
+
+	log.PanicIf(err)
+
+	stats.Levels = make([]LevelCount, 0, len(levels))
+	for _, lc := range levels {
+		stats.Levels = append(stats.Levels, *lc)
+	}
+
+	sort.Slice(stats.Levels, func(i, j int) bool {
+		return stats.Levels[i].Level < stats.Levels[j].Level
+	})
+
+	// Drop the buckets that nothing fell into.
+	stats.TokenSizes = make([]TokenSizeBucket, 0, len(buckets))
+	for _, tsb := range buckets {
+		if tsb.Tokens > 0 {
+			stats.TokenSizes = append(stats.TokenSizes, tsb)
+		}
+	}
+
+	tokenSizes := []TokenSize(largest)
+	sort.Slice(tokenSizes, func(i, j int) bool {
+		return tokenSizeBefore(tokenSizes[i], tokenSizes[j])
+	})
+
+	stats.LargestTokens = tokenSizes
+	stats.Sources = sortedTallies(sources)
+	stats.Countries = sortedTallies(countries)
+
+	return stats, nil
+}
@@ -0,0 +1,274 @@
+package geoattractorindex
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"container/heap"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor/synthetic"
+)
+
+func TestCityIndex_Inspect_CityId(t *testing.T) {
+	ci, kvFilepath, records := getSyntheticCityIndex(geoattractorsynthetic.GeneratorConfig{Count: 200, Seed: 1})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	err := ci.SetMetadata("test_name", "test value")
+	log.PanicIf(err)
+
+	items := make([]InspectItem, 0)
+	cb := func(item InspectItem) (err error) {
+		items = append(items, item)
+		return nil
+	}
+
+	city := records[0]
+
+	filter := InspectFilter{
+		CityId: city.Id,
+	}
+
+	err = ci.Inspect(filter, cb)
+	log.PanicIf(err)
+
+	cellId := city.S2Cell()
+	expectedTokens := cellId.Level() - ci.minimumSearchLevel + 1
+
+	cities := 0
+	tokens := 0
+	for _, item := range items {
+		if item.Group == InspectGroupCity {
+			cities++
+
+			if item.City.Id != city.Id {
+				t.Fatalf("Wrong city: %s", item.City)
+			}
+		} else if item.Group == InspectGroupToken {
+			tokens++
+
+			if len(item.Entries) != 1 || item.Entries[0].City.Id != city.Id {
+				t.Fatalf("Token entries not filtered: %v", item.Entries)
+			} else if cellId.Parent(item.Level).ToToken() != item.Name {
+				t.Fatalf("Token level not correct: [%s] (%d)", item.Name, item.Level)
+			} else if item.Entries[0].LeafToken != cellId.ToToken() {
+				t.Fatalf("Leaf token not correct: [%s]", item.Entries[0].LeafToken)
+			}
+		} else {
+			t.Fatalf("Unexpected group: [%s]", item.Group)
+		}
+	}
+
+	if cities != 1 || tokens != expectedTokens {
+		t.Fatalf("Counts not correct: CITIES=(%d) TOKENS=(%d)", cities, tokens)
+	}
+}
+
+func TestCityIndex_Inspect_TokenFilters(t *testing.T) {
+	ci, kvFilepath, records := getSyntheticCityIndex(geoattractorsynthetic.GeneratorConfig{Count: 200, Seed: 1})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	err := ci.SetMetadata("test_name", "test value")
+	log.PanicIf(err)
+
+	prefix := records[0].S2Cell().Parent(ci.minimumSearchLevel).ToToken()
+
+	items := make([]InspectItem, 0)
+	cb := func(item InspectItem) (err error) {
+		items = append(items, item)
+		return nil
+	}
+
+	filter := InspectFilter{
+		Groups:      []string{InspectGroupToken},
+		TokenPrefix: prefix,
+		Levels:      []int{ci.minimumSearchLevel},
+	}
+
+	err = ci.Inspect(filter, cb)
+	log.PanicIf(err)
+
+	if len(items) != 1 || items[0].Name != prefix {
+		t.Fatalf("Expected only the minimum-level token: %v", items)
+	}
+
+	// Metadata only.
+
+	items = make([]InspectItem, 0)
+
+	err = ci.Inspect(InspectFilter{Groups: []string{InspectGroupMetadata}}, cb)
+	log.PanicIf(err)
+
+	if len(items) != 1 || items[0].Name != "test_name" || items[0].Metadata != "test value" {
+		t.Fatalf("Metadata not correct: %v", items)
+	}
+}
+
+func TestCityIndex_InspectStats(t *testing.T) {
+	ci, kvFilepath, _ := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	stats, err := ci.InspectStats(3)
+	log.PanicIf(err)
+
+	if stats.Cities != 35 || stats.Keys != stats.Cities+stats.Tokens {
+		t.Fatalf("Counts not correct: %s", stats)
+	}
+
+	if reflect.DeepEqual(stats.Sources, []LoadTally{{Name: "GeoNames", Count: 35}}) == false {
+		t.Fatalf("Sources not correct: %v", stats.Sources)
+	}
+
+	countries := 0
+	for _, lt := range stats.Countries {
+		countries += lt.Count
+
+		if lt.Name == "Andorra" && lt.Count != 15 {
+			t.Fatalf("Andorra count not correct: (%d)", lt.Count)
+		}
+	}
+
+	if countries != 35 {
+		t.Fatalf("Countries don't add up: (%d)", countries)
+	}
+
+	// Every city is indexed at the minimum level and at its leaf.
+
+	levelTokens := 0
+	levelEntries := 0
+	for _, lc := range stats.Levels {
+		levelTokens += lc.Tokens
+		levelEntries += lc.Entries
+
+		if lc.Level < ci.minimumSearchLevel {
+			t.Fatalf("Level below the minimum: (%d)", lc.Level)
+		}
+	}
+
+	if levelTokens != stats.Tokens || levelEntries != stats.Entries {
+		t.Fatalf("Levels don't add up: TOKENS=(%d) ENTRIES=(%d)", levelTokens, levelEntries)
+	} else if stats.Levels[0].Level != ci.minimumSearchLevel || stats.Levels[0].Entries != 35 {
+		t.Fatalf("Minimum level not correct: %v", stats.Levels[0])
+	}
+
+	histogramTokens := 0
+	for _, tsb := range stats.TokenSizes {
+		histogramTokens += tsb.Tokens
+	}
+
+	if histogramTokens != stats.Tokens {
+		t.Fatalf("Histogram doesn't add up: (%d)", histogramTokens)
+	}
+
+	if len(stats.LargestTokens) != 3 {
+		t.Fatalf("Expected three largest tokens: %v", stats.LargestTokens)
+	} else if stats.LargestTokens[0].Cities < stats.LargestTokens[1].Cities || stats.LargestTokens[1].Cities < stats.LargestTokens[2].Cities {
+		t.Fatalf("Largest tokens not sorted: %v", stats.LargestTokens)
+	}
+
+	// The coarsest cells collect the most cities (here, most of Andorra).
+
+	if stats.LargestTokens[0].Level != ci.minimumSearchLevel || stats.LargestTokens[0].Cities != 10 {
+		t.Fatalf("Largest token not correct: %v", stats.LargestTokens[0])
+	}
+}
+
+func TestTokenSizeBucketIndex(t *testing.T) {
+	expected := map[int][3]int{
+		1:  {0, 1, 1},
+		2:  {1, 2, 2},
+		3:  {2, 3, 4},
+		4:  {2, 3, 4},
+		5:  {3, 5, 8},
+		16: {4, 9, 16},
+		17: {5, 17, 32},
+	}
+
+	for cities, bucket := range expected {
+		index, min, max := tokenSizeBucketIndex(cities)
+		if [3]int{index, min, max} != bucket {
+			t.Fatalf("Bucket for (%d) not correct: (%d) (%d) (%d)", cities, index, min, max)
+		}
+	}
+}
+
+func TestTokenSizeHeap(t *testing.T) {
+	sizes := []TokenSize{
+		{Token: "89c4", Cities: 3},
+		{Token: "89c1", Cities: 7},
+		{Token: "89c3", Cities: 1},
+		{Token: "89c2", Cities: 7},
+		{Token: "89c5", Cities: 5},
+		{Token: "89c6", Cities: 3},
+	}
+
+	largest := make(tokenSizeHeap, 0)
+	for _, ts := range sizes {
+		heap.Push(&largest, ts)
+
+		if len(largest) > 3 {
+			heap.Pop(&largest)
+		}
+	}
+
+	actual := []TokenSize(largest)
+	sort.Slice(actual, func(i, j int) bool {
+		return tokenSizeBefore(actual[i], actual[j])
+	})
+
+	expected := []TokenSize{
+		{Token: "89c1", Cities: 7},
+		{Token: "89c2", Cities: 7},
+		{Token: "89c5", Cities: 5},
+	}
+
+	if reflect.DeepEqual(actual, expected) == false {
+		t.Fatalf("Largest tokens not correct: %v", actual)
+	}
+}
+
+func TestCityIndex_TokenEntries(t *testing.T) {
+	ci, kvFilepath, records := getSyntheticCityIndex(geoattractorsynthetic.GeneratorConfig{Count: 200, Seed: 1})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	cr := records[0]
+	token := cr.S2Cell().Parent(ci.minimumSearchLevel).ToToken()
+
+	entries, err := ci.TokenEntries(token)
+	log.PanicIf(err)
+
+	found := false
+	for _, entry := range entries {
+		if entry.City.Id == cr.Id {
+			if entry.LeafToken != cr.S2Cell().ToToken() {
+				t.Fatalf("Leaf token not correct: [%s]", entry.LeafToken)
+			}
+
+			found = true
+		}
+	}
+
+	if found == false {
+		t.Fatalf("City not found at its token: %v", entries)
+	}
+
+	// Nothing is indexed above the minimum search level.
+
+	entries, err = ci.TokenEntries(cr.S2Cell().Parent(ci.minimumSearchLevel - 1).ToToken())
+	log.PanicIf(err)
+
+	if len(entries) != 0 {
+		t.Fatalf("Expected no entries: %v", entries)
+	}
+}
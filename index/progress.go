@@ -0,0 +1,206 @@
+package geoattractorindex
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"encoding/json"
+
+	"github.com/dsoprea/go-logging"
+	"gopkg.in/cheggaaa/pb.v1"
+)
+
+// Load phases.
+const (
+	// LoadPhaseLoading is reported while records are being read and indexed.
+	LoadPhaseLoading = "loading"
+
+	// LoadPhaseFinished is reported once when the load is complete.
+	LoadPhaseFinished = "finished"
+)
+
+const (
+	// DefaultJsonProgressInterval is how often `JsonProgressReporter` writes a
+	// line if an interval isn't given.
+	DefaultJsonProgressInterval = time.Second * 5
+)
+
+// LoadProgress describes how far along a load is.
+type LoadProgress struct {
+	Phase string `json:"phase"`
+
+	// Input is the name of the current input (e.g. the file-path) if known.
+	Input string `json:"input,omitempty"`
+
+	// RecordsDone is the number of records that the source has produced so
+	// far, before filtering.
+	RecordsDone int `json:"records_done"`
+
+	// RecordsTotal is the number of records expected, or zero if unknown. It's
+	// either what was given to `SetTotalRecords()` or, if `TotalIsEstimate` is
+	// true, extrapolated from how much of the input has been read.
+	RecordsTotal    int  `json:"records_total,omitempty"`
+	TotalIsEstimate bool `json:"total_is_estimate,omitempty"`
+
+	// BytesRead is how much of the input has been read. For compressed files
+	// this is the compressed size.
+	BytesRead int64 `json:"bytes_read"`
+
+	// BytesTotal is the size of the input, or zero if unknown (e.g. STDIN).
+	BytesTotal int64 `json:"bytes_total,omitempty"`
+}
+
+// ProgressReporter receives progress while the index is loaded. `Progress()`
+// is called after every record and `Finish()` is called once at the end. Both
+// are called on the loading goroutine.
+type ProgressReporter interface {
+	Progress(lp LoadProgress)
+	Finish(lp LoadProgress)
+}
+
+// TerminalProgressReporter draws a progress bar on the terminal.
+type TerminalProgressReporter struct {
+	bar *pb.ProgressBar
+}
+
+func NewTerminalProgressReporter() *TerminalProgressReporter {
+	return new(TerminalProgressReporter)
+}
+
+func (tpr *TerminalProgressReporter) Progress(lp LoadProgress) {
+	if tpr.bar == nil {
+		tpr.bar = pb.New(lp.RecordsTotal)
+		tpr.bar.Prefix("Loading cities ")
+		tpr.bar.SetMaxWidth(100)
+		tpr.bar.Start()
+	} else if int64(lp.RecordsTotal) != tpr.bar.Total {
+		tpr.bar.SetTotal(lp.RecordsTotal)
+	}
+
+	tpr.bar.Set(lp.RecordsDone)
+}
+
+func (tpr *TerminalProgressReporter) Finish(lp LoadProgress) {
+	if tpr.bar == nil {
+		return
+	}
+
+	// Make sure the bar ends up full even if the total was an estimate.
+	tpr.bar.SetTotal(lp.RecordsDone)
+	tpr.bar.Set(lp.RecordsDone)
+
+	tpr.bar.Finish()
+	tpr.bar = nil
+}
+
+// JsonProgressReporter writes progress as JSON, one object per line, no more
+// often than the given interval. The final progress is always written.
+type JsonProgressReporter struct {
+	w        io.Writer
+	interval time.Duration
+
+	lastWrittenAt time.Time
+}
+
+func NewJsonProgressReporter(w io.Writer, interval time.Duration) *JsonProgressReporter {
+	if interval == 0 {
+		interval = DefaultJsonProgressInterval
+	}
+
+	return &JsonProgressReporter{
+		w:        w,
+		interval: interval,
+	}
+}
+
+func (jpr *JsonProgressReporter) Progress(lp LoadProgress) {
+	now := time.Now()
+	if now.Sub(jpr.lastWrittenAt) < jpr.interval {
+		return
+	}
+
+	jpr.lastWrittenAt = now
+	jpr.write(lp)
+}
+
+func (jpr *JsonProgressReporter) Finish(lp LoadProgress) {
+	jpr.write(lp)
+}
+
+func (jpr *JsonProgressReporter) write(lp LoadProgress) {
+	encoded, err := json.Marshal(lp)
+	log.PanicIf(err)
+
+	encoded = append(encoded, '\n')
+
+	_, err = jpr.w.Write(encoded)
+	log.PanicIf(err)
+}
+
+// byteCounter reports how much of an input has been read.
+type byteCounter interface {
+	BytesRead() int64
+}
+
+// countingFile counts the bytes read from a file. The parallel parsers read on
+// another goroutine, so the count is kept atomically (and first, for
+// alignment). It still satisfies `io.ReaderAt` and `Stat()` so that archives
+// can be read in place.
+type countingFile struct {
+	bytesRead int64
+	*os.File
+}
+
+func (cf *countingFile) Read(p []byte) (n int, err error) {
+	n, err = cf.File.Read(p)
+	atomic.AddInt64(&cf.bytesRead, int64(n))
+
+	return n, err
+}
+
+func (cf *countingFile) ReadAt(p []byte, off int64) (n int, err error) {
+	n, err = cf.File.ReadAt(p, off)
+	atomic.AddInt64(&cf.bytesRead, int64(n))
+
+	return n, err
+}
+
+func (cf *countingFile) BytesRead() int64 {
+	return atomic.LoadInt64(&cf.bytesRead)
+}
+
+// countingReader counts the bytes read from any reader.
+type countingReader struct {
+	bytesRead int64
+	r         io.Reader
+}
+
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	atomic.AddInt64(&cr.bytesRead, int64(n))
+
+	return n, err
+}
+
+func (cr *countingReader) BytesRead() int64 {
+	return atomic.LoadInt64(&cr.bytesRead)
+}
+
+// inputSize returns the size of the given input, or zero if it can't be
+// determined.
+func inputSize(r io.Reader) int64 {
+	if f, ok := r.(*os.File); ok == true {
+		fi, err := f.Stat()
+		if err != nil || fi.Mode().IsRegular() == false {
+			return 0
+		}
+
+		return fi.Size()
+	} else if sizer, ok := r.(interface{ Size() int64 }); ok == true {
+		return sizer.Size()
+	}
+
+	return 0
+}
@@ -0,0 +1,250 @@
+package geoattractorindex
+
+import (
+	"sort"
+	"strings"
+
+	"encoding/gob"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	"github.com/kellydunn/golang-geo"
+	"github.com/randomingenuity/go-utility/geographic"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/merge"
+)
+
+// IndexedCity is a city along with the source that it was loaded from.
+type IndexedCity struct {
+	SourceName string                  `json:"source"`
+	City       geoattractor.CityRecord `json:"city"`
+}
+
+// NearbyCity is a city along with its distance from the point that was
+// queried.
+type NearbyCity struct {
+	IndexedCity
+
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// citiesInCells returns every city indexed at the tokens of the given cells.
+// The cells must be at the minimum search level, where every city is indexed,
+// so each city is returned once.
+func (ci *CityIndex) citiesInCells(cellIds []s2.CellID) (entries []IndexEntry, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	entries = make([]IndexEntry, 0)
+
+	for _, cellId := range cellIds {
+		fineTokenKk := kvKey{FineTokenKeyGroup, cellId.ToToken()}
+
+		records := make([]IndexEntry, 0)
+
+		err := ci.kvGet(fineTokenKk, &records)
+		if err == ErrNotFound {
+			continue
+		}
+
+		log.PanicIf(err)
+
+		entries = append(entries, records...)
+	}
+
+	return entries, nil
+}
+
+// sortByDistance returns the entries as `NearbyCity`s, nearest first.
+func (ci *CityIndex) sortByDistance(latitude, longitude float64, entries []IndexEntry) []NearbyCity {
+	origin := geo.NewPoint(latitude, longitude)
+
+	nearby := make([]NearbyCity, len(entries))
+	for i, ie := range entries {
+		p := geo.NewPoint(ie.CityRecord.Latitude, ie.CityRecord.Longitude)
+
+		nearby[i] = NearbyCity{
+			IndexedCity: IndexedCity{
+				SourceName: ie.SourceName,
+				City:       ie.CityRecord,
+			},
+			DistanceKm: origin.GreatCircleDistance(p),
+		}
+
+		ci.stats.HaversineCalculations++
+	}
+
+	sort.Slice(nearby, func(i, j int) bool {
+		return nearby[i].DistanceKm < nearby[j].DistanceKm
+	})
+
+	return nearby
+}
+
+// KNearest returns up to `k` cities nearest to the given coordinates, nearest
+// first. Unlike `Nearest()`, urban centers aren't preferred. Only the cities in
+// the cell at the minimum search level that contains the point and in the
+// cells that surround it are considered, so fewer than `k` may be returned in
+// sparse areas.
+func (ci *CityIndex) KNearest(latitude, longitude float64, k int) (nearby []NearbyCity, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cellId := rigeo.S2CellFromCoordinates(latitude, longitude).Parent(ci.minimumSearchLevel)
+
+	cellIds := append([]s2.CellID{cellId}, cellId.AllNeighbors(ci.minimumSearchLevel)...)
+
+	entries, err := ci.citiesInCells(cellIds)
+	log.PanicIf(err)
+
+	nearby = ci.sortByDistance(latitude, longitude, entries)
+
+	if len(nearby) > k {
+		nearby = nearby[:k]
+	}
+
+	return nearby, nil
+}
+
+// WithinRadius returns every city within `radiusKm` of the given coordinates,
+// nearest first.
+func (ci *CityIndex) WithinRadius(latitude, longitude float64, radiusKm float64) (nearby []NearbyCity, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	center := s2.PointFromLatLng(s2.LatLngFromDegrees(latitude, longitude))
+	c := s2.CapFromCenterAngle(center, s1.Angle(radiusKm/geo.EARTH_RADIUS))
+
+	rc := &s2.RegionCoverer{
+		MinLevel: ci.minimumSearchLevel,
+		MaxLevel: ci.minimumSearchLevel,
+		MaxCells: 1 << 20,
+	}
+
+	cellIds := make([]s2.CellID, 0)
+	for _, cellId := range rc.Covering(c) {
+		// The covering might have been normalized into larger cells.
+		if cellId.Level() == ci.minimumSearchLevel {
+			cellIds = append(cellIds, cellId)
+			continue
+		}
+
+		end := cellId.ChildEndAtLevel(ci.minimumSearchLevel)
+		for child := cellId.ChildBeginAtLevel(ci.minimumSearchLevel); child != end; child = child.Next() {
+			cellIds = append(cellIds, child)
+		}
+	}
+
+	entries, err := ci.citiesInCells(cellIds)
+	log.PanicIf(err)
+
+	nearby = make([]NearbyCity, 0)
+	for _, nc := range ci.sortByDistance(latitude, longitude, entries) {
+		if nc.DistanceKm > radiusKm {
+			break
+		}
+
+		nearby = append(nearby, nc)
+	}
+
+	return nearby, nil
+}
+
+// buildNameIndex maps the normalized name of every stored city to the ID-
+// phrases of the cities with that name.
+func (ci *CityIndex) buildNameIndex() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = ci.kvInit()
+	log.PanicIf(err)
+
+	nameIndex := make(map[string][]string)
+
+	err = ci.kvWalk(func(kk kvKey, key []byte, gd *gob.Decoder) {
+		if kk.EqualsGroup(CityIndexKeyGroup) == false {
+			return
+		}
+
+		cr := geoattractor.CityRecord{}
+
+		err := gd.Decode(&cr)
+		log.PanicIf(err)
+
+		name := geoattractormerge.NormalizeName(cr.City)
+		nameIndex[name] = append(nameIndex[name], kk.name)
+	})
+
+	log.PanicIf(err)
+
+	ci.nameIndex = nameIndex
+
+	return nil
+}
+
+// FindByName returns the cities with the given name, largest first. Names are
+// compared after normalization (see `geoattractormerge.NormalizeName()`), so
+// case and diacritics don't matter. If `country` is not empty only cities in
+// that country are returned. If `limit` is greater than zero at most that many
+// are returned. The names are indexed in memory on the first call.
+func (ci *CityIndex) FindByName(name, country string, limit int) (cities []IndexedCity, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if ci.nameIndex == nil {
+		err := ci.buildNameIndex()
+		log.PanicIf(err)
+	}
+
+	cities = make([]IndexedCity, 0)
+
+	for _, idPhrase := range ci.nameIndex[geoattractormerge.NormalizeName(name)] {
+		parts := strings.SplitN(idPhrase, ",", 2)
+		sourceName := parts[0]
+
+		cr, err := ci.GetById(sourceName, parts[1])
+		log.PanicIf(err)
+
+		if country != "" && strings.EqualFold(cr.Country, country) == false {
+			continue
+		}
+
+		ic := IndexedCity{
+			SourceName: sourceName,
+			City:       cr,
+		}
+
+		cities = append(cities, ic)
+	}
+
+	sort.Slice(cities, func(i, j int) bool {
+		if cities[i].City.Population != cities[j].City.Population {
+			return cities[i].City.Population > cities[j].City.Population
+		}
+
+		return cities[i].City.Id < cities[j].City.Id
+	})
+
+	if limit > 0 && len(cities) > limit {
+		cities = cities[:limit]
+	}
+
+	return cities, nil
+}
@@ -0,0 +1,194 @@
+package geoattractorindex
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/dsoprea/go-geographic-attractor/synthetic"
+)
+
+func TestCityIndex_KNearest(t *testing.T) {
+	ci, kvFilepath, _ := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	// Andorra la Vella.
+	nearby, err := ci.KNearest(42.50779, 1.52109, 3)
+	log.PanicIf(err)
+
+	if len(nearby) != 3 {
+		t.Fatalf("Expected three cities: %v", nearby)
+	} else if nearby[0].City.Id != "3041563" || nearby[0].DistanceKm != 0 {
+		t.Fatalf("First city not correct: %v", nearby[0])
+	} else if nearby[1].City.Id != "3040051" {
+		t.Fatalf("Second city not correct: %v", nearby[1])
+	} else if nearby[1].DistanceKm > nearby[2].DistanceKm {
+		t.Fatalf("Cities not sorted by distance: %v", nearby)
+	} else if nearby[0].SourceName != "GeoNames" {
+		t.Fatalf("Source not correct: [%s]", nearby[0].SourceName)
+	}
+
+	// We get all of Andorra and nothing else.
+
+	nearby, err = ci.KNearest(42.50779, 1.52109, 100)
+	log.PanicIf(err)
+
+	if len(nearby) != 15 {
+		t.Fatalf("Expected all of Andorra: (%d)", len(nearby))
+	}
+
+	for _, nc := range nearby {
+		if nc.City.Country != "Andorra" {
+			t.Fatalf("City not in Andorra: %v", nc)
+		}
+	}
+
+	// Somewhere with nothing around it.
+
+	nearby, err = ci.KNearest(-45.0, -120.0, 3)
+	log.PanicIf(err)
+
+	if len(nearby) != 0 {
+		t.Fatalf("Expected no cities: %v", nearby)
+	}
+}
+
+func TestCityIndex_WithinRadius(t *testing.T) {
+	// Dense enough around Dubai that every radius finds some cities.
+	config := geoattractorsynthetic.GeneratorConfig{
+		Count:  300,
+		Seed:   4,
+		Bounds: &geoattractorsynthetic.Bounds{MinLatitude: 23.0, MinLongitude: 53.0, MaxLatitude: 27.0, MaxLongitude: 57.0},
+	}
+
+	ci, kvFilepath, _ := getSyntheticCityIndex(config)
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	// Collect every city so that we can check against brute force.
+
+	all := make([]InspectItem, 0)
+	cb := func(item InspectItem) (err error) {
+		all = append(all, item)
+		return nil
+	}
+
+	err := ci.Inspect(InspectFilter{Groups: []string{InspectGroupCity}}, cb)
+	log.PanicIf(err)
+
+	// Dubai.
+	origin := geo.NewPoint(25.0657, 55.17128)
+
+	for _, radiusKm := range []float64{1.0, 10.0, 50.0, 150.0, 500.0} {
+		expected := make([]string, 0)
+		for _, item := range all {
+			p := geo.NewPoint(item.City.Latitude, item.City.Longitude)
+			if origin.GreatCircleDistance(p) <= radiusKm {
+				expected = append(expected, item.City.Id)
+			}
+		}
+
+		nearby, err := ci.WithinRadius(25.0657, 55.17128, radiusKm)
+		log.PanicIf(err)
+
+		actual := make([]string, len(nearby))
+		for i, nc := range nearby {
+			actual[i] = nc.City.Id
+
+			if i > 0 && nearby[i-1].DistanceKm > nc.DistanceKm {
+				t.Fatalf("Cities not sorted by distance: %v", nearby)
+			}
+		}
+
+		sort.Strings(expected)
+		sort.Strings(actual)
+
+		if reflect.DeepEqual(actual, expected) == false {
+			t.Fatalf("Cities within (%.0f) km not correct: %v != %v", radiusKm, actual, expected)
+		}
+	}
+}
+
+func TestCityIndex_FindByName(t *testing.T) {
+	ci, kvFilepath, gp := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	cities, err := ci.FindByName("sant julia de loria", "", 0)
+	log.PanicIf(err)
+
+	if len(cities) != 1 || cities[0].City.Id != "3039163" || cities[0].SourceName != "GeoNames" {
+		t.Fatalf("Expected to match without diacritics: %v", cities)
+	}
+
+	cities, err = ci.FindByName("Dubai", "andorra", 0)
+	log.PanicIf(err)
+
+	if len(cities) != 0 {
+		t.Fatalf("Expected country to be filtered: %v", cities)
+	}
+
+	cities, err = ci.FindByName("Dubai", "United Arab Emirates", 0)
+	log.PanicIf(err)
+
+	if len(cities) != 1 {
+		t.Fatalf("Expected Dubai: %v", cities)
+	}
+
+	// The name index follows changes.
+
+	cr := cities[0].City
+	cr.City = "Dubayy"
+
+	err = ci.Upsert(gp, cr)
+	log.PanicIf(err)
+
+	cities, err = ci.FindByName("Dubai", "", 0)
+	log.PanicIf(err)
+
+	if len(cities) != 0 {
+		t.Fatalf("Old name still found: %v", cities)
+	}
+
+	cities, err = ci.FindByName("DUBAYY", "", 0)
+	log.PanicIf(err)
+
+	if len(cities) != 1 {
+		t.Fatalf("New name not found: %v", cities)
+	}
+}
+
+func TestCityIndex_FindByName_Limit(t *testing.T) {
+	ci, kvFilepath, gp := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	// Rename two more cities so that three share a name.
+
+	for _, id := range []string{"3039163", "3041563"} {
+		cr, err := ci.GetById("GeoNames", id)
+		log.PanicIf(err)
+
+		cr.City = "Encamp"
+
+		err = ci.Upsert(gp, cr)
+		log.PanicIf(err)
+	}
+
+	cities, err := ci.FindByName("encamp", "", 2)
+	log.PanicIf(err)
+
+	// Largest first.
+	if len(cities) != 2 || cities[0].City.Id != "3041563" || cities[1].City.Id != "3040686" {
+		t.Fatalf("Cities not correct: %v", cities)
+	}
+}
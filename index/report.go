@@ -0,0 +1,117 @@
+package geoattractorindex
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// LoadTally is a count for one name (e.g. a country, a city ID, or a reason).
+type LoadTally struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// LoadReport describes what a call to `Load()` or `LoadFiles()` did. All of
+// the tallies are sorted by name.
+type LoadReport struct {
+	SourceName string `json:"source"`
+
+	// Parsed is the number of records that the source produced, before any
+	// filtering.
+	Parsed int `json:"parsed"`
+
+	// Dropped is the number of records that were dropped by a transform.
+	Dropped int `json:"dropped"`
+
+	// Filtered is the number of records that were excluded by the filter.
+	Filtered int `json:"filtered"`
+
+	// Duplicates is the number of records that were skipped because a record
+	// with the same ID was already loaded from an earlier input.
+	Duplicates int `json:"duplicates_skipped"`
+
+	// Indexed is the number of records that were written to the index.
+	Indexed int `json:"indexed"`
+
+	// Added and Updated count index entries (one per record per level) the same
+	// way that `AttractorStats` does.
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+
+	// Countries is the number of records indexed for each country.
+	Countries []LoadTally `json:"countries"`
+
+	// The hits are the records loaded for each ID or country that an
+	// `IdFilter` or `CountryFilter` asked for, and the misses are the IDs and
+	// countries that nothing was loaded for. Filters under `Not()` aren't
+	// tallied.
+	CityFilterHits      []LoadTally `json:"city_filter_hits,omitempty"`
+	CityFilterMisses    []string    `json:"city_filter_misses,omitempty"`
+	CountryFilterHits   []LoadTally `json:"country_filter_hits,omitempty"`
+	CountryFilterMisses []string    `json:"country_filter_misses,omitempty"`
+
+	// SkippedRows counts the rows that the source didn't produce records for,
+	// by reason. This is only available from sources that implement
+	// `geoattractor.SkipReportingSource`.
+	SkippedRows []LoadTally `json:"skipped_rows,omitempty"`
+
+	// Inputs describes what each file contributed. Only set by `LoadFiles()`.
+	Inputs []InputStats `json:"inputs,omitempty"`
+
+	Elapsed time.Duration `json:"elapsed_ns"`
+}
+
+func (lr LoadReport) String() string {
+	return fmt.Sprintf("LoadReport<SOURCE=[%s] PARSED=(%d) DROPPED=(%d) FILTERED=(%d) DUPLICATES=(%d) INDEXED=(%d) ADDS=(%d) UPDATES=(%d) COUNTRIES=(%d) ELAPSED=[%s]>", lr.SourceName, lr.Parsed, lr.Dropped, lr.Filtered, lr.Duplicates, lr.Indexed, lr.Added, lr.Updated, len(lr.Countries), lr.Elapsed)
+}
+
+// SkippedRowsCount returns the total number of rows skipped for any reason.
+func (lr LoadReport) SkippedRowsCount() (count int) {
+	for _, lt := range lr.SkippedRows {
+		count += lt.Count
+	}
+
+	return count
+}
+
+// sortedTallies converts the given counts to a list sorted by name.
+func sortedTallies(counts map[string]int) []LoadTally {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	tallies := make([]LoadTally, 0, len(counts))
+	for name, count := range counts {
+		lt := LoadTally{
+			Name:  name,
+			Count: count,
+		}
+
+		tallies = append(tallies, lt)
+	}
+
+	sort.Slice(tallies, func(i, j int) bool {
+		return tallies[i].Name < tallies[j].Name
+	})
+
+	return tallies
+}
+
+// filterMisses returns the sorted list of the wanted names that weren't hit.
+func filterMisses(wanted []string, hits map[string]int) []string {
+	misses := make([]string, 0)
+	for _, name := range wanted {
+		if _, found := hits[name]; found == false {
+			misses = append(misses, name)
+		}
+	}
+
+	if len(misses) == 0 {
+		return nil
+	}
+
+	sort.Strings(misses)
+
+	return misses
+}
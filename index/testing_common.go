@@ -1,11 +1,14 @@
 package geoattractorindex
 
 import (
+    "os"
     "path"
 
     "io/ioutil"
 
     "github.com/dsoprea/go-logging"
+
+    "github.com/dsoprea/go-geographic-attractor/parse"
 )
 
 var (
@@ -22,6 +25,28 @@ func NewTestCityIndex() (*CityIndex, string) {
     return ci, filepath
 }
 
+// NewLoadedTestCityIndex returns a test index with the GeoNames sample data
+// loaded into it, along with the parser that loaded it. The caller must close
+// the index and remove the KV file.
+func NewLoadedTestCityIndex(options LoadOptions) (ci *CityIndex, kvFilepath string, gp *geoattractorparse.GeonamesParser) {
+    countryDataFilepath := path.Join(appPath, "test", "asset", "countryInfo.txt")
+
+    gp, err := geoattractorparse.NewGeonamesParserWithFiles(countryDataFilepath)
+    log.PanicIf(err)
+
+    f, err := os.Open(path.Join(appPath, "parse", "test", "asset", "allCountries.txt.short"))
+    log.PanicIf(err)
+
+    defer f.Close()
+
+    ci, kvFilepath = NewTestCityIndex()
+
+    _, err = ci.Load(gp, f, options)
+    log.PanicIf(err)
+
+    return ci, kvFilepath, gp
+}
+
 func init() {
     testAssetsPath = path.Join(packagePath, "test", "asset")
 }
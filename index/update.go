@@ -0,0 +1,370 @@
+package geoattractorindex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/geographic"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/parse"
+)
+
+const (
+	// GeonamesLastDeltaDateMetadataName is the metadata entry that holds the
+	// date ("YYYY-MM-DD") of the last GeoNames delta applied to the index.
+	GeonamesLastDeltaDateMetadataName = "geonames_last_delta_date"
+)
+
+var (
+	ErrDeltaAlreadyApplied = errors.New("delta already applied")
+)
+
+// GetMetadata returns the given metadata value. Returns `ErrNotFound` if it was
+// never set.
+func (ci *CityIndex) GetMetadata(name string) (value string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	metadataKk := kvKey{MetadataKeyGroup, name}
+
+	err = ci.kvGet(metadataKk, &value)
+	if err == ErrNotFound {
+		return "", err
+	}
+
+	log.PanicIf(err)
+
+	return value, nil
+}
+
+// SetMetadata stores a metadata value alongside the index. The name may not
+// contain periods.
+func (ci *CityIndex) SetMetadata(name, value string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	metadataKk := kvKey{MetadataKeyGroup, name}
+
+	err = ci.kvPut(metadataKk, value)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// unsetRecord removes the given city from the entries at the given token. The
+// token is deleted if no entries remain.
+func (ci *CityIndex) unsetRecord(token string, sourceName, id string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	fineTokenKk := kvKey{FineTokenKeyGroup, token}
+
+	records := make([]IndexEntry, 0)
+
+	err = ci.kvGet(fineTokenKk, &records)
+	if err == ErrNotFound {
+		return nil
+	}
+
+	log.PanicIf(err)
+
+	filtered := make([]IndexEntry, 0, len(records))
+	for _, ie := range records {
+		if ie.CityRecord.Id == id && ie.SourceName == sourceName {
+			continue
+		}
+
+		filtered = append(filtered, ie)
+	}
+
+	if len(filtered) == len(records) {
+		return nil
+	} else if len(filtered) == 0 {
+		err := ci.kv.Delete(fineTokenKk.KeyBytes())
+		log.PanicIf(err)
+
+		return nil
+	}
+
+	err = ci.kvPut(fineTokenKk, filtered)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// removeCity removes the city from the city key-group and from the token of
+// every level that it was written to. `found` is false if the city wasn't in
+// the index.
+func (ci *CityIndex) removeCity(sourceName, id string) (found bool, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cr, err := ci.GetById(sourceName, id)
+	if log.Is(err, ErrNotFound) == true {
+		return false, nil
+	}
+
+	log.PanicIf(err)
+
+	// The tokens are derived from the coordinates that were stored, which are
+	// the ones that the city was indexed with.
+
+	cellId := cr.S2Cell()
+
+	for level := cellId.Level(); level >= ci.minimumSearchLevel; level-- {
+		token := cellId.Parent(level).ToToken()
+
+		err := ci.unsetRecord(token, sourceName, id)
+		log.PanicIf(err)
+	}
+
+	indexKk := kvKey{CityIndexKeyGroup, IdPhrase(sourceName, id)}
+
+	err = ci.kv.Delete(indexKk.KeyBytes())
+	log.PanicIf(err)
+
+	ci.nameIndex = nil
+
+	return true, nil
+}
+
+// Remove removes the given city from the index, both from the city key-group
+// and from every level that it was indexed at. Returns `ErrNotFound` if the city
+// isn't in the index.
+func (ci *CityIndex) Remove(sourceName, id string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	found, err := ci.removeCity(sourceName, id)
+	log.PanicIf(err)
+
+	if found == false {
+		return ErrNotFound
+	}
+
+	ci.resetNearestCache()
+
+	return nil
+}
+
+// Upsert adds the given city or replaces the one with the same ID from the
+// same source. The existing city is removed from the cells that it was indexed
+// at before the new record is indexed, so a city whose coordinates changed
+// won't be left behind in its old cells.
+func (ci *CityIndex) Upsert(source geoattractor.CityRecordSource, cr geoattractor.CityRecord) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if cr.Id == "" {
+		log.Panicf("city record has no ID: %s", cr)
+	}
+
+	sourceName := source.Name()
+
+	// The record may have come from `GetById()` with its coordinates changed,
+	// in which case the cell it carries is stale.
+	cr.Cell = rigeo.S2CellFromCoordinates(cr.Latitude, cr.Longitude)
+
+	_, err = ci.removeCity(sourceName, cr.Id)
+	log.PanicIf(err)
+
+	err = ci.indexCity(sourceName, cr)
+	log.PanicIf(err)
+
+	ci.resetNearestCache()
+
+	return nil
+}
+
+// resetNearestCache forgets the cached results of `Nearest()` after the index
+// has changed.
+func (ci *CityIndex) resetNearestCache() {
+	ci.cachedNearest = make(map[string]cachedNearestInfo)
+	ci.cachedNearestLru = make(sort.StringSlice, 0)
+}
+
+// DeltaReport describes what applying one day's GeoNames deltas did.
+type DeltaReport struct {
+	Date string `json:"date"`
+
+	// Modified is the number of rows in the modifications file.
+	Modified int `json:"modified"`
+
+	// Upserted is the number of cities that were added or rewritten.
+	Upserted int `json:"upserted"`
+
+	// Removed is the number of cities that were removed because their
+	// modified rows no longer qualify as cities (e.g. the population was
+	// removed).
+	Removed int `json:"removed"`
+
+	// Filtered is the number of modified cities that were left out (or
+	// removed, if they were indexed) because the load options dropped or
+	// filtered them.
+	Filtered int `json:"filtered"`
+
+	// Deleted is the number of cities removed by the deletes file and
+	// DeletesNotFound is the number of deletes for places that weren't
+	// indexed.
+	Deleted         int `json:"deleted"`
+	DeletesNotFound int `json:"deletes_not_found"`
+}
+
+func (dr DeltaReport) String() string {
+	return fmt.Sprintf("DeltaReport<DATE=[%s] MODIFIED=(%d) UPSERTED=(%d) REMOVED=(%d) FILTERED=(%d) DELETED=(%d) DELETES-NOT-FOUND=(%d)>", dr.Date, dr.Modified, dr.Upserted, dr.Removed, dr.Filtered, dr.Deleted, dr.DeletesNotFound)
+}
+
+// ApplyGeonamesDelta applies one day of GeoNames changes ("modifications-
+// YYYY-MM-DD.txt" and "deletes-YYYY-MM-DD.txt") to the index. Modified cities
+// are removed from wherever they were indexed and then indexed again, so cities
+// that moved end up in their new cells. The modifications are applied before
+// the deletes. The date is recorded in the metadata and
+// `ErrDeltaAlreadyApplied` is returned if it isn't newer than the last date
+// applied. The modified cities go through the same transforms and filter as
+// when loading, so `options` should be what the index was built with.
+func (ci *CityIndex) ApplyGeonamesDelta(gp *geoattractorparse.GeonamesParser, date string, modifications, deletes io.Reader, options LoadOptions) (report DeltaReport, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	lastDate, err := ci.GetMetadata(GeonamesLastDeltaDateMetadataName)
+	if err != nil && err != ErrNotFound {
+		log.Panic(err)
+	}
+
+	if lastDate != "" && date <= lastDate {
+		return report, ErrDeltaAlreadyApplied
+	}
+
+	defer ci.resetNearestCache()
+
+	sourceName := gp.Name()
+	report.Date = date
+
+	rowCb := func(geonamesId string, cr geoattractor.CityRecord, skipReason string) (err error) {
+		defer func() {
+			if state := recover(); state != nil {
+				err = log.Wrap(state.(error))
+			}
+		}()
+
+		report.Modified++
+
+		found, err := ci.removeCity(sourceName, geonamesId)
+		log.PanicIf(err)
+
+		if skipReason != "" {
+			if found == true {
+				report.Removed++
+			}
+
+			return nil
+		}
+
+		cr, dropped, filtered, err := options.Apply(cr)
+		log.PanicIf(err)
+
+		if dropped == true || filtered == true {
+			report.Filtered++
+			return nil
+		}
+
+		err = ci.indexCity(sourceName, cr)
+		log.PanicIf(err)
+
+		report.Upserted++
+
+		return nil
+	}
+
+	err = gp.ParseRows(modifications, rowCb)
+	log.PanicIf(err)
+
+	deleteCb := func(geonamesId string) (err error) {
+		found, err := ci.removeCity(sourceName, geonamesId)
+		if err != nil {
+			return err
+		}
+
+		if found == true {
+			report.Deleted++
+		} else {
+			report.DeletesNotFound++
+		}
+
+		return nil
+	}
+
+	err = geoattractorparse.ParseGeonamesDeletes(deletes, deleteCb)
+	log.PanicIf(err)
+
+	err = ci.SetMetadata(GeonamesLastDeltaDateMetadataName, date)
+	log.PanicIf(err)
+
+	return report, nil
+}
+
+// ApplyGeonamesDeltaDirectory applies every day of GeoNames deltas found in the
+// given directory, oldest first, skipping those that are not newer than the
+// last date applied.
+func (ci *CityIndex) ApplyGeonamesDeltaDirectory(gp *geoattractorparse.GeonamesParser, directoryPath string, options LoadOptions) (reports []DeltaReport, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	deltas, err := geoattractorparse.FindGeonamesDeltas(directoryPath)
+	log.PanicIf(err)
+
+	reports = make([]DeltaReport, 0)
+
+	apply := func(gd geoattractorparse.GeonamesDelta) (report DeltaReport, err error) {
+		modifications, deletes, err := gd.Open()
+		if err != nil {
+			return report, err
+		}
+
+		defer modifications.Close()
+		defer deletes.Close()
+
+		return ci.ApplyGeonamesDelta(gp, gd.Date, modifications, deletes, options)
+	}
+
+	for _, gd := range deltas {
+		report, err := apply(gd)
+		if err == ErrDeltaAlreadyApplied {
+			continue
+		}
+
+		log.PanicIf(err)
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
@@ -0,0 +1,518 @@
+package geoattractorindex
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/geographic"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+// getGeonamesRows returns the rows from the short sample with the given IDs,
+// split into columns.
+func getGeonamesRows(ids ...string) map[string][]string {
+	f, err := os.Open(path.Join(appPath, "parse", "test", "asset", "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	wanted := make(map[string]struct{})
+	for _, id := range ids {
+		wanted[id] = struct{}{}
+	}
+
+	rows := make(map[string][]string)
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	for s.Scan() {
+		parts := strings.Split(s.Text(), "\t")
+		if _, found := wanted[parts[0]]; found == true {
+			rows[parts[0]] = parts
+		}
+	}
+
+	log.PanicIf(s.Err())
+
+	return rows
+}
+
+func joinGeonamesRows(rows ...[]string) string {
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		lines[i] = strings.Join(row, "\t")
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// tokenHasCity returns whether the given city is among the entries at the
+// given token.
+func tokenHasCity(ci *CityIndex, token, id string) bool {
+	records := make([]IndexEntry, 0)
+
+	err := ci.kvGet(kvKey{FineTokenKeyGroup, token}, &records)
+	if err == ErrNotFound {
+		return false
+	}
+
+	log.PanicIf(err)
+
+	for _, ie := range records {
+		if ie.CityRecord.Id == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getTestDeltas() (modifications, deletes string) {
+	rows := getGeonamesRows("292223", "3039163")
+
+	// Move Dubai to the center of the city and change its population.
+	dubai := rows["292223"]
+	dubai[4] = "25.2048"
+	dubai[5] = "55.2708"
+	dubai[14] = "3331420"
+
+	// Sant Julià loses its population, so it no longer qualifies.
+	santJulia := rows["3039163"]
+	santJulia[14] = ""
+
+	newtown := []string{"99999999", "Newtown", "Newtown", "", "24.0", "54.0", "P", "PPL", "AE", "", "01", "", "", "", "5000", "", "10", "Asia/Dubai", "2026-10-01"}
+
+	modifications = joinGeonamesRows(dubai, santJulia, newtown)
+	deletes = "292968\tAbu Dhabi\tduplicate\n1\tNowhere\tnot indexed\n"
+
+	return modifications, deletes
+}
+
+func TestCityIndex_ApplyGeonamesDelta(t *testing.T) {
+	ci, kvFilepath, gp := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	originalDubai, err := ci.GetById("GeoNames", "292223")
+	log.PanicIf(err)
+
+	// Prime the cache so that we can see it being invalidated.
+	_, _, cr, err := ci.Nearest(25.2048, 55.2708, false)
+	log.PanicIf(err)
+
+	if cr.Id != "292223" {
+		t.Fatalf("Nearest city not correct before update: %s", cr)
+	}
+
+	modifications, deletes := getTestDeltas()
+
+	report, err := ci.ApplyGeonamesDelta(gp, "2026-10-01", strings.NewReader(modifications), strings.NewReader(deletes), LoadOptions{})
+	log.PanicIf(err)
+
+	expected := DeltaReport{
+		Date:            "2026-10-01",
+		Modified:        3,
+		Upserted:        2,
+		Removed:         1,
+		Deleted:         1,
+		DeletesNotFound: 1,
+	}
+
+	if report != expected {
+		t.Fatalf("Report not correct: %s", report)
+	}
+
+	// Dubai moved.
+
+	dubai, err := ci.GetById("GeoNames", "292223")
+	log.PanicIf(err)
+
+	if dubai.Population != 3331420 || dubai.Latitude != 25.2048 {
+		t.Fatalf("Dubai not updated: %s", dubai)
+	}
+
+	originalToken := originalDubai.S2Cell().ToToken()
+	newToken := rigeo.S2CellFromCoordinates(25.2048, 55.2708).ToToken()
+
+	if tokenHasCity(ci, originalToken, "292223") == true {
+		t.Fatalf("Dubai still indexed at its old leaf cell.")
+	} else if tokenHasCity(ci, newToken, "292223") == false {
+		t.Fatalf("Dubai not indexed at its new leaf cell.")
+	}
+
+	// The city is only indexed once at the levels that the old and new cells
+	// share.
+
+	sharedToken := originalDubai.S2Cell().Parent(ci.minimumSearchLevel).ToToken()
+
+	records := make([]IndexEntry, 0)
+
+	err = ci.kvGet(kvKey{FineTokenKeyGroup, sharedToken}, &records)
+	log.PanicIf(err)
+
+	hits := 0
+	for _, ie := range records {
+		if ie.CityRecord.Id == "292223" {
+			hits++
+
+			if ie.CityRecord.Population != 3331420 {
+				t.Fatalf("Shared level has the old record: %s", ie.CityRecord)
+			}
+		}
+	}
+
+	if hits != 1 {
+		t.Fatalf("Dubai should be at the shared level once: (%d)", hits)
+	}
+
+	// Sant Julià and Abu Dhabi are gone from everywhere.
+
+	for _, id := range []string{"3039163", "292968"} {
+		_, err := ci.GetById("GeoNames", id)
+		if log.Is(err, ErrNotFound) == false {
+			t.Fatalf("City [%s] not removed.", id)
+		}
+	}
+
+	santJuliaCell := rigeo.S2CellFromCoordinates(42.46372, 1.49129)
+	for level := santJuliaCell.Level(); level >= ci.minimumSearchLevel; level-- {
+		if tokenHasCity(ci, santJuliaCell.Parent(level).ToToken(), "3039163") == true {
+			t.Fatalf("Sant Julià still indexed at level (%d).", level)
+		}
+	}
+
+	// The new city was added.
+
+	newtown, err := ci.GetById("GeoNames", "99999999")
+	log.PanicIf(err)
+
+	if newtown.City != "Newtown" {
+		t.Fatalf("New city not correct: %s", newtown)
+	}
+
+	// The cached result was dropped, so we see the moved record.
+
+	_, _, cr, err = ci.Nearest(25.2048, 55.2708, false)
+	log.PanicIf(err)
+
+	if cr.Population != 3331420 {
+		t.Fatalf("Nearest city is stale: %s", cr)
+	}
+
+	// The date was recorded and can't be applied again.
+
+	lastDate, err := ci.GetMetadata(GeonamesLastDeltaDateMetadataName)
+	log.PanicIf(err)
+
+	if lastDate != "2026-10-01" {
+		t.Fatalf("Last delta date not correct: [%s]", lastDate)
+	}
+
+	_, err = ci.ApplyGeonamesDelta(gp, "2026-10-01", strings.NewReader(modifications), strings.NewReader(deletes), LoadOptions{})
+	if err != ErrDeltaAlreadyApplied {
+		t.Fatalf("Expected delta to be refused: %v", err)
+	}
+}
+
+func TestCityIndex_ApplyGeonamesDeltaDirectory(t *testing.T) {
+	ci, kvFilepath, gp := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	tempPath, err := ioutil.TempDir("", "")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	modifications, deletes := getTestDeltas()
+
+	write := func(filename, content string) {
+		err := ioutil.WriteFile(path.Join(tempPath, filename), []byte(content), 0644)
+		log.PanicIf(err)
+	}
+
+	// The second day only has deletes and deletes what the first day added.
+	write("modifications-2026-10-01.txt", modifications)
+	write("deletes-2026-10-01.txt", deletes)
+	write("deletes-2026-10-02.txt", "99999999\tNewtown\tmistake\n")
+	write("readme.txt", "")
+
+	reports, err := ci.ApplyGeonamesDeltaDirectory(gp, tempPath, LoadOptions{})
+	log.PanicIf(err)
+
+	if len(reports) != 2 {
+		t.Fatalf("Expected two days to be applied: %v", reports)
+	} else if reports[0].Date != "2026-10-01" || reports[0].Upserted != 2 {
+		t.Fatalf("First day not correct: %s", reports[0])
+	} else if reports[1].Date != "2026-10-02" || reports[1].Deleted != 1 || reports[1].Modified != 0 {
+		t.Fatalf("Second day not correct: %s", reports[1])
+	}
+
+	_, err = ci.GetById("GeoNames", "99999999")
+	if log.Is(err, ErrNotFound) == false {
+		t.Fatalf("City from the first day should have been deleted on the second.")
+	}
+
+	// Nothing new to apply.
+
+	write("deletes-2026-09-30.txt", "292223\tDubai\ttoo old\n")
+
+	reports, err = ci.ApplyGeonamesDeltaDirectory(gp, tempPath, LoadOptions{})
+	log.PanicIf(err)
+
+	if len(reports) != 0 {
+		t.Fatalf("Expected nothing to be applied: %v", reports)
+	}
+
+	// Make sure that the old delta wasn't applied.
+
+	_, err = ci.GetById("GeoNames", "292223")
+	log.PanicIf(err)
+}
+
+func TestCityIndex_SetMetadata(t *testing.T) {
+	ci, kvFilepath := NewTestCityIndex()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	_, err := ci.GetMetadata("test_name")
+	if err != ErrNotFound {
+		t.Fatalf("Expected not-found for missing metadata: %v", err)
+	}
+
+	err = ci.SetMetadata("test_name", "test value")
+	log.PanicIf(err)
+
+	value, err := ci.GetMetadata("test_name")
+	log.PanicIf(err)
+
+	if value != "test value" {
+		t.Fatalf("Metadata not correct: [%s]", value)
+	}
+}
+
+// getTokenEntries returns the entries for the given city at the given token.
+func getTokenEntries(ci *CityIndex, token, id string) []IndexEntry {
+	records := make([]IndexEntry, 0)
+
+	err := ci.kvGet(kvKey{FineTokenKeyGroup, token}, &records)
+	if err == ErrNotFound {
+		return nil
+	}
+
+	log.PanicIf(err)
+
+	hits := make([]IndexEntry, 0)
+	for _, ie := range records {
+		if ie.CityRecord.Id == id {
+			hits = append(hits, ie)
+		}
+	}
+
+	return hits
+}
+
+func TestCityIndex_Upsert_Update(t *testing.T) {
+	ci, kvFilepath, gp := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	cr, err := ci.GetById("GeoNames", "292223")
+	log.PanicIf(err)
+
+	cr.Population = 3331420
+
+	err = ci.Upsert(gp, cr)
+	log.PanicIf(err)
+
+	updated, err := ci.GetById("GeoNames", "292223")
+	log.PanicIf(err)
+
+	if updated.Population != 3331420 {
+		t.Fatalf("City record not updated: %s", updated)
+	}
+
+	cellId := cr.S2Cell()
+	for level := cellId.Level(); level >= ci.minimumSearchLevel; level-- {
+		hits := getTokenEntries(ci, cellId.Parent(level).ToToken(), "292223")
+		if len(hits) != 1 {
+			t.Fatalf("Expected exactly one entry at level (%d): (%d)", level, len(hits))
+		} else if hits[0].CityRecord.Population != 3331420 {
+			t.Fatalf("Entry at level (%d) not updated: %s", level, hits[0].CityRecord)
+		}
+	}
+}
+
+func TestCityIndex_Upsert_Move(t *testing.T) {
+	ci, kvFilepath, gp := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	cr, err := ci.GetById("GeoNames", "3039163")
+	log.PanicIf(err)
+
+	originalCellId := cr.S2Cell()
+
+	// Move Sant Julià to Dubai. The record still carries its old cell.
+	cr.Latitude = 25.2048
+	cr.Longitude = 55.2708
+
+	err = ci.Upsert(gp, cr)
+	log.PanicIf(err)
+
+	for level := originalCellId.Level(); level >= ci.minimumSearchLevel; level-- {
+		if tokenHasCity(ci, originalCellId.Parent(level).ToToken(), "3039163") == true {
+			t.Fatalf("City still indexed at its old cell at level (%d).", level)
+		}
+	}
+
+	newCellId := rigeo.S2CellFromCoordinates(25.2048, 55.2708)
+	for level := newCellId.Level(); level >= ci.minimumSearchLevel; level-- {
+		if len(getTokenEntries(ci, newCellId.Parent(level).ToToken(), "3039163")) != 1 {
+			t.Fatalf("City not indexed once at its new cell at level (%d).", level)
+		}
+	}
+
+	moved, err := ci.GetById("GeoNames", "3039163")
+	log.PanicIf(err)
+
+	if moved.S2Cell() != newCellId {
+		t.Fatalf("Stored cell not updated.")
+	}
+}
+
+func TestCityIndex_Upsert_Add(t *testing.T) {
+	ci, kvFilepath, gp := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	cr := geoattractor.CityRecord{
+		Id:         "99999999",
+		Country:    "United Arab Emirates",
+		City:       "Newtown",
+		Population: 5000,
+		Latitude:   24.0,
+		Longitude:  54.0,
+	}
+
+	err := ci.Upsert(gp, cr)
+	log.PanicIf(err)
+
+	_, _, nearest, err := ci.Nearest(24.0001, 54.0001, false)
+	log.PanicIf(err)
+
+	if nearest.Id != "99999999" {
+		t.Fatalf("Added city not found as the nearest: %s", nearest)
+	}
+
+	err = ci.Upsert(gp, geoattractor.CityRecord{City: "Nameless"})
+	if err == nil {
+		t.Fatalf("Expected error for record without ID.")
+	}
+}
+
+func TestCityIndex_Remove(t *testing.T) {
+	ci, kvFilepath, _ := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	cr, err := ci.GetById("GeoNames", "3039163")
+	log.PanicIf(err)
+
+	// Prime the cache.
+	_, _, nearest, err := ci.Nearest(cr.Latitude, cr.Longitude, false)
+	log.PanicIf(err)
+
+	if nearest.Id != "3039163" {
+		t.Fatalf("Nearest city not correct before removal: %s", nearest)
+	}
+
+	err = ci.Remove("GeoNames", "3039163")
+	log.PanicIf(err)
+
+	_, err = ci.GetById("GeoNames", "3039163")
+	if log.Is(err, ErrNotFound) == false {
+		t.Fatalf("City not removed.")
+	}
+
+	cellId := cr.S2Cell()
+	for level := cellId.Level(); level >= ci.minimumSearchLevel; level-- {
+		if tokenHasCity(ci, cellId.Parent(level).ToToken(), "3039163") == true {
+			t.Fatalf("City still indexed at level (%d).", level)
+		}
+	}
+
+	_, _, nearest, err = ci.Nearest(cr.Latitude, cr.Longitude, false)
+	log.PanicIf(err)
+
+	if nearest.Id == "3039163" {
+		t.Fatalf("Removed city still returned from the cache.")
+	}
+
+	err = ci.Remove("GeoNames", "3039163")
+	if err != ErrNotFound {
+		t.Fatalf("Expected not-found for second removal: %v", err)
+	}
+}
+
+func TestCityIndex_ApplyGeonamesDelta_LoadOptions(t *testing.T) {
+	rename := LoadTransformFunc(func(cr geoattractor.CityRecord) (geoattractor.CityRecord, bool, error) {
+		cr.City = strings.ToUpper(cr.City)
+		return cr, true, nil
+	})
+
+	options := LoadOptions{
+		Transforms: []LoadTransform{rename},
+		Filter:     NewCountryFilter("Andorra"),
+	}
+
+	ci, kvFilepath, gp := NewLoadedTestCityIndex(options)
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	modifications, _ := getTestDeltas()
+
+	// Andorra la Vella grows.
+	andorraLaVella := getGeonamesRows("3041563")["3041563"]
+	andorraLaVella[14] = "30000"
+
+	modifications += joinGeonamesRows(andorraLaVella)
+
+	report, err := ci.ApplyGeonamesDelta(gp, "2026-10-01", strings.NewReader(modifications), strings.NewReader(""), options)
+	log.PanicIf(err)
+
+	// Dubai and Newtown are outside of the filter and Sant Julià no longer
+	// qualifies.
+	if report.Upserted != 1 || report.Filtered != 2 || report.Removed != 1 {
+		t.Fatalf("Report not correct: %s", report)
+	}
+
+	if _, err := ci.GetById("GeoNames", "292223"); err != ErrNotFound {
+		t.Fatalf("Expected Dubai to stay out of the filtered index: %v", err)
+	} else if _, err := ci.GetById("GeoNames", "99999999"); err != ErrNotFound {
+		t.Fatalf("Expected Newtown to stay out of the filtered index: %v", err)
+	}
+
+	cr, err := ci.GetById("GeoNames", "3041563")
+	log.PanicIf(err)
+
+	if cr.Population != 30000 || cr.City != "ANDORRA LA VELLA" {
+		t.Fatalf("Andorra la Vella not updated through the transforms: %s", cr)
+	}
+}
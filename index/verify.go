@@ -0,0 +1,420 @@
+package geoattractorindex
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"encoding/gob"
+
+	"github.com/akrylysov/pogreb"
+	"github.com/dsoprea/go-logging"
+	"github.com/golang/geo/s2"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+const (
+	// VerifyIssueUndecodable is a value that couldn't be decoded.
+	VerifyIssueUndecodable = "undecodable value"
+
+	// VerifyIssueUnknownKeyGroup is a key that isn't in any group that the
+	// index writes.
+	VerifyIssueUnknownKeyGroup = "unrecognized key group"
+
+	// VerifyIssueInvalidToken is a fine-token key whose name isn't a valid
+	// cell token.
+	VerifyIssueInvalidToken = "invalid token"
+
+	// VerifyIssueEmptyToken is a fine-token key with no entries.
+	VerifyIssueEmptyToken = "empty token"
+
+	// VerifyIssueOrphanEntry is a fine-token entry whose city isn't in the city
+	// key-group.
+	VerifyIssueOrphanEntry = "orphan entry"
+
+	// VerifyIssueMisplacedEntry is a fine-token entry at a cell that doesn't
+	// contain the stored city (or that's above the minimum search level).
+	VerifyIssueMisplacedEntry = "misplaced entry"
+
+	// VerifyIssueDuplicateEntry is a city that appears more than once at the
+	// same token.
+	VerifyIssueDuplicateEntry = "duplicate entry"
+
+	// VerifyIssueMissingEntry is a level between the city's leaf and the
+	// minimum search level that the city isn't indexed at.
+	VerifyIssueMissingEntry = "missing entry"
+)
+
+// VerifyIssue is one inconsistency found by `Verify()`.
+type VerifyIssue struct {
+	Kind string `json:"kind"`
+	Key  string `json:"key"`
+
+	// IdPhrase is the city that the issue is about, if any.
+	IdPhrase string `json:"id_phrase,omitempty"`
+
+	Detail string `json:"detail,omitempty"`
+}
+
+func (vi VerifyIssue) String() string {
+	return fmt.Sprintf("VerifyIssue<KIND=[%s] KEY=[%s] ID-PHRASE=[%s] DETAIL=[%s]>", vi.Kind, vi.Key, vi.IdPhrase, vi.Detail)
+}
+
+// VerifyReport describes the state of the store as found by `Verify()`.
+type VerifyReport struct {
+	Keys     int `json:"keys"`
+	Cities   int `json:"cities"`
+	Tokens   int `json:"tokens"`
+	Entries  int `json:"entries"`
+	Metadata int `json:"metadata"`
+
+	Issues []VerifyIssue `json:"issues"`
+
+	// Repaired is true if repairs were requested and made. Unrecognized key
+	// groups are never touched.
+	Repaired bool `json:"repaired"`
+}
+
+func (vr VerifyReport) String() string {
+	return fmt.Sprintf("VerifyReport<KEYS=(%d) CITIES=(%d) TOKENS=(%d) ENTRIES=(%d) METADATA=(%d) ISSUES=(%d) REPAIRED=[%v]>", vr.Keys, vr.Cities, vr.Tokens, vr.Entries, vr.Metadata, len(vr.Issues), vr.Repaired)
+}
+
+// IsConsistent returns true if no issues were found.
+func (vr VerifyReport) IsConsistent() bool {
+	return len(vr.Issues) == 0
+}
+
+// IssueCounts returns the number of issues of each kind.
+func (vr VerifyReport) IssueCounts() []LoadTally {
+	counts := make(map[string]int)
+	for _, vi := range vr.Issues {
+		counts[vi.Kind]++
+	}
+
+	return sortedTallies(counts)
+}
+
+// verifiedCity is what we keep about each stored city while verifying.
+type verifiedCity struct {
+	cellId s2.CellID
+
+	// levels is the number of distinct levels that the city was properly
+	// indexed at.
+	levels int
+}
+
+// Verify walks every key in the store, decodes every value, and checks that
+// the fine-token entries and the cities agree with each other: every entry's
+// city must be stored, every entry must be at a cell that contains its city,
+// and every city must be indexed at every level from its leaf down to the
+// minimum search level. If `repair` is true, undecodable values and bad
+// entries are deleted and cities with missing levels are reindexed from the
+// stored records. The issues that were found are returned either way.
+func (ci *CityIndex) Verify(repair bool) (report VerifyReport, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = ci.kvInit()
+	log.PanicIf(err)
+
+	report.Issues = make([]VerifyIssue, 0)
+
+	addIssue := func(kind string, key, idPhrase, detail string) {
+		vi := VerifyIssue{
+			Kind:     kind,
+			Key:      key,
+			IdPhrase: idPhrase,
+			Detail:   detail,
+		}
+
+		report.Issues = append(report.Issues, vi)
+	}
+
+	// The store can't be changed while it's being iterated, so we collect the
+	// repairs and make them at the end.
+	undecodableKeys := make([][]byte, 0)
+
+	// First pass: decode everything and collect the cities.
+
+	cities := make(map[string]*verifiedCity)
+	undecodableCities := make(map[string]bool)
+
+	err = ci.kvWalk(func(kk kvKey, key []byte, gd *gob.Decoder) {
+		report.Keys++
+
+		if kk.EqualsGroup(CityIndexKeyGroup) == true {
+			cr := geoattractor.CityRecord{}
+
+			err := gd.Decode(&cr)
+			if err != nil {
+				addIssue(VerifyIssueUndecodable, kk.Key(), kk.name, err.Error())
+				undecodableKeys = append(undecodableKeys, key)
+				undecodableCities[kk.name] = true
+
+				return
+			}
+
+			report.Cities++
+
+			cities[kk.name] = &verifiedCity{
+				cellId: cr.S2Cell(),
+			}
+		} else if kk.EqualsGroup(FineTokenKeyGroup) == true {
+			records := make([]IndexEntry, 0)
+
+			err := gd.Decode(&records)
+			if err != nil {
+				addIssue(VerifyIssueUndecodable, kk.Key(), "", err.Error())
+				undecodableKeys = append(undecodableKeys, key)
+
+				return
+			}
+
+			report.Tokens++
+			report.Entries += len(records)
+		} else if kk.EqualsGroup(MetadataKeyGroup) == true {
+			var value string
+
+			err := gd.Decode(&value)
+			if err != nil {
+				addIssue(VerifyIssueUndecodable, kk.Key(), "", err.Error())
+				undecodableKeys = append(undecodableKeys, key)
+
+				return
+			}
+
+			report.Metadata++
+		} else {
+			addIssue(VerifyIssueUnknownKeyGroup, kk.Key(), "", strings.Join(kk.group, "."))
+		}
+	})
+
+	log.PanicIf(err)
+
+	// Second pass: check each fine-token entry against the cities.
+
+	// The tokens to rewrite with only the good entries (nil to delete).
+	rewrites := make(map[string][]IndexEntry)
+
+	err = ci.kvWalk(func(kk kvKey, key []byte, gd *gob.Decoder) {
+		if kk.EqualsGroup(FineTokenKeyGroup) == false {
+			return
+		}
+
+		records := make([]IndexEntry, 0)
+
+		// Undecodable tokens were already reported.
+		if err := gd.Decode(&records); err != nil {
+			return
+		}
+
+		token := kk.name
+
+		tokenCellId := s2.CellIDFromToken(token)
+		if tokenCellId.IsValid() == false {
+			addIssue(VerifyIssueInvalidToken, kk.Key(), "", "")
+			rewrites[token] = nil
+
+			return
+		}
+
+		if len(records) == 0 {
+			addIssue(VerifyIssueEmptyToken, kk.Key(), "", "")
+			rewrites[token] = nil
+
+			return
+		}
+
+		tokenLevel := tokenCellId.Level()
+
+		kept := make([]IndexEntry, 0, len(records))
+		seen := make(map[string]struct{})
+
+		for _, ie := range records {
+			idPhrase := IdPhrase(ie.SourceName, ie.CityRecord.Id)
+
+			if _, found := seen[idPhrase]; found == true {
+				addIssue(VerifyIssueDuplicateEntry, kk.Key(), idPhrase, "")
+				continue
+			}
+
+			seen[idPhrase] = struct{}{}
+
+			vc, found := cities[idPhrase]
+			if found == false {
+				// Never drop the entries of a city that's still stored, even
+				// if we couldn't account for its key.
+				cityKk := kvKey{CityIndexKeyGroup, idPhrase}
+
+				stored, err := ci.kv.Has(cityKk.KeyBytes())
+				log.PanicIf(err)
+
+				if stored == true && undecodableCities[idPhrase] == false {
+					kept = append(kept, ie)
+					continue
+				}
+
+				addIssue(VerifyIssueOrphanEntry, kk.Key(), idPhrase, "")
+				continue
+			}
+
+			if tokenLevel < ci.minimumSearchLevel || tokenLevel > vc.cellId.Level() || vc.cellId.Parent(tokenLevel) != tokenCellId {
+				detail := fmt.Sprintf("city is at [%s]", vc.cellId.ToToken())
+				addIssue(VerifyIssueMisplacedEntry, kk.Key(), idPhrase, detail)
+
+				continue
+			}
+
+			vc.levels++
+			kept = append(kept, ie)
+		}
+
+		if len(kept) != len(records) {
+			if len(kept) == 0 {
+				rewrites[token] = nil
+			} else {
+				rewrites[token] = kept
+			}
+		}
+	})
+
+	log.PanicIf(err)
+
+	// Find the levels that each incompletely-indexed city is missing from.
+
+	incomplete := make([]string, 0)
+
+	for idPhrase, vc := range cities {
+		expectedLevels := vc.cellId.Level() - ci.minimumSearchLevel + 1
+		if vc.levels == expectedLevels {
+			continue
+		}
+
+		incomplete = append(incomplete, idPhrase)
+
+		for level := vc.cellId.Level(); level >= ci.minimumSearchLevel; level-- {
+			token := vc.cellId.Parent(level).ToToken()
+
+			found, err := ci.tokenHasEntry(token, idPhrase)
+			log.PanicIf(err)
+
+			if found == false {
+				fineTokenKk := kvKey{FineTokenKeyGroup, token}
+				addIssue(VerifyIssueMissingEntry, fineTokenKk.Key(), idPhrase, fmt.Sprintf("level (%d)", level))
+			}
+		}
+	}
+
+	if repair == false || len(report.Issues) == 0 {
+		return report, nil
+	}
+
+	// Repair.
+
+	for _, key := range undecodableKeys {
+		err := ci.kv.Delete(key)
+		log.PanicIf(err)
+	}
+
+	for token, records := range rewrites {
+		fineTokenKk := kvKey{FineTokenKeyGroup, token}
+
+		if records == nil {
+			err := ci.kv.Delete(fineTokenKk.KeyBytes())
+			log.PanicIf(err)
+
+			continue
+		}
+
+		err := ci.kvPut(fineTokenKk, records)
+		log.PanicIf(err)
+	}
+
+	for _, idPhrase := range incomplete {
+		parts := strings.SplitN(idPhrase, ",", 2)
+		sourceName := parts[0]
+		id := parts[1]
+
+		cr, err := ci.GetById(sourceName, id)
+		log.PanicIf(err)
+
+		_, err = ci.removeCity(sourceName, id)
+		log.PanicIf(err)
+
+		err = ci.indexCity(sourceName, cr)
+		log.PanicIf(err)
+	}
+
+	ci.resetNearestCache()
+
+	report.Repaired = true
+
+	return report, nil
+}
+
+// tokenHasEntry returns whether the given city is among the entries at the
+// given token. A token that can't be decoded is treated as not having it.
+func (ci *CityIndex) tokenHasEntry(token string, idPhrase string) (found bool, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	fineTokenKk := kvKey{FineTokenKeyGroup, token}
+
+	data, err := ci.kv.Get(fineTokenKk.KeyBytes())
+	log.PanicIf(err)
+
+	if data == nil {
+		return false, nil
+	}
+
+	records := make([]IndexEntry, 0)
+
+	gd := gob.NewDecoder(bytes.NewBuffer(data))
+	if err := gd.Decode(&records); err != nil {
+		return false, nil
+	}
+
+	for _, ie := range records {
+		if IdPhrase(ie.SourceName, ie.CityRecord.Id) == idPhrase {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// kvWalk calls `cb` with every key in the store and a decoder for its value.
+func (ci *CityIndex) kvWalk(cb func(kk kvKey, key []byte, gd *gob.Decoder)) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ii := ci.kv.Items()
+
+	for {
+		keyEncoded, dataEncoded, err := ii.Next()
+		if err != nil {
+			if err == pogreb.ErrIterationDone {
+				break
+			}
+
+			log.Panic(err)
+		}
+
+		kk := newKvKeyFromBytes(keyEncoded)
+		gd := gob.NewDecoder(bytes.NewBuffer(dataEncoded))
+
+		cb(kk, keyEncoded, gd)
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package geoattractorindex
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/synthetic"
+)
+
+func TestCityIndex_Verify_Consistent(t *testing.T) {
+	config := geoattractorsynthetic.GeneratorConfig{
+		Count:     200,
+		Seed:      1,
+		EdgeCases: true,
+	}
+
+	ci, kvFilepath, records := getSyntheticCityIndex(config)
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	err := ci.SetMetadata("test_name", "test value")
+	log.PanicIf(err)
+
+	report, err := ci.Verify(false)
+	log.PanicIf(err)
+
+	if report.IsConsistent() == false {
+		t.Fatalf("Expected a freshly-loaded index to be consistent: %v", report.Issues)
+	} else if report.Cities != len(records) || report.Metadata != 1 {
+		t.Fatalf("Counts not correct: %s", report)
+	} else if report.Keys != report.Cities+report.Tokens+report.Metadata {
+		t.Fatalf("Keys not accounted for: %s", report)
+	}
+}
+
+func TestCityIndex_Verify_Repair(t *testing.T) {
+	ci, kvFilepath, _ := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	// Drop Dubai from one of its levels.
+
+	dubai, err := ci.GetById("GeoNames", "292223")
+	log.PanicIf(err)
+
+	dubaiCellId := dubai.S2Cell()
+	missingToken := dubaiCellId.Parent(dubaiCellId.Level() - 3).ToToken()
+
+	err = ci.unsetRecord(missingToken, "GeoNames", "292223")
+	log.PanicIf(err)
+
+	// Add an entry for a city that isn't stored.
+
+	ghost := IndexEntry{
+		CityRecord: geoattractor.CityRecord{
+			Id:        "99999999",
+			Latitude:  25.0657,
+			Longitude: 55.17128,
+		},
+		SourceName: "GeoNames",
+	}
+
+	err = ci.setRecord(dubaiCellId.ToToken(), ghost)
+	log.PanicIf(err)
+
+	// Add an entry for Dubai in Andorra.
+
+	santJulia, err := ci.GetById("GeoNames", "3039163")
+	log.PanicIf(err)
+
+	misplaced := IndexEntry{
+		CityRecord: dubai,
+		SourceName: "GeoNames",
+	}
+
+	misplacedToken := santJulia.S2Cell().Parent(ci.minimumSearchLevel).ToToken()
+
+	err = ci.setRecord(misplacedToken, misplaced)
+	log.PanicIf(err)
+
+	// Garble a value and add a key that we don't know about.
+
+	garbledKk := kvKey{FineTokenKeyGroup, "garbled"}
+
+	err = ci.kv.Put(garbledKk.KeyBytes(), []byte{0xff, 0x00, 0x12})
+	log.PanicIf(err)
+
+	unknownKk := kvKey{[]string{"attractor", "index", "unknown"}, "name"}
+
+	err = ci.kvPut(unknownKk, "value")
+	log.PanicIf(err)
+
+	report, err := ci.Verify(false)
+	log.PanicIf(err)
+
+	expected := []LoadTally{
+		{Name: VerifyIssueMisplacedEntry, Count: 1},
+		{Name: VerifyIssueMissingEntry, Count: 1},
+		{Name: VerifyIssueOrphanEntry, Count: 1},
+		{Name: VerifyIssueUndecodable, Count: 1},
+		{Name: VerifyIssueUnknownKeyGroup, Count: 1},
+	}
+
+	if reflect.DeepEqual(report.IssueCounts(), expected) == false {
+		t.Fatalf("Issues not correct: %v", report.Issues)
+	} else if report.Repaired != false {
+		t.Fatalf("Expected no repairs.")
+	}
+
+	for _, vi := range report.Issues {
+		if vi.Kind == VerifyIssueMissingEntry && vi.Key != (kvKey{FineTokenKeyGroup, missingToken}).Key() {
+			t.Fatalf("Missing entry reported at the wrong token: %s", vi)
+		}
+	}
+
+	// Repair and check again. Only the unknown key is left alone.
+
+	report, err = ci.Verify(true)
+	log.PanicIf(err)
+
+	if report.Repaired != true {
+		t.Fatalf("Expected repairs.")
+	}
+
+	report, err = ci.Verify(false)
+	log.PanicIf(err)
+
+	expected = []LoadTally{
+		{Name: VerifyIssueUnknownKeyGroup, Count: 1},
+	}
+
+	if reflect.DeepEqual(report.IssueCounts(), expected) == false {
+		t.Fatalf("Issues not correct after repair: %v", report.Issues)
+	}
+
+	if tokenHasCity(ci, missingToken, "292223") == false {
+		t.Fatalf("Missing level not restored.")
+	} else if tokenHasCity(ci, misplacedToken, "292223") == true {
+		t.Fatalf("Misplaced entry not removed.")
+	} else if tokenHasCity(ci, dubaiCellId.ToToken(), "99999999") == true {
+		t.Fatalf("Orphan entry not removed.")
+	}
+}
+
+func TestCityIndex_Verify_DottedIds(t *testing.T) {
+	ci, kvFilepath, _ := NewLoadedTestCityIndex(LoadOptions{})
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	// The delimited and GeoJSON sources allow dots in both.
+
+	dotted := []struct {
+		sourceName string
+		cr         geoattractor.CityRecord
+	}{
+		{"Delimited", geoattractor.CityRecord{Id: "A.1", City: "Dotted", Population: 10, Latitude: -33.8688, Longitude: 151.2093}},
+		{"My.Source", geoattractor.CityRecord{Id: "B.2.3", City: "Dotted Too", Population: 10, Latitude: -37.8136, Longitude: 144.9631}},
+	}
+
+	for _, d := range dotted {
+		source := geoattractorsynthetic.NewRecordSource(d.sourceName, nil)
+
+		err := ci.Upsert(source, d.cr)
+		log.PanicIf(err)
+	}
+
+	report, err := ci.Verify(true)
+	log.PanicIf(err)
+
+	if report.IsConsistent() == false {
+		t.Fatalf("Expected dotted IDs to be consistent: %v", report.Issues)
+	} else if report.Cities != 37 {
+		t.Fatalf("Expected the dotted cities to be counted: %s", report)
+	}
+
+	for _, d := range dotted {
+		sourceName, _, cr, err := ci.Nearest(d.cr.Latitude, d.cr.Longitude, false)
+		log.PanicIf(err)
+
+		if sourceName != d.sourceName || cr.Id != d.cr.Id {
+			t.Fatalf("Dotted city not found after verifying: [%s] %s", sourceName, cr)
+		}
+	}
+}
+
+func TestNewKvKeyFromBytes(t *testing.T) {
+	kk := kvKey{CityIndexKeyGroup, "My.Source,A.1"}
+
+	recovered := newKvKeyFromBytes(kk.KeyBytes())
+	if reflect.DeepEqual(recovered, kk) == false {
+		t.Fatalf("Key not parsed correctly: %v", recovered)
+	}
+
+	recovered = newKvKeyFromBytes([]byte("other.group.name"))
+	if reflect.DeepEqual(recovered, kvKey{[]string{"other", "group"}, "name"}) == false {
+		t.Fatalf("Unknown key not parsed correctly: %v", recovered)
+	}
+}
@@ -0,0 +1,387 @@
+package geoattractormerge
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/kellydunn/golang-geo"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+const (
+	// DefaultMergedSourceName is the source-name that merged records are
+	// indexed under if one isn't given.
+	DefaultMergedSourceName = "Merged"
+
+	// DefaultMaximumMatchDistance is the furthest apart (in kilometers) that
+	// two records can be and still be considered the same city.
+	DefaultMaximumMatchDistance = 25.0
+)
+
+// Field names. These match the JSON names of the `CityRecord` fields.
+const (
+	FieldId            = "id"
+	FieldCountry       = "country"
+	FieldProvinceState = "province_or_state"
+	FieldCity          = "city"
+	FieldPopulation    = "population"
+
+	// FieldCoordinates covers both latitude and longitude, which are always
+	// taken together.
+	FieldCoordinates = "coordinates"
+)
+
+var (
+	// AllFields are the fields that precedence can be configured for.
+	AllFields = []string{
+		FieldId,
+		FieldCountry,
+		FieldProvinceState,
+		FieldCity,
+		FieldPopulation,
+		FieldCoordinates,
+	}
+)
+
+// MergerConfig describes how records are matched and reconciled.
+type MergerConfig struct {
+	// SourceName is returned by `Name()` and is what merged records will be
+	// indexed under. Defaults to `DefaultMergedSourceName`.
+	SourceName string
+
+	// MaximumMatchDistance is the furthest apart (in kilometers) that two
+	// records with the same normalized name can be and still be considered the
+	// same city. Defaults to `DefaultMaximumMatchDistance`.
+	MaximumMatchDistance float64
+
+	// Precedence lists source-names from most- to least-preferred. It applies
+	// to any field that doesn't have its own entry in FieldPrecedence. Sources
+	// that aren't listed rank after those that are, by name, so that the
+	// result doesn't depend on the order that the sources were added in.
+	Precedence []string
+
+	// FieldPrecedence overrides Precedence for individual fields (keyed by the
+	// Field* constants).
+	FieldPrecedence map[string][]string
+}
+
+type sourcedRecord struct {
+	sourceName string
+	cr         geoattractor.CityRecord
+}
+
+// cluster is a set of records, at most one per source, that were matched to
+// one another.
+type cluster struct {
+	members []sourcedRecord
+}
+
+func (c *cluster) hasSource(sourceName string) bool {
+	for _, member := range c.members {
+		if member.sourceName == sourceName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Merger combines records from several sources. Records from different sources
+// are matched if their normalized names are equal and they are within the
+// maximum match distance of one another. Each field of the merged record is
+// taken from the most-preferred source that has a value for it, and the
+// provenance of every field is recorded on the record.
+//
+// Merger is itself a `CityRecordSource` so that the merged records can be
+// given to `CityIndex.Load()`. Since the merged ID must be unique across
+// sources, it's formed as "<source-name>:<id>" from whichever source won the
+// ID field.
+type Merger struct {
+	config MergerConfig
+
+	sourceNames []string
+	records     map[string][]geoattractor.CityRecord
+
+	// clusters is built from the records when they're first needed, and
+	// rebuilt if another source is added afterward.
+	clusters []*cluster
+	byName   map[string][]*cluster
+}
+
+func NewMerger(config MergerConfig) *Merger {
+	if config.SourceName == "" {
+		config.SourceName = DefaultMergedSourceName
+	}
+
+	if config.MaximumMatchDistance == 0 {
+		config.MaximumMatchDistance = DefaultMaximumMatchDistance
+	}
+
+	return &Merger{
+		config:      config,
+		sourceNames: make([]string, 0),
+		records:     make(map[string][]geoattractor.CityRecord),
+	}
+}
+
+// Add reads all records from the given source. They're matched against the
+// records from the other sources when the merged records are produced. Each
+// source may only be added once.
+func (m *Merger) Add(source geoattractor.CityRecordSource, r io.Reader) (recordsCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sourceName := source.Name()
+
+	for _, existingName := range m.sourceNames {
+		if existingName == sourceName {
+			log.Panicf("source already added: [%s]", sourceName)
+		}
+	}
+
+	m.sourceNames = append(m.sourceNames, sourceName)
+
+	records := make([]geoattractor.CityRecord, 0)
+
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		records = append(records, cr)
+		return nil
+	}
+
+	recordsCount, err = source.Parse(r, cb)
+	log.PanicIf(err)
+
+	m.records[sourceName] = records
+	m.clusters = nil
+
+	return recordsCount, nil
+}
+
+// cluster matches the records of every source to one another. The sources are
+// visited in order of their precedence for coordinates, so the first member of
+// every cluster, which the others are measured against, is its
+// most-preferred. This makes the clusters independent of the order that the
+// sources were added in.
+func (m *Merger) cluster() {
+	m.clusters = make([]*cluster, 0)
+	m.byName = make(map[string][]*cluster)
+
+	for _, sourceName := range m.precedence(FieldCoordinates) {
+		for _, cr := range m.records[sourceName] {
+			m.add(sourceName, cr)
+		}
+	}
+}
+
+func (m *Merger) add(sourceName string, cr geoattractor.CityRecord) {
+	nameKey := NormalizeName(cr.City)
+
+	// Find the nearest cluster with the same name that doesn't already have a
+	// record from this source. Two same-named records from one source are
+	// assumed to be distinct places.
+
+	origin := geo.NewPoint(cr.Latitude, cr.Longitude)
+
+	var nearest *cluster
+	var nearestDistance float64
+
+	for _, c := range m.byName[nameKey] {
+		if c.hasSource(sourceName) == true {
+			continue
+		}
+
+		// The most-preferred member.
+		anchor := c.members[0].cr
+		distance := origin.GreatCircleDistance(geo.NewPoint(anchor.Latitude, anchor.Longitude))
+
+		if distance > m.config.MaximumMatchDistance {
+			continue
+		}
+
+		if nearest == nil || distance < nearestDistance {
+			nearest = c
+			nearestDistance = distance
+		}
+	}
+
+	sr := sourcedRecord{
+		sourceName: sourceName,
+		cr:         cr,
+	}
+
+	if nearest != nil {
+		nearest.members = append(nearest.members, sr)
+		return
+	}
+
+	c := &cluster{
+		members: []sourcedRecord{sr},
+	}
+
+	m.clusters = append(m.clusters, c)
+	m.byName[nameKey] = append(m.byName[nameKey], c)
+}
+
+// precedence returns the ranking of sources for the given field.
+func (m *Merger) precedence(field string) []string {
+	preferred := m.config.FieldPrecedence[field]
+	if preferred == nil {
+		preferred = m.config.Precedence
+	}
+
+	ranked := make([]string, 0, len(m.sourceNames))
+	seen := make(map[string]struct{})
+
+	for _, sourceName := range preferred {
+		if _, found := seen[sourceName]; found == true {
+			continue
+		}
+
+		ranked = append(ranked, sourceName)
+		seen[sourceName] = struct{}{}
+	}
+
+	unlisted := make([]string, 0)
+	for _, sourceName := range m.sourceNames {
+		if _, found := seen[sourceName]; found == true {
+			continue
+		}
+
+		unlisted = append(unlisted, sourceName)
+		seen[sourceName] = struct{}{}
+	}
+
+	sort.Strings(unlisted)
+
+	return append(ranked, unlisted...)
+}
+
+// resolve picks, for each field, the value from the most-preferred member that
+// has one.
+func (m *Merger) resolve(c *cluster, precedences map[string][]string) geoattractor.CityRecord {
+	bySource := make(map[string]geoattractor.CityRecord)
+	for _, member := range c.members {
+		bySource[member.sourceName] = member.cr
+	}
+
+	provenance := &geoattractor.CityRecordProvenance{
+		Sources: make([]geoattractor.SourceRecordReference, len(c.members)),
+		Fields:  make(map[string]string),
+	}
+
+	for i, member := range c.members {
+		provenance.Sources[i] = geoattractor.SourceRecordReference{
+			SourceName: member.sourceName,
+			Id:         member.cr.Id,
+		}
+	}
+
+	// pick returns the first record, in order of precedence, that satisfies
+	// `hasValue`.
+	pick := func(field string, hasValue func(cr geoattractor.CityRecord) bool) (string, geoattractor.CityRecord) {
+		for _, sourceName := range precedences[field] {
+			cr, found := bySource[sourceName]
+			if found == true && hasValue(cr) == true {
+				provenance.Fields[field] = sourceName
+				return sourceName, cr
+			}
+		}
+
+		return "", geoattractor.CityRecord{}
+	}
+
+	merged := geoattractor.CityRecord{
+		Provenance: provenance,
+	}
+
+	idSourceName, idCr := pick(FieldId, func(cr geoattractor.CityRecord) bool { return cr.Id != "" })
+	merged.Id = fmt.Sprintf("%s:%s", idSourceName, idCr.Id)
+
+	_, countryCr := pick(FieldCountry, func(cr geoattractor.CityRecord) bool { return cr.Country != "" })
+	merged.Country = countryCr.Country
+
+	_, provinceStateCr := pick(FieldProvinceState, func(cr geoattractor.CityRecord) bool { return cr.ProvinceState != "" })
+	merged.ProvinceState = provinceStateCr.ProvinceState
+
+	_, cityCr := pick(FieldCity, func(cr geoattractor.CityRecord) bool { return cr.City != "" })
+	merged.City = cityCr.City
+
+	_, populationCr := pick(FieldPopulation, func(cr geoattractor.CityRecord) bool { return cr.Population > 0 })
+	merged.Population = populationCr.Population
+
+	_, coordinatesCr := pick(FieldCoordinates, func(cr geoattractor.CityRecord) bool { return true })
+	merged.Latitude = coordinatesCr.Latitude
+	merged.Longitude = coordinatesCr.Longitude
+
+	return merged
+}
+
+// Parse emits the merged records. The reader is ignored since the inputs were
+// given to `Add()`.
+func (m *Merger) Parse(r io.Reader, cityRecordCb geoattractor.CityRecordCb) (recordsCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if m.clusters == nil {
+		m.cluster()
+	}
+
+	precedences := make(map[string][]string)
+	for _, field := range AllFields {
+		precedences[field] = m.precedence(field)
+	}
+
+	for _, c := range m.clusters {
+		recordsCount++
+
+		if cityRecordCb != nil {
+			cr := m.resolve(c, precedences)
+
+			err := cityRecordCb(cr)
+			log.PanicIf(err)
+		}
+	}
+
+	return recordsCount, nil
+}
+
+func (m *Merger) Name() (name string) {
+	return m.config.SourceName
+}
+
+// NormalizeName reduces a place-name to a form that can be compared across
+// sources: diacritics and punctuation are removed, case is folded, and
+// whitespace is collapsed.
+func NormalizeName(name string) string {
+	decomposed := norm.NFD.String(name)
+
+	b := new(strings.Builder)
+	lastWasSpace := true
+
+	for _, r := range decomposed {
+		if unicode.Is(unicode.Mn, r) == true {
+			// A combining mark (accent).
+			continue
+		} else if unicode.IsLetter(r) == true || unicode.IsDigit(r) == true {
+			b.WriteRune(unicode.ToLower(r))
+			lastWasSpace = false
+		} else if lastWasSpace == false {
+			b.WriteRune(' ')
+			lastWasSpace = true
+		}
+	}
+
+	return strings.TrimRight(b.String(), " ")
+}
@@ -0,0 +1,232 @@
+package geoattractormerge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/parse"
+)
+
+func newTestSource(sourceName string) *geoattractorparse.DelimitedParser {
+	return geoattractorparse.NewDelimitedParser(geoattractorparse.DelimitedParserConfig{
+		SourceName: sourceName,
+		HasHeader:  true,
+		Columns: geoattractorparse.DelimitedColumnMapping{
+			Id:            geoattractorparse.ColumnByName("id"),
+			City:          geoattractorparse.ColumnByName("city"),
+			Country:       geoattractorparse.ColumnByName("country"),
+			ProvinceState: geoattractorparse.ColumnByName("province"),
+			Population:    geoattractorparse.ColumnByName("population"),
+			Latitude:      geoattractorparse.ColumnByName("latitude"),
+			Longitude:     geoattractorparse.ColumnByName("longitude"),
+		},
+	})
+}
+
+func getTestMerger(config MergerConfig) *Merger {
+	geonamesData := "id,city,country,province,population,latitude,longitude\n" +
+		"3039163,Sant Julià de Lòria,Andorra,06,8022,42.46372,1.49129\n" +
+		"292223,Dubai,United Arab Emirates,03,1137347,25.0657,55.17128\n" +
+		"4951788,Springfield,United States,MA,153606,42.10148,-72.58981\n" +
+		"4409896,Springfield,United States,MO,166810,37.21533,-93.29824\n"
+
+	customData := "id,city,country,province,population,latitude,longitude\n" +
+		"a1,SANT JULIA DE LORIA,,Sant Julià,9600,42.4640,1.4920\n" +
+		"a2,Dubai,UAE,,,25.2048,55.2708\n" +
+		"a3,Springfield,USA,MO,,37.2090,-93.2923\n" +
+		"a4,Dubai,UAE,,,40.0,-80.0\n"
+
+	m := NewMerger(config)
+
+	_, err := m.Add(newTestSource("GeoNames"), strings.NewReader(geonamesData))
+	log.PanicIf(err)
+
+	_, err = m.Add(newTestSource("Custom"), strings.NewReader(customData))
+	log.PanicIf(err)
+
+	return m
+}
+
+func TestMerger_Parse(t *testing.T) {
+	m := getTestMerger(MergerConfig{
+		Precedence: []string{"GeoNames", "Custom"},
+		FieldPrecedence: map[string][]string{
+			FieldPopulation: []string{"Custom", "GeoNames"},
+		},
+	})
+
+	if m.Name() != DefaultMergedSourceName {
+		t.Fatalf("Source-name not correct: [%s]", m.Name())
+	}
+
+	records := make([]geoattractor.CityRecord, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		records = append(records, cr)
+		return nil
+	}
+
+	recordsCount, err := m.Parse(nil, cb)
+	log.PanicIf(err)
+
+	// Four GeoNames records, the Dubai from the custom data that's too far away
+	// to match.
+	if recordsCount != 5 {
+		t.Fatalf("Number of records not correct: (%d)", recordsCount)
+	}
+
+	santJulia := records[0]
+
+	expectedSantJulia := geoattractor.CityRecord{
+		Id:            "GeoNames:3039163",
+		Country:       "Andorra",
+		ProvinceState: "06",
+		City:          "Sant Julià de Lòria",
+		Population:    9600,
+		Latitude:      42.46372,
+		Longitude:     1.49129,
+		Provenance: &geoattractor.CityRecordProvenance{
+			Sources: []geoattractor.SourceRecordReference{
+				{SourceName: "GeoNames", Id: "3039163"},
+				{SourceName: "Custom", Id: "a1"},
+			},
+			Fields: map[string]string{
+				FieldId:            "GeoNames",
+				FieldCountry:       "GeoNames",
+				FieldProvinceState: "GeoNames",
+				FieldCity:          "GeoNames",
+				FieldPopulation:    "Custom",
+				FieldCoordinates:   "GeoNames",
+			},
+		},
+	}
+
+	if reflect.DeepEqual(santJulia, expectedSantJulia) == false {
+		t.Fatalf("Merged record not correct: %v %v", santJulia, santJulia.Provenance)
+	}
+
+	// The custom Dubai has no population so we fall back to GeoNames.
+
+	dubai := records[1]
+	if dubai.Population != 1137347 || dubai.Provenance.Fields[FieldPopulation] != "GeoNames" {
+		t.Fatalf("Dubai population not correct: %v %v", dubai, dubai.Provenance)
+	} else if len(dubai.Provenance.Sources) != 2 {
+		t.Fatalf("Dubai should have been matched across sources: %v", dubai.Provenance)
+	}
+
+	// Only the Missouri Springfield is near the custom record.
+
+	if len(records[2].Provenance.Sources) != 1 {
+		t.Fatalf("Massachusetts Springfield should not have been matched: %v", records[2].Provenance)
+	} else if len(records[3].Provenance.Sources) != 2 {
+		t.Fatalf("Missouri Springfield should have been matched: %v", records[3].Provenance)
+	}
+
+	farDubai := records[4]
+	if farDubai.Id != "Custom:a4" || farDubai.Provenance.Fields[FieldId] != "Custom" {
+		t.Fatalf("Unmatched custom record not correct: %v %v", farDubai, farDubai.Provenance)
+	}
+}
+
+func TestMerger_Parse_DefaultPrecedence(t *testing.T) {
+	// With no precedence, sources rank by name, so "Custom" comes before
+	// "GeoNames" even though it was added after it.
+	m := getTestMerger(MergerConfig{
+		FieldPrecedence: map[string][]string{
+			FieldCountry: []string{"Custom"},
+		},
+	})
+
+	records := make([]geoattractor.CityRecord, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		records = append(records, cr)
+		return nil
+	}
+
+	_, err := m.Parse(nil, cb)
+	log.PanicIf(err)
+
+	// The custom Sant Julià has no country, so GeoNames fills it in.
+	if records[0].Country != "Andorra" || records[0].Provenance.Fields[FieldCountry] != "GeoNames" {
+		t.Fatalf("Sant Julià country not correct: %v", records[0])
+	} else if records[0].Population != 9600 || records[0].Provenance.Fields[FieldPopulation] != "Custom" {
+		t.Fatalf("Sant Julià population not correct: %v", records[0])
+	} else if records[1].Country != "UAE" || records[1].Provenance.Fields[FieldCountry] != "Custom" {
+		t.Fatalf("Dubai country not correct: %v", records[1])
+	}
+}
+
+func TestMerger_Parse_AddOrder(t *testing.T) {
+	// Each record is within the match distance of the middle one but the
+	// outer two are too far apart to match each other, so the clusters depend
+	// on which record the others are measured against.
+	data := map[string]string{
+		"East":   "id,city,country,province,population,latitude,longitude\ne1,Testville,Testland,,100,0.0,0.2\n",
+		"Middle": "id,city,country,province,population,latitude,longitude\nm1,Testville,Testland,,200,0.0,0.1\n",
+		"West":   "id,city,country,province,population,latitude,longitude\nw1,Testville,Testland,,300,0.0,0.0\n",
+	}
+
+	merge := func(sourceNames []string) []geoattractor.CityRecord {
+		m := NewMerger(MergerConfig{
+			MaximumMatchDistance: 15.0,
+		})
+
+		for _, sourceName := range sourceNames {
+			_, err := m.Add(newTestSource(sourceName), strings.NewReader(data[sourceName]))
+			log.PanicIf(err)
+		}
+
+		records := make([]geoattractor.CityRecord, 0)
+		cb := func(cr geoattractor.CityRecord) (err error) {
+			records = append(records, cr)
+			return nil
+		}
+
+		_, err := m.Parse(nil, cb)
+		log.PanicIf(err)
+
+		return records
+	}
+
+	forward := merge([]string{"West", "Middle", "East"})
+	backward := merge([]string{"East", "Middle", "West"})
+
+	if reflect.DeepEqual(forward, backward) == false {
+		t.Fatalf("Merged records depend on the order the sources were added:\n%v\n%v", forward, backward)
+	}
+
+	// "East" is the most-preferred source, by name, so "Middle" is matched to
+	// it and "West" is left by itself.
+	if len(forward) != 2 {
+		t.Fatalf("Expected two merged records: %v", forward)
+	} else if reflect.DeepEqual(forward[0].Provenance.Sources, []geoattractor.SourceRecordReference{{SourceName: "East", Id: "e1"}, {SourceName: "Middle", Id: "m1"}}) == false {
+		t.Fatalf("First merged record not correct: %v %v", forward[0], forward[0].Provenance)
+	} else if reflect.DeepEqual(forward[1].Provenance.Sources, []geoattractor.SourceRecordReference{{SourceName: "West", Id: "w1"}}) == false {
+		t.Fatalf("Second merged record not correct: %v %v", forward[1], forward[1].Provenance)
+	}
+}
+
+func TestMerger_Add_Duplicate(t *testing.T) {
+	m := NewMerger(MergerConfig{})
+
+	_, err := m.Add(newTestSource("GeoNames"), strings.NewReader("id,city,country,province,population,latitude,longitude\n"))
+	log.PanicIf(err)
+
+	_, err = m.Add(newTestSource("GeoNames"), strings.NewReader("id,city,country,province,population,latitude,longitude\n"))
+	if err == nil {
+		t.Fatalf("Expected error for duplicate source.")
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	if NormalizeName("Sant Julià de Lòria") != "sant julia de loria" {
+		t.Fatalf("Diacritics not removed: [%s]", NormalizeName("Sant Julià de Lòria"))
+	} else if NormalizeName("  St. John's ") != "st john s" {
+		t.Fatalf("Punctuation not handled: [%s]", NormalizeName("  St. John's "))
+	} else if NormalizeName("Zaṟah Sharan") != "zarah sharan" {
+		t.Fatalf("Combining marks not removed: [%s]", NormalizeName("Zaṟah Sharan"))
+	}
+}
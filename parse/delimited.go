@@ -0,0 +1,316 @@
+package geoattractorparse
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"encoding/csv"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// DefaultDelimitedSourceName is the source-name used for delimited data
+	// if one isn't given.
+	DefaultDelimitedSourceName = "Delimited"
+)
+
+// Reasons that delimited rows are skipped. These are reported to the callback
+// given to `SetSkipCb()`.
+const (
+	DelimitedSkipNoId               = "no ID"
+	DelimitedSkipNoName             = "no city name"
+	DelimitedSkipInvalidCoordinates = "coordinates out of range"
+)
+
+// DelimitedColumn identifies a column by its header name or by its zero-based
+// position.
+type DelimitedColumn struct {
+	name  string
+	index int
+}
+
+// ColumnByName returns a column that is resolved by the header row.
+func ColumnByName(name string) *DelimitedColumn {
+	return &DelimitedColumn{
+		name:  name,
+		index: -1,
+	}
+}
+
+// ColumnByIndex returns a column that is resolved by its zero-based position.
+func ColumnByIndex(index int) *DelimitedColumn {
+	return &DelimitedColumn{
+		index: index,
+	}
+}
+
+// ParseDelimitedColumn interprets an integer as a column index and anything
+// else as a header name. This is convenient for command-line arguments.
+func ParseDelimitedColumn(phrase string) *DelimitedColumn {
+	if phrase == "" {
+		return nil
+	}
+
+	index, err := strconv.Atoi(phrase)
+	if err == nil {
+		return ColumnByIndex(index)
+	}
+
+	return ColumnByName(phrase)
+}
+
+func (dc *DelimitedColumn) String() string {
+	if dc.name != "" {
+		return "[" + dc.name + "]"
+	}
+
+	return "(" + strconv.Itoa(dc.index) + ")"
+}
+
+// resolve returns the index of the column given the header (if any).
+func (dc *DelimitedColumn) resolve(header []string) int {
+	if dc.name == "" {
+		return dc.index
+	}
+
+	if header == nil {
+		log.Panicf("column %s is mapped by name but there is no header row", dc)
+	}
+
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), dc.name) == true {
+			return i
+		}
+	}
+
+	log.Panicf("column %s not found in header: %v", dc, header)
+	return -1
+}
+
+// DelimitedColumnMapping maps columns in the input to `CityRecord` fields.
+// Id, City, Latitude, and Longitude are required. The rest may be left as nil.
+type DelimitedColumnMapping struct {
+	Id            *DelimitedColumn
+	City          *DelimitedColumn
+	Country       *DelimitedColumn
+	ProvinceState *DelimitedColumn
+	Population    *DelimitedColumn
+	Latitude      *DelimitedColumn
+	Longitude     *DelimitedColumn
+}
+
+// DelimitedParserConfig describes the layout of the delimited data.
+type DelimitedParserConfig struct {
+	// SourceName is returned by `Name()` and is what records will be indexed
+	// under. Defaults to `DefaultDelimitedSourceName`.
+	SourceName string
+
+	// Delimiter separates fields. Defaults to a comma.
+	Delimiter rune
+
+	// Comment, if not zero, marks lines that should be ignored.
+	Comment rune
+
+	// HasHeader indicates that the first row names the columns rather than
+	// being data. It's required if any columns are mapped by name.
+	HasHeader bool
+
+	// Columns maps the input columns to record fields.
+	Columns DelimitedColumnMapping
+
+	// Countries, if provided, is used to translate the country column from
+	// codes to names (e.g. as returned by `BuildGeonamesCountryMapping`).
+	// Values not found in the mapping are used as-is.
+	Countries map[string]string
+}
+
+// DelimitedParser reads city records from CSV, TSV, or any other delimited
+// text.
+type DelimitedParser struct {
+	config DelimitedParserConfig
+
+	skipCb geoattractor.CityRecordSkipCb
+}
+
+func NewDelimitedParser(config DelimitedParserConfig) *DelimitedParser {
+	if config.SourceName == "" {
+		config.SourceName = DefaultDelimitedSourceName
+	}
+
+	if config.Delimiter == 0 {
+		config.Delimiter = ','
+	}
+
+	return &DelimitedParser{
+		config: config,
+	}
+}
+
+// SetSkipCb sets a callback that's given the reason (one of the DelimitedSkip*
+// constants) whenever a row is skipped.
+func (dp *DelimitedParser) SetSkipCb(cb geoattractor.CityRecordSkipCb) {
+	dp.skipCb = cb
+}
+
+// skip reports a skipped row.
+func (dp *DelimitedParser) skip(reason string) {
+	if dp.skipCb != nil {
+		dp.skipCb(reason)
+	}
+}
+
+// validCoordinates returns whether the coordinates are finite and in range.
+// `ParseFloat()` happily accepts "NaN" and "Inf".
+func validCoordinates(latitude, longitude float64) bool {
+	if math.IsNaN(latitude) == true || math.IsNaN(longitude) == true {
+		return false
+	}
+
+	return latitude >= -90.0 && latitude <= 90.0 && longitude >= -180.0 && longitude <= 180.0
+}
+
+func (dp *DelimitedParser) Parse(r io.Reader, cityRecordCb geoattractor.CityRecordCb) (recordsCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	columns := dp.config.Columns
+
+	if columns.Id == nil {
+		log.Panicf("ID column not mapped")
+	} else if columns.City == nil {
+		log.Panicf("city column not mapped")
+	} else if columns.Latitude == nil {
+		log.Panicf("latitude column not mapped")
+	} else if columns.Longitude == nil {
+		log.Panicf("longitude column not mapped")
+	}
+
+	c := csv.NewReader(r)
+	c.Comma = dp.config.Delimiter
+	c.Comment = dp.config.Comment
+	c.FieldsPerRecord = -1
+
+	var header []string
+	if dp.config.HasHeader == true {
+		header, err = c.Read()
+		if err == io.EOF {
+			return 0, nil
+		}
+
+		log.PanicIf(err)
+
+		// Drop a leading byte-order mark, which spreadsheet exports like to
+		// include.
+		if len(header) > 0 {
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+		}
+	}
+
+	resolve := func(dc *DelimitedColumn) int {
+		if dc == nil {
+			return -1
+		}
+
+		return dc.resolve(header)
+	}
+
+	idIndex := resolve(columns.Id)
+	cityIndex := resolve(columns.City)
+	countryIndex := resolve(columns.Country)
+	provinceStateIndex := resolve(columns.ProvinceState)
+	populationIndex := resolve(columns.Population)
+	latitudeIndex := resolve(columns.Latitude)
+	longitudeIndex := resolve(columns.Longitude)
+
+	row := 0
+	for {
+		record, err := c.Read()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		row++
+
+		get := func(i int) string {
+			if i < 0 {
+				return ""
+			} else if i >= len(record) {
+				log.Panicf("row (%d) has (%d) fields but column (%d) is mapped", row, len(record), i)
+			}
+
+			return strings.TrimSpace(record[i])
+		}
+
+		id := get(idIndex)
+		if id == "" {
+			dp.skip(DelimitedSkipNoId)
+			continue
+		}
+
+		name := get(cityIndex)
+		if name == "" {
+			dp.skip(DelimitedSkipNoName)
+			continue
+		}
+
+		latitude, err := strconv.ParseFloat(get(latitudeIndex), 64)
+		if err != nil {
+			log.Panicf("row (%d) has an invalid latitude: %s", row, err)
+		}
+
+		longitude, err := strconv.ParseFloat(get(longitudeIndex), 64)
+		if err != nil {
+			log.Panicf("row (%d) has an invalid longitude: %s", row, err)
+		}
+
+		if validCoordinates(latitude, longitude) == false {
+			dp.skip(DelimitedSkipInvalidCoordinates)
+			continue
+		}
+
+		var population uint64
+		if populationRaw := get(populationIndex); populationRaw != "" {
+			population, err = strconv.ParseUint(populationRaw, 10, 64)
+			if err != nil {
+				log.Panicf("row (%d) has an invalid population: %s", row, err)
+			}
+		}
+
+		country := get(countryIndex)
+		if countryName, found := dp.config.Countries[country]; found == true {
+			country = countryName
+		}
+
+		recordsCount++
+
+		if cityRecordCb != nil {
+			cr := geoattractor.CityRecord{
+				Id:            id,
+				Country:       country,
+				ProvinceState: get(provinceStateIndex),
+				City:          name,
+				Population:    population,
+				Latitude:      latitude,
+				Longitude:     longitude,
+			}
+
+			err = cityRecordCb(cr)
+			log.PanicIf(err)
+		}
+	}
+
+	return recordsCount, nil
+}
+
+func (dp *DelimitedParser) Name() (name string) {
+	return dp.config.SourceName
+}
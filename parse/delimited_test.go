@@ -0,0 +1,184 @@
+package geoattractorparse
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+func TestDelimitedParser_Parse_ByName(t *testing.T) {
+	data := "\ufeffSite,Lat,Lon,Country,State,Headcount,Code\n" +
+		"\"Detroit, Downtown\",42.33143,-83.04575,US,MI,1200,det\n" +
+		"Troy,42.60559,-83.14993,US,MI,,troy\n"
+
+	dp := NewDelimitedParser(DelimitedParserConfig{
+		SourceName: "Offices",
+		HasHeader:  true,
+		Columns: DelimitedColumnMapping{
+			Id:            ColumnByName("code"),
+			City:          ColumnByName("site"),
+			Country:       ColumnByName("country"),
+			ProvinceState: ColumnByName("state"),
+			Population:    ColumnByName("headcount"),
+			Latitude:      ColumnByName("lat"),
+			Longitude:     ColumnByName("lon"),
+		},
+		Countries: map[string]string{
+			"US": "United States",
+		},
+	})
+
+	if dp.Name() != "Offices" {
+		t.Fatalf("Source-name not correct: [%s]", dp.Name())
+	}
+
+	actual := make([]string, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		actual = append(actual, cr.String())
+		return nil
+	}
+
+	recordsCount, err := dp.Parse(strings.NewReader(data), cb)
+	log.PanicIf(err)
+
+	if recordsCount != 2 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+
+	expected := []string{
+		"CityRecord<ID=[det] COUNTRY=[United States] PROVINCE-OR-STATE=[MI] CITY=[Detroit, Downtown] POP=(1200) LAT=(42.3314300000) LON=(-83.0457500000) S2=[883b2d2feb90607b]>",
+		"CityRecord<ID=[troy] COUNTRY=[United States] PROVINCE-OR-STATE=[MI] CITY=[Troy] POP=(0) LAT=(42.6055900000) LON=(-83.1499300000) S2=[8824c3c40a768751]>",
+	}
+
+	if reflect.DeepEqual(actual, expected) == false {
+		for _, s := range actual {
+			fmt.Printf("%s\n", s)
+		}
+
+		t.Fatalf("Results not expected.")
+	}
+}
+
+func TestDelimitedParser_Parse_ByIndex(t *testing.T) {
+	data := "# id\tname\tlat\tlon\n" +
+		"1\tAbu Dhabi\t24.46667\t54.36667\n" +
+		"2\tDubai\t25.0657\t55.17128\n"
+
+	dp := NewDelimitedParser(DelimitedParserConfig{
+		Delimiter: '\t',
+		Comment:   '#',
+		Columns: DelimitedColumnMapping{
+			Id:        ParseDelimitedColumn("0"),
+			City:      ParseDelimitedColumn("1"),
+			Latitude:  ParseDelimitedColumn("2"),
+			Longitude: ParseDelimitedColumn("3"),
+		},
+	})
+
+	if dp.Name() != DefaultDelimitedSourceName {
+		t.Fatalf("Source-name not correct: [%s]", dp.Name())
+	}
+
+	records := make([]geoattractor.CityRecord, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		records = append(records, cr)
+		return nil
+	}
+
+	recordsCount, err := dp.Parse(strings.NewReader(data), cb)
+	log.PanicIf(err)
+
+	if recordsCount != 2 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	} else if records[1].Id != "2" || records[1].City != "Dubai" || records[1].Latitude != 25.0657 || records[1].Longitude != 55.17128 {
+		t.Fatalf("Second record not correct: %s", records[1])
+	}
+}
+
+func TestDelimitedParser_Parse_NameWithoutHeader(t *testing.T) {
+	dp := NewDelimitedParser(DelimitedParserConfig{
+		Columns: DelimitedColumnMapping{
+			Id:        ColumnByName("id"),
+			City:      ColumnByIndex(1),
+			Latitude:  ColumnByIndex(2),
+			Longitude: ColumnByIndex(3),
+		},
+	})
+
+	_, err := dp.Parse(strings.NewReader("1,a,1.0,2.0\n"), nil)
+	if err == nil {
+		t.Fatalf("Expected error for name-mapped column without header.")
+	} else if strings.Contains(err.Error(), "no header row") == false {
+		t.Fatalf("Error not correct: [%s]", err)
+	}
+}
+
+func TestDelimitedParser_Parse_InvalidLatitude(t *testing.T) {
+	dp := NewDelimitedParser(DelimitedParserConfig{
+		Columns: DelimitedColumnMapping{
+			Id:        ColumnByIndex(0),
+			City:      ColumnByIndex(1),
+			Latitude:  ColumnByIndex(2),
+			Longitude: ColumnByIndex(3),
+		},
+	})
+
+	_, err := dp.Parse(strings.NewReader("1,a,1.0,2.0\n2,b,north,2.0\n"), nil)
+	if err == nil {
+		t.Fatalf("Expected error for invalid latitude.")
+	} else if strings.Contains(err.Error(), "row (2) has an invalid latitude") == false {
+		t.Fatalf("Error not correct: [%s]", err)
+	}
+}
+
+func TestDelimitedParser_Parse_SkipsInvalidRows(t *testing.T) {
+	data := "1,a,1.0,2.0\n" +
+		",no-id,1.0,2.0\n" +
+		"3,,1.0,2.0\n" +
+		"4,nan,NaN,2.0\n" +
+		"5,south,-95.0,2.0\n" +
+		"6,east,1.0,200.0\n" +
+		"7,inf,1.0,-Inf\n" +
+		"8,b,-90.0,180.0\n"
+
+	dp := NewDelimitedParser(DelimitedParserConfig{
+		Columns: DelimitedColumnMapping{
+			Id:        ColumnByIndex(0),
+			City:      ColumnByIndex(1),
+			Latitude:  ColumnByIndex(2),
+			Longitude: ColumnByIndex(3),
+		},
+	})
+
+	skipped := make(map[string]int)
+	dp.SetSkipCb(func(reason string) {
+		skipped[reason]++
+	})
+
+	ids := make([]string, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		ids = append(ids, cr.Id)
+		return nil
+	}
+
+	recordsCount, err := dp.Parse(strings.NewReader(data), cb)
+	log.PanicIf(err)
+
+	if recordsCount != 2 || reflect.DeepEqual(ids, []string{"1", "8"}) == false {
+		t.Fatalf("Records not correct: (%d) %v", recordsCount, ids)
+	}
+
+	expected := map[string]int{
+		DelimitedSkipNoId:               1,
+		DelimitedSkipNoName:             1,
+		DelimitedSkipInvalidCoordinates: 4,
+	}
+
+	if reflect.DeepEqual(skipped, expected) == false {
+		t.Fatalf("Skips not correct: %v", skipped)
+	}
+}
@@ -0,0 +1,298 @@
+package geoattractorparse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"encoding/json"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// DefaultGeoJsonSourceName is the source-name used for GeoJSON data if one
+	// isn't given.
+	DefaultGeoJsonSourceName = "GeoJSON"
+)
+
+// Reasons that features are skipped. These are reported to the callback given
+// to `SetSkipCb()`.
+const (
+	GeoJsonSkipNotPoint           = "not a point"
+	GeoJsonSkipNoId               = "no ID"
+	GeoJsonSkipNoName             = "no city name"
+	GeoJsonSkipInvalidCoordinates = "coordinates out of range"
+	GeoJsonSkipInvalidPopulation  = "invalid population"
+)
+
+// GeoJsonPropertyMapping names the feature properties that populate each
+// `CityRecord` field. City is required. If Id is empty, the feature's own "id"
+// member is used.
+type GeoJsonPropertyMapping struct {
+	Id            string
+	City          string
+	Country       string
+	ProvinceState string
+	Population    string
+}
+
+// GeoJsonParserConfig describes how features are interpreted.
+type GeoJsonParserConfig struct {
+	// SourceName is returned by `Name()` and is what records will be indexed
+	// under. Defaults to `DefaultGeoJsonSourceName`.
+	SourceName string
+
+	// Properties maps feature properties to record fields.
+	Properties GeoJsonPropertyMapping
+
+	// Countries, if provided, is used to translate the country property from
+	// codes to names. Values not found in the mapping are used as-is.
+	Countries map[string]string
+}
+
+// GeoJsonParser reads city records from Point features. The input may be a
+// FeatureCollection, a single Feature, or a stream of Features (newline-
+// delimited GeoJSON). Features are decoded one at a time so that large
+// collections don't have to fit in memory. Features without a Point geometry,
+// or that can't be turned into a record, are skipped.
+type GeoJsonParser struct {
+	config GeoJsonParserConfig
+
+	skipCb geoattractor.CityRecordSkipCb
+}
+
+func NewGeoJsonParser(config GeoJsonParserConfig) *GeoJsonParser {
+	if config.SourceName == "" {
+		config.SourceName = DefaultGeoJsonSourceName
+	}
+
+	return &GeoJsonParser{
+		config: config,
+	}
+}
+
+// SetSkipCb sets a callback that's given the reason (one of the GeoJsonSkip*
+// constants) whenever a feature is skipped.
+func (gjp *GeoJsonParser) SetSkipCb(cb geoattractor.CityRecordSkipCb) {
+	gjp.skipCb = cb
+}
+
+// skip reports a skipped feature.
+func (gjp *GeoJsonParser) skip(reason string) {
+	if gjp.skipCb != nil {
+		gjp.skipCb(reason)
+	}
+}
+
+type geoJsonGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+type geoJsonFeature struct {
+	Type       string                 `json:"type"`
+	Id         interface{}            `json:"id"`
+	Geometry   *geoJsonGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+func (gjp *GeoJsonParser) Parse(r io.Reader, cityRecordCb geoattractor.CityRecordCb) (recordsCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if gjp.config.Properties.City == "" {
+		log.Panicf("city property not mapped")
+	}
+
+	d := json.NewDecoder(r)
+	d.UseNumber()
+
+	featureCb := func(feature geoJsonFeature) {
+		cr, skipReason := gjp.cityRecordFromFeature(feature)
+		if skipReason != "" {
+			gjp.skip(skipReason)
+			return
+		}
+
+		recordsCount++
+
+		if cityRecordCb != nil {
+			err := cityRecordCb(cr)
+			log.PanicIf(err)
+		}
+	}
+
+	// Each top-level value is either a FeatureCollection or a Feature. We walk
+	// the members of each so that we can stream the "features" array rather
+	// than decoding the whole collection at once.
+
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		if delim, ok := token.(json.Delim); ok == false || delim != '{' {
+			log.Panicf("expected a GeoJSON object: %v", token)
+		}
+
+		feature := geoJsonFeature{}
+
+		for d.More() == true {
+			token, err := d.Token()
+			log.PanicIf(err)
+
+			key := token.(string)
+
+			switch key {
+			case "features":
+				token, err := d.Token()
+				log.PanicIf(err)
+
+				if delim, ok := token.(json.Delim); ok == false || delim != '[' {
+					log.Panicf("expected an array of features: %v", token)
+				}
+
+				for d.More() == true {
+					child := geoJsonFeature{}
+
+					err := d.Decode(&child)
+					log.PanicIf(err)
+
+					featureCb(child)
+				}
+
+				// Consume the closing bracket.
+				_, err = d.Token()
+				log.PanicIf(err)
+			case "type":
+				err := d.Decode(&feature.Type)
+				log.PanicIf(err)
+			case "id":
+				err := d.Decode(&feature.Id)
+				log.PanicIf(err)
+			case "geometry":
+				err := d.Decode(&feature.Geometry)
+				log.PanicIf(err)
+			case "properties":
+				err := d.Decode(&feature.Properties)
+				log.PanicIf(err)
+			default:
+				var ignored json.RawMessage
+
+				err := d.Decode(&ignored)
+				log.PanicIf(err)
+			}
+		}
+
+		// Consume the closing brace.
+		_, err = d.Token()
+		log.PanicIf(err)
+
+		if feature.Type == "Feature" {
+			featureCb(feature)
+		} else if feature.Type != "FeatureCollection" {
+			log.Panicf("unsupported GeoJSON object type: [%s]", feature.Type)
+		}
+	}
+
+	return recordsCount, nil
+}
+
+// cityRecordFromFeature converts the feature. If it can't be, the reason (one
+// of the GeoJsonSkip* constants) is returned instead.
+func (gjp *GeoJsonParser) cityRecordFromFeature(feature geoJsonFeature) (cr geoattractor.CityRecord, skipReason string) {
+	if feature.Geometry == nil || feature.Geometry.Type != "Point" {
+		return cr, GeoJsonSkipNotPoint
+	}
+
+	mapping := gjp.config.Properties
+
+	var id string
+	if mapping.Id != "" {
+		id = propertyString(feature.Properties, mapping.Id)
+	} else if feature.Id != nil {
+		id = fmt.Sprintf("%v", feature.Id)
+	}
+
+	if id == "" {
+		return cr, GeoJsonSkipNoId
+	}
+
+	name := propertyString(feature.Properties, mapping.City)
+	if name == "" {
+		return cr, GeoJsonSkipNoName
+	}
+
+	coordinates := make([]float64, 0)
+
+	d := json.NewDecoder(bytes.NewReader(feature.Geometry.Coordinates))
+	if err := d.Decode(&coordinates); err != nil || len(coordinates) < 2 {
+		return cr, GeoJsonSkipInvalidCoordinates
+	}
+
+	// GeoJSON orders coordinates as longitude, latitude.
+	latitude := coordinates[1]
+	longitude := coordinates[0]
+
+	if validCoordinates(latitude, longitude) == false {
+		return cr, GeoJsonSkipInvalidCoordinates
+	}
+
+	var population uint64
+	if populationRaw := propertyString(feature.Properties, mapping.Population); populationRaw != "" {
+		// Population is sometimes published as a float (e.g. "1234.0").
+		populationFloat, err := strconv.ParseFloat(populationRaw, 64)
+		if err != nil || populationFloat < 0 || math.IsInf(populationFloat, 0) == true || math.IsNaN(populationFloat) == true {
+			return cr, GeoJsonSkipInvalidPopulation
+		}
+
+		population = uint64(populationFloat)
+	}
+
+	country := propertyString(feature.Properties, mapping.Country)
+	if countryName, found := gjp.config.Countries[country]; found == true {
+		country = countryName
+	}
+
+	cr = geoattractor.CityRecord{
+		Id:            id,
+		Country:       country,
+		ProvinceState: propertyString(feature.Properties, mapping.ProvinceState),
+		City:          name,
+		Population:    population,
+		Latitude:      latitude,
+		Longitude:     longitude,
+	}
+
+	return cr, ""
+}
+
+// propertyString returns the named property as a string. Missing and null
+// properties are returned as empty strings.
+func propertyString(properties map[string]interface{}, name string) string {
+	if name == "" {
+		return ""
+	}
+
+	value, found := properties[name]
+	if found == false || value == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(fmt.Sprintf("%v", value))
+}
+
+func (gjp *GeoJsonParser) Name() (name string) {
+	return gjp.config.SourceName
+}
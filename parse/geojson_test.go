@@ -0,0 +1,179 @@
+package geoattractorparse
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+func TestGeoJsonParser_Parse_FeatureCollection(t *testing.T) {
+	data := `{
+  "type": "FeatureCollection",
+  "name": "sites",
+  "features": [
+    {
+      "type": "Feature",
+      "id": 17,
+      "geometry": {"type": "Point", "coordinates": [-83.14993, 42.60559]},
+      "properties": {"name": "Troy", "cc": "US", "admin1": "MI", "pop": 83280}
+    },
+    {
+      "type": "Feature",
+      "id": 18,
+      "geometry": {"type": "LineString", "coordinates": [[0, 0], [1, 1]]},
+      "properties": {"name": "Not a place"}
+    },
+    {
+      "type": "Feature",
+      "id": "w-1",
+      "geometry": {"type": "Point", "coordinates": [-83.01304, 42.49044]},
+      "properties": {"name": "Warren", "cc": "US", "admin1": "MI", "pop": "134056.0"}
+    }
+  ],
+  "crs": {"type": "name", "properties": {"name": "urn:ogc:def:crs:OGC:1.3:CRS84"}}
+}`
+
+	gjp := NewGeoJsonParser(GeoJsonParserConfig{
+		Properties: GeoJsonPropertyMapping{
+			City:          "name",
+			Country:       "cc",
+			ProvinceState: "admin1",
+			Population:    "pop",
+		},
+		Countries: map[string]string{
+			"US": "United States",
+		},
+	})
+
+	if gjp.Name() != DefaultGeoJsonSourceName {
+		t.Fatalf("Source-name not correct: [%s]", gjp.Name())
+	}
+
+	actual := make([]string, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		actual = append(actual, cr.String())
+		return nil
+	}
+
+	recordsCount, err := gjp.Parse(strings.NewReader(data), cb)
+	log.PanicIf(err)
+
+	if recordsCount != 2 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+
+	expected := []string{
+		"CityRecord<ID=[17] COUNTRY=[United States] PROVINCE-OR-STATE=[MI] CITY=[Troy] POP=(83280) LAT=(42.6055900000) LON=(-83.1499300000) S2=[8824c3c40a768751]>",
+		"CityRecord<ID=[w-1] COUNTRY=[United States] PROVINCE-OR-STATE=[MI] CITY=[Warren] POP=(134056) LAT=(42.4904400000) LON=(-83.0130400000) S2=[8824d0a18dc66fa9]>",
+	}
+
+	if reflect.DeepEqual(actual, expected) == false {
+		for _, s := range actual {
+			fmt.Printf("%s\n", s)
+		}
+
+		t.Fatalf("Results not expected.")
+	}
+}
+
+func TestGeoJsonParser_Parse_NewlineDelimited(t *testing.T) {
+	data := `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [54.36667, 24.46667]}, "properties": {"code": "AUH", "city": "Abu Dhabi"}}
+{"type": "Feature", "geometry": {"type": "Point", "coordinates": [55.17128, 25.0657]}, "properties": {"code": "DXB", "city": "Dubai"}}
+`
+
+	gjp := NewGeoJsonParser(GeoJsonParserConfig{
+		SourceName: "Airports",
+		Properties: GeoJsonPropertyMapping{
+			Id:   "code",
+			City: "city",
+		},
+	})
+
+	records := make([]geoattractor.CityRecord, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		records = append(records, cr)
+		return nil
+	}
+
+	recordsCount, err := gjp.Parse(strings.NewReader(data), cb)
+	log.PanicIf(err)
+
+	if recordsCount != 2 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	} else if gjp.Name() != "Airports" {
+		t.Fatalf("Source-name not correct: [%s]", gjp.Name())
+	} else if records[1].Id != "DXB" || records[1].City != "Dubai" || records[1].Latitude != 25.0657 || records[1].Longitude != 55.17128 {
+		t.Fatalf("Second record not correct: %s", records[1])
+	}
+}
+
+func TestGeoJsonParser_Parse_UnsupportedType(t *testing.T) {
+	gjp := NewGeoJsonParser(GeoJsonParserConfig{
+		Properties: GeoJsonPropertyMapping{
+			City: "name",
+		},
+	})
+
+	_, err := gjp.Parse(strings.NewReader(`{"type": "Point", "coordinates": [1, 2]}`), nil)
+	if err == nil {
+		t.Fatalf("Expected error for bare geometry.")
+	} else if strings.Contains(err.Error(), "unsupported GeoJSON object type") == false {
+		t.Fatalf("Error not correct: [%s]", err)
+	}
+}
+
+func TestGeoJsonParser_Parse_SkipsInvalidFeatures(t *testing.T) {
+	data := `{"type": "FeatureCollection", "features": [
+{"type": "Feature", "id": 1, "geometry": {"type": "Point", "coordinates": [1.5, 42.5]}, "properties": {"name": "Good"}},
+{"type": "Feature", "geometry": {"type": "Point", "coordinates": [1.5, 42.5]}, "properties": {"name": "No ID"}},
+{"type": "Feature", "id": 3, "geometry": {"type": "Point", "coordinates": [1.5, 42.5]}, "properties": {}},
+{"type": "Feature", "id": 4, "geometry": {"type": "Point", "coordinates": [42.5, 95.0]}, "properties": {"name": "Swapped"}},
+{"type": "Feature", "id": 5, "geometry": {"type": "Point", "coordinates": [200.0, 10.0]}, "properties": {"name": "East"}},
+{"type": "Feature", "id": 6, "geometry": {"type": "Point", "coordinates": [1.5]}, "properties": {"name": "Short"}},
+{"type": "Feature", "id": 7, "geometry": {"type": "Point", "coordinates": [1.5, 42.5]}, "properties": {"name": "Bad population", "population": "many"}},
+{"type": "Feature", "id": 8, "geometry": {"type": "Point", "coordinates": [1.5, 42.5]}, "properties": {"name": "Negative population", "population": -1}},
+{"type": "Feature", "id": 9, "geometry": {"type": "LineString", "coordinates": [[1.5, 42.5], [1.6, 42.6]]}, "properties": {"name": "Line"}},
+{"type": "Feature", "id": 10, "geometry": {"type": "Point", "coordinates": [-180.0, -90.0]}, "properties": {"name": "Corner", "population": 5}}
+]}`
+
+	gjp := NewGeoJsonParser(GeoJsonParserConfig{
+		Properties: GeoJsonPropertyMapping{
+			City:       "name",
+			Population: "population",
+		},
+	})
+
+	skipped := make(map[string]int)
+	gjp.SetSkipCb(func(reason string) {
+		skipped[reason]++
+	})
+
+	ids := make([]string, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		ids = append(ids, cr.Id)
+		return nil
+	}
+
+	recordsCount, err := gjp.Parse(strings.NewReader(data), cb)
+	log.PanicIf(err)
+
+	if recordsCount != 2 || reflect.DeepEqual(ids, []string{"1", "10"}) == false {
+		t.Fatalf("Records not correct: (%d) %v", recordsCount, ids)
+	}
+
+	expected := map[string]int{
+		GeoJsonSkipNotPoint:           1,
+		GeoJsonSkipNoId:               1,
+		GeoJsonSkipNoName:             1,
+		GeoJsonSkipInvalidCoordinates: 3,
+		GeoJsonSkipInvalidPopulation:  2,
+	}
+
+	if reflect.DeepEqual(skipped, expected) == false {
+		t.Fatalf("Skips not correct: %v", skipped)
+	}
+}
@@ -1,15 +1,21 @@
 package geoattractorparse
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
 	"encoding/csv"
+	"io/ioutil"
 
 	"github.com/dsoprea/go-geographic-attractor"
 	"github.com/dsoprea/go-logging"
@@ -52,157 +58,279 @@ func BuildGeonamesCountryMapping(r io.Reader) (countries map[string]string, err
 	return countries, nil
 }
 
+// Reasons that GeoNames rows are skipped. These are reported to the callback
+// given to `SetSkipCb()`.
+const (
+	GeonamesSkipMalformed         = "malformed row"
+	GeonamesSkipComment           = "comment"
+	GeonamesSkipNoCountry         = "no country"
+	GeonamesSkipNotPopulatedPlace = "not a populated place"
+	GeonamesSkipNoPopulation      = "no population"
+)
+
 type GeonamesParser struct {
 	countries map[string]string
+
+	workers int
+	ordered bool
+
+	skipCb geoattractor.CityRecordSkipCb
 }
 
 func NewGeonamesParser(countries map[string]string) *GeonamesParser {
 	return &GeonamesParser{
 		countries: countries,
+		ordered:   true,
 	}
 }
 
-func (gp *GeonamesParser) Parse(r io.Reader, cityRecordCb geoattractor.CityRecordCb) (recordsCount int, err error) {
+// SetParallelism configures the parser to split the input into batches of lines
+// and to convert them on `workers` goroutines (including computing the S2
+// cells). The callback is always invoked on the calling goroutine. If `ordered`
+// is true, records are delivered in the order that they appear in the input;
+// otherwise, they're delivered as each batch completes. Fewer than two workers
+// parses sequentially, which is the default.
+func (gp *GeonamesParser) SetParallelism(workers int, ordered bool) {
+	gp.workers = workers
+	gp.ordered = ordered
+}
+
+// SetSkipCb sets a callback that's given the reason (one of the GeonamesSkip*
+// constants) whenever a row is skipped. Like the record callback, it's only
+// ever invoked on the calling goroutine.
+func (gp *GeonamesParser) SetSkipCb(cb geoattractor.CityRecordSkipCb) {
+	gp.skipCb = cb
+}
+
+// readGeonamesLines splits each line on tabs. GeoNames doesn't quote its
+// fields, so we don't use `encoding/csv`, which would trip over a stray quote
+// in a name.
+func readGeonamesLines(r io.Reader, cb func(record []string)) (err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	c := csv.NewReader(r)
-	c.Comma = '\t'
+	br := bufio.NewReader(r)
 
 	for {
-		record, err := c.Read()
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			log.Panic(err)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			cb(strings.Split(line, "\t"))
+		}
+
 		if err == io.EOF {
 			break
 		}
+	}
 
-		// From http://download.geonames.org/export/dump:
-		//
-		//  0: geonameid         : integer id of record in geonames database
-		//  1: name              : name of geographical point (utf8) varchar(200)
-		//  2: asciiname         : name of geographical point in plain ascii characters, varchar(200)
-		//  3: alternatenames    : alternatenames, comma separated, ascii names automatically transliterated, convenience attribute from alternatename table, varchar(10000)
-		//  4: latitude          : latitude in decimal degrees (wgs84)
-		//  5: longitude         : longitude in decimal degrees (wgs84)
-		//  6: feature class     : see http://www.geonames.org/export/codes.html, char(1)
-		//  7: feature code      : see http://www.geonames.org/export/codes.html, varchar(10)
-		//  8: country code      : ISO-3166 2-letter country code, 2 characters
-		//  9: cc2               : alternate country codes, comma separated, ISO-3166 2-letter country code, 200 characters
-		// 10: admin1 code       : fipscode (subject to change to iso code), see exceptions below, see file admin1Codes.txt for display names of this code; varchar(20)
-		// 11: admin2 code       : code for the second administrative division, a county in the US, see file admin2Codes.txt; varchar(80)
-		// 12: admin3 code       : code for third level administrative division, varchar(20)
-		// 13: admin4 code       : code for fourth level administrative division, varchar(20)
-		// 14: population        : bigint (8 byte int)
-		// 15: elevation         : in meters, integer
-		// 16: dem               : digital elevation model, srtm3 or gtopo30, average elevation of 3''x3'' (ca 90mx90m) or 30''x30'' (ca 900mx900m) area in meters, integer. srtm processed by cgiar/ciat.
-		// 17: timezone          : the iana timezone id (see file timeZone.txt) varchar(40)
-		// 18: modification date : date of last modification in yyyy-MM-dd format
+	return nil
+}
 
-		if len(record) != 19 {
-			// A line that doesn't look like a record.
+func (gp *GeonamesParser) Parse(r io.Reader, cityRecordCb geoattractor.CityRecordCb) (recordsCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
 
-			continue
-		} else if record[0][0] == '#' {
-			// A commented line that was somehow interpreted as a record.
+	if gp.workers > 1 {
+		recordsCount, err = gp.parseParallel(r, cityRecordCb)
+		log.PanicIf(err)
 
-			continue
-		}
+		return recordsCount, nil
+	}
 
-		geonamesId := record[0]
+	err = readGeonamesLines(r, func(record []string) {
+		cr, skipReason := gp.convertRecord(record, cityRecordCb != nil)
+		if skipReason != "" {
+			if gp.skipCb != nil {
+				gp.skipCb(skipReason)
+			}
 
-		// We've accidentally fed-in the country-list by accident so many times
-		// that now we're just protecting against it.
-		_, err = strconv.ParseUint(geonamesId, 10, 64)
-		if err != nil {
-			log.Panicf("first column doesn't look like an integer; are we looking at the right kind of file? %s", record)
+			return
 		}
 
-		name := record[1]
-		latitudeRaw := record[4]
-		longitudeRaw := record[5]
-		featureClass := record[6]
-		featureCode := record[7]
-		countryCode := record[8]
-		admin1Code := record[10]
-		populationRaw := record[14]
-
-		// In the case (name == "Commonwealth of Independent States").
-		if countryCode == "" {
-			continue
+		recordsCount++
+
+		if cityRecordCb != nil {
+			err := cityRecordCb(cr)
+			log.PanicIf(err)
 		}
+	})
 
-		dumpRecord := func() {
-			fmt.Printf("\n")
-			fmt.Printf("RECORD\n")
-			fmt.Printf("======\n")
+	log.PanicIf(err)
 
-			for i, part := range record {
-				fmt.Printf("%02d: [%s] (%d)\n", i, part, len(part))
-			}
+	return recordsCount, nil
+}
 
-			fmt.Printf("\n")
-		}
+// GeonamesFeatureRecordCb is given each record along with its GeoNames
+// feature code (e.g. "PPLA" or "PPLC").
+type GeonamesFeatureRecordCb func(cr geoattractor.CityRecord, featureCode string) (err error)
 
-		// TODO(dustin): !! Move these out to a configurable filter.
+// ParseWithFeatureCodes reads rows in the same format as `Parse()` and qualifies
+// them the same way, but also passes along the feature code, which isn't part
+// of the record. Rows are parsed sequentially regardless of `SetParallelism()`.
+func (gp *GeonamesParser) ParseWithFeatureCodes(r io.Reader, cb GeonamesFeatureRecordCb) (recordsCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
 
-		if featureClass != "P" {
-			continue
-		} else if featureCode != "PPLC" && strings.HasPrefix(featureCode, "PPLA") == false && featureCode != "PPL" && featureCode != "PPLX" && featureCode != "PPLL" {
-			// Filter for any populated place type. These all appear to depend on
-			// the size of the place and no particular classification applies.
+	err = readGeonamesLines(r, func(record []string) {
+		cr, skipReason := gp.convertRecord(record, true)
+		if skipReason != "" {
+			if gp.skipCb != nil {
+				gp.skipCb(skipReason)
+			}
 
-			continue
+			return
 		}
 
-		if populationRaw == "" || populationRaw == "null" {
-			continue
-		} else if name == "" {
-			log.Panicf("no city name found for GeoNames ID [%s]", geonamesId)
-		}
+		recordsCount++
 
-		population, err := strconv.ParseUint(populationRaw, 10, 64)
+		err := cb(cr, record[7])
 		log.PanicIf(err)
+	})
 
-		if population == 0 {
-			continue
+	log.PanicIf(err)
+
+	return recordsCount, nil
+}
+
+// convertRecord checks and converts one row. `skipReason` is one of the
+// GeonamesSkip* constants if the row should be skipped. If `convert` is false,
+// the row is only checked and an empty record is returned. Panics on data that
+// shouldn't be skipped silently.
+func (gp *GeonamesParser) convertRecord(record []string, convert bool) (cr geoattractor.CityRecord, skipReason string) {
+	// From http://download.geonames.org/export/dump:
+	//
+	//  0: geonameid         : integer id of record in geonames database
+	//  1: name              : name of geographical point (utf8) varchar(200)
+	//  2: asciiname         : name of geographical point in plain ascii characters, varchar(200)
+	//  3: alternatenames    : alternatenames, comma separated, ascii names automatically transliterated, convenience attribute from alternatename table, varchar(10000)
+	//  4: latitude          : latitude in decimal degrees (wgs84)
+	//  5: longitude         : longitude in decimal degrees (wgs84)
+	//  6: feature class     : see http://www.geonames.org/export/codes.html, char(1)
+	//  7: feature code      : see http://www.geonames.org/export/codes.html, varchar(10)
+	//  8: country code      : ISO-3166 2-letter country code, 2 characters
+	//  9: cc2               : alternate country codes, comma separated, ISO-3166 2-letter country code, 200 characters
+	// 10: admin1 code       : fipscode (subject to change to iso code), see exceptions below, see file admin1Codes.txt for display names of this code; varchar(20)
+	// 11: admin2 code       : code for the second administrative division, a county in the US, see file admin2Codes.txt; varchar(80)
+	// 12: admin3 code       : code for third level administrative division, varchar(20)
+	// 13: admin4 code       : code for fourth level administrative division, varchar(20)
+	// 14: population        : bigint (8 byte int)
+	// 15: elevation         : in meters, integer
+	// 16: dem               : digital elevation model, srtm3 or gtopo30, average elevation of 3''x3'' (ca 90mx90m) or 30''x30'' (ca 900mx900m) area in meters, integer. srtm processed by cgiar/ciat.
+	// 17: timezone          : the iana timezone id (see file timeZone.txt) varchar(40)
+	// 18: modification date : date of last modification in yyyy-MM-dd format
+
+	if len(record) != 19 || record[0] == "" {
+		// A line that doesn't look like a record.
+
+		return cr, GeonamesSkipMalformed
+	} else if record[0][0] == '#' {
+		// A commented line that was somehow interpreted as a record.
+
+		return cr, GeonamesSkipComment
+	}
+
+	geonamesId := record[0]
+
+	// We've accidentally fed-in the country-list by accident so many times
+	// that now we're just protecting against it.
+	_, err := strconv.ParseUint(geonamesId, 10, 64)
+	if err != nil {
+		log.Panicf("first column doesn't look like an integer; are we looking at the right kind of file? %s", record)
+	}
+
+	name := record[1]
+	latitudeRaw := record[4]
+	longitudeRaw := record[5]
+	featureClass := record[6]
+	featureCode := record[7]
+	countryCode := record[8]
+	admin1Code := record[10]
+	populationRaw := record[14]
+
+	// In the case (name == "Commonwealth of Independent States").
+	if countryCode == "" {
+		return cr, GeonamesSkipNoCountry
+	}
+
+	dumpRecord := func() {
+		fmt.Printf("\n")
+		fmt.Printf("RECORD\n")
+		fmt.Printf("======\n")
+
+		for i, part := range record {
+			fmt.Printf("%02d: [%s] (%d)\n", i, part, len(part))
 		}
 
-		recordsCount++
+		fmt.Printf("\n")
+	}
 
-		if cityRecordCb != nil {
-			// If we get here, we have a tangible population value.
+	// TODO(dustin): !! Move these out to a configurable filter.
 
-			countryName, found := gp.countries[countryCode]
-			if found == false {
-				dumpRecord()
+	if featureClass != "P" {
+		return cr, GeonamesSkipNotPopulatedPlace
+	} else if featureCode != "PPLC" && strings.HasPrefix(featureCode, "PPLA") == false && featureCode != "PPL" && featureCode != "PPLX" && featureCode != "PPLL" {
+		// Filter for any populated place type. These all appear to depend on
+		// the size of the place and no particular classification applies.
 
-				log.Panicf("could not resolve country with code [%s] ((%d) countries known)", countryCode, len(gp.countries))
-			}
+		return cr, GeonamesSkipNotPopulatedPlace
+	}
 
-			latitude, err := strconv.ParseFloat(latitudeRaw, 64)
-			log.PanicIf(err)
+	if populationRaw == "" || populationRaw == "null" {
+		return cr, GeonamesSkipNoPopulation
+	} else if name == "" {
+		log.Panicf("no city name found for GeoNames ID [%s]", geonamesId)
+	}
 
-			longitude, err := strconv.ParseFloat(longitudeRaw, 64)
-			log.PanicIf(err)
+	population, err := strconv.ParseUint(populationRaw, 10, 64)
+	log.PanicIf(err)
 
-			cr := geoattractor.CityRecord{
-				Id:            geonamesId,
-				Country:       countryName,
-				ProvinceState: admin1Code,
-				City:          name,
-				Population:    population,
-				Latitude:      latitude,
-				Longitude:     longitude,
-			}
+	if population == 0 {
+		return cr, GeonamesSkipNoPopulation
+	}
 
-			err = cityRecordCb(cr)
-			log.PanicIf(err)
-		}
+	if convert == false {
+		return cr, ""
 	}
 
-	return recordsCount, nil
+	// If we get here, we have a tangible population value.
+
+	countryName, found := gp.countries[countryCode]
+	if found == false {
+		dumpRecord()
+
+		log.Panicf("could not resolve country with code [%s] ((%d) countries known)", countryCode, len(gp.countries))
+	}
+
+	latitude, err := strconv.ParseFloat(latitudeRaw, 64)
+	log.PanicIf(err)
+
+	longitude, err := strconv.ParseFloat(longitudeRaw, 64)
+	log.PanicIf(err)
+
+	cr = geoattractor.CityRecord{
+		Id:            geonamesId,
+		Country:       countryName,
+		ProvinceState: admin1Code,
+		City:          name,
+		Population:    population,
+		Latitude:      latitude,
+		Longitude:     longitude,
+	}
+
+	return cr, ""
 }
 
 func (gp *GeonamesParser) Name() (name string) {
@@ -240,6 +368,10 @@ func NewGeonamesParserWithFiles(countryDataFilepath string) (gp *GeonamesParser,
 	return gp, nil
 }
 
+// GetCitydataReadCloser opens the city data. The format is detected from the
+// content rather than the file-name: plain text, gzip, bzip2, and ZIP archives
+// are supported. A file-path of "-" reads from STDIN. See
+// `NewCitydataReadCloser` for how archives are handled.
 func GetCitydataReadCloser(cityDataFilepath string) (rc io.ReadCloser, err error) {
 	defer func() {
 		if state := recover(); state != nil {
@@ -255,27 +387,263 @@ func GetCitydataReadCloser(cityDataFilepath string) (rc io.ReadCloser, err error
 		}
 	}
 
-	if path.Ext(strings.ToLower(cityDataFilepath)) == ".zip" {
-		zf, err := zip.OpenReader(cityDataFilepath)
+	if cityDataFilepath == "-" {
+		// We don't want to close STDIN out from under the process.
+		rc, err = NewCitydataReadCloser(ioutil.NopCloser(os.Stdin))
 		log.PanicIf(err)
 
-		defer zf.Close()
+		return rc, nil
+	}
+
+	f, err := os.Open(cityDataFilepath)
+	log.PanicIf(err)
+
+	rc, err = NewCitydataReadCloser(f)
+	if err != nil {
+		f.Close()
+		log.Panic(err)
+	}
+
+	return rc, nil
+}
 
-		innerFilename := "allCountries.txt"
-		for _, file := range zf.File {
-			if file.Name == innerFilename {
-				rc, err = file.Open()
-				log.PanicIf(err)
+// ExpandCitydataFilepaths expands any globs in the given list of city-data
+// file-paths. If the list is empty, the GGA_CITY_DATA_FILEPATH environment
+// variable is used, which may contain several file-paths separated by the
+// system's path-list separator. A glob that matches nothing is an error. The
+// order is preserved (matches for each glob are sorted) and repeats are
+// dropped.
+func ExpandCitydataFilepaths(patterns []string) (filepaths []string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if len(patterns) == 0 {
+		patterns = filepath.SplitList(os.Getenv("GGA_CITY_DATA_FILEPATH"))
+
+		if len(patterns) == 0 {
+			log.Panicf("city-data file-path not provided or defined via GGA_CITY_DATA_FILEPATH")
+		}
+	}
+
+	filepaths = make([]string, 0)
+	seen := make(map[string]struct{})
+
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+
+		if pattern != "-" {
+			globbed, err := filepath.Glob(pattern)
+			log.PanicIf(err)
+
+			if len(globbed) == 0 {
+				log.Panicf("no city-data files found: [%s]", pattern)
 			}
+
+			matches = globbed
 		}
 
-		if rc == nil {
-			log.Panicf("Could not find file [%s] in the city-data archive: [%s]", innerFilename, cityDataFilepath)
+		for _, match := range matches {
+			if _, found := seen[match]; found == true {
+				continue
+			}
+
+			seen[match] = struct{}{}
+			filepaths = append(filepaths, match)
 		}
-	} else {
-		rc, err = os.Open(cityDataFilepath)
+	}
+
+	return filepaths, nil
+}
+
+// NewCitydataReadCloser detects the format of the given data and returns a
+// reader for the uncompressed city data. Closing the returned reader closes
+// `r`.
+//
+// For ZIP archives, every ".txt" entry other than "readme.txt" is read, one
+// after the other in the order that they're stored. This covers
+// "allCountries.zip", the per-country archives (e.g. "US.zip"), and the
+// "citiesNNNN.zip" archives. ZIP archives need random access so, unless `r` is
+// a regular file (or wraps one and provides `ReadAt()` and `Stat()`), the
+// archive is read into memory first.
+func NewCitydataReadCloser(r io.ReadCloser) (rc io.ReadCloser, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		log.Panic(err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(br)
 		log.PanicIf(err)
+
+		rc = &citydataReadCloser{
+			Reader:  gr,
+			closers: []io.Closer{gr, r},
+		}
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		rc = &citydataReadCloser{
+			Reader:  bzip2.NewReader(br),
+			closers: []io.Closer{r},
+		}
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		rc, err = newZipCitydataReadCloser(r, br)
+		log.PanicIf(err)
+	default:
+		rc = &citydataReadCloser{
+			Reader:  br,
+			closers: []io.Closer{r},
+		}
 	}
 
 	return rc, nil
 }
+
+func newZipCitydataReadCloser(r io.ReadCloser, br *bufio.Reader) (rc io.ReadCloser, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	var ra io.ReaderAt
+	var size int64
+
+	// Files (and anything else that can be read in place, like a wrapped file)
+	// are read directly.
+	if f, ok := r.(citydataFile); ok == true {
+		fi, err := f.Stat()
+		log.PanicIf(err)
+
+		if fi.Mode().IsRegular() == true {
+			ra = f
+			size = fi.Size()
+		}
+	}
+
+	if ra == nil {
+		data, err := ioutil.ReadAll(br)
+		log.PanicIf(err)
+
+		ra = bytes.NewReader(data)
+		size = int64(len(data))
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	log.PanicIf(err)
+
+	entries := make([]*zip.File, 0)
+	for _, file := range zr.File {
+		filename := strings.ToLower(path.Base(file.Name))
+
+		if path.Ext(filename) != ".txt" || filename == "readme.txt" {
+			continue
+		}
+
+		entries = append(entries, file)
+	}
+
+	if len(entries) == 0 {
+		log.Panicf("no city-data (.txt) files found in the archive")
+	}
+
+	rc = &zipCitydataReadCloser{
+		entries: entries,
+		closer:  r,
+	}
+
+	return rc, nil
+}
+
+// citydataFile is satisfied by `*os.File` and anything that wraps one.
+type citydataFile interface {
+	io.ReaderAt
+	Stat() (os.FileInfo, error)
+}
+
+// citydataReadCloser closes a stack of readers in order.
+type citydataReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (crc *citydataReadCloser) Close() (err error) {
+	for _, c := range crc.closers {
+		if closeErr := c.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// zipCitydataReadCloser reads each of the given entries in turn, separated by
+// newlines in case an entry doesn't end with one. The underlying archive stays
+// open until it's closed.
+type zipCitydataReadCloser struct {
+	entries []*zip.File
+	current io.ReadCloser
+	closer  io.Closer
+
+	separatorPending bool
+}
+
+func (zcrc *zipCitydataReadCloser) Read(p []byte) (n int, err error) {
+	for {
+		if zcrc.current == nil {
+			if len(zcrc.entries) == 0 {
+				return 0, io.EOF
+			} else if zcrc.separatorPending == true && len(p) > 0 {
+				zcrc.separatorPending = false
+
+				p[0] = '\n'
+				return 1, nil
+			}
+
+			zcrc.current, err = zcrc.entries[0].Open()
+			if err != nil {
+				return 0, err
+			}
+
+			zcrc.entries = zcrc.entries[1:]
+		}
+
+		n, err = zcrc.current.Read(p)
+		if err == io.EOF {
+			zcrc.current.Close()
+			zcrc.current = nil
+			zcrc.separatorPending = true
+
+			if n > 0 {
+				return n, nil
+			}
+
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (zcrc *zipCitydataReadCloser) Close() (err error) {
+	if zcrc.current != nil {
+		err = zcrc.current.Close()
+		zcrc.current = nil
+	}
+
+	if closeErr := zcrc.closer.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,176 @@
+package geoattractorparse
+
+import (
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	geonamesDeltaFilenameRx = regexp.MustCompile(`^(modifications|deletes)-(\d{4}-\d{2}-\d{2})\.txt$`)
+)
+
+// GeonamesRowCb is given every row that has a GeoNames ID. If the row doesn't
+// qualify as a city, `skipReason` is one of the GeonamesSkip* constants and
+// the record is empty.
+type GeonamesRowCb func(geonamesId string, cr geoattractor.CityRecord, skipReason string) (err error)
+
+// ParseRows reads rows in the same format as `Parse()` but reports the rows
+// that were skipped along with the records. This is what's needed to apply the
+// daily modifications, where a modified row that no longer qualifies means that
+// the city has to be removed.
+func (gp *GeonamesParser) ParseRows(r io.Reader, rowCb GeonamesRowCb) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = readGeonamesLines(r, func(record []string) {
+		cr, skipReason := gp.convertRecord(record, true)
+		if skipReason == GeonamesSkipMalformed || skipReason == GeonamesSkipComment {
+			return
+		}
+
+		err := rowCb(record[0], cr, skipReason)
+		log.PanicIf(err)
+	})
+
+	log.PanicIf(err)
+
+	return nil
+}
+
+// ParseGeonamesDeletes reads a GeoNames "deletes-YYYY-MM-DD.txt" file (ID,
+// name, and comment, tab-separated) and calls `cb` with each ID.
+func ParseGeonamesDeletes(r io.Reader, cb func(geonamesId string) error) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = readGeonamesLines(r, func(record []string) {
+		if record[0] == "" || record[0][0] == '#' {
+			return
+		}
+
+		err := cb(record[0])
+		log.PanicIf(err)
+	})
+
+	log.PanicIf(err)
+
+	return nil
+}
+
+// GeonamesDelta is the pair of daily delta files for one date. Either may be
+// empty if the file isn't present.
+type GeonamesDelta struct {
+	// Date is formatted as "YYYY-MM-DD".
+	Date string
+
+	ModificationsFilepath string
+	DeletesFilepath       string
+}
+
+// FindGeonamesDeltas finds the "modifications-YYYY-MM-DD.txt" and
+// "deletes-YYYY-MM-DD.txt" files in the given directory and returns them
+// grouped by date, oldest first.
+func FindGeonamesDeltas(directoryPath string) (deltas []GeonamesDelta, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	files, err := ioutil.ReadDir(directoryPath)
+	log.PanicIf(err)
+
+	byDate := make(map[string]*GeonamesDelta)
+
+	for _, fi := range files {
+		if fi.IsDir() == true {
+			continue
+		}
+
+		matches := geonamesDeltaFilenameRx.FindStringSubmatch(fi.Name())
+		if matches == nil {
+			continue
+		}
+
+		kind := matches[1]
+		date := matches[2]
+
+		gd, found := byDate[date]
+		if found == false {
+			gd = &GeonamesDelta{
+				Date: date,
+			}
+
+			byDate[date] = gd
+		}
+
+		filepath := path.Join(directoryPath, fi.Name())
+
+		if kind == "modifications" {
+			gd.ModificationsFilepath = filepath
+		} else {
+			gd.DeletesFilepath = filepath
+		}
+	}
+
+	deltas = make([]GeonamesDelta, 0, len(byDate))
+	for _, gd := range byDate {
+		deltas = append(deltas, *gd)
+	}
+
+	// The dates are zero-padded so they sort lexically.
+	sort.Slice(deltas, func(i, j int) bool {
+		return deltas[i].Date < deltas[j].Date
+	})
+
+	return deltas, nil
+}
+
+// Open opens the delta files. Missing files are returned as empty readers. The
+// caller must close both.
+func (gd GeonamesDelta) Open() (modifications, deletes io.ReadCloser, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	modifications, err = openGeonamesDeltaFile(gd.ModificationsFilepath)
+	log.PanicIf(err)
+
+	deletes, err = openGeonamesDeltaFile(gd.DeletesFilepath)
+	if err != nil {
+		modifications.Close()
+		log.Panic(err)
+	}
+
+	return modifications, deletes, nil
+}
+
+func openGeonamesDeltaFile(filepath string) (rc io.ReadCloser, err error) {
+	if filepath == "" {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,117 @@
+package geoattractorparse
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+func TestGeonamesParser_ParseRows(t *testing.T) {
+	gp := NewGeonamesParser(getCountryMapping())
+
+	data := "# comment\n" +
+		"292223\tDubai\tDubai\t\t25.2048\t55.2708\tP\tPPLA\tAE\t\t03\t\t\t\t3331420\t\t5\tAsia/Dubai\t2026-10-01\n" +
+		"3039163\tSant Julià de Lòria\tSant Julia de Loria\t\t42.46372\t1.49129\tP\tPPLA\tAD\t\t06\t\t\t\t\t\t921\tEurope/Andorra\t2026-10-01\n" +
+		"not enough columns\n"
+
+	ids := make([]string, 0)
+	cities := make([]string, 0)
+	reasons := make([]string, 0)
+
+	cb := func(geonamesId string, cr geoattractor.CityRecord, skipReason string) (err error) {
+		ids = append(ids, geonamesId)
+		cities = append(cities, cr.City)
+		reasons = append(reasons, skipReason)
+
+		return nil
+	}
+
+	err := gp.ParseRows(strings.NewReader(data), cb)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(ids, []string{"292223", "3039163"}) == false {
+		t.Fatalf("IDs not correct: %v", ids)
+	} else if reflect.DeepEqual(cities, []string{"Dubai", ""}) == false {
+		t.Fatalf("Cities not correct: %v", cities)
+	} else if reflect.DeepEqual(reasons, []string{"", GeonamesSkipNoPopulation}) == false {
+		t.Fatalf("Skip reasons not correct: %v", reasons)
+	}
+}
+
+func TestParseGeonamesDeletes(t *testing.T) {
+	data := "292968\tAbu Dhabi\tduplicate\n\n3039163\tSant Julià de Lòria\t\"merged\" into another\r\n"
+
+	ids := make([]string, 0)
+	cb := func(geonamesId string) (err error) {
+		ids = append(ids, geonamesId)
+		return nil
+	}
+
+	err := ParseGeonamesDeletes(strings.NewReader(data), cb)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(ids, []string{"292968", "3039163"}) == false {
+		t.Fatalf("IDs not correct: %v", ids)
+	}
+}
+
+func TestFindGeonamesDeltas(t *testing.T) {
+	tempPath, err := ioutil.TempDir("", "")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	filenames := []string{
+		"modifications-2026-10-02.txt",
+		"deletes-2026-10-02.txt",
+		"deletes-2026-10-01.txt",
+		"alternateNamesModifications-2026-10-02.txt",
+		"allCountries.zip",
+	}
+
+	for _, filename := range filenames {
+		err := ioutil.WriteFile(path.Join(tempPath, filename), []byte{}, 0644)
+		log.PanicIf(err)
+	}
+
+	deltas, err := FindGeonamesDeltas(tempPath)
+	log.PanicIf(err)
+
+	expected := []GeonamesDelta{
+		{
+			Date:            "2026-10-01",
+			DeletesFilepath: path.Join(tempPath, "deletes-2026-10-01.txt"),
+		},
+		{
+			Date:                  "2026-10-02",
+			ModificationsFilepath: path.Join(tempPath, "modifications-2026-10-02.txt"),
+			DeletesFilepath:       path.Join(tempPath, "deletes-2026-10-02.txt"),
+		},
+	}
+
+	if reflect.DeepEqual(deltas, expected) == false {
+		t.Fatalf("Deltas not correct: %v", deltas)
+	}
+
+	// The missing modifications file reads as empty.
+
+	modifications, deletes, err := deltas[0].Open()
+	log.PanicIf(err)
+
+	defer modifications.Close()
+	defer deletes.Close()
+
+	data, err := ioutil.ReadAll(modifications)
+	log.PanicIf(err)
+
+	if len(data) != 0 {
+		t.Fatalf("Expected empty modifications.")
+	}
+}
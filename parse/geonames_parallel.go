@@ -0,0 +1,275 @@
+package geoattractorparse
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// geonamesBatchSize is the approximate number of bytes given to a worker
+	// at a time.
+	geonamesBatchSize = 256 * 1024
+)
+
+var (
+	errGeonamesParseStopped = errors.New("parse stopped")
+)
+
+type geonamesBatch struct {
+	sequence int
+	data     []byte
+}
+
+type geonamesBatchResult struct {
+	sequence     int
+	records      []geoattractor.CityRecord
+	recordsCount int
+	skipped      map[string]int
+	err          error
+}
+
+// parseParallel runs a pipeline of one reader that splits the input into
+// batches of lines, `gp.workers` goroutines that convert and filter each batch,
+// and the calling goroutine, which delivers the records to the callback.
+//
+// Like the sequential parser, lines are split on tabs (see
+// `readGeonamesLines()`) so that both return the same records.
+func (gp *GeonamesParser) parseParallel(r io.Reader, cityRecordCb geoattractor.CityRecordCb) (recordsCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	convert := cityRecordCb != nil
+
+	// Closing `done` tells the reader and the workers to stop early.
+	done := make(chan struct{})
+	defer close(done)
+
+	batches := make(chan geonamesBatch, gp.workers*2)
+	results := make(chan geonamesBatchResult, gp.workers*2)
+
+	// The reader reports its error, if any, as a result with a negative
+	// sequence so that it's seen in the same place as the worker errors.
+
+	go func() {
+		defer close(batches)
+
+		err := gp.readBatches(r, batches, done)
+		if err != nil {
+			select {
+			case results <- geonamesBatchResult{sequence: -1, err: err}:
+			case <-done:
+			}
+		}
+	}()
+
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < gp.workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for batch := range batches {
+				result := gp.convertBatch(batch, convert)
+
+				select {
+				case results <- result:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results that arrived ahead of their turn when delivering in order.
+	pending := make(map[int]geonamesBatchResult)
+	nextSequence := 0
+
+	deliver := func(result geonamesBatchResult) {
+		recordsCount += result.recordsCount
+
+		if gp.skipCb != nil {
+			for reason, count := range result.skipped {
+				for i := 0; i < count; i++ {
+					gp.skipCb(reason)
+				}
+			}
+		}
+
+		if cityRecordCb == nil {
+			return
+		}
+
+		for _, cr := range result.records {
+			err := cityRecordCb(cr)
+			log.PanicIf(err)
+		}
+	}
+
+	for result := range results {
+		log.PanicIf(result.err)
+
+		if gp.ordered == false {
+			deliver(result)
+			continue
+		}
+
+		pending[result.sequence] = result
+
+		for {
+			next, found := pending[nextSequence]
+			if found == false {
+				break
+			}
+
+			delete(pending, nextSequence)
+			nextSequence++
+
+			deliver(next)
+		}
+	}
+
+	if len(pending) > 0 {
+		log.Panicf("(%d) batches were never delivered", len(pending))
+	}
+
+	return recordsCount, nil
+}
+
+// readBatches splits the input into batches of whole lines. The reader doesn't
+// look at the lines beyond finding the last newline in each chunk so that it
+// stays ahead of the workers. Returns `errGeonamesParseStopped` if `done` was
+// closed before the input was exhausted.
+func (gp *GeonamesParser) readBatches(r io.Reader, batches chan<- geonamesBatch, done <-chan struct{}) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sequence := 0
+
+	// The partial line left over from the previous chunk.
+	var carry []byte
+
+	for {
+		chunk := make([]byte, len(carry)+geonamesBatchSize)
+		copy(chunk, carry)
+
+		n, err := io.ReadFull(r, chunk[len(carry):])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			log.Panic(err)
+		}
+
+		isLast := err != nil
+		chunk = chunk[:len(carry)+n]
+
+		if isLast == true {
+			carry = nil
+		} else {
+			i := bytes.LastIndexByte(chunk, '\n')
+			if i == -1 {
+				// A line longer than the chunk. Keep reading.
+				carry = chunk
+				continue
+			}
+
+			carry = chunk[i+1:]
+			chunk = chunk[:i+1]
+		}
+
+		if len(chunk) > 0 {
+			batch := geonamesBatch{
+				sequence: sequence,
+				data:     chunk,
+			}
+
+			select {
+			case batches <- batch:
+			case <-done:
+				return errGeonamesParseStopped
+			}
+
+			sequence++
+		}
+
+		if isLast == true {
+			break
+		}
+	}
+
+	return nil
+}
+
+// convertBatch converts the lines of one batch. Panics are returned as the
+// result's error.
+func (gp *GeonamesParser) convertBatch(batch geonamesBatch, convert bool) (result geonamesBatchResult) {
+	result.sequence = batch.sequence
+	result.skipped = make(map[string]int)
+
+	defer func() {
+		if state := recover(); state != nil {
+			result.err = log.Wrap(state.(error))
+		}
+	}()
+
+	if convert == true {
+		result.records = make([]geoattractor.CityRecord, 0)
+	}
+
+	data := batch.data
+
+	for len(data) > 0 {
+		var line []byte
+
+		if i := bytes.IndexByte(data, '\n'); i != -1 {
+			line = data[:i]
+			data = data[i+1:]
+		} else {
+			line = data
+			data = nil
+		}
+
+		line = bytes.TrimRight(line, "\r")
+
+		// `encoding/csv` ignores empty lines so we do too.
+		if len(line) == 0 {
+			continue
+		}
+
+		record := strings.Split(string(line), "\t")
+
+		cr, skipReason := gp.convertRecord(record, convert)
+		if skipReason != "" {
+			result.skipped[skipReason]++
+			continue
+		}
+
+		result.recordsCount++
+
+		if convert == true {
+			// Compute the cell here so that the index doesn't have to do it on
+			// the delivering goroutine.
+			cr.Cell = cr.S2Cell()
+
+			result.records = append(result.records, cr)
+		}
+	}
+
+	return result
+}
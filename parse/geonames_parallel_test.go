@@ -0,0 +1,239 @@
+package geoattractorparse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+func getGeonamesShortData() []byte {
+	data, err := ioutil.ReadFile(path.Join(testAssetsPath, "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	return data
+}
+
+func parseGeonamesToStrings(gp *GeonamesParser, data []byte) (recordsCount int, actual []string) {
+	actual = make([]string, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		actual = append(actual, cr.String())
+		return nil
+	}
+
+	recordsCount, err := gp.Parse(bytes.NewReader(data), cb)
+	log.PanicIf(err)
+
+	return recordsCount, actual
+}
+
+func TestGeonamesParser_Parse_StrayQuote(t *testing.T) {
+	data := getGeonamesShortData()
+
+	// Put an unbalanced quote in the name of the first city (Andorra la
+	// Vella). It mustn't affect the lines that follow it.
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if bytes.HasPrefix(line, []byte("3041563\t")) == true {
+			lines[i] = bytes.Replace(line, []byte("\tAndorra la Vella\t"), []byte("\t\"Andorra la Vella\t"), 1)
+		}
+	}
+
+	data = bytes.Join(lines, []byte("\n"))
+
+	gp := NewGeonamesParser(getCountryMapping())
+
+	recordsCount, sequential := parseGeonamesToStrings(gp, data)
+	if recordsCount != 35 {
+		t.Fatalf("Sequential parse lost records: (%d)", recordsCount)
+	}
+
+	gp.SetParallelism(4, true)
+
+	recordsCount, parallel := parseGeonamesToStrings(gp, data)
+	if recordsCount != 35 {
+		t.Fatalf("Parallel parse lost records: (%d)", recordsCount)
+	} else if reflect.DeepEqual(parallel, sequential) == false {
+		t.Fatalf("Sequential and parallel parses don't agree.")
+	}
+}
+
+func TestGeonamesParser_Parse_ParallelOrdered(t *testing.T) {
+	data := getGeonamesShortData()
+
+	gp := NewGeonamesParser(getCountryMapping())
+	_, expected := parseGeonamesToStrings(gp, data)
+
+	gp.SetParallelism(4, true)
+	recordsCount, actual := parseGeonamesToStrings(gp, data)
+
+	if recordsCount != 35 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+
+	if reflect.DeepEqual(actual, expected) == false {
+		for _, s := range actual {
+			fmt.Printf("%s\n", s)
+		}
+
+		t.Fatalf("Results not expected.")
+	}
+}
+
+func TestGeonamesParser_Parse_ParallelUnordered(t *testing.T) {
+	data := getGeonamesShortData()
+
+	gp := NewGeonamesParser(getCountryMapping())
+	_, expected := parseGeonamesToStrings(gp, data)
+
+	gp.SetParallelism(4, false)
+	recordsCount, actual := parseGeonamesToStrings(gp, data)
+
+	if recordsCount != 35 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+
+	sort.Strings(expected)
+	sort.Strings(actual)
+
+	if reflect.DeepEqual(actual, expected) == false {
+		for _, s := range actual {
+			fmt.Printf("%s\n", s)
+		}
+
+		t.Fatalf("Results not expected.")
+	}
+}
+
+func TestGeonamesParser_Parse_ParallelWithoutCallback(t *testing.T) {
+	gp := NewGeonamesParser(nil)
+	gp.SetParallelism(4, true)
+
+	// Without a callback the countries aren't needed.
+	recordsCount, err := gp.Parse(bytes.NewReader(getGeonamesShortData()), nil)
+	log.PanicIf(err)
+
+	if recordsCount != 35 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+}
+
+func TestGeonamesParser_Parse_ParallelCallbackError(t *testing.T) {
+	gp := NewGeonamesParser(getCountryMapping())
+	gp.SetParallelism(4, true)
+
+	errStop := errors.New("stop")
+
+	calls := 0
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		calls++
+		return errStop
+	}
+
+	_, err := gp.Parse(bytes.NewReader(getGeonamesShortData()), cb)
+	if err == nil {
+		t.Fatalf("Expected error from callback.")
+	} else if calls != 1 {
+		t.Fatalf("Callback should not have been called after the error: (%d)", calls)
+	}
+}
+
+func TestGeonamesParser_Parse_ParallelBadData(t *testing.T) {
+	// Feed the country-list in, which the parser protects against.
+
+	f, err := os.Open(path.Join(appPath, "test", "asset", "countryInfo.txt"))
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	gp := NewGeonamesParser(getCountryMapping())
+	gp.SetParallelism(4, true)
+
+	_, err = gp.Parse(f, nil)
+	if err == nil {
+		t.Fatalf("Expected error for wrong kind of file.")
+	}
+}
+
+func TestGeonamesParser_SetSkipCb(t *testing.T) {
+	data := getGeonamesShortData()
+
+	gp := NewGeonamesParser(getCountryMapping())
+
+	getSkipped := func() map[string]int {
+		skipped := make(map[string]int)
+		gp.SetSkipCb(func(reason string) {
+			skipped[reason]++
+		})
+
+		recordsCount, _ := parseGeonamesToStrings(gp, data)
+
+		if recordsCount+skipped[GeonamesSkipNotPopulatedPlace]+skipped[GeonamesSkipNoPopulation] != 10000 {
+			t.Fatalf("Skipped rows not correct: (%d) %v", recordsCount, skipped)
+		}
+
+		return skipped
+	}
+
+	sequential := getSkipped()
+
+	gp.SetParallelism(4, false)
+	parallel := getSkipped()
+
+	if reflect.DeepEqual(parallel, sequential) == false {
+		t.Fatalf("Skipped rows from parallel parse not correct: %v != %v", parallel, sequential)
+	}
+}
+
+func benchmarkGeonamesParserParse(b *testing.B, data []byte, workers int, ordered bool) {
+	gp := NewGeonamesParser(getCountryMapping())
+	gp.SetParallelism(workers, ordered)
+
+	// Stand in for the indexer, which needs the cell of every record.
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		cr.S2Cell()
+		return nil
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := gp.Parse(bytes.NewReader(data), cb)
+		log.PanicIf(err)
+	}
+}
+
+func BenchmarkGeonamesParser_Parse_Sequential(b *testing.B) {
+	benchmarkGeonamesParserParse(b, getGeonamesShortData(), 1, true)
+}
+
+// benchmarkWorkers is the number of workers for the parallel benchmarks. It's
+// at least two, since a single worker falls back to the sequential parser.
+func benchmarkWorkers() int {
+	workers := runtime.NumCPU()
+	if workers < 2 {
+		workers = 2
+	}
+
+	return workers
+}
+
+func BenchmarkGeonamesParser_Parse_ParallelOrdered(b *testing.B) {
+	benchmarkGeonamesParserParse(b, getGeonamesShortData(), benchmarkWorkers(), true)
+}
+
+func BenchmarkGeonamesParser_Parse_ParallelUnordered(b *testing.B) {
+	benchmarkGeonamesParserParse(b, getGeonamesShortData(), benchmarkWorkers(), false)
+}
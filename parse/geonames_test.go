@@ -1,13 +1,20 @@
 package geoattractorparse
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"reflect"
 	"testing"
 
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+
 	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/synthetic"
 	"github.com/dsoprea/go-logging"
 )
 
@@ -128,3 +135,255 @@ func TestGeonamesParser_Parse(t *testing.T) {
 		t.Fatalf("Results not expected.")
 	}
 }
+
+func parseCitydata(rc io.ReadCloser) int {
+	defer rc.Close()
+
+	gp := NewGeonamesParser(getCountryMapping())
+
+	recordsCount, err := gp.Parse(rc, nil)
+	log.PanicIf(err)
+
+	return recordsCount
+}
+
+func writeTestZip(entries map[string][]byte, names ...string) []byte {
+	b := new(bytes.Buffer)
+	zw := zip.NewWriter(b)
+
+	for _, name := range names {
+		w, err := zw.Create(name)
+		log.PanicIf(err)
+
+		_, err = w.Write(entries[name])
+		log.PanicIf(err)
+	}
+
+	err := zw.Close()
+	log.PanicIf(err)
+
+	return b.Bytes()
+}
+
+func getSplitCitydata() map[string][]byte {
+	data, err := ioutil.ReadFile(path.Join(testAssetsPath, "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	// Split on a line boundary and drop the final newline from the first part
+	// to make sure the entries are kept apart.
+
+	i := bytes.IndexByte(data[len(data)/2:], '\n') + len(data)/2
+
+	return map[string][]byte{
+		"readme.txt": []byte("1\tnot\ta\trecord\n"),
+		"AD.txt":     data[:i],
+		"AE.txt":     data[i+1:],
+	}
+}
+
+func TestGeonamesParser_ParseWithFeatureCodes(t *testing.T) {
+	countries := getCountryMapping()
+
+	gp := NewGeonamesParser(countries)
+
+	filepath := path.Join(testAssetsPath, "allCountries.txt.short")
+
+	f, err := os.Open(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	featureCodes := make(map[string]string)
+	cb := func(cr geoattractor.CityRecord, featureCode string) (err error) {
+		featureCodes[cr.Id] = featureCode
+		return nil
+	}
+
+	recordsCount, err := gp.ParseWithFeatureCodes(f, cb)
+	log.PanicIf(err)
+
+	if recordsCount != 35 || len(featureCodes) != 35 {
+		t.Fatalf("Number of records read is not correct: (%d) (%d)", recordsCount, len(featureCodes))
+	}
+
+	if featureCodes["3041563"] != "PPLC" {
+		t.Fatalf("Feature code for Andorra la Vella not correct: [%s]", featureCodes["3041563"])
+	} else if featureCodes["3039163"] != "PPLA" {
+		t.Fatalf("Feature code for Sant Julià de Lòria not correct: [%s]", featureCodes["3039163"])
+	}
+}
+
+func TestGetCitydataReadCloser_Plain(t *testing.T) {
+	rc, err := GetCitydataReadCloser(path.Join(testAssetsPath, "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	recordsCount := parseCitydata(rc)
+	if recordsCount != 35 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+}
+
+func TestGetCitydataReadCloser_Gzip(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join(testAssetsPath, "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	f, err := ioutil.TempFile("", "allCountries*.txt.gz")
+	log.PanicIf(err)
+
+	defer os.Remove(f.Name())
+
+	gw := gzip.NewWriter(f)
+
+	_, err = gw.Write(data)
+	log.PanicIf(err)
+
+	err = gw.Close()
+	log.PanicIf(err)
+
+	err = f.Close()
+	log.PanicIf(err)
+
+	rc, err := GetCitydataReadCloser(f.Name())
+	log.PanicIf(err)
+
+	recordsCount := parseCitydata(rc)
+	if recordsCount != 35 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+}
+
+func TestGetCitydataReadCloser_Bzip2(t *testing.T) {
+	// The fixture is the first 300 lines of the short file.
+
+	data, err := ioutil.ReadFile(path.Join(testAssetsPath, "allCountries.txt.short"))
+	log.PanicIf(err)
+
+	expected := data
+	for i, count := 0, 0; i < len(data); i++ {
+		if data[i] == '\n' {
+			count++
+			if count == 300 {
+				expected = data[:i+1]
+				break
+			}
+		}
+	}
+
+	rc, err := GetCitydataReadCloser(path.Join(testAssetsPath, "allCountries.txt.short.head.bz2"))
+	log.PanicIf(err)
+
+	defer rc.Close()
+
+	actual, err := ioutil.ReadAll(rc)
+	log.PanicIf(err)
+
+	if bytes.Equal(actual, expected) == false {
+		t.Fatalf("Decompressed data not correct.")
+	}
+}
+
+func TestGetCitydataReadCloser_ZipPerCountry(t *testing.T) {
+	entries := getSplitCitydata()
+	zipData := writeTestZip(entries, "readme.txt", "AD.txt", "AE.txt")
+
+	f, err := ioutil.TempFile("", "per-country*.zip")
+	log.PanicIf(err)
+
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(zipData)
+	log.PanicIf(err)
+
+	err = f.Close()
+	log.PanicIf(err)
+
+	rc, err := GetCitydataReadCloser(f.Name())
+	log.PanicIf(err)
+
+	// The parser would quietly skip the readme's rows anyway so check the
+	// content directly.
+
+	actual, err := ioutil.ReadAll(rc)
+	log.PanicIf(err)
+
+	err = rc.Close()
+	log.PanicIf(err)
+
+	if bytes.Contains(actual, entries["readme.txt"]) == true {
+		t.Fatalf("The readme should have been skipped.")
+	}
+
+	recordsCount := parseCitydata(ioutil.NopCloser(bytes.NewReader(actual)))
+	if recordsCount != 35 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+}
+
+func TestNewCitydataReadCloser_ZipInMemory(t *testing.T) {
+	// This is how STDIN is handled.
+
+	entries := getSplitCitydata()
+	zipData := writeTestZip(entries, "AD.txt", "AE.txt")
+
+	rc, err := NewCitydataReadCloser(ioutil.NopCloser(bytes.NewReader(zipData)))
+	log.PanicIf(err)
+
+	recordsCount := parseCitydata(rc)
+	if recordsCount != 35 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+}
+
+func TestNewCitydataReadCloser_ZipWithoutData(t *testing.T) {
+	entries := getSplitCitydata()
+	zipData := writeTestZip(entries, "readme.txt")
+
+	_, err := NewCitydataReadCloser(ioutil.NopCloser(bytes.NewReader(zipData)))
+	if err == nil {
+		t.Fatalf("Expected error for archive without city data.")
+	}
+}
+
+func TestExpandCitydataFilepaths(t *testing.T) {
+	filepaths, err := ExpandCitydataFilepaths([]string{
+		path.Join(testAssetsPath, "allCountries.txt.*"),
+		"-",
+		path.Join(testAssetsPath, "allCountries.txt.short"),
+	})
+
+	log.PanicIf(err)
+
+	expected := []string{
+		path.Join(testAssetsPath, "allCountries.txt.short"),
+		path.Join(testAssetsPath, "allCountries.txt.short.head.bz2"),
+		"-",
+	}
+
+	if reflect.DeepEqual(filepaths, expected) == false {
+		t.Fatalf("File-paths not correct: %v", filepaths)
+	}
+}
+
+func TestExpandCitydataFilepaths_NoMatches(t *testing.T) {
+	_, err := ExpandCitydataFilepaths([]string{path.Join(testAssetsPath, "*.missing")})
+	if err == nil {
+		t.Fatalf("Expected error for glob without matches.")
+	}
+}
+
+// BenchmarkGeonamesParser_Parse_Synthetic measures how parsing scales beyond
+// the bundled sample.
+func BenchmarkGeonamesParser_Parse_Synthetic(b *testing.B) {
+	for _, count := range []int{1000, 10000, 100000} {
+		g := geoattractorsynthetic.NewGenerator(geoattractorsynthetic.GeneratorConfig{Count: count, Seed: 1})
+
+		buffer := new(bytes.Buffer)
+
+		err := g.WriteGeonames(buffer)
+		log.PanicIf(err)
+
+		b.Run(fmt.Sprintf("cities=%d", count), func(b *testing.B) {
+			benchmarkGeonamesParserParse(b, buffer.Bytes(), 1, true)
+		})
+	}
+}
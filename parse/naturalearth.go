@@ -0,0 +1,382 @@
+package geoattractorparse
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// DefaultNaturalEarthSourceName is the source-name used for Natural Earth
+	// data if one isn't given.
+	DefaultNaturalEarthSourceName = "NaturalEarth"
+
+	// NaturalEarthMetroPopulationField is the metropolitan population.
+	NaturalEarthMetroPopulationField = "POP_MAX"
+
+	// NaturalEarthCityPopulationField is the population of the city proper.
+	NaturalEarthCityPopulationField = "POP_MIN"
+)
+
+// NaturalEarthParserConfig describes how the populated-places attributes are
+// mapped.
+type NaturalEarthParserConfig struct {
+	// SourceName is returned by `Name()` and is what records will be indexed
+	// under. Defaults to `DefaultNaturalEarthSourceName`.
+	SourceName string
+
+	// PopulationField is the attribute that the population is read from.
+	// Defaults to `NaturalEarthMetroPopulationField`, which is what makes this
+	// dataset useful for attracting to metropolitan areas.
+	PopulationField string
+
+	// IdField is the attribute that the ID is read from. Defaults to "NE_ID".
+	// If the attribute is missing (older releases), the record number is used.
+	IdField string
+}
+
+// NaturalEarthParser reads the Natural Earth "ne_10m_populated_places"
+// dataset. `Parse()` is given the shapefile (".shp") and the attributes are
+// read in step from the accompanying dBASE (".dbf") file that is passed to the
+// constructor.
+type NaturalEarthParser struct {
+	config NaturalEarthParserConfig
+	dbf    io.ReadSeeker
+
+	// dbfFile is set if we opened the DBF ourselves and have to close it.
+	dbfFile *os.File
+}
+
+func NewNaturalEarthParser(dbf io.ReadSeeker, config NaturalEarthParserConfig) *NaturalEarthParser {
+	if config.SourceName == "" {
+		config.SourceName = DefaultNaturalEarthSourceName
+	}
+
+	if config.PopulationField == "" {
+		config.PopulationField = NaturalEarthMetroPopulationField
+	}
+
+	if config.IdField == "" {
+		config.IdField = "NE_ID"
+	}
+
+	return &NaturalEarthParser{
+		config: config,
+		dbf:    dbf,
+	}
+}
+
+func (nep *NaturalEarthParser) Parse(r io.Reader, cityRecordCb geoattractor.CityRecordCb) (recordsCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	// Allow the parser to be used more than once.
+	_, err = nep.dbf.Seek(0, io.SeekStart)
+	log.PanicIf(err)
+
+	dr := newDbfReader(nep.dbf)
+
+	for _, required := range []string{"NAME", "ADM0NAME", "ADM1NAME", nep.config.PopulationField} {
+		if dr.has(required) == false {
+			log.Panicf("attribute [%s] not found in DBF; is this the populated-places dataset?", required)
+		}
+	}
+
+	sr := newShpPointReader(r)
+
+	for i := 0; ; i++ {
+		latitude, longitude, hasPoint, done := sr.next()
+		attributes, isDeleted, attributesDone := dr.next()
+
+		if done == true && attributesDone == true {
+			break
+		} else if done != attributesDone {
+			log.Panicf("SHP and DBF have different numbers of records")
+		}
+
+		if isDeleted == true || hasPoint == false {
+			continue
+		}
+
+		id := attributes[strings.ToUpper(nep.config.IdField)]
+		if id == "" {
+			id = strconv.Itoa(i + 1)
+		} else if idFloat, err := strconv.ParseFloat(id, 64); err == nil {
+			// Numeric columns are stored with decimals (e.g. "1159151467.0").
+			id = strconv.FormatFloat(idFloat, 'f', -1, 64)
+		}
+
+		name := attributes["NAME"]
+		if name == "" {
+			log.Panicf("record (%d) has no name", i+1)
+		}
+
+		// Unknown populations are given as negative numbers.
+		var population uint64
+		if populationFloat, err := strconv.ParseFloat(attributes[strings.ToUpper(nep.config.PopulationField)], 64); err == nil && populationFloat > 0 {
+			population = uint64(populationFloat)
+		}
+
+		recordsCount++
+
+		if cityRecordCb != nil {
+			cr := geoattractor.CityRecord{
+				Id:            id,
+				Country:       attributes["ADM0NAME"],
+				ProvinceState: attributes["ADM1NAME"],
+				City:          name,
+				Population:    population,
+				Latitude:      latitude,
+				Longitude:     longitude,
+			}
+
+			err = cityRecordCb(cr)
+			log.PanicIf(err)
+		}
+	}
+
+	return recordsCount, nil
+}
+
+func (nep *NaturalEarthParser) Name() (name string) {
+	return nep.config.SourceName
+}
+
+// NewNaturalEarthParserWithFiles returns a parser that reads the attributes
+// from the DBF file alongside the given shapefile, so that it can be used
+// wherever the source is only given the shapefile (e.g.
+// `CityIndex.LoadFiles()`). `Close()` must be called when done.
+func NewNaturalEarthParserWithFiles(shpFilepath string, config NaturalEarthParserConfig) (nep *NaturalEarthParser, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	dbf, err := os.Open(naturalEarthDbfFilepath(shpFilepath))
+	log.PanicIf(err)
+
+	nep = NewNaturalEarthParser(dbf, config)
+	nep.dbfFile = dbf
+
+	return nep, nil
+}
+
+// Close closes the DBF file if it was opened by
+// `NewNaturalEarthParserWithFiles()`.
+func (nep *NaturalEarthParser) Close() (err error) {
+	if nep.dbfFile == nil {
+		return nil
+	}
+
+	err = nep.dbfFile.Close()
+	nep.dbfFile = nil
+
+	return err
+}
+
+// naturalEarthDbfFilepath returns the path of the DBF file that accompanies
+// the given shapefile.
+func naturalEarthDbfFilepath(shpFilepath string) string {
+	extension := path.Ext(shpFilepath)
+	return shpFilepath[:len(shpFilepath)-len(extension)] + ".dbf"
+}
+
+// GetNaturalEarthFiles opens the shapefile and the DBF file alongside it. The
+// caller must close both.
+func GetNaturalEarthFiles(shpFilepath string) (shp, dbf *os.File, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	shp, err = os.Open(shpFilepath)
+	log.PanicIf(err)
+
+	dbf, err = os.Open(naturalEarthDbfFilepath(shpFilepath))
+	if err != nil {
+		shp.Close()
+		log.Panic(err)
+	}
+
+	return shp, dbf, nil
+}
+
+// shpPointReader reads point geometries from an ESRI shapefile.
+type shpPointReader struct {
+	r io.Reader
+}
+
+func newShpPointReader(r io.Reader) *shpPointReader {
+	header := make([]byte, 100)
+
+	_, err := io.ReadFull(r, header)
+	log.PanicIf(err)
+
+	if fileCode := binary.BigEndian.Uint32(header[0:4]); fileCode != 9994 {
+		log.Panicf("not a shapefile: file-code (%d)", fileCode)
+	}
+
+	return &shpPointReader{
+		r: r,
+	}
+}
+
+// next returns the next point. `hasPoint` is false for null shapes. `done` is
+// true at the end of the file.
+func (spr *shpPointReader) next() (latitude, longitude float64, hasPoint, done bool) {
+	recordHeader := make([]byte, 8)
+
+	_, err := io.ReadFull(spr.r, recordHeader)
+	if err == io.EOF {
+		return 0, 0, false, true
+	}
+
+	log.PanicIf(err)
+
+	// The length is in 16-bit words.
+	contentLength := int(binary.BigEndian.Uint32(recordHeader[4:8])) * 2
+
+	content := make([]byte, contentLength)
+
+	_, err = io.ReadFull(spr.r, content)
+	log.PanicIf(err)
+
+	if len(content) < 4 {
+		log.Panicf("shape record too short")
+	}
+
+	shapeType := binary.LittleEndian.Uint32(content[0:4])
+	switch shapeType {
+	case 0:
+		// Null shape.
+		return 0, 0, false, false
+	case 1, 11, 21:
+		// Point, PointZ, and PointM all start with X and Y.
+		if len(content) < 20 {
+			log.Panicf("point record too short")
+		}
+
+		x := math.Float64frombits(binary.LittleEndian.Uint64(content[4:12]))
+		y := math.Float64frombits(binary.LittleEndian.Uint64(content[12:20]))
+
+		return y, x, true, false
+	default:
+		log.Panicf("shape-type (%d) is not a point", shapeType)
+	}
+
+	return 0, 0, false, false
+}
+
+type dbfField struct {
+	name   string
+	length int
+}
+
+// dbfReader reads records from a dBASE III table. All values are returned as
+// trimmed strings.
+type dbfReader struct {
+	r            io.Reader
+	fields       []dbfField
+	recordLength int
+	recordsCount int
+	current      int
+}
+
+func newDbfReader(r io.Reader) *dbfReader {
+	header := make([]byte, 32)
+
+	_, err := io.ReadFull(r, header)
+	log.PanicIf(err)
+
+	recordsCount := int(binary.LittleEndian.Uint32(header[4:8]))
+	headerLength := int(binary.LittleEndian.Uint16(header[8:10]))
+	recordLength := int(binary.LittleEndian.Uint16(header[10:12]))
+
+	if headerLength < 33 {
+		log.Panicf("DBF header too short: (%d)", headerLength)
+	}
+
+	descriptors := make([]byte, headerLength-32)
+
+	_, err = io.ReadFull(r, descriptors)
+	log.PanicIf(err)
+
+	fields := make([]dbfField, 0)
+	for i := 0; i+32 <= len(descriptors) && descriptors[i] != 0x0d; i += 32 {
+		descriptor := descriptors[i : i+32]
+
+		name := string(bytes.TrimRight(descriptor[0:11], "\x00"))
+
+		field := dbfField{
+			name:   strings.ToUpper(name),
+			length: int(descriptor[16]),
+		}
+
+		fields = append(fields, field)
+	}
+
+	return &dbfReader{
+		r:            r,
+		fields:       fields,
+		recordLength: recordLength,
+		recordsCount: recordsCount,
+	}
+}
+
+func (dr *dbfReader) has(name string) bool {
+	name = strings.ToUpper(name)
+
+	for _, field := range dr.fields {
+		if field.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// next returns the next record keyed by (uppercase) field-name.
+func (dr *dbfReader) next() (attributes map[string]string, isDeleted, done bool) {
+	if dr.current >= dr.recordsCount {
+		return nil, false, true
+	}
+
+	dr.current++
+
+	record := make([]byte, dr.recordLength)
+
+	_, err := io.ReadFull(dr.r, record)
+	log.PanicIf(err)
+
+	isDeleted = record[0] == '*'
+
+	attributes = make(map[string]string)
+
+	offset := 1
+	for _, field := range dr.fields {
+		if offset+field.length > len(record) {
+			log.Panicf("DBF field [%s] overruns record", field.name)
+		}
+
+		value := record[offset : offset+field.length]
+		attributes[field.name] = strings.TrimSpace(string(bytes.TrimRight(value, "\x00")))
+
+		offset += field.length
+	}
+
+	return attributes, isDeleted, false
+}
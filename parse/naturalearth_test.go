@@ -0,0 +1,131 @@
+package geoattractorparse
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+// The sample has three records, the second of which is marked as deleted in
+// the DBF.
+
+func TestNaturalEarthParser_Parse(t *testing.T) {
+	shp, dbf, err := GetNaturalEarthFiles(path.Join(testAssetsPath, "ne_populated_places_sample.shp"))
+	log.PanicIf(err)
+
+	defer shp.Close()
+	defer dbf.Close()
+
+	nep := NewNaturalEarthParser(dbf, NaturalEarthParserConfig{})
+
+	if nep.Name() != DefaultNaturalEarthSourceName {
+		t.Fatalf("Source-name not correct: [%s]", nep.Name())
+	}
+
+	actual := make([]string, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		actual = append(actual, cr.String())
+		return nil
+	}
+
+	recordsCount, err := nep.Parse(shp, cb)
+	log.PanicIf(err)
+
+	if recordsCount != 2 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+
+	expected := []string{
+		"CityRecord<ID=[1159151467] COUNTRY=[United States of America] PROVINCE-OR-STATE=[Michigan] CITY=[Detroit] POP=(4101000) LAT=(42.3314270000) LON=(-83.0457538000) S2=[883b2d2feb90494f]>",
+		"CityRecord<ID=[1159148935] COUNTRY=[United Arab Emirates] PROVINCE-OR-STATE=[Abu Dhabi] CITY=[Abu Dhabi] POP=(603492) LAT=(24.4666670000) LON=(54.3666690000) S2=[3e5e661847865f19]>",
+	}
+
+	if reflect.DeepEqual(actual, expected) == false {
+		for _, s := range actual {
+			fmt.Printf("%s\n", s)
+		}
+
+		t.Fatalf("Results not expected.")
+	}
+}
+
+func TestNaturalEarthParser_Parse_CityPopulation(t *testing.T) {
+	shp, dbf, err := GetNaturalEarthFiles(path.Join(testAssetsPath, "ne_populated_places_sample.shp"))
+	log.PanicIf(err)
+
+	defer shp.Close()
+	defer dbf.Close()
+
+	nep := NewNaturalEarthParser(dbf, NaturalEarthParserConfig{
+		PopulationField: NaturalEarthCityPopulationField,
+	})
+
+	records := make([]geoattractor.CityRecord, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		records = append(records, cr)
+		return nil
+	}
+
+	_, err = nep.Parse(shp, cb)
+	log.PanicIf(err)
+
+	// The second population is unknown (-99).
+	if records[0].Population != 951270 {
+		t.Fatalf("First population not correct: (%d)", records[0].Population)
+	} else if records[1].Population != 0 {
+		t.Fatalf("Second population not correct: (%d)", records[1].Population)
+	}
+}
+
+func TestNaturalEarthParser_Parse_MissingAttribute(t *testing.T) {
+	shp, dbf, err := GetNaturalEarthFiles(path.Join(testAssetsPath, "ne_populated_places_sample.shp"))
+	log.PanicIf(err)
+
+	defer shp.Close()
+	defer dbf.Close()
+
+	nep := NewNaturalEarthParser(dbf, NaturalEarthParserConfig{
+		PopulationField: "POP2050",
+	})
+
+	_, err = nep.Parse(shp, nil)
+	if err == nil {
+		t.Fatalf("Expected error for missing attribute.")
+	}
+}
+
+func TestNewNaturalEarthParserWithFiles(t *testing.T) {
+	shpFilepath := path.Join(testAssetsPath, "ne_populated_places_sample.shp")
+
+	nep, err := NewNaturalEarthParserWithFiles(shpFilepath, NaturalEarthParserConfig{})
+	log.PanicIf(err)
+
+	defer nep.Close()
+
+	shp, err := os.Open(shpFilepath)
+	log.PanicIf(err)
+
+	defer shp.Close()
+
+	recordsCount, err := nep.Parse(shp, nil)
+	log.PanicIf(err)
+
+	if recordsCount != 2 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+
+	err = nep.Close()
+	log.PanicIf(err)
+}
+
+func TestNewNaturalEarthParserWithFiles_MissingDbf(t *testing.T) {
+	_, err := NewNaturalEarthParserWithFiles(path.Join(testAssetsPath, "does_not_exist.shp"), NaturalEarthParserConfig{})
+	if err == nil {
+		t.Fatalf("Expected error for missing DBF.")
+	}
+}
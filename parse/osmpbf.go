@@ -0,0 +1,497 @@
+package geoattractorparse
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// DefaultOsmPbfSourceName is the source-name used for OSM data if one
+	// isn't given.
+	DefaultOsmPbfSourceName = "OpenStreetMap"
+
+	// osmPbfMaxBlobHeaderSize and osmPbfMaxBlobSize are the limits imposed
+	// by the file-format specification.
+	osmPbfMaxBlobHeaderSize = 64 * 1024
+	osmPbfMaxBlobSize       = 32 * 1024 * 1024
+)
+
+var (
+	// DefaultOsmPlaceTypes are the values of the "place" tag that we treat as
+	// cities.
+	DefaultOsmPlaceTypes = []string{"city", "town", "village"}
+)
+
+// OsmPbfParserConfig describes which nodes are read from the extract.
+type OsmPbfParserConfig struct {
+	// SourceName is returned by `Name()` and is what records will be indexed
+	// under. Defaults to `DefaultOsmPbfSourceName`.
+	SourceName string
+
+	// PlaceTypes are the "place" tag values that are accepted. Defaults to
+	// `DefaultOsmPlaceTypes`.
+	PlaceTypes []string
+
+	// SkipWithoutPopulation excludes places that have no usable "population"
+	// tag.
+	SkipWithoutPopulation bool
+
+	// Countries, if provided, is used to translate country codes (e.g. from
+	// "addr:country") to names. Values not found in the mapping are used
+	// as-is.
+	Countries map[string]string
+}
+
+// OsmPbfParser reads place nodes from an OpenStreetMap ".osm.pbf" extract.
+// Only uncompressed and zlib-compressed blobs are supported, which covers the
+// extracts published by the usual providers. Ways and relations are ignored.
+type OsmPbfParser struct {
+	config     OsmPbfParserConfig
+	placeTypes map[string]struct{}
+}
+
+func NewOsmPbfParser(config OsmPbfParserConfig) *OsmPbfParser {
+	if config.SourceName == "" {
+		config.SourceName = DefaultOsmPbfSourceName
+	}
+
+	if config.PlaceTypes == nil {
+		config.PlaceTypes = DefaultOsmPlaceTypes
+	}
+
+	placeTypes := make(map[string]struct{})
+	for _, placeType := range config.PlaceTypes {
+		placeTypes[placeType] = struct{}{}
+	}
+
+	return &OsmPbfParser{
+		config:     config,
+		placeTypes: placeTypes,
+	}
+}
+
+func (opp *OsmPbfParser) Parse(r io.Reader, cityRecordCb geoattractor.CityRecordCb) (recordsCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	nodeCb := func(id int64, latitude, longitude float64, tags map[string]string) {
+		cr, ok := opp.cityRecordFromNode(id, latitude, longitude, tags)
+		if ok == false {
+			return
+		}
+
+		recordsCount++
+
+		if cityRecordCb != nil {
+			err := cityRecordCb(cr)
+			log.PanicIf(err)
+		}
+	}
+
+	// The file is a sequence of blobs, each preceded by its header and the
+	// header's length.
+
+	for {
+		var headerSize uint32
+		err := binary.Read(r, binary.BigEndian, &headerSize)
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		if headerSize > osmPbfMaxBlobHeaderSize {
+			log.Panicf("blob-header too large; is this a PBF file? (%d)", headerSize)
+		}
+
+		headerData := make([]byte, headerSize)
+
+		_, err = io.ReadFull(r, headerData)
+		log.PanicIf(err)
+
+		blobType, blobSize := parseOsmBlobHeader(headerData)
+		if blobSize > osmPbfMaxBlobSize {
+			log.Panicf("blob too large: (%d)", blobSize)
+		}
+
+		blobData := make([]byte, blobSize)
+
+		_, err = io.ReadFull(r, blobData)
+		log.PanicIf(err)
+
+		if blobType != "OSMData" {
+			// "OSMHeader" carries nothing we need.
+			continue
+		}
+
+		blockData := decodeOsmBlob(blobData)
+		parseOsmPrimitiveBlock(blockData, nodeCb)
+	}
+
+	return recordsCount, nil
+}
+
+// cityRecordFromNode converts the node. Returns false if the node isn't a
+// place that we're interested in.
+func (opp *OsmPbfParser) cityRecordFromNode(id int64, latitude, longitude float64, tags map[string]string) (cr geoattractor.CityRecord, ok bool) {
+	if _, found := opp.placeTypes[tags["place"]]; found == false {
+		return cr, false
+	}
+
+	name := tags["name"]
+	if name == "" {
+		return cr, false
+	}
+
+	population := parseOsmPopulation(tags["population"])
+	if population == 0 && opp.config.SkipWithoutPopulation == true {
+		return cr, false
+	}
+
+	country := tags["is_in:country"]
+	if country == "" {
+		country = tags["addr:country"]
+	}
+
+	if countryName, found := opp.config.Countries[country]; found == true {
+		country = countryName
+	}
+
+	provinceState := tags["is_in:state"]
+	if provinceState == "" {
+		provinceState = tags["addr:state"]
+	}
+
+	cr = geoattractor.CityRecord{
+		Id:            strconv.FormatInt(id, 10),
+		Country:       country,
+		ProvinceState: provinceState,
+		City:          name,
+		Population:    population,
+		Latitude:      latitude,
+		Longitude:     longitude,
+	}
+
+	return cr, true
+}
+
+func (opp *OsmPbfParser) Name() (name string) {
+	return opp.config.SourceName
+}
+
+// parseOsmPopulation is lenient since the tag is free-form. Thousands
+// separators are dropped and anything else unparseable is treated as unknown.
+func parseOsmPopulation(raw string) uint64 {
+	raw = strings.Map(func(r rune) rune {
+		if r == ',' || r == ' ' || r == '_' {
+			return -1
+		}
+
+		return r
+	}, raw)
+
+	population, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return population
+}
+
+func parseOsmBlobHeader(data []byte) (blobType string, blobSize int) {
+	pr := newProtobufReader(data)
+	for pr.more() == true {
+		field, wireType := pr.key()
+
+		switch field {
+		case 1:
+			blobType = string(pr.bytes())
+		case 3:
+			blobSize = int(pr.varint())
+		default:
+			pr.skip(wireType)
+		}
+	}
+
+	return blobType, blobSize
+}
+
+func decodeOsmBlob(data []byte) []byte {
+	pr := newProtobufReader(data)
+	for pr.more() == true {
+		field, wireType := pr.key()
+
+		switch field {
+		case 1:
+			// Raw.
+			return pr.bytes()
+		case 3:
+			// Zlib.
+			zr, err := zlib.NewReader(bytes.NewReader(pr.bytes()))
+			log.PanicIf(err)
+
+			decompressed, err := ioutil.ReadAll(zr)
+			log.PanicIf(err)
+
+			return decompressed
+		case 4, 5, 6, 7:
+			log.Panicf("blob compression not supported (field %d)", field)
+		default:
+			pr.skip(wireType)
+		}
+	}
+
+	log.Panicf("blob has no data")
+	return nil
+}
+
+type osmNodeCb func(id int64, latitude, longitude float64, tags map[string]string)
+
+func parseOsmPrimitiveBlock(data []byte, nodeCb osmNodeCb) {
+	// The string-table and coordinate parameters can appear after the groups
+	// so collect the groups first.
+
+	stringTable := make([]string, 0)
+	groups := make([][]byte, 0)
+
+	granularity := int64(100)
+	latOffset := int64(0)
+	lonOffset := int64(0)
+
+	pr := newProtobufReader(data)
+	for pr.more() == true {
+		field, wireType := pr.key()
+
+		switch field {
+		case 1:
+			stPr := newProtobufReader(pr.bytes())
+			for stPr.more() == true {
+				stField, stWireType := stPr.key()
+				if stField == 1 {
+					stringTable = append(stringTable, string(stPr.bytes()))
+				} else {
+					stPr.skip(stWireType)
+				}
+			}
+		case 2:
+			groups = append(groups, pr.bytes())
+		case 17:
+			granularity = int64(pr.varint())
+		case 19:
+			latOffset = int64(pr.varint())
+		case 20:
+			lonOffset = int64(pr.varint())
+		default:
+			pr.skip(wireType)
+		}
+	}
+
+	toDegrees := func(offset, value int64) float64 {
+		return 1e-9 * float64(offset+granularity*value)
+	}
+
+	for _, group := range groups {
+		groupPr := newProtobufReader(group)
+		for groupPr.more() == true {
+			field, wireType := groupPr.key()
+
+			switch field {
+			case 1:
+				id, lat, lon, tags := parseOsmNode(groupPr.bytes(), stringTable)
+				nodeCb(id, toDegrees(latOffset, lat), toDegrees(lonOffset, lon), tags)
+			case 2:
+				parseOsmDenseNodes(groupPr.bytes(), stringTable, func(id, lat, lon int64, tags map[string]string) {
+					nodeCb(id, toDegrees(latOffset, lat), toDegrees(lonOffset, lon), tags)
+				})
+			default:
+				// Ways, relations, and changesets.
+				groupPr.skip(wireType)
+			}
+		}
+	}
+}
+
+func parseOsmNode(data []byte, stringTable []string) (id, lat, lon int64, tags map[string]string) {
+	var keys, values []uint64
+
+	pr := newProtobufReader(data)
+	for pr.more() == true {
+		field, wireType := pr.key()
+
+		switch field {
+		case 1:
+			id = pr.svarint()
+		case 2:
+			keys = pr.packedVarints()
+		case 3:
+			values = pr.packedVarints()
+		case 8:
+			lat = pr.svarint()
+		case 9:
+			lon = pr.svarint()
+		default:
+			pr.skip(wireType)
+		}
+	}
+
+	if len(keys) != len(values) {
+		log.Panicf("node (%d) has (%d) keys but (%d) values", id, len(keys), len(values))
+	}
+
+	tags = make(map[string]string)
+	for i, k := range keys {
+		tags[stringTable[k]] = stringTable[values[i]]
+	}
+
+	return id, lat, lon, tags
+}
+
+func parseOsmDenseNodes(data []byte, stringTable []string, cb func(id, lat, lon int64, tags map[string]string)) {
+	var ids, lats, lons, keysVals []uint64
+
+	pr := newProtobufReader(data)
+	for pr.more() == true {
+		field, wireType := pr.key()
+
+		switch field {
+		case 1:
+			ids = pr.packedVarints()
+		case 8:
+			lats = pr.packedVarints()
+		case 9:
+			lons = pr.packedVarints()
+		case 10:
+			keysVals = pr.packedVarints()
+		default:
+			pr.skip(wireType)
+		}
+	}
+
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		log.Panicf("dense-nodes are inconsistent: IDS=(%d) LATS=(%d) LONS=(%d)", len(ids), len(lats), len(lons))
+	}
+
+	// IDs and coordinates are delta-coded. Tags are a flat list of key/value
+	// string-table indices with each node's list terminated by a zero.
+
+	var id, lat, lon int64
+	j := 0
+	for i := range ids {
+		id += zigzag(ids[i])
+		lat += zigzag(lats[i])
+		lon += zigzag(lons[i])
+
+		tags := make(map[string]string)
+		for j < len(keysVals) {
+			k := keysVals[j]
+			j++
+
+			if k == 0 {
+				break
+			} else if j >= len(keysVals) {
+				log.Panicf("dense-node (%d) has a key without a value", id)
+			}
+
+			v := keysVals[j]
+			j++
+
+			tags[stringTable[k]] = stringTable[v]
+		}
+
+		cb(id, lat, lon, tags)
+	}
+}
+
+// protobufReader is a minimal decoder for the protobuf wire-format, which is
+// all that the PBF format needs.
+type protobufReader struct {
+	data []byte
+	i    int
+}
+
+func newProtobufReader(data []byte) *protobufReader {
+	return &protobufReader{
+		data: data,
+	}
+}
+
+func (pr *protobufReader) more() bool {
+	return pr.i < len(pr.data)
+}
+
+func (pr *protobufReader) key() (field int, wireType int) {
+	k := pr.varint()
+	return int(k >> 3), int(k & 7)
+}
+
+func (pr *protobufReader) varint() uint64 {
+	value, n := binary.Uvarint(pr.data[pr.i:])
+	if n <= 0 {
+		log.Panicf("invalid varint at offset (%d)", pr.i)
+	}
+
+	pr.i += n
+	return value
+}
+
+func (pr *protobufReader) svarint() int64 {
+	return zigzag(pr.varint())
+}
+
+func (pr *protobufReader) bytes() []byte {
+	length := int(pr.varint())
+	if length < 0 || pr.i+length > len(pr.data) {
+		log.Panicf("length-delimited field overruns message at offset (%d)", pr.i)
+	}
+
+	value := pr.data[pr.i : pr.i+length]
+	pr.i += length
+
+	return value
+}
+
+func (pr *protobufReader) packedVarints() []uint64 {
+	packedPr := newProtobufReader(pr.bytes())
+
+	values := make([]uint64, 0)
+	for packedPr.more() == true {
+		values = append(values, packedPr.varint())
+	}
+
+	return values
+}
+
+func (pr *protobufReader) skip(wireType int) {
+	switch wireType {
+	case 0:
+		pr.varint()
+	case 1:
+		pr.i += 8
+	case 2:
+		pr.bytes()
+	case 5:
+		pr.i += 4
+	default:
+		log.Panicf("unsupported wire-type (%d) at offset (%d)", wireType, pr.i)
+	}
+
+	if pr.i > len(pr.data) {
+		log.Panicf("field overruns message")
+	}
+}
+
+func zigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
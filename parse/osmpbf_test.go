@@ -0,0 +1,125 @@
+package geoattractorparse
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-logging"
+)
+
+// The fixture has one raw header blob and one zlib-compressed data blob. The
+// data has a plain node (Detroit), dense nodes (Troy, an untagged node, a
+// hamlet, and an unnamed village), and a way.
+
+func TestOsmPbfParser_Parse(t *testing.T) {
+	opp := NewOsmPbfParser(OsmPbfParserConfig{
+		Countries: map[string]string{
+			"US": "United States",
+		},
+	})
+
+	filepath := path.Join(testAssetsPath, "places.osm.pbf")
+
+	f, err := os.Open(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	actual := make([]string, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		actual = append(actual, cr.String())
+		return nil
+	}
+
+	recordsCount, err := opp.Parse(f, cb)
+	log.PanicIf(err)
+
+	if recordsCount != 2 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+
+	expected := []string{
+		"CityRecord<ID=[237385] COUNTRY=[United States] PROVINCE-OR-STATE=[MI] CITY=[Detroit] POP=(639111) LAT=(42.3314270000) LON=(-83.0457538000) S2=[883b2d2feb90494f]>",
+		"CityRecord<ID=[1001] COUNTRY=[United States] PROVINCE-OR-STATE=[MI] CITY=[Troy] POP=(83280) LAT=(42.6055900000) LON=(-83.1499300000) S2=[8824c3c40a768751]>",
+	}
+
+	if reflect.DeepEqual(actual, expected) == false {
+		for _, s := range actual {
+			fmt.Printf("%s\n", s)
+		}
+
+		t.Fatalf("Results not expected.")
+	}
+}
+
+func TestOsmPbfParser_Parse_PlaceTypes(t *testing.T) {
+	opp := NewOsmPbfParser(OsmPbfParserConfig{
+		SourceName: "OSM",
+		PlaceTypes: []string{"hamlet", "village"},
+	})
+
+	if opp.Name() != "OSM" {
+		t.Fatalf("Source-name not correct: [%s]", opp.Name())
+	}
+
+	filepath := path.Join(testAssetsPath, "places.osm.pbf")
+
+	f, err := os.Open(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	records := make([]geoattractor.CityRecord, 0)
+	cb := func(cr geoattractor.CityRecord) (err error) {
+		records = append(records, cr)
+		return nil
+	}
+
+	// The village has no name so only the hamlet should come back.
+
+	recordsCount, err := opp.Parse(f, cb)
+	log.PanicIf(err)
+
+	if recordsCount != 1 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	} else if records[0].Id != "1010" || records[0].City != "Tiny" || records[0].Population != 0 {
+		t.Fatalf("Record not correct: %s", records[0])
+	}
+}
+
+func TestOsmPbfParser_Parse_SkipWithoutPopulation(t *testing.T) {
+	opp := NewOsmPbfParser(OsmPbfParserConfig{
+		PlaceTypes:            []string{"city", "hamlet"},
+		SkipWithoutPopulation: true,
+	})
+
+	filepath := path.Join(testAssetsPath, "places.osm.pbf")
+
+	f, err := os.Open(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	recordsCount, err := opp.Parse(f, nil)
+	log.PanicIf(err)
+
+	if recordsCount != 1 {
+		t.Fatalf("Number of records read is not correct: (%d)", recordsCount)
+	}
+}
+
+func TestParseOsmPopulation(t *testing.T) {
+	if parseOsmPopulation("12 345") != 12345 {
+		t.Fatalf("Spaces not handled.")
+	} else if parseOsmPopulation("1,234,567") != 1234567 {
+		t.Fatalf("Commas not handled.")
+	} else if parseOsmPopulation("about 500") != 0 {
+		t.Fatalf("Free-form text not handled.")
+	} else if parseOsmPopulation("") != 0 {
+		t.Fatalf("Empty value not handled.")
+	}
+}
@@ -0,0 +1,198 @@
+package geoattractorclient
+
+import (
+	"context"
+
+	"github.com/dsoprea/go-logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/index"
+	"github.com/dsoprea/go-geographic-attractor/rpc"
+)
+
+// Query is one nearest-city query.
+type Query struct {
+	// RequestId is returned with the result. Optional.
+	RequestId string
+
+	Latitude  float64
+	Longitude float64
+
+	// ReturnVisits asks for every city seen along the way.
+	ReturnVisits bool
+}
+
+func (q Query) request() *geoattractorrpc.NearestRequest {
+	return &geoattractorrpc.NearestRequest{
+		RequestId:    q.RequestId,
+		Latitude:     q.Latitude,
+		Longitude:    q.Longitude,
+		ReturnVisits: q.ReturnVisits,
+	}
+}
+
+// Result is the answer to one query.
+type Result struct {
+	RequestId string
+
+	// Found is false if nothing is indexed near the point.
+	Found bool
+
+	SourceName string
+	City       geoattractor.CityRecord
+	Visits     []geoattractorindex.VisitHistoryItem
+}
+
+func newResult(response *geoattractorrpc.NearestResponse) Result {
+	result := Result{
+		RequestId:  response.GetRequestId(),
+		Found:      response.GetFound(),
+		SourceName: response.GetSourceName(),
+	}
+
+	if result.Found == true {
+		result.City = response.GetCity().ToCityRecord()
+	}
+
+	if visits := response.GetVisits(); len(visits) > 0 {
+		result.Visits = make([]geoattractorindex.VisitHistoryItem, len(visits))
+		for i, visit := range visits {
+			result.Visits[i] = visit.ToVisitHistoryItem()
+		}
+	}
+
+	return result
+}
+
+// Client wraps the calls of the `CityIndex` service.
+type Client struct {
+	cc     *grpc.ClientConn
+	client geoattractorrpc.CityIndexClient
+}
+
+// NewClient returns a client that uses the given connection. The caller owns
+// the connection.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{
+		client: geoattractorrpc.NewCityIndexClient(cc),
+	}
+}
+
+// Dial connects to the server at the given target. `Close()` closes the
+// connection.
+func Dial(target string, opts ...grpc.DialOption) (c *Client, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cc, err := grpc.NewClient(target, opts...)
+	log.PanicIf(err)
+
+	c = NewClient(cc)
+	c.cc = cc
+
+	return c, nil
+}
+
+// Close closes the connection if it was opened by `Dial()`.
+func (c *Client) Close() (err error) {
+	if c.cc == nil {
+		return nil
+	}
+
+	return c.cc.Close()
+}
+
+// Nearest has the same semantics as `CityIndex.Nearest()`, including
+// returning `geoattractorindex.ErrNoNearestCity` if there's nothing near the
+// point.
+func (c *Client) Nearest(ctx context.Context, latitude, longitude float64, returnAllVisits bool) (sourceName string, visits []geoattractorindex.VisitHistoryItem, cr geoattractor.CityRecord, err error) {
+	q := Query{
+		Latitude:     latitude,
+		Longitude:    longitude,
+		ReturnVisits: returnAllVisits,
+	}
+
+	response, err := c.client.Nearest(ctx, q.request())
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return "", nil, cr, geoattractorindex.ErrNoNearestCity
+		}
+
+		return "", nil, cr, err
+	}
+
+	result := newResult(response)
+
+	return result.SourceName, result.Visits, result.City, nil
+}
+
+// BatchNearest answers all of the queries in one call. The results are in the
+// same order as the queries.
+func (c *Client) BatchNearest(ctx context.Context, queries []Query) (results []Result, err error) {
+	request := &geoattractorrpc.BatchNearestRequest{
+		Requests: make([]*geoattractorrpc.NearestRequest, len(queries)),
+	}
+
+	for i, q := range queries {
+		request.Requests[i] = q.request()
+	}
+
+	response, err := c.client.BatchNearest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	results = make([]Result, len(response.GetResponses()))
+	for i, nr := range response.GetResponses() {
+		results[i] = newResult(nr)
+	}
+
+	return results, nil
+}
+
+// NearestStream sends queries and receives their results over one stream.
+// The results arrive in the order that the queries were sent.
+type NearestStream struct {
+	stream geoattractorrpc.CityIndex_StreamNearestClient
+}
+
+// StreamNearest opens a stream. Cancel the context to abandon it.
+func (c *Client) StreamNearest(ctx context.Context) (ns *NearestStream, err error) {
+	stream, err := c.client.StreamNearest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ns = &NearestStream{
+		stream: stream,
+	}
+
+	return ns, nil
+}
+
+// Send sends a query.
+func (ns *NearestStream) Send(q Query) (err error) {
+	return ns.stream.Send(q.request())
+}
+
+// CloseSend tells the server that there are no more queries.
+func (ns *NearestStream) CloseSend() (err error) {
+	return ns.stream.CloseSend()
+}
+
+// Recv returns the next result. Returns `io.EOF` after the last one once
+// `CloseSend()` has been called.
+func (ns *NearestStream) Recv() (result Result, err error) {
+	response, err := ns.stream.Recv()
+	if err != nil {
+		return result, err
+	}
+
+	return newResult(response), nil
+}
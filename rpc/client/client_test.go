@@ -0,0 +1,193 @@
+package geoattractorclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+	"github.com/dsoprea/go-geographic-attractor/rpc"
+)
+
+// getTestClient serves an index of the sample data over an in-memory
+// listener. The returned function tears everything down.
+func getTestClient() (c *Client, ci *geoattractorindex.CityIndex, cleanup func()) {
+	ci, kvFilepath, _ := geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	config := geoattractorrpc.ServerConfig{
+		Index:        ci,
+		MaxBatchSize: 3,
+	}
+
+	gs := grpc.NewServer()
+	geoattractorrpc.RegisterCityIndexServer(gs, geoattractorrpc.NewServer(config))
+
+	listener := bufconn.Listen(1024 * 1024)
+
+	go gs.Serve(listener)
+
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}
+
+	c, err := Dial("passthrough:///bufnet", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	log.PanicIf(err)
+
+	cleanup = func() {
+		c.Close()
+		gs.Stop()
+		ci.Close()
+		os.Remove(kvFilepath)
+	}
+
+	return c, ci, cleanup
+}
+
+func TestClient_Nearest(t *testing.T) {
+	c, ci, cleanup := getTestClient()
+	defer cleanup()
+
+	sourceName, visits, cr, err := c.Nearest(context.Background(), 25.2048, 55.2708, true)
+	log.PanicIf(err)
+
+	expectedSourceName, expectedVisits, expectedCr, err := ci.Nearest(25.2048, 55.2708, true)
+	log.PanicIf(err)
+
+	if sourceName != expectedSourceName {
+		t.Fatalf("Source not correct: [%s]", sourceName)
+	} else if cr.Id != "292223" || cr.City != expectedCr.City || cr.Population != expectedCr.Population || cr.ProvinceState != expectedCr.ProvinceState {
+		t.Fatalf("City not correct: %s", cr)
+	} else if cr.S2Cell() != expectedCr.S2Cell() {
+		t.Fatalf("Cell not correct.")
+	} else if len(visits) == 0 || len(visits) != len(expectedVisits) {
+		t.Fatalf("Visits not correct: (%d) != (%d)", len(visits), len(expectedVisits))
+	}
+
+	for i, vhi := range visits {
+		expected := expectedVisits[i]
+		if vhi.Token != expected.Token || vhi.SourceName != expected.SourceName || vhi.City.Id != expected.City.Id {
+			t.Fatalf("Visit (%d) not correct: %v != %v", i, vhi, expected)
+		}
+	}
+
+	// Without visits.
+
+	_, visits, _, err = c.Nearest(context.Background(), 25.2048, 55.2708, false)
+	log.PanicIf(err)
+
+	if len(visits) != 0 {
+		t.Fatalf("Expected no visits: (%d)", len(visits))
+	}
+}
+
+func TestClient_Nearest_Errors(t *testing.T) {
+	c, _, cleanup := getTestClient()
+	defer cleanup()
+
+	_, _, _, err := c.Nearest(context.Background(), -45.0, -120.0, false)
+	if err != geoattractorindex.ErrNoNearestCity {
+		t.Fatalf("Expected no-nearest-city: %v", err)
+	}
+
+	_, _, _, err = c.Nearest(context.Background(), 95.0, 55.2708, false)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected invalid-argument: %v", err)
+	}
+}
+
+func TestClient_BatchNearest(t *testing.T) {
+	c, _, cleanup := getTestClient()
+	defer cleanup()
+
+	queries := []Query{
+		{RequestId: "dubai", Latitude: 25.2048, Longitude: 55.2708},
+		{RequestId: "nowhere", Latitude: -45.0, Longitude: -120.0},
+		{RequestId: "andorra", Latitude: 42.50779, Longitude: 1.52109},
+	}
+
+	results, err := c.BatchNearest(context.Background(), queries)
+	log.PanicIf(err)
+
+	if len(results) != 3 {
+		t.Fatalf("Expected three results: (%d)", len(results))
+	} else if results[0].RequestId != "dubai" || results[0].Found != true || results[0].City.Id != "292223" {
+		t.Fatalf("First result not correct: %v", results[0])
+	} else if results[1].RequestId != "nowhere" || results[1].Found != false {
+		t.Fatalf("Second result not correct: %v", results[1])
+	} else if results[2].RequestId != "andorra" || results[2].City.Country != "Andorra" {
+		t.Fatalf("Third result not correct: %v", results[2])
+	}
+
+	// Too many.
+
+	_, err = c.BatchNearest(context.Background(), append(queries, queries[0]))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected invalid-argument for large batch: %v", err)
+	}
+}
+
+func TestClient_StreamNearest(t *testing.T) {
+	c, _, cleanup := getTestClient()
+	defer cleanup()
+
+	ns, err := c.StreamNearest(context.Background())
+	log.PanicIf(err)
+
+	coordinates := [][2]float64{
+		{25.2048, 55.2708},
+		{-45.0, -120.0},
+		{42.50779, 1.52109},
+		{24.46667, 54.36667},
+	}
+
+	go func() {
+		for i, coordinate := range coordinates {
+			q := Query{
+				RequestId: fmt.Sprintf("%d", i),
+				Latitude:  coordinate[0],
+				Longitude: coordinate[1],
+			}
+
+			err := ns.Send(q)
+			log.PanicIf(err)
+		}
+
+		err := ns.CloseSend()
+		log.PanicIf(err)
+	}()
+
+	results := make([]Result, 0)
+	for {
+		result, err := ns.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		results = append(results, result)
+	}
+
+	if len(results) != len(coordinates) {
+		t.Fatalf("Expected a result for every query: (%d)", len(results))
+	}
+
+	expectedIds := []string{"292223", "", "3041563", "292968"}
+	for i, result := range results {
+		if result.RequestId != fmt.Sprintf("%d", i) {
+			t.Fatalf("Result (%d) out of order: [%s]", i, result.RequestId)
+		} else if result.City.Id != expectedIds[i] || result.Found != (expectedIds[i] != "") {
+			t.Fatalf("Result (%d) not correct: %v", i, result)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+package geoattractorrpc
+
+// The generated code requires protoc-gen-go and protoc-gen-go-grpc.
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative geoattractor.proto
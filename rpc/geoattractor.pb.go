@@ -0,0 +1,667 @@
+// The city index as a gRPC service. The Go code in this package is generated
+// from this file (see "generate.go").
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        (unknown)
+// source: geoattractor.proto
+
+package geoattractorrpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// CityRecord mirrors `geoattractor.CityRecord`.
+type CityRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id              string  `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Country         string  `protobuf:"bytes,2,opt,name=country,proto3" json:"country,omitempty"`
+	ProvinceOrState string  `protobuf:"bytes,3,opt,name=province_or_state,json=provinceOrState,proto3" json:"province_or_state,omitempty"`
+	City            string  `protobuf:"bytes,4,opt,name=city,proto3" json:"city,omitempty"`
+	Population      uint64  `protobuf:"varint,5,opt,name=population,proto3" json:"population,omitempty"`
+	Latitude        float64 `protobuf:"fixed64,6,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude       float64 `protobuf:"fixed64,7,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	// cell_id is the S2 leaf cell of the coordinates.
+	CellId uint64 `protobuf:"varint,8,opt,name=cell_id,json=cellId,proto3" json:"cell_id,omitempty"`
+}
+
+func (x *CityRecord) Reset() {
+	*x = CityRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_geoattractor_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CityRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CityRecord) ProtoMessage() {}
+
+func (x *CityRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_geoattractor_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CityRecord.ProtoReflect.Descriptor instead.
+func (*CityRecord) Descriptor() ([]byte, []int) {
+	return file_geoattractor_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CityRecord) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CityRecord) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *CityRecord) GetProvinceOrState() string {
+	if x != nil {
+		return x.ProvinceOrState
+	}
+	return ""
+}
+
+func (x *CityRecord) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *CityRecord) GetPopulation() uint64 {
+	if x != nil {
+		return x.Population
+	}
+	return 0
+}
+
+func (x *CityRecord) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *CityRecord) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *CityRecord) GetCellId() uint64 {
+	if x != nil {
+		return x.CellId
+	}
+	return 0
+}
+
+// Visit is one city seen while searching outward from the query point. It
+// mirrors `geoattractorindex.VisitHistoryItem`.
+type Visit struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Token      string      `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	SourceName string      `protobuf:"bytes,2,opt,name=source_name,json=sourceName,proto3" json:"source_name,omitempty"`
+	City       *CityRecord `protobuf:"bytes,3,opt,name=city,proto3" json:"city,omitempty"`
+}
+
+func (x *Visit) Reset() {
+	*x = Visit{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_geoattractor_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Visit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Visit) ProtoMessage() {}
+
+func (x *Visit) ProtoReflect() protoreflect.Message {
+	mi := &file_geoattractor_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Visit.ProtoReflect.Descriptor instead.
+func (*Visit) Descriptor() ([]byte, []int) {
+	return file_geoattractor_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Visit) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *Visit) GetSourceName() string {
+	if x != nil {
+		return x.SourceName
+	}
+	return ""
+}
+
+func (x *Visit) GetCity() *CityRecord {
+	if x != nil {
+		return x.City
+	}
+	return nil
+}
+
+type NearestRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Latitude  float64 `protobuf:"fixed64,1,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude float64 `protobuf:"fixed64,2,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	// return_visits asks for every city seen along the way.
+	ReturnVisits bool `protobuf:"varint,3,opt,name=return_visits,json=returnVisits,proto3" json:"return_visits,omitempty"`
+	// request_id is echoed in the response so that streamed responses can be
+	// matched to their requests.
+	RequestId string `protobuf:"bytes,4,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+}
+
+func (x *NearestRequest) Reset() {
+	*x = NearestRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_geoattractor_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NearestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NearestRequest) ProtoMessage() {}
+
+func (x *NearestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geoattractor_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NearestRequest.ProtoReflect.Descriptor instead.
+func (*NearestRequest) Descriptor() ([]byte, []int) {
+	return file_geoattractor_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *NearestRequest) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *NearestRequest) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *NearestRequest) GetReturnVisits() bool {
+	if x != nil {
+		return x.ReturnVisits
+	}
+	return false
+}
+
+func (x *NearestRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+type NearestResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	RequestId string `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	// found is false if nothing is indexed near the point. The unary call
+	// returns NOT_FOUND instead.
+	Found      bool        `protobuf:"varint,2,opt,name=found,proto3" json:"found,omitempty"`
+	SourceName string      `protobuf:"bytes,3,opt,name=source_name,json=sourceName,proto3" json:"source_name,omitempty"`
+	City       *CityRecord `protobuf:"bytes,4,opt,name=city,proto3" json:"city,omitempty"`
+	Visits     []*Visit    `protobuf:"bytes,5,rep,name=visits,proto3" json:"visits,omitempty"`
+}
+
+func (x *NearestResponse) Reset() {
+	*x = NearestResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_geoattractor_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NearestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NearestResponse) ProtoMessage() {}
+
+func (x *NearestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_geoattractor_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NearestResponse.ProtoReflect.Descriptor instead.
+func (*NearestResponse) Descriptor() ([]byte, []int) {
+	return file_geoattractor_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *NearestResponse) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *NearestResponse) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *NearestResponse) GetSourceName() string {
+	if x != nil {
+		return x.SourceName
+	}
+	return ""
+}
+
+func (x *NearestResponse) GetCity() *CityRecord {
+	if x != nil {
+		return x.City
+	}
+	return nil
+}
+
+func (x *NearestResponse) GetVisits() []*Visit {
+	if x != nil {
+		return x.Visits
+	}
+	return nil
+}
+
+type BatchNearestRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Requests []*NearestRequest `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+}
+
+func (x *BatchNearestRequest) Reset() {
+	*x = BatchNearestRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_geoattractor_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchNearestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchNearestRequest) ProtoMessage() {}
+
+func (x *BatchNearestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_geoattractor_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchNearestRequest.ProtoReflect.Descriptor instead.
+func (*BatchNearestRequest) Descriptor() ([]byte, []int) {
+	return file_geoattractor_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BatchNearestRequest) GetRequests() []*NearestRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
+// BatchNearestResponse has one response for each request, in the same order.
+type BatchNearestResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Responses []*NearestResponse `protobuf:"bytes,1,rep,name=responses,proto3" json:"responses,omitempty"`
+}
+
+func (x *BatchNearestResponse) Reset() {
+	*x = BatchNearestResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_geoattractor_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchNearestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchNearestResponse) ProtoMessage() {}
+
+func (x *BatchNearestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_geoattractor_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchNearestResponse.ProtoReflect.Descriptor instead.
+func (*BatchNearestResponse) Descriptor() ([]byte, []int) {
+	return file_geoattractor_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BatchNearestResponse) GetResponses() []*NearestResponse {
+	if x != nil {
+		return x.Responses
+	}
+	return nil
+}
+
+var File_geoattractor_proto protoreflect.FileDescriptor
+
+var file_geoattractor_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x67, 0x65, 0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0f, 0x67, 0x65, 0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63, 0x74,
+	0x6f, 0x72, 0x2e, 0x76, 0x31, 0x22, 0xe9, 0x01, 0x0a, 0x0a, 0x43, 0x69, 0x74, 0x79, 0x52, 0x65,
+	0x63, 0x6f, 0x72, 0x64, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x02, 0x69, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x79, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x2a,
+	0x0a, 0x11, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x6e, 0x63, 0x65, 0x5f, 0x6f, 0x72, 0x5f, 0x73, 0x74,
+	0x61, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x70, 0x72, 0x6f, 0x76, 0x69,
+	0x6e, 0x63, 0x65, 0x4f, 0x72, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x69,
+	0x74, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x69, 0x74, 0x79, 0x12, 0x1e,
+	0x0a, 0x0a, 0x70, 0x6f, 0x70, 0x75, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x0a, 0x70, 0x6f, 0x70, 0x75, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1a,
+	0x0a, 0x08, 0x6c, 0x61, 0x74, 0x69, 0x74, 0x75, 0x64, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x08, 0x6c, 0x61, 0x74, 0x69, 0x74, 0x75, 0x64, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x6c, 0x6f,
+	0x6e, 0x67, 0x69, 0x74, 0x75, 0x64, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x6c,
+	0x6f, 0x6e, 0x67, 0x69, 0x74, 0x75, 0x64, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x63, 0x65, 0x6c, 0x6c,
+	0x5f, 0x69, 0x64, 0x18, 0x08, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x63, 0x65, 0x6c, 0x6c, 0x49,
+	0x64, 0x22, 0x6f, 0x0a, 0x05, 0x56, 0x69, 0x73, 0x69, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f,
+	0x6b, 0x65, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e,
+	0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x4e, 0x61, 0x6d,
+	0x65, 0x12, 0x2f, 0x0a, 0x04, 0x63, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x1b, 0x2e, 0x67, 0x65, 0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76,
+	0x31, 0x2e, 0x43, 0x69, 0x74, 0x79, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x04, 0x63, 0x69,
+	0x74, 0x79, 0x22, 0x8e, 0x01, 0x0a, 0x0e, 0x4e, 0x65, 0x61, 0x72, 0x65, 0x73, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x6c, 0x61, 0x74, 0x69, 0x74, 0x75, 0x64,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x08, 0x6c, 0x61, 0x74, 0x69, 0x74, 0x75, 0x64,
+	0x65, 0x12, 0x1c, 0x0a, 0x09, 0x6c, 0x6f, 0x6e, 0x67, 0x69, 0x74, 0x75, 0x64, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x6c, 0x6f, 0x6e, 0x67, 0x69, 0x74, 0x75, 0x64, 0x65, 0x12,
+	0x23, 0x0a, 0x0d, 0x72, 0x65, 0x74, 0x75, 0x72, 0x6e, 0x5f, 0x76, 0x69, 0x73, 0x69, 0x74, 0x73,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x72, 0x65, 0x74, 0x75, 0x72, 0x6e, 0x56, 0x69,
+	0x73, 0x69, 0x74, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f,
+	0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x49, 0x64, 0x22, 0xc8, 0x01, 0x0a, 0x0f, 0x4e, 0x65, 0x61, 0x72, 0x65, 0x73, 0x74, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x72, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x49, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x6f, 0x75, 0x6e, 0x64, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x66, 0x6f, 0x75, 0x6e, 0x64, 0x12, 0x1f, 0x0a, 0x0b,
+	0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0a, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x2f, 0x0a,
+	0x04, 0x63, 0x69, 0x74, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x65,
+	0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x69,
+	0x74, 0x79, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x04, 0x63, 0x69, 0x74, 0x79, 0x12, 0x2e,
+	0x0a, 0x06, 0x76, 0x69, 0x73, 0x69, 0x74, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16,
+	0x2e, 0x67, 0x65, 0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31,
+	0x2e, 0x56, 0x69, 0x73, 0x69, 0x74, 0x52, 0x06, 0x76, 0x69, 0x73, 0x69, 0x74, 0x73, 0x22, 0x52,
+	0x0a, 0x13, 0x42, 0x61, 0x74, 0x63, 0x68, 0x4e, 0x65, 0x61, 0x72, 0x65, 0x73, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x3b, 0x0a, 0x08, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x67, 0x65, 0x6f, 0x61, 0x74, 0x74,
+	0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x4e, 0x65, 0x61, 0x72, 0x65, 0x73,
+	0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x08, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x73, 0x22, 0x56, 0x0a, 0x14, 0x42, 0x61, 0x74, 0x63, 0x68, 0x4e, 0x65, 0x61, 0x72, 0x65,
+	0x73, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3e, 0x0a, 0x09, 0x72, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x20, 0x2e,
+	0x67, 0x65, 0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e,
+	0x4e, 0x65, 0x61, 0x72, 0x65, 0x73, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52,
+	0x09, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x73, 0x32, 0x8e, 0x02, 0x0a, 0x09, 0x43,
+	0x69, 0x74, 0x79, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x4c, 0x0a, 0x07, 0x4e, 0x65, 0x61, 0x72,
+	0x65, 0x73, 0x74, 0x12, 0x1f, 0x2e, 0x67, 0x65, 0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63, 0x74,
+	0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x4e, 0x65, 0x61, 0x72, 0x65, 0x73, 0x74, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x20, 0x2e, 0x67, 0x65, 0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63,
+	0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x4e, 0x65, 0x61, 0x72, 0x65, 0x73, 0x74, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x5b, 0x0a, 0x0c, 0x42, 0x61, 0x74, 0x63, 0x68, 0x4e,
+	0x65, 0x61, 0x72, 0x65, 0x73, 0x74, 0x12, 0x24, 0x2e, 0x67, 0x65, 0x6f, 0x61, 0x74, 0x74, 0x72,
+	0x61, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x4e, 0x65,
+	0x61, 0x72, 0x65, 0x73, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x25, 0x2e, 0x67,
+	0x65, 0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x42,
+	0x61, 0x74, 0x63, 0x68, 0x4e, 0x65, 0x61, 0x72, 0x65, 0x73, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x56, 0x0a, 0x0d, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x4e, 0x65, 0x61,
+	0x72, 0x65, 0x73, 0x74, 0x12, 0x1f, 0x2e, 0x67, 0x65, 0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63,
+	0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x4e, 0x65, 0x61, 0x72, 0x65, 0x73, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x20, 0x2e, 0x67, 0x65, 0x6f, 0x61, 0x74, 0x74, 0x72, 0x61,
+	0x63, 0x74, 0x6f, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x4e, 0x65, 0x61, 0x72, 0x65, 0x73, 0x74, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01, 0x30, 0x01, 0x42, 0x40, 0x5a, 0x3e, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x64, 0x73, 0x6f, 0x70, 0x72, 0x65,
+	0x61, 0x2f, 0x67, 0x6f, 0x2d, 0x67, 0x65, 0x6f, 0x67, 0x72, 0x61, 0x70, 0x68, 0x69, 0x63, 0x2d,
+	0x61, 0x74, 0x74, 0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x2f, 0x72, 0x70, 0x63, 0x3b, 0x67, 0x65,
+	0x6f, 0x61, 0x74, 0x74, 0x72, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_geoattractor_proto_rawDescOnce sync.Once
+	file_geoattractor_proto_rawDescData = file_geoattractor_proto_rawDesc
+)
+
+func file_geoattractor_proto_rawDescGZIP() []byte {
+	file_geoattractor_proto_rawDescOnce.Do(func() {
+		file_geoattractor_proto_rawDescData = protoimpl.X.CompressGZIP(file_geoattractor_proto_rawDescData)
+	})
+	return file_geoattractor_proto_rawDescData
+}
+
+var file_geoattractor_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_geoattractor_proto_goTypes = []any{
+	(*CityRecord)(nil),           // 0: geoattractor.v1.CityRecord
+	(*Visit)(nil),                // 1: geoattractor.v1.Visit
+	(*NearestRequest)(nil),       // 2: geoattractor.v1.NearestRequest
+	(*NearestResponse)(nil),      // 3: geoattractor.v1.NearestResponse
+	(*BatchNearestRequest)(nil),  // 4: geoattractor.v1.BatchNearestRequest
+	(*BatchNearestResponse)(nil), // 5: geoattractor.v1.BatchNearestResponse
+}
+var file_geoattractor_proto_depIdxs = []int32{
+	0, // 0: geoattractor.v1.Visit.city:type_name -> geoattractor.v1.CityRecord
+	0, // 1: geoattractor.v1.NearestResponse.city:type_name -> geoattractor.v1.CityRecord
+	1, // 2: geoattractor.v1.NearestResponse.visits:type_name -> geoattractor.v1.Visit
+	2, // 3: geoattractor.v1.BatchNearestRequest.requests:type_name -> geoattractor.v1.NearestRequest
+	3, // 4: geoattractor.v1.BatchNearestResponse.responses:type_name -> geoattractor.v1.NearestResponse
+	2, // 5: geoattractor.v1.CityIndex.Nearest:input_type -> geoattractor.v1.NearestRequest
+	4, // 6: geoattractor.v1.CityIndex.BatchNearest:input_type -> geoattractor.v1.BatchNearestRequest
+	2, // 7: geoattractor.v1.CityIndex.StreamNearest:input_type -> geoattractor.v1.NearestRequest
+	3, // 8: geoattractor.v1.CityIndex.Nearest:output_type -> geoattractor.v1.NearestResponse
+	5, // 9: geoattractor.v1.CityIndex.BatchNearest:output_type -> geoattractor.v1.BatchNearestResponse
+	3, // 10: geoattractor.v1.CityIndex.StreamNearest:output_type -> geoattractor.v1.NearestResponse
+	8, // [8:11] is the sub-list for method output_type
+	5, // [5:8] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_geoattractor_proto_init() }
+func file_geoattractor_proto_init() {
+	if File_geoattractor_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_geoattractor_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*CityRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_geoattractor_proto_msgTypes[1].Exporter = func(v any, i int) any {
+			switch v := v.(*Visit); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_geoattractor_proto_msgTypes[2].Exporter = func(v any, i int) any {
+			switch v := v.(*NearestRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_geoattractor_proto_msgTypes[3].Exporter = func(v any, i int) any {
+			switch v := v.(*NearestResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_geoattractor_proto_msgTypes[4].Exporter = func(v any, i int) any {
+			switch v := v.(*BatchNearestRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_geoattractor_proto_msgTypes[5].Exporter = func(v any, i int) any {
+			switch v := v.(*BatchNearestResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_geoattractor_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_geoattractor_proto_goTypes,
+		DependencyIndexes: file_geoattractor_proto_depIdxs,
+		MessageInfos:      file_geoattractor_proto_msgTypes,
+	}.Build()
+	File_geoattractor_proto = out.File
+	file_geoattractor_proto_rawDesc = nil
+	file_geoattractor_proto_goTypes = nil
+	file_geoattractor_proto_depIdxs = nil
+}
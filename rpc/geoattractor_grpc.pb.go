@@ -0,0 +1,203 @@
+// The city index as a gRPC service. The Go code in this package is generated
+// from this file (see "generate.go").
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: geoattractor.proto
+
+package geoattractorrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CityIndex_Nearest_FullMethodName       = "/geoattractor.v1.CityIndex/Nearest"
+	CityIndex_BatchNearest_FullMethodName  = "/geoattractor.v1.CityIndex/BatchNearest"
+	CityIndex_StreamNearest_FullMethodName = "/geoattractor.v1.CityIndex/StreamNearest"
+)
+
+// CityIndexClient is the client API for CityIndex service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CityIndexClient interface {
+	// Nearest returns the nearest urban center or, if there isn't one, the
+	// nearest city.
+	Nearest(ctx context.Context, in *NearestRequest, opts ...grpc.CallOption) (*NearestResponse, error)
+	// BatchNearest answers many queries in one call.
+	BatchNearest(ctx context.Context, in *BatchNearestRequest, opts ...grpc.CallOption) (*BatchNearestResponse, error)
+	// StreamNearest answers each request as it arrives, in order.
+	StreamNearest(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[NearestRequest, NearestResponse], error)
+}
+
+type cityIndexClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCityIndexClient(cc grpc.ClientConnInterface) CityIndexClient {
+	return &cityIndexClient{cc}
+}
+
+func (c *cityIndexClient) Nearest(ctx context.Context, in *NearestRequest, opts ...grpc.CallOption) (*NearestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NearestResponse)
+	err := c.cc.Invoke(ctx, CityIndex_Nearest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cityIndexClient) BatchNearest(ctx context.Context, in *BatchNearestRequest, opts ...grpc.CallOption) (*BatchNearestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchNearestResponse)
+	err := c.cc.Invoke(ctx, CityIndex_BatchNearest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cityIndexClient) StreamNearest(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[NearestRequest, NearestResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CityIndex_ServiceDesc.Streams[0], CityIndex_StreamNearest_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[NearestRequest, NearestResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CityIndex_StreamNearestClient = grpc.BidiStreamingClient[NearestRequest, NearestResponse]
+
+// CityIndexServer is the server API for CityIndex service.
+// All implementations must embed UnimplementedCityIndexServer
+// for forward compatibility.
+type CityIndexServer interface {
+	// Nearest returns the nearest urban center or, if there isn't one, the
+	// nearest city.
+	Nearest(context.Context, *NearestRequest) (*NearestResponse, error)
+	// BatchNearest answers many queries in one call.
+	BatchNearest(context.Context, *BatchNearestRequest) (*BatchNearestResponse, error)
+	// StreamNearest answers each request as it arrives, in order.
+	StreamNearest(grpc.BidiStreamingServer[NearestRequest, NearestResponse]) error
+	mustEmbedUnimplementedCityIndexServer()
+}
+
+// UnimplementedCityIndexServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCityIndexServer struct{}
+
+func (UnimplementedCityIndexServer) Nearest(context.Context, *NearestRequest) (*NearestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Nearest not implemented")
+}
+func (UnimplementedCityIndexServer) BatchNearest(context.Context, *BatchNearestRequest) (*BatchNearestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchNearest not implemented")
+}
+func (UnimplementedCityIndexServer) StreamNearest(grpc.BidiStreamingServer[NearestRequest, NearestResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamNearest not implemented")
+}
+func (UnimplementedCityIndexServer) mustEmbedUnimplementedCityIndexServer() {}
+func (UnimplementedCityIndexServer) testEmbeddedByValue()                   {}
+
+// UnsafeCityIndexServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CityIndexServer will
+// result in compilation errors.
+type UnsafeCityIndexServer interface {
+	mustEmbedUnimplementedCityIndexServer()
+}
+
+func RegisterCityIndexServer(s grpc.ServiceRegistrar, srv CityIndexServer) {
+	// If the following call pancis, it indicates UnimplementedCityIndexServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CityIndex_ServiceDesc, srv)
+}
+
+func _CityIndex_Nearest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NearestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CityIndexServer).Nearest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CityIndex_Nearest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CityIndexServer).Nearest(ctx, req.(*NearestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CityIndex_BatchNearest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchNearestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CityIndexServer).BatchNearest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CityIndex_BatchNearest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CityIndexServer).BatchNearest(ctx, req.(*BatchNearestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CityIndex_StreamNearest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CityIndexServer).StreamNearest(&grpc.GenericServerStream[NearestRequest, NearestResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CityIndex_StreamNearestServer = grpc.BidiStreamingServer[NearestRequest, NearestResponse]
+
+// CityIndex_ServiceDesc is the grpc.ServiceDesc for CityIndex service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CityIndex_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "geoattractor.v1.CityIndex",
+	HandlerType: (*CityIndexServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Nearest",
+			Handler:    _CityIndex_Nearest_Handler,
+		},
+		{
+			MethodName: "BatchNearest",
+			Handler:    _CityIndex_BatchNearest_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamNearest",
+			Handler:       _CityIndex_StreamNearest_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "geoattractor.proto",
+}
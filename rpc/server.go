@@ -0,0 +1,205 @@
+package geoattractorrpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/golang/geo/s2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+const (
+	// DefaultMaxBatchSize is the most requests that `BatchNearest()` accepts if
+	// `ServerConfig.MaxBatchSize` isn't set.
+	DefaultMaxBatchSize = 1000
+)
+
+var (
+	rpcLogger = log.NewLogger("geoattractor.rpc")
+)
+
+// NewCityRecord converts a city record to its message.
+func NewCityRecord(cr geoattractor.CityRecord) *CityRecord {
+	return &CityRecord{
+		Id:              cr.Id,
+		Country:         cr.Country,
+		ProvinceOrState: cr.ProvinceState,
+		City:            cr.City,
+		Population:      cr.Population,
+		Latitude:        cr.Latitude,
+		Longitude:       cr.Longitude,
+		CellId:          uint64(cr.S2Cell()),
+	}
+}
+
+// ToCityRecord converts the message back to a city record.
+func (x *CityRecord) ToCityRecord() geoattractor.CityRecord {
+	return geoattractor.CityRecord{
+		Id:            x.GetId(),
+		Country:       x.GetCountry(),
+		ProvinceState: x.GetProvinceOrState(),
+		City:          x.GetCity(),
+		Population:    x.GetPopulation(),
+		Latitude:      x.GetLatitude(),
+		Longitude:     x.GetLongitude(),
+		Cell:          s2.CellID(x.GetCellId()),
+	}
+}
+
+// ToVisitHistoryItem converts the message back to a visit.
+func (x *Visit) ToVisitHistoryItem() geoattractorindex.VisitHistoryItem {
+	return geoattractorindex.VisitHistoryItem{
+		Token:      x.GetToken(),
+		SourceName: x.GetSourceName(),
+		City:       x.GetCity().ToCityRecord(),
+	}
+}
+
+// ServerConfig configures a `Server`.
+type ServerConfig struct {
+	// Index is a prebuilt index.
+	Index *geoattractorindex.CityIndex
+
+	// MaxBatchSize caps the number of requests in one `BatchNearest()` call.
+	MaxBatchSize int
+}
+
+// Server implements the `CityIndex` service against an index. The index isn't
+// safe for concurrent use, so queries are serialized.
+type Server struct {
+	UnimplementedCityIndexServer
+
+	config ServerConfig
+
+	// locker guards the index.
+	locker sync.Mutex
+}
+
+// NewServer returns a `Server`. Register it with
+// `RegisterCityIndexServer()`.
+func NewServer(config ServerConfig) *Server {
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = DefaultMaxBatchSize
+	}
+
+	return &Server{
+		config: config,
+	}
+}
+
+// nearest answers one request. The response has `Found` cleared if there's no
+// city near the point.
+func (s *Server) nearest(request *NearestRequest) (response *NearestResponse, err error) {
+	latitude := request.GetLatitude()
+	longitude := request.GetLongitude()
+
+	if latitude < -90.0 || latitude > 90.0 || longitude < -180.0 || longitude > 180.0 {
+		message := fmt.Sprintf("coordinates out of range: (%f) (%f)", latitude, longitude)
+		return nil, status.Error(codes.InvalidArgument, message)
+	}
+
+	s.locker.Lock()
+	sourceName, visits, cr, err := s.config.Index.Nearest(latitude, longitude, request.GetReturnVisits())
+	s.locker.Unlock()
+
+	response = &NearestResponse{
+		RequestId: request.GetRequestId(),
+	}
+
+	if err != nil {
+		if log.Is(err, geoattractorindex.ErrNoNearestCity) == true {
+			return response, nil
+		}
+
+		rpcLogger.Errorf(nil, err, "Nearest query failed.")
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	response.Found = true
+	response.SourceName = sourceName
+	response.City = NewCityRecord(cr)
+
+	if len(visits) > 0 {
+		response.Visits = make([]*Visit, len(visits))
+		for i, vhi := range visits {
+			response.Visits[i] = &Visit{
+				Token:      vhi.Token,
+				SourceName: vhi.SourceName,
+				City:       NewCityRecord(vhi.City),
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// Nearest implements `CityIndexServer`. Returns NOT_FOUND if nothing is
+// indexed near the point.
+func (s *Server) Nearest(ctx context.Context, request *NearestRequest) (response *NearestResponse, err error) {
+	response, err = s.nearest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Found == false {
+		return nil, status.Error(codes.NotFound, geoattractorindex.ErrNoNearestCity.Error())
+	}
+
+	return response, nil
+}
+
+// BatchNearest implements `CityIndexServer`.
+func (s *Server) BatchNearest(ctx context.Context, request *BatchNearestRequest) (response *BatchNearestResponse, err error) {
+	requests := request.GetRequests()
+
+	if len(requests) > s.config.MaxBatchSize {
+		message := fmt.Sprintf("too many requests in batch: (%d) > (%d)", len(requests), s.config.MaxBatchSize)
+		return nil, status.Error(codes.InvalidArgument, message)
+	}
+
+	response = &BatchNearestResponse{
+		Responses: make([]*NearestResponse, len(requests)),
+	}
+
+	for i, nr := range requests {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+
+		response.Responses[i], err = s.nearest(nr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// StreamNearest implements `CityIndexServer`.
+func (s *Server) StreamNearest(stream CityIndex_StreamNearestServer) (err error) {
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		response, err := s.nearest(request)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(response)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package geoattractorrpc
+
+import (
+	"testing"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+func TestCityRecord_RoundTrip(t *testing.T) {
+	cr := geoattractor.CityRecord{
+		Id:            "292223",
+		Country:       "United Arab Emirates",
+		ProvinceState: "03",
+		City:          "Dubai",
+		Population:    1137347,
+		Latitude:      25.0657,
+		Longitude:     55.17128,
+	}
+
+	message := NewCityRecord(cr)
+
+	if message.GetCellId() != uint64(cr.S2Cell()) {
+		t.Fatalf("Cell not computed.")
+	}
+
+	recovered := message.ToCityRecord()
+
+	cr.Cell = cr.S2Cell()
+	if recovered != cr {
+		t.Fatalf("Record not recovered: %s != %s", recovered, cr)
+	}
+}
+
+func TestCityRecord_ToCityRecord_Nil(t *testing.T) {
+	var message *CityRecord
+
+	if message.ToCityRecord() != (geoattractor.CityRecord{}) {
+		t.Fatalf("Expected an empty record from a nil message.")
+	}
+}
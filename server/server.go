@@ -0,0 +1,412 @@
+package geoattractorserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+const (
+	// DefaultMaxResults is the most results that a k-nearest, radius, or name
+	// query can return if `ServerConfig.MaxResults` isn't set.
+	DefaultMaxResults = 100
+
+	// DefaultMaxRadiusKm is the largest radius that can be queried if
+	// `ServerConfig.MaxRadiusKm` isn't set.
+	DefaultMaxRadiusKm = 500.0
+
+	// DefaultSourceName is the source that cities are looked-up by ID in if
+	// neither the request nor `ServerConfig.DefaultSourceName` gives one.
+	DefaultSourceName = "GeoNames"
+)
+
+var (
+	serverLogger = log.NewLogger("geoattractor.server")
+)
+
+// ServerConfig configures a `Server`.
+type ServerConfig struct {
+	// Index is a prebuilt index.
+	Index *geoattractorindex.CityIndex
+
+	// DefaultSourceName is the source used for by-ID lookups that don't give
+	// one.
+	DefaultSourceName string
+
+	// MaxResults caps `k` and `limit`.
+	MaxResults int
+
+	// MaxRadiusKm caps `radius_km`.
+	MaxRadiusKm float64
+}
+
+// Server answers reverse-geocoding queries against an index over HTTP. All
+// responses are JSON.
+//
+//   GET /nearest?lat=&lon=
+//   GET /nearest/k?lat=&lon=&k=
+//   GET /radius?lat=&lon=&radius_km=
+//   GET /city?id=[&source=]
+//   GET /search?name=[&country=][&limit=]
+//   GET /stats
+//   GET /healthz
+//   GET /readyz
+//
+// The index isn't safe for concurrent use, so queries are serialized.
+type Server struct {
+	config ServerConfig
+
+	// locker guards the index.
+	locker sync.Mutex
+
+	// isReady is accessed atomically.
+	isReady int32
+
+	mux *http.ServeMux
+}
+
+// NewServer returns a `Server`. It isn't ready until `SetReady(true)` is
+// called.
+func NewServer(config ServerConfig) *Server {
+	if config.DefaultSourceName == "" {
+		config.DefaultSourceName = DefaultSourceName
+	}
+
+	if config.MaxResults <= 0 {
+		config.MaxResults = DefaultMaxResults
+	}
+
+	if config.MaxRadiusKm <= 0 {
+		config.MaxRadiusKm = DefaultMaxRadiusKm
+	}
+
+	s := &Server{
+		config: config,
+		mux:    http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/nearest", s.handleNearest)
+	s.mux.HandleFunc("/nearest/k", s.handleKNearest)
+	s.mux.HandleFunc("/radius", s.handleRadius)
+	s.mux.HandleFunc("/city", s.handleCity)
+	s.mux.HandleFunc("/search", s.handleSearch)
+	s.mux.HandleFunc("/stats", s.handleStats)
+	s.mux.HandleFunc("/healthz", s.handleHealth)
+	s.mux.HandleFunc("/readyz", s.handleReady)
+
+	return s
+}
+
+// SetReady sets whether the server reports itself as ready. Clear it before
+// shutting down so that load-balancers stop sending queries.
+func (s *Server) SetReady(flag bool) {
+	var value int32
+	if flag == true {
+		value = 1
+	}
+
+	atomic.StoreInt32(&s.isReady, value)
+}
+
+// IsReady returns whether the server reports itself as ready.
+func (s *Server) IsReady() bool {
+	return atomic.LoadInt32(&s.isReady) == 1
+}
+
+// ServeHTTP implements `http.Handler`.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		s.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: [%s]", r.Method))
+
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// errorResponse is the body of every response that isn't a success.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// resultsResponse is the body of the queries that return lists.
+type resultsResponse struct {
+	Results interface{} `json:"results"`
+}
+
+// statusResponse is the body of the health and readiness checks.
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+func (s *Server) writeJson(w http.ResponseWriter, statusCode int, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		serverLogger.Errorf(nil, err, "Could not encode response.")
+		http.Error(w, "could not encode response", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	w.Write(encoded)
+	w.Write([]byte{'\n'})
+}
+
+func (s *Server) writeError(w http.ResponseWriter, statusCode int, err error) {
+	if statusCode == http.StatusInternalServerError {
+		serverLogger.Errorf(nil, err, "Query failed.")
+	}
+
+	er := errorResponse{
+		Error: err.Error(),
+	}
+
+	s.writeJson(w, statusCode, er)
+}
+
+// writeQueryError maps the errors that the index returns to status codes.
+func (s *Server) writeQueryError(w http.ResponseWriter, err error) {
+	if log.Is(err, geoattractorindex.ErrNotFound) == true || log.Is(err, geoattractorindex.ErrNoNearestCity) == true {
+		s.writeError(w, http.StatusNotFound, err)
+	} else {
+		s.writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func floatParameter(r *http.Request, name string) (value float64, err error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0.0, fmt.Errorf("parameter [%s] is required", name)
+	}
+
+	value, err = strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0.0, fmt.Errorf("parameter [%s] is not a number: [%s]", name, raw)
+	}
+
+	return value, nil
+}
+
+// intParameter returns the parameter, or `defaultValue` if it wasn't given.
+func intParameter(r *http.Request, name string, defaultValue int) (value int, err error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return defaultValue, nil
+	}
+
+	value, err = strconv.Atoi(raw)
+	if err != nil || value < 1 {
+		return 0, fmt.Errorf("parameter [%s] is not a positive integer: [%s]", name, raw)
+	}
+
+	return value, nil
+}
+
+func coordinateParameters(r *http.Request) (latitude, longitude float64, err error) {
+	latitude, err = floatParameter(r, "lat")
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+
+	longitude, err = floatParameter(r, "lon")
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+
+	if latitude < -90.0 || latitude > 90.0 || longitude < -180.0 || longitude > 180.0 {
+		return 0.0, 0.0, fmt.Errorf("coordinates out of range: (%f) (%f)", latitude, longitude)
+	}
+
+	return latitude, longitude, nil
+}
+
+func (s *Server) handleNearest(w http.ResponseWriter, r *http.Request) {
+	latitude, longitude, err := coordinateParameters(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.locker.Lock()
+	sourceName, _, cr, err := s.config.Index.Nearest(latitude, longitude, false)
+	s.locker.Unlock()
+
+	if err != nil {
+		s.writeQueryError(w, err)
+		return
+	}
+
+	origin := geo.NewPoint(latitude, longitude)
+	p := geo.NewPoint(cr.Latitude, cr.Longitude)
+
+	nc := geoattractorindex.NearbyCity{
+		IndexedCity: geoattractorindex.IndexedCity{
+			SourceName: sourceName,
+			City:       cr,
+		},
+		DistanceKm: origin.GreatCircleDistance(p),
+	}
+
+	s.writeJson(w, http.StatusOK, nc)
+}
+
+func (s *Server) handleKNearest(w http.ResponseWriter, r *http.Request) {
+	latitude, longitude, err := coordinateParameters(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	k, err := intParameter(r, "k", 1)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if k > s.config.MaxResults {
+		k = s.config.MaxResults
+	}
+
+	s.locker.Lock()
+	nearby, err := s.config.Index.KNearest(latitude, longitude, k)
+	s.locker.Unlock()
+
+	if err != nil {
+		s.writeQueryError(w, err)
+		return
+	}
+
+	s.writeJson(w, http.StatusOK, resultsResponse{Results: nearby})
+}
+
+func (s *Server) handleRadius(w http.ResponseWriter, r *http.Request) {
+	latitude, longitude, err := coordinateParameters(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	radiusKm, err := floatParameter(r, "radius_km")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if radiusKm <= 0.0 || radiusKm > s.config.MaxRadiusKm {
+		err := fmt.Errorf("radius must be greater than zero and at most (%.0f) km: (%f)", s.config.MaxRadiusKm, radiusKm)
+		s.writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	s.locker.Lock()
+	nearby, err := s.config.Index.WithinRadius(latitude, longitude, radiusKm)
+	s.locker.Unlock()
+
+	if err != nil {
+		s.writeQueryError(w, err)
+		return
+	}
+
+	if len(nearby) > s.config.MaxResults {
+		nearby = nearby[:s.config.MaxResults]
+	}
+
+	s.writeJson(w, http.StatusOK, resultsResponse{Results: nearby})
+}
+
+func (s *Server) handleCity(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	id := query.Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("parameter [id] is required"))
+		return
+	}
+
+	sourceName := query.Get("source")
+	if sourceName == "" {
+		sourceName = s.config.DefaultSourceName
+	}
+
+	s.locker.Lock()
+	cr, err := s.config.Index.GetById(sourceName, id)
+	s.locker.Unlock()
+
+	if err != nil {
+		s.writeQueryError(w, err)
+		return
+	}
+
+	ic := geoattractorindex.IndexedCity{
+		SourceName: sourceName,
+		City:       cr,
+	}
+
+	s.writeJson(w, http.StatusOK, ic)
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	name := query.Get("name")
+	if name == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("parameter [name] is required"))
+		return
+	}
+
+	limit, err := intParameter(r, "limit", s.config.MaxResults)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if limit > s.config.MaxResults {
+		limit = s.config.MaxResults
+	}
+
+	s.locker.Lock()
+	cities, err := s.config.Index.FindByName(name, query.Get("country"), limit)
+	s.locker.Unlock()
+
+	if err != nil {
+		s.writeQueryError(w, err)
+		return
+	}
+
+	s.writeJson(w, http.StatusOK, resultsResponse{Results: cities})
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	s.locker.Lock()
+	stats := s.config.Index.Stats()
+	s.locker.Unlock()
+
+	s.writeJson(w, http.StatusOK, stats)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.writeJson(w, http.StatusOK, statusResponse{Status: "ok"})
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.IsReady() == false {
+		s.writeJson(w, http.StatusServiceUnavailable, statusResponse{Status: "not ready"})
+		return
+	}
+
+	s.writeJson(w, http.StatusOK, statusResponse{Status: "ready"})
+}
@@ -0,0 +1,264 @@
+package geoattractorserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor/index"
+)
+
+func getTestServer() (s *Server, ci *geoattractorindex.CityIndex, kvFilepath string) {
+	ci, kvFilepath, _ = geoattractorindex.NewLoadedTestCityIndex(geoattractorindex.LoadOptions{})
+
+	config := ServerConfig{
+		Index:       ci,
+		MaxResults:  5,
+		MaxRadiusKm: 200.0,
+	}
+
+	s = NewServer(config)
+	s.SetReady(true)
+
+	return s, ci, kvFilepath
+}
+
+// get does the request and decodes the response into `result`.
+func get(s *Server, url string, result interface{}) (statusCode int) {
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	w := httptest.NewRecorder()
+
+	s.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Type") != "application/json" {
+		log.Panicf("response not JSON: [%s]", w.Header().Get("Content-Type"))
+	}
+
+	err := json.Unmarshal(w.Body.Bytes(), result)
+	log.PanicIf(err)
+
+	return w.Code
+}
+
+type testNearbyResults struct {
+	Results []geoattractorindex.NearbyCity `json:"results"`
+}
+
+func TestServer_Nearest(t *testing.T) {
+	s, ci, kvFilepath := getTestServer()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	nc := geoattractorindex.NearbyCity{}
+
+	statusCode := get(s, "/nearest?lat=25.0657&lon=55.17128", &nc)
+	if statusCode != http.StatusOK {
+		t.Fatalf("Status not correct: (%d)", statusCode)
+	} else if nc.City.Id != "292223" || nc.SourceName != "GeoNames" || nc.DistanceKm != 0 {
+		t.Fatalf("Result not correct: %v", nc)
+	}
+
+	// The raw document uses the record's tags.
+
+	raw := make(map[string]interface{})
+
+	get(s, "/nearest?lat=25.0657&lon=55.17128", &raw)
+
+	city := raw["city"].(map[string]interface{})
+	if city["city"] != "Dubai" || city["province_or_state"] != "03" || raw["source"] != "GeoNames" {
+		t.Fatalf("Document not correct: %v", raw)
+	}
+}
+
+func TestServer_Nearest_Errors(t *testing.T) {
+	s, ci, kvFilepath := getTestServer()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	er := errorResponse{}
+
+	urls := []string{
+		"/nearest?lat=25.0657",
+		"/nearest?lat=abc&lon=55.17128",
+		"/nearest?lat=95.0&lon=55.17128",
+	}
+
+	for _, url := range urls {
+		statusCode := get(s, url, &er)
+		if statusCode != http.StatusBadRequest || er.Error == "" {
+			t.Fatalf("Expected bad-request for [%s]: (%d)", url, statusCode)
+		}
+	}
+
+	// Nothing is indexed near here.
+
+	statusCode := get(s, "/nearest?lat=-45.0&lon=-120.0", &er)
+	if statusCode != http.StatusNotFound {
+		t.Fatalf("Expected not-found: (%d)", statusCode)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/nearest?lat=25.0657&lon=55.17128", nil)
+	w := httptest.NewRecorder()
+
+	s.ServeHTTP(w, r)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected method-not-allowed: (%d)", w.Code)
+	}
+}
+
+func TestServer_KNearest(t *testing.T) {
+	s, ci, kvFilepath := getTestServer()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	results := testNearbyResults{}
+
+	statusCode := get(s, "/nearest/k?lat=42.50779&lon=1.52109&k=2", &results)
+	if statusCode != http.StatusOK {
+		t.Fatalf("Status not correct: (%d)", statusCode)
+	} else if len(results.Results) != 2 || results.Results[0].City.Id != "3041563" || results.Results[1].City.Id != "3040051" {
+		t.Fatalf("Results not correct: %v", results.Results)
+	}
+
+	// Capped by the configuration.
+
+	statusCode = get(s, "/nearest/k?lat=42.50779&lon=1.52109&k=50", &results)
+	if statusCode != http.StatusOK || len(results.Results) != 5 {
+		t.Fatalf("Results not capped: (%d) (%d)", statusCode, len(results.Results))
+	}
+
+	er := errorResponse{}
+
+	statusCode = get(s, "/nearest/k?lat=42.50779&lon=1.52109&k=0", &er)
+	if statusCode != http.StatusBadRequest {
+		t.Fatalf("Expected bad-request for zero k: (%d)", statusCode)
+	}
+}
+
+func TestServer_Radius(t *testing.T) {
+	s, ci, kvFilepath := getTestServer()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	results := testNearbyResults{}
+
+	statusCode := get(s, "/radius?lat=25.0657&lon=55.17128&radius_km=40", &results)
+	if statusCode != http.StatusOK {
+		t.Fatalf("Status not correct: (%d)", statusCode)
+	} else if len(results.Results) == 0 || results.Results[0].City.Id != "292223" {
+		t.Fatalf("Results not correct: %v", results.Results)
+	}
+
+	for _, nc := range results.Results {
+		if nc.DistanceKm > 40.0 {
+			t.Fatalf("City outside of radius: %v", nc)
+		}
+	}
+
+	er := errorResponse{}
+
+	statusCode = get(s, "/radius?lat=25.0657&lon=55.17128&radius_km=1000", &er)
+	if statusCode != http.StatusBadRequest {
+		t.Fatalf("Expected bad-request for too large a radius: (%d)", statusCode)
+	}
+}
+
+func TestServer_City(t *testing.T) {
+	s, ci, kvFilepath := getTestServer()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	ic := geoattractorindex.IndexedCity{}
+
+	statusCode := get(s, "/city?id=3039163", &ic)
+	if statusCode != http.StatusOK || ic.City.City != "Sant Julià de Lòria" {
+		t.Fatalf("Result not correct: (%d) %v", statusCode, ic)
+	}
+
+	er := errorResponse{}
+
+	statusCode = get(s, "/city?id=3039163&source=Other", &er)
+	if statusCode != http.StatusNotFound {
+		t.Fatalf("Expected not-found for other source: (%d)", statusCode)
+	}
+
+	statusCode = get(s, "/city", &er)
+	if statusCode != http.StatusBadRequest {
+		t.Fatalf("Expected bad-request without ID: (%d)", statusCode)
+	}
+}
+
+func TestServer_Search(t *testing.T) {
+	s, ci, kvFilepath := getTestServer()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	results := struct {
+		Results []geoattractorindex.IndexedCity `json:"results"`
+	}{}
+
+	statusCode := get(s, "/search?name=abu+dhabi&country=United+Arab+Emirates", &results)
+	if statusCode != http.StatusOK {
+		t.Fatalf("Status not correct: (%d)", statusCode)
+	} else if len(results.Results) != 1 || results.Results[0].City.Id != "292968" {
+		t.Fatalf("Results not correct: %v", results.Results)
+	}
+
+	statusCode = get(s, "/search?name=nowhere", &results)
+	if statusCode != http.StatusOK || len(results.Results) != 0 {
+		t.Fatalf("Expected empty results: (%d) %v", statusCode, results.Results)
+	}
+}
+
+func TestServer_StatsAndHealth(t *testing.T) {
+	s, ci, kvFilepath := getTestServer()
+
+	defer os.Remove(kvFilepath)
+	defer ci.Close()
+
+	get(s, "/nearest?lat=25.0657&lon=55.17128", &geoattractorindex.NearbyCity{})
+
+	stats := geoattractorindex.AttractorStats{}
+
+	statusCode := get(s, "/stats", &stats)
+	if statusCode != http.StatusOK || stats.CachedNearestMisses != 1 {
+		t.Fatalf("Stats not correct: (%d) %s", statusCode, stats)
+	}
+
+	status := statusResponse{}
+
+	statusCode = get(s, "/healthz", &status)
+	if statusCode != http.StatusOK || status.Status != "ok" {
+		t.Fatalf("Health not correct: (%d) %v", statusCode, status)
+	}
+
+	statusCode = get(s, "/readyz", &status)
+	if statusCode != http.StatusOK {
+		t.Fatalf("Expected ready: (%d)", statusCode)
+	}
+
+	s.SetReady(false)
+
+	statusCode = get(s, "/readyz", &status)
+	if statusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected not ready: (%d)", statusCode)
+	}
+
+	// Still alive.
+
+	statusCode = get(s, "/healthz", &status)
+	if statusCode != http.StatusOK {
+		t.Fatalf("Expected healthy while not ready: (%d)", statusCode)
+	}
+}
@@ -0,0 +1,428 @@
+package geoattractorsynthetic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+const (
+	// DefaultMinimumPopulation is the smallest population generated.
+	DefaultMinimumPopulation = 100
+
+	// DefaultMaximumPopulation is the largest population generated.
+	DefaultMaximumPopulation = 20000000
+
+	// DefaultParetoAlpha is the shape of the Pareto distribution. Smaller
+	// values produce more large cities.
+	DefaultParetoAlpha = 1.1
+
+	// DefaultMetroRadiusKm is how far from its center a metro's cities are
+	// spread.
+	DefaultMetroRadiusKm = 50.0
+
+	// DefaultMetroPopulation is the population of the city at the center of
+	// each metro.
+	DefaultMetroPopulation = 5000000
+
+	// SourceName is the name of the `RecordSource` returned by
+	// `Generator.Source()`.
+	SourceName = "Synthetic"
+
+	// firstId is where the generated IDs start, to keep them clear of the small
+	// IDs used in hand-written test data.
+	firstId = 100000000
+)
+
+// PopulationDistribution determines how populations are drawn.
+type PopulationDistribution string
+
+const (
+	// PopulationPareto produces many small places and few large ones, like the
+	// real data. This is the default.
+	PopulationPareto PopulationDistribution = "pareto"
+
+	// PopulationUniform draws evenly between the minimum and the maximum.
+	PopulationUniform PopulationDistribution = "uniform"
+
+	// PopulationFixed gives every city the minimum population.
+	PopulationFixed PopulationDistribution = "fixed"
+)
+
+// syntheticCountry is a country that is known to the bundled countryInfo.txt,
+// so that generated GeoNames rows can be parsed with it.
+type syntheticCountry struct {
+	code string
+	name string
+}
+
+var (
+	syntheticCountries = []syntheticCountry{
+		{"US", "United States"},
+		{"BR", "Brazil"},
+		{"IN", "India"},
+		{"NG", "Nigeria"},
+		{"RU", "Russia"},
+		{"AU", "Australia"},
+	}
+)
+
+// Bounds is a region to generate cities in. If the minimum longitude is
+// greater than the maximum, the region crosses the antimeridian.
+type Bounds struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+var (
+	// WorldBounds covers the whole surface.
+	WorldBounds = Bounds{-90.0, -180.0, 90.0, 180.0}
+)
+
+// longitudeSpan returns the width of the region in degrees.
+func (b Bounds) longitudeSpan() float64 {
+	span := b.MaxLongitude - b.MinLongitude
+	if span < 0 {
+		span += 360.0
+	}
+
+	return span
+}
+
+// AreaKm2 returns the area of the surface within the region.
+func (b Bounds) AreaKm2() float64 {
+	minLatitude := b.MinLatitude * math.Pi / 180.0
+	maxLatitude := b.MaxLatitude * math.Pi / 180.0
+	longitudeSpan := b.longitudeSpan() * math.Pi / 180.0
+
+	return geo.EARTH_RADIUS * geo.EARTH_RADIUS * longitudeSpan * (math.Sin(maxLatitude) - math.Sin(minLatitude))
+}
+
+// GeneratorConfig describes the dataset to generate.
+type GeneratorConfig struct {
+	// Count is the number of cities (not including the edge cases).
+	Count int
+
+	// Density, if not zero, is the number of cities per 10,000 square
+	// kilometers of `Bounds` and is used instead of `Count`.
+	Density float64
+
+	// Bounds is where the cities are placed. Defaults to `WorldBounds`.
+	Bounds *Bounds
+
+	// Seed makes the dataset reproducible. The same configuration always
+	// produces the same cities.
+	Seed int64
+
+	// Population is the distribution that populations are drawn from.
+	// Defaults to `PopulationPareto`.
+	Population PopulationDistribution
+
+	// MinimumPopulation and MaximumPopulation bound the populations. They
+	// default to `DefaultMinimumPopulation` and `DefaultMaximumPopulation`.
+	MinimumPopulation uint64
+	MaximumPopulation uint64
+
+	// ParetoAlpha defaults to `DefaultParetoAlpha`.
+	ParetoAlpha float64
+
+	// Metros is the number of clusters to place cities around. Each has a
+	// city of `MetroPopulation` at its center.
+	Metros int
+
+	// MetroFraction is the share of the cities that are placed within
+	// `MetroRadiusKm` of a metro (the rest are spread evenly). Cities are
+	// denser nearer the center.
+	MetroFraction float64
+
+	// MetroRadiusKm defaults to `DefaultMetroRadiusKm`.
+	MetroRadiusKm float64
+
+	// MetroPopulation defaults to `DefaultMetroPopulation`.
+	MetroPopulation uint64
+
+	// EdgeCases adds cities at the poles, on either side of the antimeridian,
+	// and at the corners and edges of the S2 cube faces. These are where
+	// coordinate and cell handling are most likely to go wrong.
+	EdgeCases bool
+}
+
+// Generator produces synthetic cities.
+type Generator struct {
+	config GeneratorConfig
+}
+
+// NewGenerator returns a new `Generator`.
+func NewGenerator(config GeneratorConfig) *Generator {
+	if config.Bounds == nil {
+		config.Bounds = &WorldBounds
+	}
+
+	if config.Density != 0 {
+		config.Count = int(math.Round(config.Bounds.AreaKm2() / 10000.0 * config.Density))
+	}
+
+	if config.Population == "" {
+		config.Population = PopulationPareto
+	}
+
+	if config.MinimumPopulation == 0 {
+		config.MinimumPopulation = DefaultMinimumPopulation
+	}
+
+	if config.MaximumPopulation == 0 {
+		config.MaximumPopulation = DefaultMaximumPopulation
+	}
+
+	if config.ParetoAlpha == 0 {
+		config.ParetoAlpha = DefaultParetoAlpha
+	}
+
+	if config.MetroRadiusKm == 0 {
+		config.MetroRadiusKm = DefaultMetroRadiusKm
+	}
+
+	if config.MetroPopulation == 0 {
+		config.MetroPopulation = DefaultMetroPopulation
+	}
+
+	return &Generator{
+		config: config,
+	}
+}
+
+// population draws a population from the configured distribution.
+func (g *Generator) population(rng *rand.Rand) uint64 {
+	minimum := float64(g.config.MinimumPopulation)
+	maximum := float64(g.config.MaximumPopulation)
+
+	var population float64
+
+	switch g.config.Population {
+	case PopulationPareto:
+		population = minimum / math.Pow(1.0-rng.Float64(), 1.0/g.config.ParetoAlpha)
+	case PopulationUniform:
+		population = minimum + rng.Float64()*(maximum-minimum)
+	case PopulationFixed:
+		population = minimum
+	default:
+		log.Panicf("population distribution not valid: [%s]", g.config.Population)
+	}
+
+	if population > maximum {
+		population = maximum
+	}
+
+	return uint64(population)
+}
+
+// randomPoint returns a point spread evenly over the surface within the bounds
+// (not evenly over latitude, which would crowd the poles).
+func (g *Generator) randomPoint(rng *rand.Rand) (latitude, longitude float64) {
+	b := g.config.Bounds
+
+	minSin := math.Sin(b.MinLatitude * math.Pi / 180.0)
+	maxSin := math.Sin(b.MaxLatitude * math.Pi / 180.0)
+
+	latitude = math.Asin(minSin+rng.Float64()*(maxSin-minSin)) * 180.0 / math.Pi
+
+	longitude = b.MinLongitude + rng.Float64()*b.longitudeSpan()
+	if longitude > 180.0 {
+		longitude -= 360.0
+	}
+
+	return latitude, longitude
+}
+
+// nearbyPoint returns a point within `radiusKm` of the origin. The distance is
+// drawn evenly, so points crowd toward the origin.
+func nearbyPoint(rng *rand.Rand, latitude, longitude, radiusKm float64) (float64, float64) {
+	origin := s2.LatLngFromDegrees(latitude, longitude)
+
+	distance := s1.Angle(rng.Float64() * radiusKm / geo.EARTH_RADIUS)
+	heading := rng.Float64() * 2.0 * math.Pi
+
+	ll := geoattractor.Destination(origin, distance, heading)
+
+	return ll.Lat.Degrees(), ll.Lng.Degrees()
+}
+
+// edgeCase is a place that tends to trip-up coordinate and cell handling.
+type edgeCase struct {
+	name      string
+	latitude  float64
+	longitude float64
+}
+
+// edgeCases returns the poles, points on either side of the antimeridian, and
+// the corners and edge midpoints of the six S2 cube faces.
+func edgeCases() []edgeCase {
+	cases := []edgeCase{
+		{"North Pole", 90.0, 0.0},
+		{"South Pole", -90.0, 0.0},
+		{"Near North Pole", 89.999, 135.0},
+		{"Near South Pole", -89.999, -45.0},
+		{"Antimeridian East", 10.0, 179.999},
+		{"Antimeridian West", 10.0, -179.999},
+		{"Antimeridian", -10.0, 180.0},
+	}
+
+	// Every corner is shared by three faces and every edge by two, so only
+	// keep the first of each.
+	seen := make(map[string]bool)
+	add := func(name string, p s2.Point) {
+		ll := s2.LatLngFromPoint(p)
+		key := fmt.Sprintf("%.6f,%.6f", ll.Lat.Degrees(), ll.Lng.Degrees())
+
+		if seen[key] == true {
+			return
+		}
+
+		seen[key] = true
+
+		cases = append(cases, edgeCase{name, ll.Lat.Degrees(), ll.Lng.Degrees()})
+	}
+
+	for face := 0; face < 6; face++ {
+		cell := s2.CellFromCellID(s2.CellIDFromFace(face))
+
+		for k := 0; k < 4; k++ {
+			corner := cell.Vertex(k)
+			next := cell.Vertex((k + 1) % 4)
+
+			add(fmt.Sprintf("Face %d Corner %d", face, k), corner)
+
+			midpoint := s2.Point{Vector: corner.Add(next.Vector).Normalize()}
+			add(fmt.Sprintf("Face %d Edge %d", face, k), midpoint)
+		}
+	}
+
+	return cases
+}
+
+// Records returns the cities: the metro centers, the cities around them, the
+// cities spread over the bounds, and then the edge cases.
+func (g *Generator) Records() []geoattractor.CityRecord {
+	rng := rand.New(rand.NewSource(g.config.Seed))
+
+	records := make([]geoattractor.CityRecord, 0, g.config.Count)
+
+	add := func(name string, population uint64, latitude, longitude float64) {
+		i := len(records)
+		country := syntheticCountries[rng.Intn(len(syntheticCountries))]
+
+		if name == "" {
+			name = fmt.Sprintf("Synthetic City %d", i)
+		}
+
+		cr := geoattractor.CityRecord{
+			Id:            strconv.Itoa(firstId + i),
+			Country:       country.name,
+			ProvinceState: fmt.Sprintf("%02d", rng.Intn(50)),
+			City:          name,
+			Population:    population,
+			Latitude:      latitude,
+			Longitude:     longitude,
+		}
+
+		records = append(records, cr)
+	}
+
+	metroCount := 0
+	if g.config.Metros > 0 {
+		metroCount = int(math.Round(float64(g.config.Count) * g.config.MetroFraction))
+		if metroCount < g.config.Metros {
+			metroCount = g.config.Metros
+		}
+
+		if metroCount > g.config.Count {
+			metroCount = g.config.Count
+		}
+	}
+
+	if metroCount > 0 {
+		centers := make([]geoattractor.CityRecord, 0, g.config.Metros)
+		for i := 0; i < g.config.Metros && i < metroCount; i++ {
+			latitude, longitude := g.randomPoint(rng)
+			add(fmt.Sprintf("Synthetic Metro %d", i), g.config.MetroPopulation, latitude, longitude)
+
+			centers = append(centers, records[len(records)-1])
+		}
+
+		for len(records) < metroCount {
+			center := centers[rng.Intn(len(centers))]
+			latitude, longitude := nearbyPoint(rng, center.Latitude, center.Longitude, g.config.MetroRadiusKm)
+
+			add("", g.population(rng), latitude, longitude)
+		}
+	}
+
+	for len(records) < g.config.Count {
+		latitude, longitude := g.randomPoint(rng)
+		add("", g.population(rng), latitude, longitude)
+	}
+
+	if g.config.EdgeCases == true {
+		for _, ec := range edgeCases() {
+			add(ec.name, g.population(rng), ec.latitude, ec.longitude)
+		}
+	}
+
+	return records
+}
+
+// Source returns the cities as an in-memory `CityRecordSource`.
+func (g *Generator) Source() *RecordSource {
+	return NewRecordSource(SourceName, g.Records())
+}
+
+// countryCode returns the code for a country name that we generated.
+func countryCode(name string) string {
+	for _, sc := range syntheticCountries {
+		if sc.name == name {
+			return sc.code
+		}
+	}
+
+	log.Panicf("country not generated by us: [%s]", name)
+	return ""
+}
+
+// WriteGeonames writes the cities as GeoNames rows (the format of
+// allCountries.txt), which `GeonamesParser` reads with the bundled
+// countryInfo.txt .
+func (g *Generator) WriteGeonames(w io.Writer) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	bw := bufio.NewWriter(w)
+
+	for _, cr := range g.Records() {
+		_, err := fmt.Fprintf(
+			bw,
+			"%s\t%s\t%s\t\t%.5f\t%.5f\tP\tPPL\t%s\t\t%s\t\t\t\t%d\t\t0\tUTC\t2019-01-01\n",
+			cr.Id, cr.City, cr.City, cr.Latitude, cr.Longitude, countryCode(cr.Country), cr.ProvinceState, cr.Population)
+
+		log.PanicIf(err)
+	}
+
+	err = bw.Flush()
+	log.PanicIf(err)
+
+	return nil
+}
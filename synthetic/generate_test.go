@@ -0,0 +1,243 @@
+package geoattractorsynthetic
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/dsoprea/go-geographic-attractor"
+	"github.com/dsoprea/go-geographic-attractor/parse"
+)
+
+func TestGenerator_Records(t *testing.T) {
+	g := NewGenerator(GeneratorConfig{Count: 1000, Seed: 1})
+
+	records := g.Records()
+	if len(records) != 1000 {
+		t.Fatalf("Expected (1000) records: (%d)", len(records))
+	}
+
+	ids := make(map[string]bool)
+	for _, cr := range records {
+		if ids[cr.Id] == true {
+			t.Fatalf("ID repeated: [%s]", cr.Id)
+		}
+
+		ids[cr.Id] = true
+
+		if cr.Population < DefaultMinimumPopulation || cr.Population > DefaultMaximumPopulation {
+			t.Fatalf("Population out of range: %s", cr)
+		} else if cr.Latitude < -90.0 || cr.Latitude > 90.0 || cr.Longitude < -180.0 || cr.Longitude > 180.0 {
+			t.Fatalf("Coordinates out of range: %s", cr)
+		}
+	}
+
+	// The same seed produces the same cities.
+
+	if reflect.DeepEqual(NewGenerator(GeneratorConfig{Count: 1000, Seed: 1}).Records(), records) == false {
+		t.Fatalf("Records not reproducible.")
+	}
+}
+
+func TestGenerator_WriteGeonames(t *testing.T) {
+	g := NewGenerator(GeneratorConfig{Count: 100, Seed: 2})
+
+	b := new(bytes.Buffer)
+
+	err := g.WriteGeonames(b)
+	log.PanicIf(err)
+
+	// The generated rows only use these countries.
+	countries := make(map[string]string)
+	for _, sc := range syntheticCountries {
+		countries[sc.code] = sc.name
+	}
+
+	gp := geoattractorparse.NewGeonamesParser(countries)
+
+	parsed := make([]geoattractor.CityRecord, 0)
+	cb := func(cr geoattractor.CityRecord) error {
+		parsed = append(parsed, cr)
+		return nil
+	}
+
+	recordsCount, err := gp.Parse(b, cb)
+	log.PanicIf(err)
+
+	if recordsCount != 100 {
+		t.Fatalf("Expected every row to be parsed: (%d)", recordsCount)
+	}
+
+	for i, cr := range g.Records() {
+		p := parsed[i]
+
+		if p.Id != cr.Id || p.City != cr.City || p.Country != cr.Country || p.ProvinceState != cr.ProvinceState || p.Population != cr.Population {
+			t.Fatalf("Parsed record not correct:\nACTUAL: %s\nEXPECTED: %s", p, cr)
+		} else if p.Latitude-cr.Latitude > 0.00001 || cr.Latitude-p.Latitude > 0.00001 {
+			t.Fatalf("Latitude not correct: (%f) != (%f)", p.Latitude, cr.Latitude)
+		}
+	}
+}
+
+func TestNewGenerator_Density(t *testing.T) {
+	bounds := &Bounds{0.0, 0.0, 10.0, 10.0}
+
+	g := NewGenerator(GeneratorConfig{Density: 2.0, Bounds: bounds})
+
+	// About 1.23M square kilometers.
+	expected := int(math.Round(bounds.AreaKm2() / 10000.0 * 2.0))
+	if len(g.Records()) != expected || expected < 240 || expected > 250 {
+		t.Fatalf("Count not correct: (%d) (%d)", len(g.Records()), expected)
+	}
+}
+
+func TestGenerator_Records_Bounds(t *testing.T) {
+	// Crosses the antimeridian.
+	bounds := &Bounds{-10.0, 170.0, 10.0, -170.0}
+
+	g := NewGenerator(GeneratorConfig{Count: 500, Seed: 3, Bounds: bounds})
+
+	for _, cr := range g.Records() {
+		if cr.Latitude < -10.0 || cr.Latitude > 10.0 {
+			t.Fatalf("Latitude out of bounds: %s", cr)
+		} else if cr.Longitude > -170.0 && cr.Longitude < 170.0 {
+			t.Fatalf("Longitude out of bounds: %s", cr)
+		}
+	}
+}
+
+func TestGenerator_Records_Population(t *testing.T) {
+	g := NewGenerator(GeneratorConfig{Count: 100, Population: PopulationFixed, MinimumPopulation: 1234})
+
+	for _, cr := range g.Records() {
+		if cr.Population != 1234 {
+			t.Fatalf("Population not fixed: %s", cr)
+		}
+	}
+
+	g = NewGenerator(GeneratorConfig{Count: 1000, Population: PopulationUniform, MinimumPopulation: 1000, MaximumPopulation: 2000})
+
+	sum := uint64(0)
+	for _, cr := range g.Records() {
+		if cr.Population < 1000 || cr.Population > 2000 {
+			t.Fatalf("Population out of range: %s", cr)
+		}
+
+		sum += cr.Population
+	}
+
+	if mean := sum / 1000; mean < 1400 || mean > 1600 {
+		t.Fatalf("Uniform populations not centered: (%d)", mean)
+	}
+
+	// Most places are small under the default distribution.
+
+	g = NewGenerator(GeneratorConfig{Count: 1000})
+
+	small := 0
+	for _, cr := range g.Records() {
+		if cr.Population < 10*DefaultMinimumPopulation {
+			small++
+		}
+	}
+
+	if small < 800 {
+		t.Fatalf("Expected mostly small places: (%d)", small)
+	}
+}
+
+func TestGenerator_Records_Metros(t *testing.T) {
+	config := GeneratorConfig{
+		Count:         1000,
+		Seed:          4,
+		Metros:        3,
+		MetroFraction: 0.5,
+		MetroRadiusKm: 20.0,
+	}
+
+	g := NewGenerator(config)
+	records := g.Records()
+
+	centers := records[:3]
+	for _, cr := range centers {
+		if cr.Population != DefaultMetroPopulation {
+			t.Fatalf("Metro center not correct: %s", cr)
+		}
+	}
+
+	near := 0
+	for _, cr := range records[3:] {
+		p := geo.NewPoint(cr.Latitude, cr.Longitude)
+
+		for _, center := range centers {
+			if p.GreatCircleDistance(geo.NewPoint(center.Latitude, center.Longitude)) <= 20.001 {
+				near++
+				break
+			}
+		}
+	}
+
+	if near < 497 {
+		t.Fatalf("Expected half of the cities around the metros: (%d)", near)
+	}
+}
+
+func TestGenerator_Records_EdgeCases(t *testing.T) {
+	g := NewGenerator(GeneratorConfig{Count: 10, EdgeCases: true})
+	records := g.Records()
+
+	// Seven fixed places plus the eight corners and twelve edges of the cube.
+	if len(records) != 10+7+8+12 {
+		t.Fatalf("Edge cases not correct: (%d)", len(records))
+	}
+
+	names := make(map[string]bool)
+	for _, cr := range records[10:] {
+		names[cr.City] = true
+	}
+
+	if names["North Pole"] != true || names["Antimeridian West"] != true {
+		t.Fatalf("Expected the poles and the antimeridian: %v", names)
+	}
+
+	// Every corner is on the boundary of three faces.
+
+	corners := 0
+	for _, cr := range records[10:] {
+		if math.Abs(math.Abs(cr.Latitude)-35.26439) < 0.00001 {
+			corners++
+		}
+	}
+
+	if corners != 8 {
+		t.Fatalf("Expected eight cube corners: (%d)", corners)
+	}
+}
+
+func TestRecordSource_Parse(t *testing.T) {
+	g := NewGenerator(GeneratorConfig{Count: 20, Seed: 5})
+	rs := g.Source()
+
+	if rs.Name() != SourceName {
+		t.Fatalf("Name not correct: [%s]", rs.Name())
+	}
+
+	parsed := make([]geoattractor.CityRecord, 0)
+	cb := func(cr geoattractor.CityRecord) error {
+		parsed = append(parsed, cr)
+		return nil
+	}
+
+	recordsCount, err := rs.Parse(nil, cb)
+	log.PanicIf(err)
+
+	if recordsCount != 20 {
+		t.Fatalf("Count not correct: (%d)", recordsCount)
+	} else if reflect.DeepEqual(parsed, g.Records()) == false {
+		t.Fatalf("Records not correct.")
+	}
+}
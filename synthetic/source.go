@@ -0,0 +1,48 @@
+package geoattractorsynthetic
+
+import (
+	"io"
+
+	"github.com/dsoprea/go-logging"
+
+	"github.com/dsoprea/go-geographic-attractor"
+)
+
+// RecordSource is a `CityRecordSource` that hands out records that are already
+// in memory, so tests can load an index without writing and parsing a file.
+type RecordSource struct {
+	name    string
+	records []geoattractor.CityRecord
+}
+
+// NewRecordSource returns a new `RecordSource`.
+func NewRecordSource(name string, records []geoattractor.CityRecord) *RecordSource {
+	return &RecordSource{
+		name:    name,
+		records: records,
+	}
+}
+
+// Parse emits the records. The reader is ignored (and may be nil).
+func (rs *RecordSource) Parse(r io.Reader, cityRecordCb geoattractor.CityRecordCb) (recordsCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	for _, cr := range rs.records {
+		recordsCount++
+
+		if cityRecordCb != nil {
+			err := cityRecordCb(cr)
+			log.PanicIf(err)
+		}
+	}
+
+	return recordsCount, nil
+}
+
+func (rs *RecordSource) Name() (name string) {
+	return rs.name
+}
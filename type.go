@@ -20,6 +20,10 @@ type CityRecord struct {
     Latitude      float64 `json:"latitude"`
     Longitude     float64 `json:"longitude"`
     Cell          s2.CellID
+
+    // Provenance is only set on records that were produced by merging
+    // sources.
+    Provenance *CityRecordProvenance `json:"provenance,omitempty"`
 }
 
 func (cr CityRecord) String() string {
@@ -48,8 +52,34 @@ func (cr CityRecord) S2Cell() s2.CellID {
     return cr.Cell
 }
 
+// SourceRecordReference identifies a record as it was read from a particular
+// source.
+type SourceRecordReference struct {
+    SourceName string `json:"source"`
+    Id         string `json:"id"`
+}
+
+// CityRecordProvenance describes how a merged record was assembled.
+type CityRecordProvenance struct {
+    // Sources are the records that were matched to one another.
+    Sources []SourceRecordReference `json:"sources"`
+
+    // Fields maps each field (by its JSON name) to the source that supplied
+    // it.
+    Fields map[string]string `json:"fields"`
+}
+
 type CityRecordCb func(cr CityRecord) (err error)
 
+// CityRecordSkipCb is given the reason that a row wasn't turned into a record.
+type CityRecordSkipCb func(reason string)
+
+// SkipReportingSource is implemented by sources that can say why rows were
+// skipped.
+type SkipReportingSource interface {
+    SetSkipCb(cb CityRecordSkipCb)
+}
+
 type CityRecordSource interface {
     Parse(r io.Reader, cb CityRecordCb) (recordsCount int, err error)
     Name() string